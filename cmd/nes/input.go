@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tejasdeepakmasne/NESemu/pkg/nes"
+)
+
+const inputFileHelp = `
+Input files list the frames at which controller state changes, one per line:
+
+  FRAME PLAYER1 [PLAYER2]
+
+Each player field is eight characters in the order RLDUTSBA (Right, Left,
+Down, Up, sTart, Select, B, A), with '.' for a released button, as in FM2
+movies. The state holds until the next line. Blank lines and lines starting
+with '#' are ignored. Example:
+
+  # press Start on frame 30 for two frames
+  30 ....T...
+  32 ........
+`
+
+// buttonOrder maps positions in an input field to buttons.
+var buttonOrder = [8]nes.Button{
+	nes.ButtonRight, nes.ButtonLeft, nes.ButtonDown, nes.ButtonUp,
+	nes.ButtonStart, nes.ButtonSelect, nes.ButtonB, nes.ButtonA,
+}
+
+// inputEvent sets both controllers at the start of a frame.
+type inputEvent struct {
+	frame   int
+	buttons [2]nes.Buttons
+}
+
+// inputScript replays controller input from a file during a headless run.
+type inputScript struct {
+	events []inputEvent
+	next   int
+}
+
+func loadInputScript(path string) (*inputScript, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	script := &inputScript{}
+	scanner := bufio.NewScanner(file)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		event, err := parseInputEvent(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		script.events = append(script.events, event)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(script.events, func(i, j int) bool {
+		return script.events[i].frame < script.events[j].frame
+	})
+	return script, nil
+}
+
+func parseInputEvent(text string) (inputEvent, error) {
+	var event inputEvent
+	fields := strings.Fields(text)
+	if len(fields) < 2 || len(fields) > 3 {
+		return event, fmt.Errorf("expected FRAME PLAYER1 [PLAYER2], got %q", text)
+	}
+	frame, err := strconv.Atoi(fields[0])
+	if err != nil || frame < 0 {
+		return event, fmt.Errorf("invalid frame number %q", fields[0])
+	}
+	event.frame = frame
+	for player, field := range fields[1:] {
+		buttons, err := parseButtons(field)
+		if err != nil {
+			return event, err
+		}
+		event.buttons[player] = buttons
+	}
+	return event, nil
+}
+
+func parseButtons(field string) (nes.Buttons, error) {
+	if len(field) != len(buttonOrder) {
+		return 0, fmt.Errorf("button field %q must be %d characters", field, len(buttonOrder))
+	}
+	var buttons nes.Buttons
+	for i, c := range field {
+		if c != '.' {
+			buttons = buttons.With(buttonOrder[i])
+		}
+	}
+	return buttons, nil
+}
+
+// apply sets the controllers for the given frame.
+func (s *inputScript) apply(emu *nes.Emulator, frame int) {
+	for s.next < len(s.events) && s.events[s.next].frame <= frame {
+		event := s.events[s.next]
+		emu.SetButtons(nes.Player1, event.buttons[0])
+		emu.SetButtons(nes.Player2, event.buttons[1])
+		s.next++
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tejasdeepakmasne/NESemu/pkg/nes"
+)
+
+func TestParseInputEvent(t *testing.T) {
+	tests := []struct {
+		text    string
+		frame   int
+		buttons [2]nes.Buttons
+	}{
+		{"0 ........", 0, [2]nes.Buttons{}},
+		{"30 R.......", 30, [2]nes.Buttons{nes.Buttons(0).With(nes.ButtonRight)}},
+		{"1 .L......", 1, [2]nes.Buttons{nes.Buttons(0).With(nes.ButtonLeft)}},
+		{"1 ..D.....", 1, [2]nes.Buttons{nes.Buttons(0).With(nes.ButtonDown)}},
+		{"1 ...U....", 1, [2]nes.Buttons{nes.Buttons(0).With(nes.ButtonUp)}},
+		{"1 ....T...", 1, [2]nes.Buttons{nes.Buttons(0).With(nes.ButtonStart)}},
+		{"1 .....S..", 1, [2]nes.Buttons{nes.Buttons(0).With(nes.ButtonSelect)}},
+		{"1 ......B.", 1, [2]nes.Buttons{nes.Buttons(0).With(nes.ButtonB)}},
+		{"1 .......A", 1, [2]nes.Buttons{nes.Buttons(0).With(nes.ButtonA)}},
+		// Any character other than '.' presses the button.
+		{"2 xxxxxxxx", 2, [2]nes.Buttons{nes.Buttons(0).
+			With(nes.ButtonRight).With(nes.ButtonLeft).With(nes.ButtonDown).With(nes.ButtonUp).
+			With(nes.ButtonStart).With(nes.ButtonSelect).With(nes.ButtonB).With(nes.ButtonA)}},
+		{"5 ....T... .......A", 5, [2]nes.Buttons{
+			nes.Buttons(0).With(nes.ButtonStart),
+			nes.Buttons(0).With(nes.ButtonA),
+		}},
+	}
+	for _, test := range tests {
+		event, err := parseInputEvent(test.text)
+		if err != nil {
+			t.Errorf("parseInputEvent(%q): %v", test.text, err)
+			continue
+		}
+		if event.frame != test.frame || event.buttons != test.buttons {
+			t.Errorf("parseInputEvent(%q) = frame %d, buttons %v; want %d, %v", test.text, event.frame, event.buttons, test.frame, test.buttons)
+		}
+	}
+}
+
+func TestParseInputEventErrors(t *testing.T) {
+	tests := []struct {
+		text string
+		err  string
+	}{
+		{"30", "expected FRAME PLAYER1 [PLAYER2]"},
+		{"30 ........ ........ ........", "expected FRAME PLAYER1 [PLAYER2]"},
+		{"x ........", `invalid frame number "x"`},
+		{"-1 ........", `invalid frame number "-1"`},
+		{"30 ....T..", "must be 8 characters"},
+		{"30 ........ .........", "must be 8 characters"},
+	}
+	for _, test := range tests {
+		_, err := parseInputEvent(test.text)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("parseInputEvent(%q) = %v, want error containing %q", test.text, err, test.err)
+		}
+	}
+}
+
+func TestLoadInputScript(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "input.txt")
+	text := "# comment\n\n32 ........\n30 ....T...\n"
+	if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	script, err := loadInputScript(path)
+	if err != nil {
+		t.Fatalf("loadInputScript: %v", err)
+	}
+	if len(script.events) != 2 || script.events[0].frame != 30 || script.events[1].frame != 32 {
+		t.Errorf("events = %+v, want frames 30 and 32 in order", script.events)
+	}
+
+	if err := os.WriteFile(path, []byte("# comment\n30 ....T...\n31 bad\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadInputScript(path); err == nil || !strings.Contains(err.Error(), path+":3:") {
+		t.Errorf("loadInputScript = %v, want an error for line 3", err)
+	}
+}
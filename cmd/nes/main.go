@@ -2,46 +2,42 @@ package main
 
 import (
 	"fmt"
+	"os"
 )
 
-func main() {
-	// Initialize your NES emulator components here
-	// For example:
-	// cpu := cpu.NewCPU()
-	// memory := memory.NewMemory()
-	// cartridge := cartridge.LoadCartridge("roms/game.nes")
-	// ppu := ppu.NewPPU()
-
-	// Start the emulation loop
-	for {
-		// Execute one frame of the emulation
-		// For example:
-		// cpu.ExecuteInstruction()
-		// ppu.RenderFrame()
-
-		// Check for exit conditions
-		if shouldExit() {
-			break
-		}
-	}
-
-	fmt.Println("NES Emulator terminated.")
-}
+// Exit codes shared by all subcommands.
+const (
+	exitOK             = 0
+	exitEmulationError = 1
+	exitUsage          = 2
+	exitIOError        = 3
+)
 
-func shouldExit() bool {
-	// Check for exit conditions, such as user input
-	// For example:
-	// return userPressedExitKey() || reachedEndOfGame()
+const usage = `usage: nes <command> [arguments]
 
-	return false
-}
+commands:
+  run [flags] rom.nes       run a game
+  testrom [flags] rom.nes   run test ROMs and report pass/fail
+  patch apply|create ...    apply or create IPS, UPS and BPS patches
+`
 
-func userPressedExitKey() bool {
-	// Implement logic to check if the user has pressed a key to exit
-	return false
-}
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(exitUsage)
+	}
 
-func reachedEndOfGame() bool {
-	// Implement logic to check if the emulator has reached the end of the game
-	return false
+	switch os.Args[1] {
+	case "run":
+		os.Exit(runCommand(os.Args[2:]))
+	case "testrom":
+		os.Exit(testROMCommand(os.Args[2:]))
+	case "patch":
+		os.Exit(patchCommand(os.Args[2:]))
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+	default:
+		// A bare ROM path runs the game, as before subcommands existed.
+		os.Exit(runCommand(os.Args[1:]))
+	}
 }
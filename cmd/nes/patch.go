@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tejasdeepakmasne/NESemu/internal/patch"
+)
+
+const patchUsage = `usage:
+  nes patch apply [-o output] rom.nes patch...
+  nes patch create [-format ips|ups|bps] original.nes modified.nes output.patch
+`
+
+// patchCommand implements "nes patch". It returns the process exit code.
+func patchCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, patchUsage)
+		return exitUsage
+	}
+	switch args[0] {
+	case "apply":
+		return patchApplyCommand(args[1:])
+	case "create":
+		return patchCreateCommand(args[1:])
+	case "help", "-h", "--help":
+		fmt.Print(patchUsage)
+		return exitOK
+	}
+	fmt.Fprintf(os.Stderr, "nes patch: unknown subcommand %q\n", args[0])
+	fmt.Fprint(os.Stderr, patchUsage)
+	return exitUsage
+}
+
+func patchApplyCommand(args []string) int {
+	flags := flag.NewFlagSet("patch apply", flag.ContinueOnError)
+	output := flags.String("o", "", "output file (default: rom-patched.nes next to the ROM)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: nes patch apply [-o output] rom.nes patch...")
+		fmt.Fprintln(flags.Output(), "Applies IPS, UPS or BPS patches in order and writes the result.")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if flags.NArg() < 2 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	romPath := flags.Arg(0)
+	data, err := os.ReadFile(romPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitIOError
+	}
+	for _, path := range flags.Args()[1:] {
+		if data, err = patch.ApplyFile(data, path); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitIOError
+		}
+	}
+	if *output == "" {
+		ext := filepath.Ext(romPath)
+		*output = strings.TrimSuffix(romPath, ext) + "-patched" + ext
+	}
+	if err := os.WriteFile(*output, data, 0o644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitIOError
+	}
+	fmt.Println(*output)
+	return exitOK
+}
+
+func patchCreateCommand(args []string) int {
+	flags := flag.NewFlagSet("patch create", flag.ContinueOnError)
+	formatName := flags.String("format", "", "patch format: ips, ups or bps (default: from the output extension)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: nes patch create [-format ips|ups|bps] original.nes modified.nes output.patch")
+		fmt.Fprintln(flags.Output(), "Writes a patch that turns the original ROM into the modified one.")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if flags.NArg() != 3 {
+		flags.Usage()
+		return exitUsage
+	}
+	output := flags.Arg(2)
+	if *formatName == "" {
+		*formatName = strings.TrimPrefix(filepath.Ext(output), ".")
+	}
+	format, err := patch.ParseFormat(*formatName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	original, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitIOError
+	}
+	modified, err := os.ReadFile(flags.Arg(1))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitIOError
+	}
+	data, err := patch.Create(format, original, modified)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitIOError
+	}
+	if err := os.WriteFile(output, data, 0o644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitIOError
+	}
+	return exitOK
+}
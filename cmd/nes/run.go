@@ -0,0 +1,273 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"image/png"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/tejasdeepakmasne/NESemu/pkg/nes"
+)
+
+// runCommand implements "nes run". It returns the process exit code.
+func runCommand(args []string) int {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	headless := flags.Bool("headless", false, "run without a window or audio device")
+	frames := flags.Int("frames", 0, "number of frames to emulate in headless mode")
+	inputPath := flags.String("input", "", "file of controller inputs to replay")
+	pngPath := flags.String("png", "", "write the final frame to this PNG file")
+	wavPath := flags.String("wav", "", "write the audio to this WAV file")
+	ramInit := flags.String("ram-init", "zero", "power-on RAM contents: zero, ff, alternating or random")
+	ramSeed := flags.Int64("ram-seed", 0, "seed for --ram-init=random (default: chosen at random and printed)")
+	uninit := flags.String("uninit", "off", "report reads of never-written RAM: off, log, or break to stop the run")
+	symbolFile := flags.String("symbols", "", "label file (ld65 -Ln or FCEUX .nl) used to name addresses")
+	accessCSV := flags.String("access-csv", "", "write per-address memory access counts to this CSV file")
+	heatmap := flags.String("heatmap", "", "write a 256x256 memory access heatmap to this PNG file")
+	perFrame := flags.Bool("heatmap-per-frame", false, "count accesses for the last frame only")
+	saveDir := flags.String("save-dir", "", "directory for battery save files (default: next to the ROM)")
+	noSave := flags.Bool("no-save", false, "do not load or write battery save files")
+	var patches []string
+	flags.Func("patch", "apply this IPS, UPS or BPS `file` to the ROM (repeatable)", func(path string) error {
+		patches = append(patches, path)
+		return nil
+	})
+	entry := flags.String("entry", "", "ROM image to run from an archive holding several")
+	noPatch := flags.Bool("no-patch", false, "do not apply a patch file found next to the ROM")
+	gameDB := flags.String("gamedb", "", "game database in NES 2.0 XML format (default: built in)")
+	noGameDB := flags.Bool("no-gamedb", false, "use ROM headers as found instead of correcting them from the game database")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: nes run [flags] rom.nes")
+		flags.PrintDefaults()
+		fmt.Fprint(flags.Output(), inputFileHelp)
+	}
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return exitUsage
+	}
+	if *headless && *frames <= 0 {
+		fmt.Fprintln(os.Stderr, "nes run: --headless requires --frames greater than zero")
+		return exitUsage
+	}
+
+	options, err := powerOnOptions(flags, *ramInit, *ramSeed)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	options.SymbolFile = *symbolFile
+	options.ProfileMemory = *accessCSV != "" || *heatmap != ""
+	options.ProfilePerFrame = *perFrame
+	options.SaveDirectory = *saveDir
+	options.DisableSaveFile = *noSave
+	options.SaveError = func(err error) {
+		fmt.Fprintf(os.Stderr, "nes run: %v\n", err)
+	}
+	options.Patches = patches
+	switch {
+	case *entry != "":
+		options.SelectROM = func([]string) (string, error) { return *entry, nil }
+	case !*headless && isTerminal(os.Stdin):
+		options.SelectROM = promptROM
+	}
+	options.DisableAutoPatch = *noPatch
+	options.GameDatabase = *gameDB
+	options.DisableGameDatabase = *noGameDB
+	switch *uninit {
+	case "off":
+	case "log", "break":
+		stop := *uninit == "break"
+		options.UninitializedRead = func(read nes.UninitializedRead) bool {
+			fmt.Fprintf(os.Stderr, "nes run: %v\n", read)
+			return stop
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "nes run: unknown --uninit mode %q\n", *uninit)
+		return exitUsage
+	}
+
+	emu, err := nes.OpenWithOptions(flags.Arg(0), options)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitIOError
+	}
+	for _, path := range emu.Patches() {
+		fmt.Fprintf(os.Stderr, "nes run: applied patch %s\n", path)
+	}
+	for _, correction := range emu.HeaderCorrections() {
+		fmt.Fprintf(os.Stderr, "nes run: header corrected from game database: %s\n", correction)
+	}
+
+	// Stop cleanly on Ctrl-C or SIGTERM so Close writes the save file.
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+
+	if !*headless {
+		code := runInteractive(emu, interrupt)
+		if err := emu.Close(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitIOError
+		}
+		return code
+	}
+
+	var script *inputScript
+	if *inputPath != "" {
+		script, err = loadInputScript(*inputPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitUsage
+		}
+	}
+
+	var audio []float32
+	for frame := 0; frame < *frames; frame++ {
+		if script != nil {
+			script.apply(emu, frame)
+		}
+		emu.StepFrame()
+		if *wavPath != "" {
+			audio = append(audio, emu.AudioSamples()...)
+		} else {
+			emu.AudioSamples()
+		}
+		if emu.Err() != nil || interrupted(interrupt) {
+			break
+		}
+	}
+
+	if *pngPath != "" {
+		if err := writeFile(*pngPath, func(w io.Writer) error {
+			return png.Encode(w, emu.Framebuffer())
+		}); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitIOError
+		}
+	}
+	if *accessCSV != "" {
+		if err := writeFile(*accessCSV, emu.WriteAccessCSV); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitIOError
+		}
+	}
+	if *heatmap != "" {
+		if err := writeFile(*heatmap, emu.WriteAccessHeatmap); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitIOError
+		}
+	}
+	if *wavPath != "" {
+		if err := writeWAV(*wavPath, emu.SampleRate(), audio); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitIOError
+		}
+	}
+	if err := emu.Close(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitIOError
+	}
+
+	if err := emu.Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "nes run: emulation error after %d frames: %v\n", emu.FrameCount(), err)
+		return exitEmulationError
+	}
+	return exitOK
+}
+
+// powerOnOptions builds the emulator options for the RAM flags. Random
+// contents without an explicit seed get a fresh seed, which is printed so
+// the run can be reproduced.
+func powerOnOptions(flags *flag.FlagSet, ramInit string, ramSeed int64) (nes.Options, error) {
+	pattern, err := nes.ParseRAMInit(ramInit)
+	if err != nil {
+		return nes.Options{}, err
+	}
+	options := nes.Options{RAMInit: pattern, RAMSeed: ramSeed}
+
+	seedSet := false
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == "ram-seed" {
+			seedSet = true
+		}
+	})
+	if pattern == nes.RAMRandom && !seedSet {
+		options.RAMSeed = time.Now().UnixNano()
+		fmt.Fprintf(os.Stderr, "nes run: power-on RAM seed %d\n", options.RAMSeed)
+	}
+	return options, nil
+}
+
+// promptROM asks on the terminal which of several ROM images in an archive
+// to run.
+func promptROM(names []string) (string, error) {
+	fmt.Fprintln(os.Stderr, "The archive holds several ROM images:")
+	for i, name := range names {
+		fmt.Fprintf(os.Stderr, "  %d) %s\n", i+1, name)
+	}
+	fmt.Fprint(os.Stderr, "Run which? ")
+	var choice int
+	if _, err := fmt.Fscanln(os.Stdin, &choice); err != nil || choice < 1 || choice > len(names) {
+		return "", errors.New("nes run: no ROM image selected")
+	}
+	return names[choice-1], nil
+}
+
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// runInteractive runs the emulation loop until a signal arrives on
+// interrupt or emulation breaks.
+func runInteractive(emu *nes.Emulator, interrupt <-chan os.Signal) int {
+	// Start the emulation loop
+	for {
+		emu.StepFrame()
+		emu.AudioSamples()
+
+		// Check for exit conditions
+		if interrupted(interrupt) || emu.Err() != nil {
+			break
+		}
+	}
+
+	fmt.Println("NES Emulator terminated.")
+	if emu.Err() != nil {
+		return exitEmulationError
+	}
+	return exitOK
+}
+
+// interrupted reports whether a signal has arrived on interrupt.
+func interrupted(interrupt <-chan os.Signal) bool {
+	select {
+	case <-interrupt:
+		return true
+	default:
+		return false
+	}
+}
+
+// writeFile creates path and fills it using write.
+func writeFile(path string, write func(w io.Writer) error) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeROM writes an NROM image running program from $8000 to a temporary
+// directory and returns its path.
+func writeROM(t *testing.T, program []byte) string {
+	t.Helper()
+	data := append([]byte("NES\x1a\x02\x00"), make([]byte, 10+0x8000)...)
+	prg := data[16:]
+	copy(prg, program)
+	prg[0x7FFC], prg[0x7FFD] = 0x00, 0x80
+	path := filepath.Join(t.TempDir(), "game.nes")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRunCommandExitCodes(t *testing.T) {
+	loop := writeROM(t, []byte{0x4C, 0x00, 0x80})               // JMP *
+	uninit := writeROM(t, []byte{0xA5, 0x10, 0x4C, 0x02, 0x80}) // LDA $10; JMP *
+	badInput := filepath.Join(t.TempDir(), "input.txt")
+	if err := os.WriteFile(badInput, []byte("30 bad\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{name: "ok", args: []string{"--headless", "--frames", "2", "--no-save", loop}, want: exitOK},
+		{name: "emulation error", args: []string{"--headless", "--frames", "2", "--no-save", "--uninit", "break", uninit}, want: exitEmulationError},
+		{name: "no ROM", args: []string{"--headless", "--frames", "2"}, want: exitUsage},
+		{name: "unknown flag", args: []string{"--bogus", loop}, want: exitUsage},
+		{name: "headless without frames", args: []string{"--headless", loop}, want: exitUsage},
+		{name: "bad RAM init", args: []string{"--headless", "--frames", "1", "--ram-init", "stripes", loop}, want: exitUsage},
+		{name: "bad uninit mode", args: []string{"--headless", "--frames", "1", "--uninit", "loud", loop}, want: exitUsage},
+		{name: "malformed input", args: []string{"--headless", "--frames", "1", "--no-save", "--input", badInput, loop}, want: exitUsage},
+		{name: "missing ROM", args: []string{"--headless", "--frames", "1", filepath.Join(t.TempDir(), "none.nes")}, want: exitIOError},
+		{name: "unwritable PNG", args: []string{"--headless", "--frames", "1", "--no-save", "--png", filepath.Join(t.TempDir(), "none", "frame.png"), loop}, want: exitIOError},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := runCommand(test.args); got != test.want {
+				t.Errorf("runCommand(%q) = %d, want %d", test.args, got, test.want)
+			}
+		})
+	}
+}
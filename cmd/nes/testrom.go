@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/tejasdeepakmasne/NESemu/internal/testrom"
+)
+
+// testROMCommand implements "nes testrom". It returns the process exit code.
+func testROMCommand(args []string) int {
+	flags := flag.NewFlagSet("testrom", flag.ContinueOnError)
+	maxFrames := flags.Int("frames", testrom.DefaultMaxFrames, "frames to wait for each ROM to report a result")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: nes testrom [flags] rom.nes...")
+		fmt.Fprintln(flags.Output(), "Runs test ROMs that report through the $6000 status protocol.")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	code := exitOK
+	for _, path := range flags.Args() {
+		result, err := testrom.Run(path, testrom.Options{MaxFrames: *maxFrames})
+		switch {
+		case err != nil:
+			fmt.Printf("%s: ERROR: %v\n", path, err)
+			code = exitEmulationError
+		case !result.Passed():
+			fmt.Printf("%s: %v\n", path, result)
+			code = exitEmulationError
+		default:
+			fmt.Printf("%s: %v\n", path, result)
+		}
+	}
+	if code != exitOK {
+		fmt.Fprintln(os.Stderr, "nes testrom: some ROMs failed")
+	}
+	return code
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"os"
+)
+
+// writeWAV writes mono samples in the range [-1, 1] as a 16-bit PCM WAV file.
+func writeWAV(path string, sampleRate int, samples []float32) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+
+	const bitsPerSample = 16
+	const channels = 1
+	dataSize := uint32(len(samples) * bitsPerSample / 8)
+	header := []interface{}{
+		[4]byte{'R', 'I', 'F', 'F'},
+		uint32(36 + dataSize),
+		[4]byte{'W', 'A', 'V', 'E'},
+		[4]byte{'f', 'm', 't', ' '},
+		uint32(16),
+		uint16(1), // PCM
+		uint16(channels),
+		uint32(sampleRate),
+		uint32(sampleRate * channels * bitsPerSample / 8),
+		uint16(channels * bitsPerSample / 8),
+		uint16(bitsPerSample),
+		[4]byte{'d', 'a', 't', 'a'},
+		dataSize,
+	}
+	for _, field := range header {
+		if err := binary.Write(w, binary.LittleEndian, field); err != nil {
+			file.Close()
+			return err
+		}
+	}
+
+	for _, sample := range samples {
+		if sample > 1 {
+			sample = 1
+		} else if sample < -1 {
+			sample = -1
+		}
+		if err := binary.Write(w, binary.LittleEndian, int16(sample*32767)); err != nil {
+			file.Close()
+			return err
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
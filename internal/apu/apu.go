@@ -0,0 +1,297 @@
+package apu
+
+import (
+	"encoding/gob"
+
+	"github.com/tejasdeepakmasne/NESemu/internal/savestate"
+)
+
+// CPUFrequency is the NTSC CPU clock rate in Hz. The APU is clocked by the CPU.
+const CPUFrequency = 1789773
+
+// DefaultSampleRate is the output sample rate used unless SetSampleRate is called.
+const DefaultSampleRate = 44100
+
+// Frame counter step points, in CPU cycles since the sequencer was reset.
+const (
+	frameStep1      = 7457
+	frameStep2      = 14913
+	frameStep3      = 22371
+	frameStep4      = 29829
+	frameStep5      = 37281
+	frameIRQInhibit = 0x40
+	frameFiveStep   = 0x80
+)
+
+var lengthTable = [32]uint8{
+	10, 254, 20, 2, 40, 4, 80, 6, 160, 8, 60, 10, 14, 12, 26, 14,
+	12, 16, 24, 18, 48, 20, 96, 22, 192, 24, 72, 26, 16, 28, 32, 30,
+}
+
+var pulseMixTable [31]float32
+var tndMixTable [203]float32
+
+func init() {
+	for i := 1; i < len(pulseMixTable); i++ {
+		pulseMixTable[i] = 95.52 / (8128.0/float32(i) + 100)
+	}
+	for i := 1; i < len(tndMixTable); i++ {
+		tndMixTable[i] = 163.67 / (24329.0/float32(i) + 100)
+	}
+}
+
+// APU represents the Audio Processing Unit of the NES.
+type APU struct {
+	pulse1   pulse
+	pulse2   pulse
+	triangle triangle
+	noise    noise
+	dmc      dmc
+
+	// cycle counts CPU cycles since power-on; the APU is clocked by the CPU.
+	cycle uint64
+
+	frameMode    uint8
+	frameCounter int
+	frameIRQ     bool
+
+	sampleRate    float64
+	sampleCounter float64
+	samples       []float32
+	filters       [3]filter
+
+	// expansion returns the level of sound generated on the cartridge.
+	expansion func() float32
+}
+
+// NewAPU creates and initializes a new APU instance.
+func NewAPU() *APU {
+	apu := &APU{
+		pulse1: pulse{channel: 1},
+		pulse2: pulse{channel: 2},
+		noise:  noise{shiftRegister: 1},
+	}
+	apu.SetSampleRate(DefaultSampleRate)
+	apu.Reset()
+	return apu
+}
+
+// SetSampleRate sets the rate at which output samples are produced.
+func (a *APU) SetSampleRate(rate float64) {
+	a.sampleRate = rate
+	a.filters = [3]filter{
+		highPassFilter(rate, 90),
+		highPassFilter(rate, 440),
+		lowPassFilter(rate, 14000),
+	}
+}
+
+// SampleRate returns the rate at which output samples are produced.
+func (a *APU) SampleRate() float64 {
+	return a.sampleRate
+}
+
+// ConnectMemory attaches the function the DMC uses to fetch sample bytes.
+// The function is expected to stall the CPU for the duration of the fetch.
+func (a *APU) ConnectMemory(read func(address uint16) uint8) {
+	a.dmc.read = read
+}
+
+// ConnectExpansion attaches a cartridge sound source, which is mixed into
+// the output before filtering. output returns the source's current level
+// on the scale of the APU's own mix, where a pulse channel at full volume
+// is about 0.12.
+func (a *APU) ConnectExpansion(output func() float32) {
+	a.expansion = output
+}
+
+// Reset silences all channels.
+func (a *APU) Reset() {
+	a.WriteRegister(0x4015, 0)
+	a.frameIRQ = false
+	a.dmc.irq = false
+	a.frameCounter = 0
+}
+
+// IRQ reports whether the frame counter or DMC is asserting the IRQ line.
+func (a *APU) IRQ() bool {
+	return a.frameIRQ || a.dmc.irq
+}
+
+// Samples returns the audio samples produced since the last call, as mono
+// values in the range [-1, 1].
+func (a *APU) Samples() []float32 {
+	samples := a.samples
+	a.samples = nil
+	return samples
+}
+
+// Step advances the APU by one CPU cycle.
+func (a *APU) Step() {
+	a.cycle++
+
+	a.triangle.stepTimer()
+	if a.cycle%2 == 0 {
+		a.pulse1.stepTimer()
+		a.pulse2.stepTimer()
+		a.noise.stepTimer()
+		a.dmc.stepTimer()
+	}
+	a.stepFrameCounter()
+
+	a.sampleCounter += a.sampleRate
+	if a.sampleCounter >= CPUFrequency {
+		a.sampleCounter -= CPUFrequency
+		a.samples = append(a.samples, a.output())
+	}
+}
+
+func (a *APU) stepFrameCounter() {
+	a.frameCounter++
+	switch a.frameCounter {
+	case frameStep1, frameStep3:
+		a.stepEnvelopes()
+	case frameStep2:
+		a.stepEnvelopes()
+		a.stepLengthCounters()
+	case frameStep4:
+		if a.frameMode&frameFiveStep == 0 {
+			a.stepEnvelopes()
+			a.stepLengthCounters()
+			if a.frameMode&frameIRQInhibit == 0 {
+				a.frameIRQ = true
+			}
+			a.frameCounter = 0
+		}
+	case frameStep5:
+		a.stepEnvelopes()
+		a.stepLengthCounters()
+		a.frameCounter = 0
+	}
+}
+
+// stepEnvelopes performs the quarter-frame clock.
+func (a *APU) stepEnvelopes() {
+	a.pulse1.stepEnvelope()
+	a.pulse2.stepEnvelope()
+	a.triangle.stepCounter()
+	a.noise.stepEnvelope()
+}
+
+// stepLengthCounters performs the half-frame clock.
+func (a *APU) stepLengthCounters() {
+	a.pulse1.stepLength()
+	a.pulse1.stepSweep()
+	a.pulse2.stepLength()
+	a.pulse2.stepSweep()
+	a.triangle.stepLength()
+	a.noise.stepLength()
+}
+
+// output mixes the channels and runs the result through the console's
+// analog filters.
+func (a *APU) output() float32 {
+	sample := a.mix()
+	for i := range a.filters {
+		sample = a.filters[i].step(sample)
+	}
+	return sample
+}
+
+// mix combines the channels with the non-linear DAC response of the 2A03.
+func (a *APU) mix() float32 {
+	p1 := a.pulse1.output()
+	p2 := a.pulse2.output()
+	t := a.triangle.output()
+	n := a.noise.output()
+	d := a.dmc.output()
+	sample := pulseMixTable[p1+p2] + tndMixTable[3*int(t)+2*int(n)+int(d)]
+	if a.expansion != nil {
+		sample += a.expansion()
+	}
+	return sample
+}
+
+// ReadRegister reads the APU status register at $4015.
+func (a *APU) ReadRegister(address uint16) uint8 {
+	if address != 0x4015 {
+		return 0
+	}
+	var result uint8
+	if a.pulse1.lengthValue > 0 {
+		result |= 0x01
+	}
+	if a.pulse2.lengthValue > 0 {
+		result |= 0x02
+	}
+	if a.triangle.lengthValue > 0 {
+		result |= 0x04
+	}
+	if a.noise.lengthValue > 0 {
+		result |= 0x08
+	}
+	if a.dmc.currentLength > 0 {
+		result |= 0x10
+	}
+	if a.frameIRQ {
+		result |= 0x40
+	}
+	if a.dmc.irq {
+		result |= 0x80
+	}
+	a.frameIRQ = false
+	return result
+}
+
+// WriteRegister writes one of the APU registers at $4000-$4017.
+func (a *APU) WriteRegister(address uint16, data uint8) {
+	switch {
+	case address >= 0x4000 && address <= 0x4003:
+		a.pulse1.writeRegister(address&3, data)
+	case address >= 0x4004 && address <= 0x4007:
+		a.pulse2.writeRegister(address&3, data)
+	case address >= 0x4008 && address <= 0x400B:
+		a.triangle.writeRegister(address&3, data)
+	case address >= 0x400C && address <= 0x400F:
+		a.noise.writeRegister(address&3, data)
+	case address >= 0x4010 && address <= 0x4013:
+		a.dmc.writeRegister(address&3, data)
+	case address == 0x4015:
+		a.pulse1.setEnabled(data&0x01 != 0)
+		a.pulse2.setEnabled(data&0x02 != 0)
+		a.triangle.setEnabled(data&0x04 != 0)
+		a.noise.setEnabled(data&0x08 != 0)
+		a.dmc.setEnabled(data&0x10 != 0)
+	case address == 0x4017:
+		a.frameMode = data
+		a.frameCounter = 0
+		if data&frameIRQInhibit != 0 {
+			a.frameIRQ = false
+		}
+		if data&frameFiveStep != 0 {
+			a.stepEnvelopes()
+			a.stepLengthCounters()
+		}
+	}
+}
+
+// stateFields lists the APU state that is captured in save states.
+func (a *APU) stateFields() []interface{} {
+	fields := []interface{}{&a.cycle, &a.frameMode, &a.frameCounter, &a.frameIRQ}
+	fields = append(fields, a.pulse1.stateFields()...)
+	fields = append(fields, a.pulse2.stateFields()...)
+	fields = append(fields, a.triangle.stateFields()...)
+	fields = append(fields, a.noise.stateFields()...)
+	fields = append(fields, a.dmc.stateFields()...)
+	return fields
+}
+
+// Save writes the APU state to encoder.
+func (a *APU) Save(encoder *gob.Encoder) error {
+	return savestate.Encode(encoder, a.stateFields()...)
+}
+
+// Load restores APU state written by Save.
+func (a *APU) Load(decoder *gob.Decoder) error {
+	return savestate.Decode(decoder, a.stateFields()...)
+}
@@ -0,0 +1,189 @@
+package apu
+
+import (
+	"math"
+	"testing"
+)
+
+func stepAPU(a *APU, cycles int) {
+	for i := 0; i < cycles; i++ {
+		a.Step()
+	}
+}
+
+func TestFrameIRQ(t *testing.T) {
+	tests := []struct {
+		name  string
+		mode  uint8
+		cycle int
+		irq   bool
+	}{
+		{name: "4-step before last step", mode: 0x00, cycle: frameStep4 - 1, irq: false},
+		{name: "4-step at last step", mode: 0x00, cycle: frameStep4, irq: true},
+		{name: "4-step inhibited", mode: frameIRQInhibit, cycle: frameStep4, irq: false},
+		{name: "5-step", mode: frameFiveStep, cycle: 2 * frameStep5, irq: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := NewAPU()
+			a.WriteRegister(0x4017, test.mode)
+			stepAPU(a, test.cycle)
+			if a.IRQ() != test.irq {
+				t.Errorf("IRQ() = %v, want %v", a.IRQ(), test.irq)
+			}
+		})
+	}
+}
+
+func TestFrameIRQAcknowledge(t *testing.T) {
+	a := NewAPU()
+	stepAPU(a, frameStep4)
+	if status := a.ReadRegister(0x4015); status&0x40 == 0 {
+		t.Fatalf("status = %#02x, want frame interrupt flag", status)
+	}
+	if a.IRQ() {
+		t.Error("IRQ() still asserted after reading $4015")
+	}
+
+	stepAPU(a, frameStep4)
+	a.WriteRegister(0x4017, frameIRQInhibit)
+	if a.IRQ() {
+		t.Error("IRQ() still asserted after setting the inhibit flag")
+	}
+}
+
+func TestLengthCounter(t *testing.T) {
+	tests := []struct {
+		name   string
+		enable uint8
+		writes [][2]uint16
+		frames int
+		status uint8
+	}{
+		{
+			name:   "loads from table",
+			enable: 0x01,
+			writes: [][2]uint16{{0x4003, 0x08}},
+			status: 0x01,
+		},
+		{
+			name:   "ignored while disabled",
+			enable: 0x00,
+			writes: [][2]uint16{{0x4003, 0x08}},
+			status: 0x00,
+		},
+		{
+			name:   "counts two half frames per frame",
+			enable: 0x01,
+			writes: [][2]uint16{{0x4003, 0x00}},
+			frames: 4,
+			status: 0x01,
+		},
+		{
+			name:   "expires",
+			enable: 0x01,
+			writes: [][2]uint16{{0x4003, 0x00}},
+			frames: 5,
+			status: 0x00,
+		},
+		{
+			name:   "halted",
+			enable: 0x01,
+			writes: [][2]uint16{{0x4000, 0x20}, {0x4003, 0x00}},
+			frames: 5,
+			status: 0x01,
+		},
+		{
+			name:   "all channels",
+			enable: 0x0F,
+			writes: [][2]uint16{{0x4003, 0x08}, {0x4007, 0x08}, {0x400B, 0x08}, {0x400F, 0x08}},
+			status: 0x0F,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := NewAPU()
+			a.WriteRegister(0x4015, test.enable)
+			for _, write := range test.writes {
+				a.WriteRegister(write[0], uint8(write[1]))
+			}
+			a.WriteRegister(0x4017, frameIRQInhibit)
+			stepAPU(a, test.frames*frameStep4)
+			if status := a.ReadRegister(0x4015) & 0x1F; status != test.status {
+				t.Errorf("status = %#02x, want %#02x", status, test.status)
+			}
+		})
+	}
+}
+
+func TestFiveStepWriteClocksLengths(t *testing.T) {
+	a := NewAPU()
+	a.WriteRegister(0x4015, 0x02)
+	a.WriteRegister(0x4007, 0x18)
+	a.WriteRegister(0x4017, frameFiveStep)
+	if a.pulse2.lengthValue != 1 {
+		t.Errorf("length = %d, want 1", a.pulse2.lengthValue)
+	}
+}
+
+func TestLengthCounterDisable(t *testing.T) {
+	a := NewAPU()
+	a.WriteRegister(0x4015, 0x01)
+	a.WriteRegister(0x4003, 0x08)
+	a.WriteRegister(0x4015, 0x00)
+	if a.pulse1.lengthValue != 0 {
+		t.Errorf("length = %d after disabling, want 0", a.pulse1.lengthValue)
+	}
+}
+
+func TestMixTables(t *testing.T) {
+	tests := []struct {
+		name  string
+		table []float32
+		index int
+		want  float64
+	}{
+		{name: "pulse silent", table: pulseMixTable[:], index: 0, want: 0},
+		{name: "pulse one channel", table: pulseMixTable[:], index: 15, want: 0.1488},
+		{name: "pulse both channels", table: pulseMixTable[:], index: 30, want: 0.2575},
+		{name: "tnd silent", table: tndMixTable[:], index: 0, want: 0},
+		{name: "tnd triangle", table: tndMixTable[:], index: 45, want: 0.2555},
+		{name: "tnd full scale", table: tndMixTable[:], index: 202, want: 0.7425},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := float64(test.table[test.index]); math.Abs(got-test.want) > 0.0005 {
+				t.Errorf("table[%d] = %.4f, want %.4f", test.index, got, test.want)
+			}
+		})
+	}
+}
+
+func TestMix(t *testing.T) {
+	a := NewAPU()
+	if sample := a.mix(); sample != 0 {
+		t.Errorf("silent mix = %v, want 0", sample)
+	}
+
+	a.pulse1 = pulse{
+		channel:     1,
+		enabled:     true,
+		lengthValue: 1,
+		timerPeriod: 0x100,
+		dutyMode:    2,
+		dutyValue:   1,
+		envelope:    envelope{constant: 15},
+	}
+	a.pulse2 = a.pulse1
+	a.pulse2.channel = 2
+	a.dmc.value = 0x7F
+	want := pulseMixTable[30] + tndMixTable[0x7F]
+	if sample := a.mix(); sample != want {
+		t.Errorf("mix = %v, want %v", sample, want)
+	}
+
+	a.ConnectExpansion(func() float32 { return 0.25 })
+	if sample := a.mix(); sample != want+0.25 {
+		t.Errorf("mix with expansion = %v, want %v", sample, want+0.25)
+	}
+}
@@ -0,0 +1,466 @@
+package apu
+
+var dutyTable = [4][8]uint8{
+	{0, 1, 0, 0, 0, 0, 0, 0},
+	{0, 1, 1, 0, 0, 0, 0, 0},
+	{0, 1, 1, 1, 1, 0, 0, 0},
+	{1, 0, 0, 1, 1, 1, 1, 1},
+}
+
+var triangleTable = [32]uint8{
+	15, 14, 13, 12, 11, 10, 9, 8, 7, 6, 5, 4, 3, 2, 1, 0,
+	0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+}
+
+var noiseTable = [16]uint16{
+	4, 8, 16, 32, 64, 96, 128, 160, 202, 254, 380, 508, 762, 1016, 2034, 4068,
+}
+
+var dmcTable = [16]uint16{
+	214, 190, 170, 160, 143, 127, 113, 107, 95, 80, 71, 64, 53, 42, 36, 27,
+}
+
+// envelope is the volume unit shared by the pulse and noise channels.
+type envelope struct {
+	enabled  bool
+	loop     bool
+	start    bool
+	period   uint8
+	value    uint8
+	volume   uint8
+	constant uint8
+}
+
+func (e *envelope) write(data uint8) {
+	e.loop = data&0x20 != 0
+	e.enabled = data&0x10 == 0
+	e.period = data & 0x0F
+	e.constant = data & 0x0F
+	e.start = true
+}
+
+func (e *envelope) step() {
+	if e.start {
+		e.volume = 15
+		e.value = e.period
+		e.start = false
+		return
+	}
+	if e.value > 0 {
+		e.value--
+		return
+	}
+	e.value = e.period
+	if e.volume > 0 {
+		e.volume--
+	} else if e.loop {
+		e.volume = 15
+	}
+}
+
+func (e *envelope) output() uint8 {
+	if e.enabled {
+		return e.volume
+	}
+	return e.constant
+}
+
+// pulse is one of the two square wave channels.
+type pulse struct {
+	channel uint8
+
+	enabled     bool
+	lengthHalt  bool
+	lengthValue uint8
+
+	timerPeriod uint16
+	timerValue  uint16
+	dutyMode    uint8
+	dutyValue   uint8
+
+	sweepReload  bool
+	sweepEnabled bool
+	sweepNegate  bool
+	sweepShift   uint8
+	sweepPeriod  uint8
+	sweepValue   uint8
+
+	envelope envelope
+}
+
+func (p *pulse) writeRegister(register uint16, data uint8) {
+	switch register {
+	case 0:
+		p.dutyMode = (data >> 6) & 3
+		p.lengthHalt = data&0x20 != 0
+		p.envelope.write(data)
+	case 1:
+		p.sweepEnabled = data&0x80 != 0
+		p.sweepPeriod = (data>>4)&7 + 1
+		p.sweepNegate = data&0x08 != 0
+		p.sweepShift = data & 7
+		p.sweepReload = true
+	case 2:
+		p.timerPeriod = (p.timerPeriod & 0xFF00) | uint16(data)
+	case 3:
+		if p.enabled {
+			p.lengthValue = lengthTable[data>>3]
+		}
+		p.timerPeriod = (p.timerPeriod & 0x00FF) | uint16(data&7)<<8
+		p.envelope.start = true
+		p.dutyValue = 0
+	}
+}
+
+func (p *pulse) setEnabled(enabled bool) {
+	p.enabled = enabled
+	if !enabled {
+		p.lengthValue = 0
+	}
+}
+
+func (p *pulse) stepTimer() {
+	if p.timerValue == 0 {
+		p.timerValue = p.timerPeriod
+		p.dutyValue = (p.dutyValue + 1) % 8
+	} else {
+		p.timerValue--
+	}
+}
+
+func (p *pulse) stepEnvelope() {
+	p.envelope.step()
+}
+
+func (p *pulse) stepLength() {
+	if !p.lengthHalt && p.lengthValue > 0 {
+		p.lengthValue--
+	}
+}
+
+// sweepTarget computes the period the sweep unit is moving towards. Pulse 1
+// negates with ones' complement, pulse 2 with two's complement.
+func (p *pulse) sweepTarget() uint16 {
+	delta := p.timerPeriod >> p.sweepShift
+	if !p.sweepNegate {
+		return p.timerPeriod + delta
+	}
+	if p.channel == 1 {
+		return p.timerPeriod - delta - 1
+	}
+	return p.timerPeriod - delta
+}
+
+func (p *pulse) stepSweep() {
+	if p.sweepValue == 0 && p.sweepEnabled && p.sweepShift > 0 && !p.sweepMuted() {
+		p.timerPeriod = p.sweepTarget()
+	}
+	if p.sweepValue == 0 || p.sweepReload {
+		p.sweepValue = p.sweepPeriod
+		p.sweepReload = false
+	} else {
+		p.sweepValue--
+	}
+}
+
+func (p *pulse) sweepMuted() bool {
+	return p.timerPeriod < 8 || (!p.sweepNegate && p.sweepTarget() > 0x7FF)
+}
+
+func (p *pulse) output() uint8 {
+	if !p.enabled || p.lengthValue == 0 || p.sweepMuted() {
+		return 0
+	}
+	if dutyTable[p.dutyMode][p.dutyValue] == 0 {
+		return 0
+	}
+	return p.envelope.output()
+}
+
+// triangle is the triangle wave channel.
+type triangle struct {
+	enabled     bool
+	lengthHalt  bool
+	lengthValue uint8
+
+	timerPeriod uint16
+	timerValue  uint16
+	dutyValue   uint8
+
+	counterPeriod uint8
+	counterValue  uint8
+	counterReload bool
+}
+
+func (t *triangle) writeRegister(register uint16, data uint8) {
+	switch register {
+	case 0:
+		t.lengthHalt = data&0x80 != 0
+		t.counterPeriod = data & 0x7F
+	case 2:
+		t.timerPeriod = (t.timerPeriod & 0xFF00) | uint16(data)
+	case 3:
+		if t.enabled {
+			t.lengthValue = lengthTable[data>>3]
+		}
+		t.timerPeriod = (t.timerPeriod & 0x00FF) | uint16(data&7)<<8
+		t.counterReload = true
+	}
+}
+
+func (t *triangle) setEnabled(enabled bool) {
+	t.enabled = enabled
+	if !enabled {
+		t.lengthValue = 0
+	}
+}
+
+func (t *triangle) stepTimer() {
+	if t.timerValue > 0 {
+		t.timerValue--
+		return
+	}
+	t.timerValue = t.timerPeriod
+	if t.lengthValue > 0 && t.counterValue > 0 {
+		t.dutyValue = (t.dutyValue + 1) % 32
+	}
+}
+
+func (t *triangle) stepLength() {
+	if !t.lengthHalt && t.lengthValue > 0 {
+		t.lengthValue--
+	}
+}
+
+func (t *triangle) stepCounter() {
+	if t.counterReload {
+		t.counterValue = t.counterPeriod
+	} else if t.counterValue > 0 {
+		t.counterValue--
+	}
+	if !t.lengthHalt {
+		t.counterReload = false
+	}
+}
+
+func (t *triangle) output() uint8 {
+	if !t.enabled || t.lengthValue == 0 || t.counterValue == 0 {
+		return 0
+	}
+	return triangleTable[t.dutyValue]
+}
+
+// noise is the pseudo-random noise channel.
+type noise struct {
+	enabled     bool
+	lengthHalt  bool
+	lengthValue uint8
+
+	mode          bool
+	shiftRegister uint16
+	timerPeriod   uint16
+	timerValue    uint16
+
+	envelope envelope
+}
+
+func (n *noise) writeRegister(register uint16, data uint8) {
+	switch register {
+	case 0:
+		n.lengthHalt = data&0x20 != 0
+		n.envelope.write(data)
+	case 2:
+		n.mode = data&0x80 != 0
+		n.timerPeriod = noiseTable[data&0x0F]
+	case 3:
+		if n.enabled {
+			n.lengthValue = lengthTable[data>>3]
+		}
+		n.envelope.start = true
+	}
+}
+
+func (n *noise) setEnabled(enabled bool) {
+	n.enabled = enabled
+	if !enabled {
+		n.lengthValue = 0
+	}
+}
+
+func (n *noise) stepTimer() {
+	if n.timerValue > 0 {
+		n.timerValue--
+		return
+	}
+	n.timerValue = n.timerPeriod
+	shift := uint16(1)
+	if n.mode {
+		shift = 6
+	}
+	feedback := (n.shiftRegister & 1) ^ ((n.shiftRegister >> shift) & 1)
+	n.shiftRegister >>= 1
+	n.shiftRegister |= feedback << 14
+}
+
+func (n *noise) stepEnvelope() {
+	n.envelope.step()
+}
+
+func (n *noise) stepLength() {
+	if !n.lengthHalt && n.lengthValue > 0 {
+		n.lengthValue--
+	}
+}
+
+func (n *noise) output() uint8 {
+	if !n.enabled || n.lengthValue == 0 || n.shiftRegister&1 == 1 {
+		return 0
+	}
+	return n.envelope.output()
+}
+
+// dmc is the delta modulation channel, which plays 1-bit delta samples
+// fetched from CPU memory.
+type dmc struct {
+	read func(address uint16) uint8
+
+	enabled bool
+	irq     bool
+	value   uint8
+
+	irqEnabled bool
+	loop       bool
+	tickPeriod uint16
+	tickValue  uint16
+
+	sampleAddress  uint16
+	sampleLength   uint16
+	currentAddress uint16
+	currentLength  uint16
+
+	shiftRegister uint8
+	bitCount      uint8
+}
+
+func (d *dmc) writeRegister(register uint16, data uint8) {
+	switch register {
+	case 0:
+		d.irqEnabled = data&0x80 != 0
+		d.loop = data&0x40 != 0
+		d.tickPeriod = dmcTable[data&0x0F] / 2
+		if !d.irqEnabled {
+			d.irq = false
+		}
+	case 1:
+		d.value = data & 0x7F
+	case 2:
+		d.sampleAddress = 0xC000 | uint16(data)<<6
+	case 3:
+		d.sampleLength = uint16(data)<<4 | 1
+	}
+}
+
+func (d *dmc) setEnabled(enabled bool) {
+	d.enabled = enabled
+	d.irq = false
+	if !enabled {
+		d.currentLength = 0
+	} else if d.currentLength == 0 {
+		d.restart()
+	}
+}
+
+func (d *dmc) restart() {
+	d.currentAddress = d.sampleAddress
+	d.currentLength = d.sampleLength
+}
+
+func (d *dmc) stepTimer() {
+	if !d.enabled {
+		return
+	}
+	d.stepReader()
+	if d.tickValue > 0 {
+		d.tickValue--
+		return
+	}
+	d.tickValue = d.tickPeriod
+	d.stepShifter()
+}
+
+// stepReader refills the shift register from memory when it has emptied.
+func (d *dmc) stepReader() {
+	if d.currentLength == 0 || d.bitCount != 0 || d.read == nil {
+		return
+	}
+	d.shiftRegister = d.read(d.currentAddress)
+	d.bitCount = 8
+	d.currentAddress++
+	if d.currentAddress == 0 {
+		d.currentAddress = 0x8000
+	}
+	d.currentLength--
+	if d.currentLength == 0 {
+		if d.loop {
+			d.restart()
+		} else if d.irqEnabled {
+			d.irq = true
+		}
+	}
+}
+
+func (d *dmc) stepShifter() {
+	if d.bitCount == 0 {
+		return
+	}
+	if d.shiftRegister&1 == 1 {
+		if d.value <= 125 {
+			d.value += 2
+		}
+	} else if d.value >= 2 {
+		d.value -= 2
+	}
+	d.shiftRegister >>= 1
+	d.bitCount--
+}
+
+func (d *dmc) output() uint8 {
+	return d.value
+}
+
+func (e *envelope) stateFields() []interface{} {
+	return []interface{}{&e.enabled, &e.loop, &e.start, &e.period, &e.value, &e.volume, &e.constant}
+}
+
+func (p *pulse) stateFields() []interface{} {
+	fields := []interface{}{
+		&p.enabled, &p.lengthHalt, &p.lengthValue,
+		&p.timerPeriod, &p.timerValue, &p.dutyMode, &p.dutyValue,
+		&p.sweepReload, &p.sweepEnabled, &p.sweepNegate, &p.sweepShift, &p.sweepPeriod, &p.sweepValue,
+	}
+	return append(fields, p.envelope.stateFields()...)
+}
+
+func (t *triangle) stateFields() []interface{} {
+	return []interface{}{
+		&t.enabled, &t.lengthHalt, &t.lengthValue,
+		&t.timerPeriod, &t.timerValue, &t.dutyValue,
+		&t.counterPeriod, &t.counterValue, &t.counterReload,
+	}
+}
+
+func (n *noise) stateFields() []interface{} {
+	fields := []interface{}{
+		&n.enabled, &n.lengthHalt, &n.lengthValue,
+		&n.mode, &n.shiftRegister, &n.timerPeriod, &n.timerValue,
+	}
+	return append(fields, n.envelope.stateFields()...)
+}
+
+func (d *dmc) stateFields() []interface{} {
+	return []interface{}{
+		&d.enabled, &d.irq, &d.value, &d.irqEnabled, &d.loop, &d.tickPeriod, &d.tickValue,
+		&d.sampleAddress, &d.sampleLength, &d.currentAddress, &d.currentLength,
+		&d.shiftRegister, &d.bitCount,
+	}
+}
@@ -0,0 +1,37 @@
+package apu
+
+import "math"
+
+// filter is a first-order IIR filter modeling the analog output stage.
+type filter struct {
+	b0, b1, a1 float32
+	prevX      float32
+	prevY      float32
+}
+
+func (f *filter) step(x float32) float32 {
+	y := f.b0*x + f.b1*f.prevX - f.a1*f.prevY
+	f.prevY = y
+	f.prevX = x
+	return y
+}
+
+func lowPassFilter(sampleRate, cutoff float64) filter {
+	c := sampleRate / (math.Pi * cutoff)
+	a0i := float32(1 / (1 + c))
+	return filter{
+		b0: a0i,
+		b1: a0i,
+		a1: (1 - float32(c)) * a0i,
+	}
+}
+
+func highPassFilter(sampleRate, cutoff float64) filter {
+	c := sampleRate / (math.Pi * cutoff)
+	a0i := float32(1 / (1 + c))
+	return filter{
+		b0: float32(c) * a0i,
+		b1: -float32(c) * a0i,
+		a1: (1 - float32(c)) * a0i,
+	}
+}
@@ -0,0 +1,208 @@
+package cartridge
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// romExtensions are the file name extensions of ROM images looked for in
+// archives.
+var romExtensions = []string{".nes", ".fds", ".nsf", ".unf"}
+
+// maxImageSize bounds how much is read from a compressed file, so a
+// damaged or malicious archive cannot exhaust memory.
+const maxImageSize = 64 << 20
+
+var (
+	// ErrNoROMInArchive is returned for an archive without a ROM image.
+	ErrNoROMInArchive = errors.New("no ROM image in archive")
+	// ErrAmbiguousArchive is returned for an archive with several ROM
+	// images when no selector is given.
+	ErrAmbiguousArchive = errors.New("several ROM images in archive")
+)
+
+// ArchiveError reports a problem with the archive a ROM image was to be
+// read from, as opposed to the image itself.
+type ArchiveError struct {
+	Path string
+	Err  error
+	// Entries lists the candidate ROM images when Err is
+	// ErrAmbiguousArchive.
+	Entries []string
+}
+
+func (e *ArchiveError) Error() string {
+	if len(e.Entries) > 0 {
+		return fmt.Sprintf("cartridge: %s: %v: %s", e.Path, e.Err, strings.Join(e.Entries, ", "))
+	}
+	return fmt.Sprintf("cartridge: %s: %v", e.Path, e.Err)
+}
+
+func (e *ArchiveError) Unwrap() error {
+	return e.Err
+}
+
+// SelectFunc picks one of several ROM images in an archive by name. It
+// returns an error to abandon loading.
+type SelectFunc func(names []string) (string, error)
+
+// readImage reads the ROM image at filePath, taking it out of a zip, gzip
+// or tar archive (or gzipped tar) when the file is one. Archives are
+// recognized by their contents, not their names.
+func readImage(filePath string, selectEntry SelectFunc) ([]byte, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	image, err := unpack(data, selectEntry)
+	if err != nil {
+		var archiveErr *ArchiveError
+		if !errors.As(err, &archiveErr) {
+			archiveErr = &ArchiveError{Err: err}
+		}
+		archiveErr.Path = filePath
+		return nil, archiveErr
+	}
+	return image, nil
+}
+
+// unpack returns data, or the ROM image inside it if it is an archive.
+func unpack(data []byte, selectEntry SelectFunc) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")), bytes.HasPrefix(data, []byte("PK\x05\x06")):
+		return unpackZip(data, selectEntry)
+	case bytes.HasPrefix(data, []byte{0x1F, 0x8B}):
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		inner, err := readLimited(reader)
+		if err != nil {
+			return nil, err
+		}
+		if isTar(inner) {
+			return unpackTar(inner, selectEntry)
+		}
+		return inner, nil
+	case isTar(data):
+		return unpackTar(data, selectEntry)
+	}
+	return data, nil
+}
+
+func isTar(data []byte) bool {
+	return len(data) >= 262 && bytes.Equal(data[257:262], []byte("ustar"))
+}
+
+func readLimited(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxImageSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxImageSize {
+		return nil, fmt.Errorf("entry larger than %d bytes", maxImageSize)
+	}
+	return data, nil
+}
+
+func isROMName(name string) bool {
+	ext := strings.ToLower(path.Ext(name))
+	for _, romExt := range romExtensions {
+		if ext == romExt {
+			return true
+		}
+	}
+	return false
+}
+
+// choose picks the ROM image among names.
+func choose(names []string, selectEntry SelectFunc) (string, error) {
+	switch {
+	case len(names) == 0:
+		return "", ErrNoROMInArchive
+	case len(names) == 1:
+		return names[0], nil
+	case selectEntry == nil:
+		return "", &ArchiveError{Err: ErrAmbiguousArchive, Entries: names}
+	}
+	name, err := selectEntry(names)
+	if err != nil {
+		return "", err
+	}
+	for _, candidate := range names {
+		if candidate == name {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("no ROM image named %q in archive", name)
+}
+
+func unpackZip(data []byte, selectEntry SelectFunc) ([]byte, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]*zip.File)
+	var names []string
+	for _, file := range archive.File {
+		if !file.FileInfo().IsDir() && isROMName(file.Name) {
+			files[file.Name] = file
+			names = append(names, file.Name)
+		}
+	}
+	name, err := choose(names, selectEntry)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := files[name].Open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return readLimited(reader)
+}
+
+// unpackTar lists the ROM images in a tar archive, then reads only the one
+// chosen. When a name repeats, the last entry with it wins, as when the
+// archive is extracted.
+func unpackTar(data []byte, selectEntry SelectFunc) ([]byte, error) {
+	entries := make(map[string]int)
+	var names []string
+	archive := tar.NewReader(bytes.NewReader(data))
+	for index := 0; ; index++ {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg || !isROMName(header.Name) {
+			continue
+		}
+		if _, seen := entries[header.Name]; !seen {
+			names = append(names, header.Name)
+		}
+		entries[header.Name] = index
+	}
+	name, err := choose(names, selectEntry)
+	if err != nil {
+		return nil, err
+	}
+
+	archive = tar.NewReader(bytes.NewReader(data))
+	for index := 0; index <= entries[name]; index++ {
+		if _, err := archive.Next(); err != nil {
+			return nil, err
+		}
+	}
+	return readLimited(archive)
+}
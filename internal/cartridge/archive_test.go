@@ -0,0 +1,178 @@
+package cartridge
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type archiveEntry struct {
+	name string
+	data string
+}
+
+func zipArchive(t *testing.T, entries ...archiveEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, entry := range entries {
+		f, err := w.Create(entry.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(entry.data))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func tarArchive(t *testing.T, entries ...archiveEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := tar.NewWriter(&buf)
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Mode: 0o644, Size: int64(len(entry.data)), Typeflag: tar.TypeReg}
+		if err := w.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(entry.data))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func gzipData(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(data)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// selectName returns a SelectFunc that picks name.
+func selectName(name string) SelectFunc {
+	return func([]string) (string, error) { return name, nil }
+}
+
+func TestUnpack(t *testing.T) {
+	several := []archiveEntry{{"readme.txt", "text"}, {"a.nes", "rom a"}, {"dir/b.NES", "rom b"}}
+	tests := []struct {
+		name        string
+		data        []byte
+		selectEntry SelectFunc
+		want        string
+	}{
+		{"plain image", []byte("NES\x1a rom"), nil, "NES\x1a rom"},
+		{"zip with one ROM", zipArchive(t, archiveEntry{"readme.txt", "text"}, archiveEntry{"game.nes", "rom"}), nil, "rom"},
+		{"zip selection", zipArchive(t, several...), selectName("dir/b.NES"), "rom b"},
+		{"gzip", gzipData(t, []byte("rom")), nil, "rom"},
+		{"tar with one ROM", tarArchive(t, archiveEntry{"notes", "text"}, archiveEntry{"game.unf", "rom"}), nil, "rom"},
+		{"tar selection", tarArchive(t, several...), selectName("a.nes"), "rom a"},
+		{"tar repeated name", tarArchive(t, archiveEntry{"a.nes", "old"}, archiveEntry{"b.nes", "rom b"}, archiveEntry{"a.nes", "new"}), selectName("a.nes"), "new"},
+		{"gzipped tar selection", gzipData(t, tarArchive(t, several...)), selectName("dir/b.NES"), "rom b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := unpack(tt.data, tt.selectEntry)
+			if err != nil {
+				t.Fatalf("unpack: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("unpack = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnpackSelectorNames(t *testing.T) {
+	entries := []archiveEntry{{"b.nes", "rom b"}, {"x.txt", "text"}, {"a.fds", "rom a"}, {"b.nes", "rom b2"}}
+	for name, data := range map[string][]byte{
+		"zip": zipArchive(t, entries[:3]...),
+		"tar": tarArchive(t, entries...),
+	} {
+		var offered []string
+		unpack(data, func(names []string) (string, error) {
+			offered = names
+			return names[0], nil
+		})
+		if want := []string{"b.nes", "a.fds"}; !reflect.DeepEqual(offered, want) {
+			t.Errorf("%s: selector offered %q, want %q", name, offered, want)
+		}
+	}
+}
+
+func TestUnpackErrors(t *testing.T) {
+	several := []archiveEntry{{"a.nes", "rom a"}, {"b.nes", "rom b"}}
+	errSelect := errors.New("cancelled")
+	tests := []struct {
+		name        string
+		data        []byte
+		selectEntry SelectFunc
+		want        error
+		entries     []string
+	}{
+		{"ambiguous zip", zipArchive(t, several...), nil, ErrAmbiguousArchive, []string{"a.nes", "b.nes"}},
+		{"ambiguous tar", tarArchive(t, several...), nil, ErrAmbiguousArchive, []string{"a.nes", "b.nes"}},
+		{"ambiguous gzipped tar", gzipData(t, tarArchive(t, several...)), nil, ErrAmbiguousArchive, []string{"a.nes", "b.nes"}},
+		{"no ROM in zip", zipArchive(t, archiveEntry{"readme.txt", "text"}), nil, ErrNoROMInArchive, nil},
+		{"no ROM in tar", tarArchive(t, archiveEntry{"readme.txt", "text"}), nil, ErrNoROMInArchive, nil},
+		{"selector error", zipArchive(t, several...), func([]string) (string, error) { return "", errSelect }, errSelect, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := unpack(tt.data, tt.selectEntry)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("unpack = %v, want %v", err, tt.want)
+			}
+			if tt.entries != nil {
+				var archiveErr *ArchiveError
+				if !errors.As(err, &archiveErr) || !reflect.DeepEqual(archiveErr.Entries, tt.entries) {
+					t.Errorf("unpack = %#v, want an *ArchiveError listing %q", err, tt.entries)
+				}
+			}
+		})
+	}
+
+	if _, err := unpack(zipArchive(t, several...), selectName("c.nes")); err == nil {
+		t.Error("unpack accepted a selection that is not in the archive")
+	}
+}
+
+func TestLoadCartridgeFromArchive(t *testing.T) {
+	dir := t.TempDir()
+	rom := string(image(header(2, 1), 0x8000, 0x2000))
+	path := filepath.Join(dir, "game.zip")
+	if err := os.WriteFile(path, zipArchive(t, archiveEntry{"game.nes", rom}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cart, err := LoadCartridgeWithOptions(path, LoadOptions{DisableDatabase: true})
+	if err != nil {
+		t.Fatalf("LoadCartridgeWithOptions: %v", err)
+	}
+	if got := cart.Header().PRGROMSize; got != 0x8000 {
+		t.Errorf("PRG ROM size %#x, want %#x", got, 0x8000)
+	}
+
+	path = filepath.Join(dir, "games.tar")
+	if err := os.WriteFile(path, tarArchive(t, archiveEntry{"a.nes", rom}, archiveEntry{"b.nes", rom}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = LoadCartridge(path)
+	var archiveErr *ArchiveError
+	if !errors.As(err, &archiveErr) || archiveErr.Path != path || !errors.Is(err, ErrAmbiguousArchive) {
+		t.Errorf("LoadCartridge = %v, want an ambiguous *ArchiveError for %s", err, path)
+	}
+}
@@ -0,0 +1,39 @@
+package cartridge
+
+func init() {
+	registerMapper(7, newAxROM)
+}
+
+// axrom is mapper 7: a switchable 32 KiB PRG bank, 8 KiB of CHR RAM and
+// single-screen mirroring selected by the same register at $8000-$FFFF.
+type axrom struct {
+	*board
+	busConflicts bool
+}
+
+func newAxROM(b *board) Mapper {
+	m := &axrom{
+		board: b,
+		// Only AMROM boards have bus conflicts, and only submapper 2 says so.
+		busConflicts: b.header.Submapper == 2,
+	}
+	m.setPRGBank(0, 0x8000, 0)
+	m.setMirroring(MirrorSingleLower)
+	return m
+}
+
+func (m *axrom) WritePRG(address uint16, data uint8) {
+	if address < 0x8000 {
+		m.board.WritePRG(address, data)
+		return
+	}
+	if m.busConflicts {
+		data = m.busConflict(address, data)
+	}
+	m.setPRGBank(0, 0x8000, int(data&0x07))
+	if data&0x10 != 0 {
+		m.setMirroring(MirrorSingleUpper)
+	} else {
+		m.setMirroring(MirrorSingleLower)
+	}
+}
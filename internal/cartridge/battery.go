@@ -0,0 +1,132 @@
+package cartridge
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SaveExtension is the file extension of battery save files.
+const SaveExtension = ".sav"
+
+// batteryRegions returns the memories kept alive by the battery, in the
+// order they are stored in a save file: non-volatile PRG RAM, then
+// non-volatile CHR RAM. Non-volatile RAM follows the volatile RAM of the
+// same kind. RAM a mapper adds beyond the header's sizes is included only
+// where the mapper says the battery keeps it; see board.growPRGRAM.
+func (c *Cartridge) batteryRegions() [][]uint8 {
+	var regions [][]uint8
+	if start, size := c.header.PRGRAMSize, c.board.prgNVRAMSize; size > 0 && len(c.board.prgRAM) >= start+size {
+		regions = append(regions, c.board.prgRAM[start:start+size])
+	}
+	if c.header.CHRNVRAMSize > 0 && c.board.chrWritable && len(c.board.chr) > c.header.CHRRAMSize {
+		regions = append(regions, c.board.chr[c.header.CHRRAMSize:])
+	}
+	return regions
+}
+
+// HasBattery reports whether the cartridge has battery-backed memory.
+func (c *Cartridge) HasBattery() bool {
+	return len(c.batteryRegions()) > 0
+}
+
+// BatteryRAM returns a copy of the battery-backed memory, or nil if the
+// cartridge has none.
+func (c *Cartridge) BatteryRAM() []uint8 {
+	var data []uint8
+	for _, region := range c.batteryRegions() {
+		data = append(data, region...)
+	}
+	return data
+}
+
+// LoadBatteryRAM restores battery-backed memory from data as returned by
+// BatteryRAM. Data of the wrong length is copied as far as it goes, which
+// accepts saves from emulators that size the RAM differently. The contents
+// then survive PowerOn, as they do on a real cartridge.
+func (c *Cartridge) LoadBatteryRAM(data []uint8) {
+	for _, region := range c.batteryRegions() {
+		data = data[copy(region, data):]
+	}
+	c.batteryValid = true
+}
+
+// WorkRAMRestored reports whether the last PowerOn kept the contents of
+// work RAM from a battery save instead of filling it. Boards that have
+// volatile PRG RAM alongside the battery-backed RAM never report it, as
+// which CPU addresses hold the saved bytes depends on their banking.
+func (c *Cartridge) WorkRAMRestored() bool {
+	return c.batteryRestored && c.header.PRGNVRAMSize > 0 && c.header.PRGRAMSize == 0
+}
+
+// SavePath returns the path of the save file for the ROM at romPath: the
+// ROM's name with SaveExtension, in dir, or next to the ROM if dir is empty.
+func SavePath(romPath, dir string) string {
+	name := strings.TrimSuffix(filepath.Base(romPath), filepath.Ext(romPath)) + SaveExtension
+	if dir == "" {
+		dir = filepath.Dir(romPath)
+	}
+	return filepath.Join(dir, name)
+}
+
+// LoadSaveFile loads battery-backed memory from the save file at path. A
+// missing file is not an error; the game simply starts without a save.
+func (c *Cartridge) LoadSaveFile(path string) error {
+	if !c.HasBattery() {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("cartridge: loading save: %w", err)
+	}
+	c.LoadBatteryRAM(data)
+	return nil
+}
+
+// WriteSaveFile writes battery-backed memory to the save file at path. The
+// data is written to a temporary file in the same directory which then
+// replaces the save, so a crash part way through never leaves a truncated
+// save behind.
+func (c *Cartridge) WriteSaveFile(path string) error {
+	if !c.HasBattery() {
+		return nil
+	}
+	if err := writeFileAtomic(path, c.BatteryRAM()); err != nil {
+		return fmt.Errorf("cartridge: writing save: %w", err)
+	}
+	return nil
+}
+
+func writeFileAtomic(path string, data []uint8) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(dir, filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if err := file.Chmod(0o644); err != nil {
+		file.Close()
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
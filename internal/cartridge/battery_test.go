@@ -0,0 +1,119 @@
+package cartridge
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// batteryImage is an NROM image with 8 KiB of battery-backed work RAM.
+var batteryImage = image(header(2, 1, 0x02), 0x8000, 0x2000)
+
+func TestMMC5BatteryRAMSize(t *testing.T) {
+	cart := newTestCartridge(t, image(header(2, 1, 0x52), 0x8000, 0x2000))
+	if got := len(cart.board.prgRAM); got != 0x10000 {
+		t.Errorf("PRG RAM is %#x bytes, want %#x", got, 0x10000)
+	}
+	if got := len(cart.BatteryRAM()); got != 0x2000 {
+		t.Errorf("BatteryRAM is %#x bytes, want %#x", got, 0x2000)
+	}
+}
+
+func TestSaveFileRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "game.sav")
+	cart := newTestCartridge(t, batteryImage)
+	cart.PowerOn(func(buf []uint8) {})
+	cart.WritePRGByte(0x6000, 0x12)
+	cart.WritePRGByte(0x7FFF, 0x34)
+	if err := cart.WriteSaveFile(path); err != nil {
+		t.Fatalf("WriteSaveFile: %v", err)
+	}
+
+	cart = newTestCartridge(t, batteryImage)
+	if err := cart.LoadSaveFile(path); err != nil {
+		t.Fatalf("LoadSaveFile: %v", err)
+	}
+	cart.PowerOn(func(buf []uint8) {
+		for i := range buf {
+			buf[i] = 0xFF
+		}
+	})
+	if got := cart.ReadPRGByte(0x6000); got != 0x12 {
+		t.Errorf("$6000 = %#02x, want 0x12", got)
+	}
+	if got := cart.ReadPRGByte(0x7FFF); got != 0x34 {
+		t.Errorf("$7FFF = %#02x, want 0x34", got)
+	}
+	if !cart.WorkRAMRestored() {
+		t.Error("WorkRAMRestored = false after loading a save")
+	}
+}
+
+func TestLoadSaveFileMissing(t *testing.T) {
+	cart := newTestCartridge(t, batteryImage)
+	if err := cart.LoadSaveFile(filepath.Join(t.TempDir(), "none.sav")); err != nil {
+		t.Errorf("LoadSaveFile: %v", err)
+	}
+}
+
+func TestWriteSaveFileFailedRename(t *testing.T) {
+	dir := t.TempDir()
+	// A non-empty directory in place of the save makes the rename fail.
+	path := filepath.Join(dir, "game.sav")
+	if err := os.MkdirAll(filepath.Join(path, "keep"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	cart := newTestCartridge(t, batteryImage)
+	cart.PowerOn(func(buf []uint8) {})
+	if err := cart.WriteSaveFile(path); err == nil {
+		t.Fatal("WriteSaveFile succeeded over a directory")
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if entry.Name() != "game.sav" {
+			t.Errorf("%s left behind after a failed save", entry.Name())
+		}
+	}
+}
+
+func TestWriteSaveFileReplaces(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "game.sav")
+	if err := os.WriteFile(path, []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cart := newTestCartridge(t, batteryImage)
+	cart.PowerOn(func(buf []uint8) {})
+	if err := cart.WriteSaveFile(path); err != nil {
+		t.Fatalf("WriteSaveFile: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, cart.BatteryRAM()) {
+		t.Errorf("save holds %d bytes, want the %d bytes of battery RAM", len(data), len(cart.BatteryRAM()))
+	}
+}
+
+func TestSavePath(t *testing.T) {
+	tests := []struct {
+		rom  string
+		dir  string
+		want string
+	}{
+		{rom: "roms/game.nes", want: "roms/game.sav"},
+		{rom: "roms/game.zip", want: "roms/game.sav"},
+		{rom: "roms/game.v1.nes", want: "roms/game.v1.sav"},
+		{rom: "roms/game.nes", dir: "saves", want: "saves/game.sav"},
+	}
+	for _, test := range tests {
+		want := filepath.FromSlash(test.want)
+		if got := SavePath(filepath.FromSlash(test.rom), filepath.FromSlash(test.dir)); got != want {
+			t.Errorf("SavePath(%q, %q) = %q, want %q", test.rom, test.dir, got, want)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package cartridge
+
+func init() {
+	registerMapper(34, newBNROM)
+}
+
+// Submappers of mapper 34.
+const (
+	bnromNINA001 = 1
+	bnromBNROM   = 2
+)
+
+// bnrom is mapper 34, which covers two unrelated boards. BNROM switches
+// 32 KiB of PRG by writing $8000-$FFFF, with bus conflicts, and has CHR
+// RAM. The AVE NINA-001 has its registers at $7FFD-$7FFF, on top of the
+// PRG RAM: a 32 KiB PRG bank and two 4 KiB CHR banks. Without a submapper
+// the NINA-001 is recognized by having more than 8 KiB of CHR ROM.
+type bnrom struct {
+	*board
+	nina001 bool
+}
+
+func newBNROM(b *board) Mapper {
+	nina001 := b.header.Submapper == bnromNINA001
+	if b.header.Submapper != bnromBNROM && len(b.chr) > 0x2000 && !b.chrWritable {
+		nina001 = true
+	}
+	m := &bnrom{board: b, nina001: nina001}
+	m.setPRGBank(0, 0x8000, 0)
+	return m
+}
+
+func (m *bnrom) WritePRG(address uint16, data uint8) {
+	if address < 0x8000 {
+		m.board.WritePRG(address, data)
+		if !m.nina001 {
+			return
+		}
+		switch address {
+		case 0x7FFD:
+			m.setPRGBank(0, 0x8000, int(data&0x01))
+		case 0x7FFE:
+			m.setCHRBank(0, 0x1000, int(data&0x0F))
+		case 0x7FFF:
+			m.setCHRBank(1, 0x1000, int(data&0x0F))
+		}
+		return
+	}
+	if !m.nina001 {
+		data = m.busConflict(address, data)
+		m.setPRGBank(0, 0x8000, int(data))
+	}
+}
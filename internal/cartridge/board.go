@@ -0,0 +1,302 @@
+package cartridge
+
+import "fmt"
+
+// Mirroring selects how the four logical nametables map onto nametable RAM.
+type Mirroring int
+
+const (
+	MirrorHorizontal Mirroring = iota
+	MirrorVertical
+	MirrorSingleLower
+	MirrorSingleUpper
+	MirrorFourScreen
+)
+
+func (m Mirroring) String() string {
+	switch m {
+	case MirrorHorizontal:
+		return "horizontal"
+	case MirrorVertical:
+		return "vertical"
+	case MirrorSingleLower:
+		return "single-screen lower"
+	case MirrorSingleUpper:
+		return "single-screen upper"
+	case MirrorFourScreen:
+		return "four-screen"
+	}
+	return fmt.Sprintf("Mirroring(%d)", int(m))
+}
+
+// mirrorLookup gives the 1 KiB page of nametable RAM used for each of the
+// four logical nametables under each mirroring mode. Pages 2 and 3 are RAM
+// on the cartridge.
+var mirrorLookup = [...][4]int{
+	MirrorHorizontal:  {0, 0, 1, 1},
+	MirrorVertical:    {0, 1, 0, 1},
+	MirrorSingleLower: {0, 0, 0, 0},
+	MirrorSingleUpper: {1, 1, 1, 1},
+	MirrorFourScreen:  {0, 1, 2, 3},
+}
+
+// Window sizes of the bank tables.
+const (
+	prgWindow = 0x2000
+	chrWindow = 0x0400
+	ramWindow = 0x2000
+
+	// ciramSize is the size of the nametable RAM inside the console.
+	ciramSize = 0x0800
+)
+
+// board holds the memories on a cartridge and the bank tables through which
+// mappers expose them. Its methods implement Mapper for a board with fixed
+// banks, so mappers embed it and change the tables as their registers are
+// written.
+type board struct {
+	header Header
+
+	prg         []uint8
+	chr         []uint8
+	chrWritable bool
+	prgRAM      []uint8
+	// prgNVRAMSize is how much of prgRAM, after the volatile part, the
+	// battery keeps.
+	prgNVRAMSize int
+
+	// ciram is the console's nametable RAM and vram is nametable RAM on the
+	// cartridge, which follows it in the page numbering.
+	ciram []uint8
+	vram  []uint8
+
+	// prgBanks and chrBanks give the offsets in PRG and CHR of the 8 KiB
+	// windows at $8000-$FFFF and the 1 KiB windows at $0000-$1FFF.
+	prgBanks [4]int
+	chrBanks [8]int
+	// ramBank is the offset in PRG RAM of the window at $6000-$7FFF.
+	ramBank      int
+	ramDisabled  bool
+	ramProtected bool
+
+	mirroring  Mirroring
+	nametables [4]int
+}
+
+// reset restores the bank tables to their state before any mapper register
+// is written: the first 32 KiB of PRG and 8 KiB of CHR, and the mirroring
+// wired on the board.
+func (b *board) reset() {
+	for i := range b.prgBanks {
+		b.prgBanks[i] = i * prgWindow
+	}
+	for i := range b.chrBanks {
+		b.chrBanks[i] = i * chrWindow
+	}
+	b.ramBank = 0
+	b.ramDisabled = false
+	b.ramProtected = false
+	b.setMirroring(b.header.Mirroring)
+}
+
+// bankOffset returns the offset of bank number bank of the given size in
+// memory. Banks beyond the end wrap around and negative banks count back
+// from the end, so -1 is the last bank.
+func bankOffset(memory []uint8, size, bank int) int {
+	count := len(memory) / size
+	if count == 0 {
+		return 0
+	}
+	bank %= count
+	if bank < 0 {
+		bank += count
+	}
+	return bank * size
+}
+
+// growPRGRAM extends PRG RAM to size bytes for boards with more RAM than
+// the header describes. The added RAM is battery-backed if battery is set
+// and the header declares battery-backed RAM.
+func (b *board) growPRGRAM(size int, battery bool) {
+	if len(b.prgRAM) >= size {
+		return
+	}
+	b.prgRAM = append(b.prgRAM, make([]uint8, size-len(b.prgRAM))...)
+	if battery && b.prgNVRAMSize > 0 {
+		b.prgNVRAMSize = len(b.prgRAM) - b.header.PRGRAMSize
+	}
+}
+
+// setPRGBank maps PRG bank number bank of size bytes into the slot'th
+// window of that size at $8000-$FFFF.
+func (b *board) setPRGBank(slot, size, bank int) {
+	offset := bankOffset(b.prg, size, bank)
+	windows := size / prgWindow
+	for i := 0; i < windows; i++ {
+		b.prgBanks[slot*windows+i] = offset + i*prgWindow
+	}
+}
+
+// setCHRBank maps CHR bank number bank of size bytes into the slot'th
+// window of that size at $0000-$1FFF.
+func (b *board) setCHRBank(slot, size, bank int) {
+	offset := bankOffset(b.chr, size, bank)
+	windows := size / chrWindow
+	for i := 0; i < windows; i++ {
+		b.chrBanks[slot*windows+i] = offset + i*chrWindow
+	}
+}
+
+// setRAMBank maps 8 KiB PRG RAM bank number bank at $6000-$7FFF.
+func (b *board) setRAMBank(bank int) {
+	b.ramBank = bankOffset(b.prgRAM, ramWindow, bank)
+}
+
+// setMirroring arranges the nametables in one of the standard ways.
+func (b *board) setMirroring(mirroring Mirroring) {
+	b.mirroring = mirroring
+	for i, page := range mirrorLookup[mirroring] {
+		b.nametables[i] = page * 0x0400
+	}
+}
+
+// setNametable maps 1 KiB page of nametable RAM into logical nametable
+// table, for mappers that arrange them individually.
+func (b *board) setNametable(table, page int) {
+	b.nametables[table] = page * 0x0400
+}
+
+func (b *board) ReadPRG(address uint16) (uint8, bool) {
+	switch {
+	case address >= 0x8000:
+		return b.prg[b.prgOffset(address)], true
+	case address >= 0x6000:
+		if len(b.prgRAM) == 0 || b.ramDisabled {
+			return 0, false
+		}
+		return b.prgRAM[b.ramOffset(address)], true
+	}
+	return 0, false
+}
+
+func (b *board) WritePRG(address uint16, data uint8) {
+	if address >= 0x6000 && address < 0x8000 && len(b.prgRAM) > 0 && !b.ramDisabled && !b.ramProtected {
+		b.prgRAM[b.ramOffset(address)] = data
+	}
+}
+
+// busConflict returns the value seen by a register write to ROM on boards
+// that do not disable the ROM during writes: both drive the data bus and
+// 0 wins.
+func (b *board) busConflict(address uint16, data uint8) uint8 {
+	return data & b.prg[b.prgOffset(address)]
+}
+
+func (b *board) prgOffset(address uint16) int {
+	window := int(address-0x8000) / prgWindow
+	return (b.prgBanks[window] + int(address)%prgWindow) % len(b.prg)
+}
+
+func (b *board) ramOffset(address uint16) int {
+	return (b.ramBank + int(address)%ramWindow) % len(b.prgRAM)
+}
+
+func (b *board) ReadCHR(address uint16) uint8 {
+	return b.chr[b.chrOffset(address)]
+}
+
+func (b *board) WriteCHR(address uint16, data uint8) {
+	if b.chrWritable {
+		b.chr[b.chrOffset(address)] = data
+	}
+}
+
+func (b *board) chrOffset(address uint16) int {
+	window := int(address&0x1FFF) / chrWindow
+	return (b.chrBanks[window] + int(address)%chrWindow) % len(b.chr)
+}
+
+func (b *board) ReadNametable(address uint16) uint8 {
+	return b.readVRAM(b.nametableOffset(address))
+}
+
+func (b *board) WriteNametable(address uint16, data uint8) {
+	b.writeVRAM(b.nametableOffset(address), data)
+}
+
+// nametableOffset maps an address in $2000-$3EFF to an offset in nametable
+// RAM according to the nametable arrangement.
+func (b *board) nametableOffset(address uint16) int {
+	address = (address - 0x2000) & 0x0FFF
+	return b.nametables[address/0x0400] + int(address%0x0400)
+}
+
+// readVRAM reads nametable RAM by page-numbered offset: the console's
+// nametable RAM first, then the cartridge's.
+func (b *board) readVRAM(offset int) uint8 {
+	if offset < ciramSize {
+		if b.ciram == nil {
+			return 0
+		}
+		return b.ciram[offset]
+	}
+	if offset -= ciramSize; offset < len(b.vram) {
+		return b.vram[offset]
+	}
+	return 0
+}
+
+func (b *board) writeVRAM(offset int, data uint8) {
+	if offset < ciramSize {
+		if b.ciram != nil {
+			b.ciram[offset] = data
+		}
+		return
+	}
+	if offset -= ciramSize; offset < len(b.vram) {
+		b.vram[offset] = data
+	}
+}
+
+func (b *board) Mirroring() Mirroring {
+	return b.mirroring
+}
+
+func (b *board) IRQ() bool {
+	return false
+}
+
+func (b *board) StepCPU() {}
+
+func (b *board) OnA12Rise() {}
+
+func (b *board) StartScanline(scanline int, rendering bool) {}
+
+func (b *board) SpriteFetches(active bool) {}
+
+func (b *board) SnoopWrite(address uint16, data uint8) {}
+
+func (b *board) AudioOutput() float32 {
+	return 0
+}
+
+func (b *board) PRGBank(address uint16) (int, bool) {
+	if address < 0x8000 || len(b.prg) <= 0x8000 {
+		return 0, false
+	}
+	return b.prgBanks[(address-0x8000)/prgWindow] / prgWindow, true
+}
+
+// stateFields lists the board state captured in save states. ROM is left
+// out since it cannot change.
+func (b *board) stateFields() []interface{} {
+	fields := []interface{}{
+		&b.prgRAM, &b.vram,
+		&b.prgBanks, &b.chrBanks, &b.ramBank, &b.ramDisabled, &b.ramProtected,
+		&b.mirroring, &b.nametables,
+	}
+	if b.chrWritable {
+		fields = append(fields, &b.chr)
+	}
+	return fields
+}
@@ -0,0 +1,40 @@
+package cartridge
+
+func init() {
+	registerMapper(71, newCamerica)
+}
+
+// camerica is mapper 71, the Camerica/Codemasters BF909x boards: a
+// switchable 16 KiB PRG bank at $8000 selected by writing $C000-$FFFF and
+// the last bank fixed at $C000. The BF9097 used by Fire Hawk (submapper 1)
+// adds single-screen mirroring selected by bit 4 of writes to $8000-$9FFF;
+// other games never write there, so it is decoded without a submapper too.
+type camerica struct {
+	*board
+}
+
+func newCamerica(b *board) Mapper {
+	m := &camerica{b}
+	m.setPRGBank(0, 0x4000, 0)
+	m.setPRGBank(1, 0x4000, -1)
+	return m
+}
+
+func (m *camerica) WritePRG(address uint16, data uint8) {
+	switch {
+	case address < 0x8000:
+		m.board.WritePRG(address, data)
+	case address < 0xA000:
+		if m.header.Submapper == 0 && address < 0x9000 {
+			// Some BF9093 games write here with no intent to mirror.
+			return
+		}
+		if data&0x10 != 0 {
+			m.setMirroring(MirrorSingleUpper)
+		} else {
+			m.setMirroring(MirrorSingleLower)
+		}
+	case address >= 0xC000:
+		m.setPRGBank(0, 0x4000, int(data))
+	}
+}
@@ -1,27 +1,346 @@
 package cartridge
 
+import (
+	"encoding/gob"
+	"fmt"
+	"hash/crc32"
+
+	"github.com/tejasdeepakmasne/NESemu/internal/patch"
+	"github.com/tejasdeepakmasne/NESemu/internal/savestate"
+)
+
+// a12FilterCycles is how many CPU cycles PPU A12 must stay low before a
+// rising edge is passed to the mapper. Scanline counters filter out the
+// brief drops between sprite pattern fetches this way.
+const a12FilterCycles = 3
+
 // Cartridge represents the NES cartridge containing ROM data.
 type Cartridge struct {
-	// Define cartridge properties and ROM data here
-	// For example:
-	// ROM []uint8
-	// Name string
-	// Mapper int
+	header  Header
+	trainer []uint8
+	misc    []uint8
+	// checksum is the CRC32 of PRG ROM followed by CHR ROM.
+	checksum uint32
+
+	// gameName and corrections record what the game database said about
+	// the image.
+	gameName    string
+	corrections []string
+	// patches lists the patch files applied to the image.
+	patches []string
+
+	board     board
+	mapper    Mapper
+	newMapper mapperFunc
+
+	// cycles counts CPU cycles for the A12 filter; a12 is the level of A12
+	// on the last PPU access and a12Low the cycle on which it last fell.
+	cycles uint64
+	a12    bool
+	a12Low uint64
+
+	// batteryValid is set once battery-backed memory holds data that must
+	// survive PowerOn: after it was loaded or powered on once.
+	batteryValid bool
+	// batteryRestored is set when the last PowerOn kept battery-backed
+	// memory rather than filling it.
+	batteryRestored bool
+}
+
+// LoadOptions controls how a ROM image is turned into a cartridge.
+type LoadOptions struct {
+	// DisableDatabase keeps the header exactly as found in the image
+	// instead of correcting it from the game database.
+	DisableDatabase bool
+	// Database is consulted instead of DefaultDatabase when set.
+	Database *Database
+
+	// Patches names IPS, UPS or BPS files applied in order to the image
+	// before it is parsed. When there are none, a patch file next to the
+	// ROM with the same name, such as game.ips for game.nes, is applied
+	// unless DisableAutoPatch is set.
+	Patches          []string
+	DisableAutoPatch bool
+
+	// SelectEntry picks the ROM image to load from an archive holding
+	// several. Without it such archives fail with ErrAmbiguousArchive.
+	SelectEntry SelectFunc
+}
+
+// LoadCartridge loads an NES cartridge ROM from the specified file path. The
+// file may also be a zip, gzip or tar archive holding the ROM, in which
+// case problems with the archive are reported as an *ArchiveError.
+func LoadCartridge(filePath string) (*Cartridge, error) {
+	return LoadCartridgeWithOptions(filePath, LoadOptions{})
+}
+
+// LoadCartridgeWithOptions is like LoadCartridge but applies options.
+func LoadCartridgeWithOptions(filePath string, options LoadOptions) (*Cartridge, error) {
+	data, err := readImage(filePath, options.SelectEntry)
+	if err != nil {
+		return nil, err
+	}
+	patches := options.Patches
+	if len(patches) == 0 && !options.DisableAutoPatch {
+		if sibling := patch.FindSibling(filePath); sibling != "" {
+			patches = []string{sibling}
+		}
+	}
+	for _, path := range patches {
+		if data, err = patch.ApplyFile(data, path); err != nil {
+			return nil, err
+		}
+	}
+	cart, err := ParseWithOptions(data, options)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%s)", err, filePath)
+	}
+	cart.patches = patches
+	return cart, nil
+}
+
+// newCartridge builds a cartridge from the parts of a ROM image, copying
+// them so the cartridge does not alias the caller's buffer.
+func newCartridge(header Header, trainer, prg, chr, misc []uint8) (*Cartridge, error) {
+	newMapper, err := lookupMapper(header.Mapper, header.Submapper)
+	if err != nil {
+		return nil, err
+	}
+	cart := &Cartridge{
+		header:    header,
+		trainer:   append([]uint8(nil), trainer...),
+		misc:      append([]uint8(nil), misc...),
+		checksum:  crc32.Update(crc32.ChecksumIEEE(prg), crc32.IEEETable, chr),
+		newMapper: newMapper,
+	}
+	cart.board = board{
+		header:       header,
+		prg:          append([]uint8(nil), prg...),
+		prgRAM:       make([]uint8, header.PRGRAMSize+header.PRGNVRAMSize),
+		prgNVRAMSize: header.PRGNVRAMSize,
+	}
+	if len(chr) == 0 {
+		size := header.CHRRAMSize + header.CHRNVRAMSize
+		if size == 0 {
+			size = CHRBankSize
+		}
+		cart.board.chr = make([]uint8, size)
+		cart.board.chrWritable = true
+	} else {
+		cart.board.chr = append([]uint8(nil), chr...)
+	}
+	if header.FourScreen {
+		cart.board.vram = make([]uint8, ciramSize)
+	}
+	if len(trainer) > 0 {
+		// The trainer is loaded at $7000, so the board needs work RAM
+		// even if the header declares none.
+		cart.board.growPRGRAM(0x2000, false)
+	}
+	cart.powerOnMapper()
+	return cart, nil
 }
 
-// LoadCartridge loads an NES cartridge ROM from the specified file path.
-func LoadCartridge(filePath string) *Cartridge {
-	// Implement cartridge loading logic here
-	return nil // Placeholder return value
+// Header returns the decoded header of the ROM image.
+func (c *Cartridge) Header() Header {
+	return c.header
+}
+
+// Checksum returns the CRC32 of the cartridge's PRG ROM followed by its CHR
+// ROM, which identifies the game.
+func (c *Cartridge) Checksum() uint32 {
+	return c.checksum
+}
+
+// GameName returns the name the game database gives the image, or "".
+func (c *Cartridge) GameName() string {
+	return c.gameName
+}
+
+// Corrections describes each header field that the game database changed,
+// such as "mapper 4 -> 118". It is empty when the header was right or the
+// image is not in the database.
+func (c *Cartridge) Corrections() []string {
+	return c.corrections
+}
+
+// Patches returns the patch files that were applied to the image.
+func (c *Cartridge) Patches() []string {
+	return c.patches
+}
+
+// Mapper returns the cartridge's mapper.
+func (c *Cartridge) Mapper() Mapper {
+	return c.mapper
+}
+
+// Trainer returns the 512-byte trainer, or nil if the image has none.
+func (c *Cartridge) Trainer() []uint8 {
+	if len(c.trainer) == 0 {
+		return nil
+	}
+	return c.trainer
+}
+
+// MiscROM returns the miscellaneous ROM data of a NES 2.0 image, or nil.
+func (c *Cartridge) MiscROM() []uint8 {
+	if len(c.misc) == 0 {
+		return nil
+	}
+	return c.misc
+}
+
+// ConnectNametableRAM gives the cartridge the console's nametable RAM, which
+// the mapper arranges into the PPU address space.
+func (c *Cartridge) ConnectNametableRAM(ram []uint8) {
+	c.board.ciram = ram
+}
+
+// PowerOn fills the cartridge's work RAM with its power-on contents using
+// fill and puts the mapper in its power-on state. Battery-backed memory
+// keeps its contents once it has been loaded or powered on. A trainer, if
+// present, is then copied to $7000-$71FF.
+func (c *Cartridge) PowerOn(fill func(buf []uint8)) {
+	var battery []uint8
+	if c.batteryValid {
+		battery = c.BatteryRAM()
+	}
+	c.batteryRestored = battery != nil
+	fill(c.board.prgRAM)
+	fill(c.board.vram)
+	if c.board.chrWritable {
+		fill(c.board.chr)
+	}
+	if battery != nil {
+		c.LoadBatteryRAM(battery)
+	}
+	c.batteryValid = c.HasBattery()
+	if len(c.trainer) > 0 {
+		copy(c.board.prgRAM[0x1000:], c.trainer)
+	}
+	c.powerOnMapper()
+}
+
+func (c *Cartridge) powerOnMapper() {
+	c.board.reset()
+	c.mapper = c.newMapper(&c.board)
+	c.cycles = 0
+	c.a12 = false
+	c.a12Low = 0
+}
+
+// HasWorkRAM reports whether the cartridge has RAM to map at $6000-$7FFF.
+func (c *Cartridge) HasWorkRAM() bool {
+	return len(c.board.prgRAM) > 0
 }
 
 // ReadPRGByte reads a byte from the PRG ROM of the cartridge at the specified address.
 func (c *Cartridge) ReadPRGByte(address uint16) uint8 {
-	// Implement PRG ROM read logic here
-	return 0 // Placeholder return value
+	data, _ := c.mapper.ReadPRG(address)
+	return data
 }
 
-// WritePRGByte writes a byte to the PRG ROM of the cartridge at the specified address.
+// ReadPRGPartial reads a byte from the cartridge at the specified address,
+// reporting in driven which data lines the cartridge drove: none when
+// nothing on the board answers the address.
+func (c *Cartridge) ReadPRGPartial(address uint16) (data, driven uint8) {
+	data, ok := c.mapper.ReadPRG(address)
+	if !ok {
+		return 0, 0
+	}
+	return data, 0xFF
+}
+
+// WritePRGByte writes a byte to the cartridge at the specified address.
 func (c *Cartridge) WritePRGByte(address uint16, data uint8) {
-	// Implement PRG ROM write logic here
+	c.mapper.WritePRG(address, data)
+}
+
+// PRGBank reports which PRG bank is mapped at the specified CPU address, and
+// whether that address is bank-switched at all.
+func (c *Cartridge) PRGBank(address uint16) (int, bool) {
+	return c.mapper.PRGBank(address)
+}
+
+// ReadPPUByte reads a byte from the pattern tables or nametables at the
+// specified PPU address.
+func (c *Cartridge) ReadPPUByte(address uint16) uint8 {
+	c.watchA12(address)
+	if address&0x3FFF < 0x2000 {
+		return c.mapper.ReadCHR(address & 0x1FFF)
+	}
+	return c.mapper.ReadNametable(address)
+}
+
+// WritePPUByte writes a byte to the pattern tables or nametables at the
+// specified PPU address.
+func (c *Cartridge) WritePPUByte(address uint16, data uint8) {
+	c.watchA12(address)
+	if address&0x3FFF < 0x2000 {
+		c.mapper.WriteCHR(address&0x1FFF, data)
+		return
+	}
+	c.mapper.WriteNametable(address, data)
+}
+
+// watchA12 tracks PPU address line A12 and tells the mapper about filtered
+// rising edges.
+func (c *Cartridge) watchA12(address uint16) {
+	high := address&0x1000 != 0
+	switch {
+	case high && !c.a12:
+		if c.cycles-c.a12Low >= a12FilterCycles {
+			c.mapper.OnA12Rise()
+		}
+	case !high && c.a12:
+		c.a12Low = c.cycles
+	}
+	c.a12 = high
+}
+
+// Step advances the cartridge by one CPU cycle.
+func (c *Cartridge) Step() {
+	c.cycles++
+	c.mapper.StepCPU()
+}
+
+// StartScanline is called by the PPU at the start of every scanline.
+func (c *Cartridge) StartScanline(scanline int, rendering bool) {
+	c.mapper.StartScanline(scanline, rendering)
+}
+
+// SpriteFetches is called by the PPU around its sprite pattern fetches.
+func (c *Cartridge) SpriteFetches(active bool) {
+	c.mapper.SpriteFetches(active)
+}
+
+// SnoopWrite passes a CPU write to the PPU registers to the mapper.
+func (c *Cartridge) SnoopWrite(address uint16, data uint8) {
+	c.mapper.SnoopWrite(address, data)
+}
+
+// AudioOutput returns the current level of the cartridge's expansion sound.
+func (c *Cartridge) AudioOutput() float32 {
+	return c.mapper.AudioOutput()
+}
+
+// IRQ reports whether the cartridge is asserting the CPU's IRQ line.
+func (c *Cartridge) IRQ() bool {
+	return c.mapper.IRQ()
+}
+
+// stateFields lists the cartridge state captured in save states.
+func (c *Cartridge) stateFields() []interface{} {
+	fields := []interface{}{&c.cycles, &c.a12, &c.a12Low}
+	return append(fields, c.mapper.stateFields()...)
+}
+
+// Save writes the cartridge's RAM and mapper state to encoder.
+func (c *Cartridge) Save(encoder *gob.Encoder) error {
+	return savestate.Encode(encoder, c.stateFields()...)
+}
+
+// Load restores cartridge state written by Save.
+func (c *Cartridge) Load(decoder *gob.Decoder) error {
+	return savestate.Decode(decoder, c.stateFields()...)
 }
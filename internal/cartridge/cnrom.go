@@ -0,0 +1,31 @@
+package cartridge
+
+func init() {
+	registerMapper(3, newCNROM)
+}
+
+// cnrom is mapper 3: fixed PRG and a switchable 8 KiB CHR bank, selected by
+// writing anywhere in $8000-$FFFF.
+type cnrom struct {
+	*board
+	busConflicts bool
+}
+
+func newCNROM(b *board) Mapper {
+	return &cnrom{
+		board: b,
+		// Submapper 1 declares a board without bus conflicts.
+		busConflicts: b.header.Submapper != 1,
+	}
+}
+
+func (m *cnrom) WritePRG(address uint16, data uint8) {
+	if address < 0x8000 {
+		m.board.WritePRG(address, data)
+		return
+	}
+	if m.busConflicts {
+		data = m.busConflict(address, data)
+	}
+	m.setCHRBank(0, 0x2000, int(data))
+}
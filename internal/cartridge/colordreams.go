@@ -0,0 +1,28 @@
+package cartridge
+
+func init() {
+	registerMapper(11, newColorDreams)
+}
+
+// colorDreams is mapper 11, the unlicensed Color Dreams board: a switchable
+// 32 KiB PRG bank and a switchable 8 KiB CHR bank, selected by writing
+// $8000-$FFFF (CCCC--PP). The board has bus conflicts.
+type colorDreams struct {
+	*board
+}
+
+func newColorDreams(b *board) Mapper {
+	m := &colorDreams{b}
+	m.setPRGBank(0, 0x8000, 0)
+	return m
+}
+
+func (m *colorDreams) WritePRG(address uint16, data uint8) {
+	if address < 0x8000 {
+		m.board.WritePRG(address, data)
+		return
+	}
+	data = m.busConflict(address, data)
+	m.setPRGBank(0, 0x8000, int(data&0x03))
+	m.setCHRBank(0, 0x2000, int(data>>4))
+}
@@ -0,0 +1,139 @@
+package cartridge
+
+func init() {
+	registerMapper(69, newFME7)
+}
+
+// fme7 is mapper 69, the Sunsoft FME-7 and its 5A and 5B versions: sixteen
+// registers written through a command port at $8000 and a parameter port
+// at $A000, ROM or RAM banked at $6000, a CPU cycle IRQ counter and, on the
+// 5B, a three-channel sound generator derived from the AY-3-8910.
+type fme7 struct {
+	*board
+
+	command   uint8
+	chrRegs   [8]uint8
+	prgRegs   [3]uint8
+	lowBank   uint8
+	mirroring uint8
+
+	irqEnabled     bool
+	counterEnabled bool
+	counter        uint16
+	irqPending     bool
+
+	audio sunsoft5B
+}
+
+// Fields of the $6000 bank register.
+const (
+	fme7RAMSelect = 0x40
+	fme7RAMEnable = 0x80
+)
+
+func newFME7(b *board) Mapper {
+	m := &fme7{board: b}
+	m.audio.reset()
+	m.updateBanks()
+	return m
+}
+
+func (m *fme7) ReadPRG(address uint16) (uint8, bool) {
+	if address >= 0x6000 && address < 0x8000 {
+		switch {
+		case m.lowBank&fme7RAMSelect == 0:
+			offset := bankOffset(m.prg, prgWindow, int(m.lowBank&0x3F))
+			return m.prg[(offset+int(address)%prgWindow)%len(m.prg)], true
+		case m.lowBank&fme7RAMEnable == 0:
+			return 0, false
+		}
+	}
+	return m.board.ReadPRG(address)
+}
+
+func (m *fme7) WritePRG(address uint16, data uint8) {
+	switch {
+	case address < 0x8000:
+		if m.lowBank&fme7RAMSelect != 0 {
+			m.board.WritePRG(address, data)
+		}
+	case address < 0xA000:
+		m.command = data & 0x0F
+	case address < 0xC000:
+		m.writeParameter(data)
+	case address < 0xE000:
+		m.audio.writeAddress(data)
+	default:
+		m.audio.writeData(data)
+	}
+}
+
+func (m *fme7) writeParameter(data uint8) {
+	switch command := m.command; {
+	case command < 8:
+		m.chrRegs[command] = data
+	case command == 8:
+		m.lowBank = data
+	case command < 0x0C:
+		m.prgRegs[command-9] = data & 0x3F
+	case command == 0x0C:
+		m.mirroring = data & 3
+	case command == 0x0D:
+		m.irqEnabled = data&0x01 != 0
+		m.counterEnabled = data&0x80 != 0
+		m.irqPending = false
+	case command == 0x0E:
+		m.counter = m.counter&0xFF00 | uint16(data)
+	case command == 0x0F:
+		m.counter = m.counter&0x00FF | uint16(data)<<8
+	}
+	m.updateBanks()
+}
+
+// updateBanks rebuilds the bank tables from the registers.
+func (m *fme7) updateBanks() {
+	for window, bank := range m.chrRegs {
+		m.setCHRBank(window, chrWindow, int(bank))
+	}
+	for slot, bank := range m.prgRegs {
+		m.setPRGBank(slot, prgWindow, int(bank))
+	}
+	m.setPRGBank(3, prgWindow, -1)
+	m.setRAMBank(int(m.lowBank & 0x3F))
+	switch m.mirroring {
+	case 0:
+		m.setMirroring(MirrorVertical)
+	case 1:
+		m.setMirroring(MirrorHorizontal)
+	case 2:
+		m.setMirroring(MirrorSingleLower)
+	case 3:
+		m.setMirroring(MirrorSingleUpper)
+	}
+	m.ramDisabled = m.lowBank&fme7RAMEnable == 0
+}
+
+func (m *fme7) StepCPU() {
+	if m.counterEnabled {
+		m.counter--
+		if m.counter == 0xFFFF && m.irqEnabled {
+			m.irqPending = true
+		}
+	}
+	m.audio.step()
+}
+
+func (m *fme7) IRQ() bool {
+	return m.irqPending
+}
+
+func (m *fme7) AudioOutput() float32 {
+	return m.audio.output()
+}
+
+func (m *fme7) stateFields() []interface{} {
+	fields := append(m.board.stateFields(),
+		&m.command, &m.chrRegs, &m.prgRegs, &m.lowBank, &m.mirroring,
+		&m.irqEnabled, &m.counterEnabled, &m.counter, &m.irqPending)
+	return append(fields, m.audio.stateFields()...)
+}
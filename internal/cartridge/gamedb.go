@@ -0,0 +1,240 @@
+package cartridge
+
+import (
+	"bytes"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// embeddedDatabase is the game database built into the emulator. It is
+// regenerated from the full NES 2.0 database, saved as nes20db-full.xml, by
+// go generate.
+//
+//go:generate go run gendb.go -in nes20db-full.xml -out nes20db.xml
+//go:embed nes20db.xml
+var embeddedDatabase []byte
+
+// GameInfo is what a Database knows about one ROM image.
+type GameInfo struct {
+	// Name is the game's name, taken from the comment that precedes its
+	// ROM hashes in the database; it may be empty.
+	Name string
+	// Header is the correct header for the image.
+	Header Header
+}
+
+// Database maps the hashes of ROM images to corrected headers. Images are
+// identified by the CRC32 of PRG ROM followed by CHR ROM, confirmed by the
+// size and, when the database has it, the SHA-1.
+type Database struct {
+	games map[uint32][]dbGame
+}
+
+type dbGame struct {
+	size int
+	sha1 string
+	info GameInfo
+}
+
+// nes20DB mirrors the elements of the NES 2.0 XML database that are used.
+type nes20DB struct {
+	Games []struct {
+		Comment string `xml:",comment"`
+		ROM     struct {
+			Size  int    `xml:"size,attr"`
+			CRC32 string `xml:"crc32,attr"`
+			SHA1  string `xml:"sha1,attr"`
+		} `xml:"rom"`
+		PRGROM   dbSize  `xml:"prgrom"`
+		CHRROM   dbSize  `xml:"chrrom"`
+		PRGRAM   dbSize  `xml:"prgram"`
+		PRGNVRAM dbSize  `xml:"prgnvram"`
+		CHRRAM   dbSize  `xml:"chrram"`
+		CHRNVRAM dbSize  `xml:"chrnvram"`
+		Trainer  *dbSize `xml:"trainer"`
+		MiscROM  *struct {
+			Number int `xml:"number,attr"`
+		} `xml:"miscrom"`
+		PCB struct {
+			Mapper    int    `xml:"mapper,attr"`
+			Submapper int    `xml:"submapper,attr"`
+			Mirroring string `xml:"mirroring,attr"`
+			Battery   int    `xml:"battery,attr"`
+		} `xml:"pcb"`
+		Console struct {
+			Type   int `xml:"type,attr"`
+			Region int `xml:"region,attr"`
+		} `xml:"console"`
+		Vs struct {
+			Hardware int `xml:"hardware,attr"`
+			PPU      int `xml:"ppu,attr"`
+		} `xml:"vs"`
+		Expansion struct {
+			Type int `xml:"type,attr"`
+		} `xml:"expansion"`
+	} `xml:"game"`
+}
+
+type dbSize struct {
+	Size int `xml:"size,attr"`
+}
+
+// ParseDatabase reads a game database in the NES 2.0 XML database format.
+func ParseDatabase(r io.Reader) (*Database, error) {
+	var doc nes20DB
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("cartridge: game database: %w", err)
+	}
+	db := &Database{games: make(map[uint32][]dbGame)}
+	for i, game := range doc.Games {
+		crc, err := strconv.ParseUint(game.ROM.CRC32, 16, 32)
+		if err != nil {
+			return nil, fmt.Errorf("cartridge: game database: game %d: bad crc32 %q", i+1, game.ROM.CRC32)
+		}
+		header := Header{
+			Format:       FormatNES20,
+			PRGROMSize:   game.PRGROM.Size,
+			CHRROMSize:   game.CHRROM.Size,
+			PRGRAMSize:   game.PRGRAM.Size,
+			PRGNVRAMSize: game.PRGNVRAM.Size,
+			CHRRAMSize:   game.CHRRAM.Size,
+			CHRNVRAMSize: game.CHRNVRAM.Size,
+			Mapper:       game.PCB.Mapper,
+			Submapper:    game.PCB.Submapper,
+			Battery:      game.PCB.Battery != 0,
+			Trainer:      game.Trainer != nil,
+
+			Timing:          Timing(game.Console.Region & 3),
+			ConsoleType:     ConsoleType(game.Console.Type),
+			VsPPUType:       game.Vs.PPU,
+			VsHardwareType:  game.Vs.Hardware,
+			ExpansionDevice: game.Expansion.Type,
+		}
+		// The database numbers extended console types on from
+		// ConsoleExtended, as the NES 2.0 header's byte 13 does.
+		if header.ConsoleType >= ConsoleExtended {
+			header.ConsoleType = ConsoleExtended
+			header.ExtendedConsoleType = game.Console.Type
+		}
+		if game.MiscROM != nil {
+			header.MiscROMs = game.MiscROM.Number
+		}
+		switch game.PCB.Mirroring {
+		case "V":
+			header.Mirroring = MirrorVertical
+		case "4":
+			header.Mirroring = MirrorFourScreen
+			header.FourScreen = true
+		default:
+			header.Mirroring = MirrorHorizontal
+		}
+		db.games[uint32(crc)] = append(db.games[uint32(crc)], dbGame{
+			size: game.ROM.Size,
+			sha1: strings.ToLower(game.ROM.SHA1),
+			info: GameInfo{Name: strings.TrimSpace(game.Comment), Header: header},
+		})
+	}
+	return db, nil
+}
+
+var (
+	defaultDatabase     *Database
+	defaultDatabaseErr  error
+	defaultDatabaseOnce sync.Once
+)
+
+// DefaultDatabase returns the game database built into the emulator.
+func DefaultDatabase() (*Database, error) {
+	defaultDatabaseOnce.Do(func() {
+		defaultDatabase, defaultDatabaseErr = ParseDatabase(bytes.NewReader(embeddedDatabase))
+	})
+	return defaultDatabase, defaultDatabaseErr
+}
+
+// Len returns the number of images in the database.
+func (d *Database) Len() int {
+	n := 0
+	for _, games := range d.games {
+		n += len(games)
+	}
+	return n
+}
+
+// Lookup finds the image made of prg followed by chr.
+func (d *Database) Lookup(prg, chr []uint8) (GameInfo, bool) {
+	crc := crc32.Update(crc32.ChecksumIEEE(prg), crc32.IEEETable, chr)
+	var sum string
+	for _, game := range d.games[crc] {
+		if game.size != len(prg)+len(chr) {
+			continue
+		}
+		if game.sha1 != "" {
+			if sum == "" {
+				hash := sha1.New()
+				hash.Write(prg)
+				hash.Write(chr)
+				sum = hex.EncodeToString(hash.Sum(nil))
+			}
+			if game.sha1 != sum {
+				continue
+			}
+		}
+		return game.info, true
+	}
+	return GameInfo{}, false
+}
+
+// correctHeader replaces the fields of header that the database records
+// with the database's values, returning a description of each change.
+// Fields an iNES 1.0 header cannot express, such as the submapper or the
+// exact RAM sizes, are replaced without being described as corrections.
+func correctHeader(header *Header, correct Header) []string {
+	var changes []string
+	note := func(field string, from, to interface{}) {
+		if from != to {
+			changes = append(changes, fmt.Sprintf("%s %v -> %v", field, from, to))
+		}
+	}
+	note("mapper", header.Mapper, correct.Mapper)
+	note("mirroring", header.Mirroring, correct.Mirroring)
+	note("battery", header.Battery, correct.Battery)
+	if header.Format == FormatNES20 {
+		note("submapper", header.Submapper, correct.Submapper)
+		note("PRG RAM", header.PRGRAMSize, correct.PRGRAMSize)
+		note("PRG NVRAM", header.PRGNVRAMSize, correct.PRGNVRAMSize)
+		note("CHR RAM", header.CHRRAMSize, correct.CHRRAMSize)
+		note("CHR NVRAM", header.CHRNVRAMSize, correct.CHRNVRAMSize)
+		note("timing", header.Timing, correct.Timing)
+		note("console type", header.ConsoleType, correct.ConsoleType)
+		note("Vs. PPU", header.VsPPUType, correct.VsPPUType)
+		note("Vs. hardware", header.VsHardwareType, correct.VsHardwareType)
+		note("expansion device", header.ExpansionDevice, correct.ExpansionDevice)
+	} else {
+		// iNES 1.0 has a PAL flag and Vs. System and PlayChoice-10 flags,
+		// but no way to say multi-region, Dendy or an extended console.
+		if correct.Timing == TimingNTSC || correct.Timing == TimingPAL {
+			note("timing", header.Timing, correct.Timing)
+		}
+		if correct.ConsoleType < ConsoleExtended {
+			note("console type", header.ConsoleType, correct.ConsoleType)
+		}
+	}
+
+	// ROM sizes, the trainer and miscellaneous ROMs describe the layout of
+	// the file, which was already read by the original header.
+	correct.Format = header.Format
+	correct.PRGROMSize = header.PRGROMSize
+	correct.CHRROMSize = header.CHRROMSize
+	correct.Trainer = header.Trainer
+	correct.MiscROMs = header.MiscROMs
+	*header = correct
+	return changes
+}
@@ -0,0 +1,206 @@
+package cartridge
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"strings"
+	"testing"
+)
+
+// testImage is a CNROM-sized image whose header wrongly says mapper 0 with
+// horizontal mirroring.
+var testImage = image(header(2, 1), 0x8000, 0x2000)
+
+// romHashes returns the CRC32 and SHA-1 of the ROM data of an image as the
+// database writes them.
+func romHashes(data []byte) (crc, sum string) {
+	rom := data[HeaderSize:]
+	hash := sha1.Sum(rom)
+	return fmt.Sprintf("%08X", crc32.ChecksumIEEE(rom)), strings.ToUpper(hex.EncodeToString(hash[:]))
+}
+
+// parseTestDatabase parses a database holding games.
+func parseTestDatabase(t *testing.T, games ...string) *Database {
+	t.Helper()
+	db, err := ParseDatabase(strings.NewReader("<nes20db>" + strings.Join(games, "") + "</nes20db>"))
+	if err != nil {
+		t.Fatalf("ParseDatabase: %v", err)
+	}
+	return db
+}
+
+func TestParseDatabase(t *testing.T) {
+	crc, sum := romHashes(testImage)
+	db := parseTestDatabase(t, `<game>
+		<!-- Extended Test -->
+		<rom size="40960" crc32="`+crc+`" sha1="`+sum+`"/>
+		<prgrom size="32768"/>
+		<chrrom size="8192"/>
+		<prgnvram size="8192"/>
+		<trainer size="512"/>
+		<miscrom number="1"/>
+		<pcb mapper="3" submapper="1" mirroring="4" battery="1"/>
+		<console type="5" region="1"/>
+		<expansion type="2"/>
+	</game>`)
+	if db.Len() != 1 {
+		t.Fatalf("Len = %d, want 1", db.Len())
+	}
+	game, ok := db.Lookup(testImage[HeaderSize:HeaderSize+0x8000], testImage[HeaderSize+0x8000:])
+	if !ok {
+		t.Fatal("Lookup did not find the image")
+	}
+	want := GameInfo{
+		Name: "Extended Test",
+		Header: Header{
+			Format: FormatNES20, PRGROMSize: 0x8000, CHRROMSize: 0x2000,
+			PRGNVRAMSize: 0x2000, Mapper: 3, Submapper: 1,
+			Mirroring: MirrorFourScreen, FourScreen: true, Battery: true,
+			Trainer: true, MiscROMs: 1, Timing: TimingPAL,
+			ConsoleType: ConsoleExtended, ExtendedConsoleType: 5,
+			ExpansionDevice: 2,
+		},
+	}
+	if game != want {
+		t.Errorf("Lookup =\n%+v\nwant\n%+v", game, want)
+	}
+}
+
+func TestParseDatabaseConsoleType(t *testing.T) {
+	for _, tt := range []struct {
+		typ      int
+		console  ConsoleType
+		extended int
+	}{
+		{0, ConsoleNES, 0},
+		{1, ConsoleVsSystem, 0},
+		{2, ConsolePlayChoice10, 0},
+		{3, ConsoleExtended, 3},
+		{7, ConsoleExtended, 7},
+	} {
+		db := parseTestDatabase(t, fmt.Sprintf(`<game><rom size="1" crc32="1"/><console type="%d"/></game>`, tt.typ))
+		game := db.games[1][0].info.Header
+		if game.ConsoleType != tt.console || game.ExtendedConsoleType != tt.extended {
+			t.Errorf("type %d: console %v, extended %d; want %v, %d",
+				tt.typ, game.ConsoleType, game.ExtendedConsoleType, tt.console, tt.extended)
+		}
+	}
+}
+
+func TestParseDatabaseErrors(t *testing.T) {
+	for _, doc := range []string{
+		`<nes20db><game><rom size="1" crc32="xyz"/></game></nes20db>`,
+		`<nes20db><game>`,
+	} {
+		if _, err := ParseDatabase(strings.NewReader(doc)); err == nil {
+			t.Errorf("ParseDatabase(%q) succeeded", doc)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	crc, sum := romHashes(testImage)
+	prg, chr := testImage[HeaderSize:HeaderSize+0x8000], testImage[HeaderSize+0x8000:]
+	tests := []struct {
+		name string
+		rom  string
+		want bool
+	}{
+		{"CRC and SHA-1", `size="40960" crc32="` + crc + `" sha1="` + sum + `"`, true},
+		{"CRC only", `size="40960" crc32="` + crc + `"`, true},
+		{"wrong size", `size="40961" crc32="` + crc + `"`, false},
+		{"wrong SHA-1", `size="40960" crc32="` + crc + `" sha1="` + strings.Repeat("0", 40) + `"`, false},
+		{"wrong CRC", `size="40960" crc32="00000000"`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := parseTestDatabase(t, `<game><rom `+tt.rom+`/><pcb mapper="3"/></game>`)
+			if _, ok := db.Lookup(prg, chr); ok != tt.want {
+				t.Errorf("Lookup found = %v, want %v", ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestDatabaseCorrectsHeader(t *testing.T) {
+	crc, sum := romHashes(testImage)
+	db := parseTestDatabase(t, `<game>
+		<!-- Test Game -->
+		<rom size="40960" crc32="`+crc+`" sha1="`+sum+`"/>
+		<pcb mapper="3" mirroring="V"/>
+	</game>`)
+
+	cart, err := ParseWithOptions(testImage, LoadOptions{Database: db})
+	if err != nil {
+		t.Fatalf("ParseWithOptions: %v", err)
+	}
+	header := cart.Header()
+	if header.Mapper != 3 || header.Mirroring != MirrorVertical {
+		t.Errorf("mapper %d, mirroring %v; want 3, %v", header.Mapper, header.Mirroring, MirrorVertical)
+	}
+	if header.PRGROMSize != 0x8000 || header.CHRROMSize != 0x2000 || header.Format != FormatINES {
+		t.Errorf("layout changed: %+v", header)
+	}
+	if cart.GameName() != "Test Game" {
+		t.Errorf("GameName = %q, want %q", cart.GameName(), "Test Game")
+	}
+	corrections := strings.Join(cart.Corrections(), "; ")
+	for _, want := range []string{"mapper 0 -> 3", "mirroring"} {
+		if !strings.Contains(corrections, want) {
+			t.Errorf("Corrections %q lack %q", corrections, want)
+		}
+	}
+
+	cart, err = ParseWithOptions(testImage, LoadOptions{Database: db, DisableDatabase: true})
+	if err != nil {
+		t.Fatalf("ParseWithOptions: %v", err)
+	}
+	if cart.Header().Mapper != 0 || cart.Corrections() != nil {
+		t.Errorf("DisableDatabase: mapper %d, corrections %q", cart.Header().Mapper, cart.Corrections())
+	}
+}
+
+func TestDatabaseCorrectionsINES(t *testing.T) {
+	crc, sum := romHashes(testImage)
+	db := parseTestDatabase(t, `<game>
+		<rom size="40960" crc32="`+crc+`" sha1="`+sum+`"/>
+		<pcb mapper="0" submapper="1" mirroring="H"/>
+		<expansion type="1"/>
+	</game>`)
+
+	cart, err := ParseWithOptions(testImage, LoadOptions{Database: db})
+	if err != nil {
+		t.Fatalf("ParseWithOptions: %v", err)
+	}
+	if header := cart.Header(); header.ExpansionDevice != 1 || header.Submapper != 1 || header.PRGRAMSize != 0 {
+		t.Errorf("header not corrected: %+v", header)
+	}
+	if corrections := cart.Corrections(); corrections != nil {
+		t.Errorf("Corrections = %q for fields iNES cannot express", corrections)
+	}
+
+	nes20 := append([]byte(nil), testImage...)
+	nes20[7] |= 0x08
+	cart, err = ParseWithOptions(nes20, LoadOptions{Database: db})
+	if err != nil {
+		t.Fatalf("ParseWithOptions: %v", err)
+	}
+	corrections := strings.Join(cart.Corrections(), "; ")
+	for _, want := range []string{"submapper 0 -> 1", "expansion device 0 -> 1"} {
+		if !strings.Contains(corrections, want) {
+			t.Errorf("NES 2.0 corrections %q lack %q", corrections, want)
+		}
+	}
+}
+
+func TestDefaultDatabase(t *testing.T) {
+	db, err := DefaultDatabase()
+	if err != nil {
+		t.Fatalf("DefaultDatabase: %v", err)
+	}
+	if db.Len() == 0 {
+		t.Error("the built-in database is empty")
+	}
+}
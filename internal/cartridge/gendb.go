@@ -0,0 +1,110 @@
+//go:build ignore
+
+// Gendb writes the part of a full NES 2.0 XML database that the emulator
+// embeds: the games whose correct header cannot be written as iNES 1.0, and
+// so are the ones found with wrong headers in the wild.
+//
+// Usage:
+//
+//	go run gendb.go -in nes20db-full.xml -out nes20db.xml
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+)
+
+// game mirrors the elements of a database entry that decide whether it is
+// kept.
+type game struct {
+	PRGRAM   size `xml:"prgram"`
+	PRGNVRAM size `xml:"prgnvram"`
+	CHRROM   size `xml:"chrrom"`
+	CHRRAM   size `xml:"chrram"`
+	CHRNVRAM size `xml:"chrnvram"`
+	PCB      struct {
+		Mapper    int `xml:"mapper,attr"`
+		Submapper int `xml:"submapper,attr"`
+	} `xml:"pcb"`
+	Console struct {
+		Type   int `xml:"type,attr"`
+		Region int `xml:"region,attr"`
+	} `xml:"console"`
+}
+
+type size struct {
+	Size int `xml:"size,attr"`
+}
+
+// needsNES20 reports whether an iNES 1.0 header would lose part of g.
+func (g game) needsNES20() bool {
+	const ramBank = 0x2000
+	switch {
+	case g.PCB.Mapper > 255, g.PCB.Submapper != 0:
+		return true
+	case g.PRGRAM.Size%ramBank != 0, g.PRGNVRAM.Size%ramBank != 0:
+		return true
+	case g.PRGRAM.Size != 0 && g.PRGNVRAM.Size != 0:
+		return true
+	case g.CHRNVRAM.Size != 0:
+		return true
+	case g.CHRROM.Size == 0 && g.CHRRAM.Size != ramBank:
+		return true
+	case g.CHRROM.Size != 0 && g.CHRRAM.Size != 0:
+		return true
+	case g.Console.Type != 0 || g.Console.Region > 1:
+		return true
+	}
+	return false
+}
+
+var gamePattern = regexp.MustCompile(`(?s)[ \t]*<game>.*?</game>\n?`)
+
+func main() {
+	in := flag.String("in", "", "full `database` to read")
+	out := flag.String("out", "nes20db.xml", "`file` to write the subset to")
+	flag.Parse()
+	if *in == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	data, err := os.ReadFile(*in)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var buf bytes.Buffer
+	buf.WriteString(header)
+	kept, total := 0, 0
+	for _, entry := range gamePattern.FindAll(data, -1) {
+		total++
+		var g game
+		if err := xml.Unmarshal(entry, &g); err != nil {
+			log.Fatalf("game %d: %v", total, err)
+		}
+		if g.needsNES20() {
+			buf.Write(entry)
+			kept++
+		}
+	}
+	buf.WriteString("</nes20db>\n")
+	if err := os.WriteFile(*out, buf.Bytes(), 0o644); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("kept %d of %d games\n", kept, total)
+}
+
+const header = `<?xml version="1.0" encoding="UTF-8"?>
+<!--
+	Game database in the NES 2.0 XML database format (nes20db.xml). Each
+	<game> is keyed by the <rom> element: the size, CRC32 and SHA-1 of PRG
+	ROM followed by CHR ROM. Generated by gendb.go from the full database,
+	keeping the games whose header cannot be written as iNES 1.0.
+-->
+<nes20db>
+`
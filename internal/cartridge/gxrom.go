@@ -0,0 +1,27 @@
+package cartridge
+
+func init() {
+	registerMapper(66, newGxROM)
+}
+
+// gxrom is mapper 66: a switchable 32 KiB PRG bank and a switchable 8 KiB
+// CHR bank, both selected by writing $8000-$FFFF (--PP--CC).
+type gxrom struct {
+	*board
+}
+
+func newGxROM(b *board) Mapper {
+	m := &gxrom{b}
+	m.setPRGBank(0, 0x8000, 0)
+	return m
+}
+
+func (m *gxrom) WritePRG(address uint16, data uint8) {
+	if address < 0x8000 {
+		m.board.WritePRG(address, data)
+		return
+	}
+	data = m.busConflict(address, data)
+	m.setPRGBank(0, 0x8000, int(data>>4&0x03))
+	m.setCHRBank(0, 0x2000, int(data&0x03))
+}
@@ -0,0 +1,346 @@
+package cartridge
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// Sizes of the parts of an iNES file.
+const (
+	HeaderSize     = 16
+	TrainerSize    = 512
+	PRGBankSize    = 0x4000
+	CHRBankSize    = 0x2000
+	PRGRAMBankSize = 0x2000
+)
+
+// inesMagic starts every iNES file.
+var inesMagic = []byte("NES\x1A")
+
+// ErrNotINES is returned for files that do not start with the iNES magic number.
+var ErrNotINES = errors.New("cartridge: not an iNES file")
+
+// Flags in byte 6 of the header.
+const (
+	flagVertical   = 1 << 0
+	flagBattery    = 1 << 1
+	flagTrainer    = 1 << 2
+	flagFourScreen = 1 << 3
+)
+
+// Format identifies the header revision a ROM image was written with.
+type Format int
+
+const (
+	// FormatINES is the original iNES header.
+	FormatINES Format = iota
+	// FormatArchaicINES is an iNES header whose bytes 7-15 hold garbage,
+	// typically a ripper's signature such as "DiskDude!". Only the low
+	// nibble of the mapper number is trusted.
+	FormatArchaicINES
+	// FormatNES20 is the NES 2.0 extension of the iNES header.
+	FormatNES20
+)
+
+// Timing is the CPU/PPU timing a game was made for.
+type Timing int
+
+const (
+	TimingNTSC Timing = iota
+	TimingPAL
+	// TimingMultiRegion games run on both NTSC and PAL consoles.
+	TimingMultiRegion
+	TimingDendy
+)
+
+func (t Timing) String() string {
+	switch t {
+	case TimingNTSC:
+		return "NTSC"
+	case TimingPAL:
+		return "PAL"
+	case TimingMultiRegion:
+		return "multi-region"
+	case TimingDendy:
+		return "Dendy"
+	}
+	return fmt.Sprintf("Timing(%d)", int(t))
+}
+
+// ConsoleType is the kind of system a game runs on.
+type ConsoleType int
+
+const (
+	ConsoleNES ConsoleType = iota
+	ConsoleVsSystem
+	ConsolePlayChoice10
+	// ConsoleExtended is described further by Header.ExtendedConsoleType.
+	ConsoleExtended
+)
+
+// Header is the decoded iNES or NES 2.0 header of a ROM image.
+type Header struct {
+	Format Format
+
+	// PRGROMSize and CHRROMSize are the sizes of PRG and CHR ROM in bytes.
+	// A CHRROMSize of zero means the board has CHR RAM instead.
+	PRGROMSize int
+	CHRROMSize int
+	// PRGRAMSize and PRGNVRAMSize are the sizes of volatile and battery
+	// backed work RAM in bytes.
+	PRGRAMSize   int
+	PRGNVRAMSize int
+	// CHRRAMSize and CHRNVRAMSize are the sizes of volatile and battery
+	// backed CHR RAM in bytes.
+	CHRRAMSize   int
+	CHRNVRAMSize int
+
+	Mapper    int
+	Submapper int
+	// Mirroring is the nametable arrangement wired on the board;
+	// MirrorFourScreen when FourScreen is set.
+	Mirroring Mirroring
+	// Battery is set when the board keeps memory alive with a battery.
+	Battery bool
+	// Trainer is set when a 512-byte trainer precedes PRG ROM.
+	Trainer bool
+	// FourScreen is set when the board supplies its own nametable RAM.
+	FourScreen bool
+
+	Timing      Timing
+	ConsoleType ConsoleType
+	// VsPPUType and VsHardwareType describe Vs. System boards; see the
+	// NES 2.0 specification for their values.
+	VsPPUType      int
+	VsHardwareType int
+	// ExtendedConsoleType is set when ConsoleType is ConsoleExtended.
+	ExtendedConsoleType int
+	// MiscROMs is the number of miscellaneous ROMs after CHR ROM.
+	MiscROMs int
+	// ExpansionDevice is the default expansion device, as numbered by the
+	// NES 2.0 specification; 0 is unspecified and 1 is standard controllers.
+	ExpansionDevice int
+}
+
+// ParseHeader decodes the 16-byte header at the start of data. The header
+// is read as NES 2.0 when it is marked as such, and as iNES otherwise.
+func ParseHeader(data []byte) (Header, error) {
+	if len(data) < HeaderSize {
+		if bytes.HasPrefix(inesMagic, data) || bytes.HasPrefix(data, inesMagic) {
+			return Header{}, fmt.Errorf("cartridge: header truncated to %d bytes", len(data))
+		}
+		return Header{}, ErrNotINES
+	}
+	if !bytes.Equal(data[:4], inesMagic) {
+		return Header{}, ErrNotINES
+	}
+
+	flags6 := data[6]
+	header := Header{
+		Mapper:     int(flags6 >> 4),
+		Mirroring:  MirrorHorizontal,
+		Battery:    flags6&flagBattery != 0,
+		Trainer:    flags6&flagTrainer != 0,
+		FourScreen: flags6&flagFourScreen != 0,
+	}
+	if flags6&flagVertical != 0 {
+		header.Mirroring = MirrorVertical
+	}
+	if header.FourScreen {
+		header.Mirroring = MirrorFourScreen
+	}
+
+	var err error
+	switch {
+	case data[7]&0x0C == 0x08:
+		err = header.parseNES20(data)
+	case data[7]&0x0C == 0 && isZero(data[12:16]):
+		header.parseINES(data)
+	default:
+		header.parseArchaicINES(data)
+	}
+	if err != nil {
+		return Header{}, err
+	}
+	if header.PRGROMSize == 0 {
+		return Header{}, errors.New("cartridge: header declares no PRG ROM")
+	}
+	return header, nil
+}
+
+// parseArchaicINES decodes a header whose bytes 7-15 cannot be trusted.
+func (h *Header) parseArchaicINES(data []byte) {
+	h.Format = FormatArchaicINES
+	h.PRGROMSize = int(data[4]) * PRGBankSize
+	h.CHRROMSize = int(data[5]) * CHRBankSize
+	h.setINESRAM(PRGRAMBankSize)
+}
+
+// parseINES decodes the fields of an iNES 1.0 header.
+func (h *Header) parseINES(data []byte) {
+	flags7 := data[7]
+	h.Format = FormatINES
+	h.PRGROMSize = int(data[4]) * PRGBankSize
+	h.CHRROMSize = int(data[5]) * CHRBankSize
+	h.Mapper |= int(flags7 & 0xF0)
+	switch {
+	case flags7&0x01 != 0:
+		h.ConsoleType = ConsoleVsSystem
+	case flags7&0x02 != 0:
+		h.ConsoleType = ConsolePlayChoice10
+	}
+	if data[9]&0x01 != 0 {
+		h.Timing = TimingPAL
+	}
+
+	prgRAM := int(data[8]) * PRGRAMBankSize
+	if prgRAM == 0 {
+		// Zero means 8 KiB, for compatibility with older dumps.
+		prgRAM = PRGRAMBankSize
+	}
+	h.setINESRAM(prgRAM)
+}
+
+// setINESRAM fills in the RAM sizes that iNES leaves implicit: work RAM is
+// battery backed when the battery flag is set, and boards without CHR ROM
+// have 8 KiB of CHR RAM.
+func (h *Header) setINESRAM(prgRAM int) {
+	if h.Battery {
+		h.PRGNVRAMSize = prgRAM
+	} else {
+		h.PRGRAMSize = prgRAM
+	}
+	if h.CHRROMSize == 0 {
+		h.CHRRAMSize = CHRBankSize
+	}
+}
+
+// parseNES20 decodes the fields of a NES 2.0 header.
+func (h *Header) parseNES20(data []byte) error {
+	flags7 := data[7]
+	h.Format = FormatNES20
+	h.Mapper |= int(flags7&0xF0) | int(data[8]&0x0F)<<8
+	h.Submapper = int(data[8] >> 4)
+	h.ConsoleType = ConsoleType(flags7 & 0x03)
+
+	var err error
+	h.PRGROMSize, err = nes20ROMSize(data[4], data[9]&0x0F, PRGBankSize)
+	if err != nil {
+		return fmt.Errorf("cartridge: PRG ROM %w", err)
+	}
+	h.CHRROMSize, err = nes20ROMSize(data[5], data[9]>>4, CHRBankSize)
+	if err != nil {
+		return fmt.Errorf("cartridge: CHR ROM %w", err)
+	}
+
+	h.PRGRAMSize = nes20RAMSize(data[10] & 0x0F)
+	h.PRGNVRAMSize = nes20RAMSize(data[10] >> 4)
+	h.CHRRAMSize = nes20RAMSize(data[11] & 0x0F)
+	h.CHRNVRAMSize = nes20RAMSize(data[11] >> 4)
+
+	h.Timing = Timing(data[12] & 0x03)
+	switch h.ConsoleType {
+	case ConsoleVsSystem:
+		h.VsPPUType = int(data[13] & 0x0F)
+		h.VsHardwareType = int(data[13] >> 4)
+	case ConsoleExtended:
+		h.ExtendedConsoleType = int(data[13] & 0x0F)
+	}
+	h.MiscROMs = int(data[14] & 0x03)
+	h.ExpansionDevice = int(data[15] & 0x3F)
+	return nil
+}
+
+// nes20ROMSize decodes a NES 2.0 ROM size from its least significant byte
+// and most significant nibble. An MSB nibble of $F selects the
+// exponent-multiplier form, 2^E * (MM*2+1) bytes with lsb = EEEEEEMM.
+func nes20ROMSize(lsb, msb uint8, unit int) (int, error) {
+	if msb != 0x0F {
+		return (int(msb)<<8 | int(lsb)) * unit, nil
+	}
+	exponent := lsb >> 2
+	multiplier := int(lsb&0x03)*2 + 1
+	if exponent > 30 {
+		return 0, fmt.Errorf("size 2^%d*%d is too large", exponent, multiplier)
+	}
+	return (1 << exponent) * multiplier, nil
+}
+
+// nes20RAMSize decodes a NES 2.0 RAM shift count: zero means no RAM and
+// otherwise the size is 64 << shift bytes.
+func nes20RAMSize(shift uint8) int {
+	if shift == 0 {
+		return 0
+	}
+	return 64 << shift
+}
+
+func isZero(data []byte) bool {
+	for _, b := range data {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Parse decodes a complete iNES or NES 2.0 image: the header, the optional
+// trainer, PRG ROM, CHR ROM and, for NES 2.0, miscellaneous ROM data. Data
+// after CHR ROM is ignored in iNES images. The header is corrected from the
+// built-in game database.
+func Parse(data []byte) (*Cartridge, error) {
+	return ParseWithOptions(data, LoadOptions{})
+}
+
+// ParseWithOptions is like Parse but applies options.
+func ParseWithOptions(data []byte, options LoadOptions) (*Cartridge, error) {
+	header, err := ParseHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	rest := data[HeaderSize:]
+
+	var trainer []uint8
+	if header.Trainer {
+		if len(rest) < TrainerSize {
+			return nil, fmt.Errorf("cartridge: trainer truncated: want %d bytes, have %d", TrainerSize, len(rest))
+		}
+		trainer, rest = rest[:TrainerSize], rest[TrainerSize:]
+	}
+	if len(rest) < header.PRGROMSize {
+		return nil, fmt.Errorf("cartridge: PRG ROM truncated: want %d bytes, have %d", header.PRGROMSize, len(rest))
+	}
+	prg, rest := rest[:header.PRGROMSize], rest[header.PRGROMSize:]
+	if len(rest) < header.CHRROMSize {
+		return nil, fmt.Errorf("cartridge: CHR ROM truncated: want %d bytes, have %d", header.CHRROMSize, len(rest))
+	}
+	chr, rest := rest[:header.CHRROMSize], rest[header.CHRROMSize:]
+
+	var misc []uint8
+	if header.MiscROMs > 0 {
+		misc = rest
+	}
+
+	var game GameInfo
+	var corrections []string
+	if !options.DisableDatabase {
+		db := options.Database
+		if db == nil {
+			if db, err = DefaultDatabase(); err != nil {
+				return nil, err
+			}
+		}
+		var found bool
+		if game, found = db.Lookup(prg, chr); found {
+			corrections = correctHeader(&header, game.Header)
+		}
+	}
+	cart, err := newCartridge(header, trainer, prg, chr, misc)
+	if err != nil {
+		return nil, err
+	}
+	cart.gameName = game.Name
+	cart.corrections = corrections
+	return cart, nil
+}
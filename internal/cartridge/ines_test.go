@@ -0,0 +1,229 @@
+package cartridge
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// header builds a 16-byte header with the iNES magic and the given bytes
+// 4 onwards.
+func header(fields ...uint8) []byte {
+	h := make([]byte, HeaderSize)
+	copy(h, inesMagic)
+	copy(h[4:], fields)
+	return h
+}
+
+// image appends PRG and CHR ROM of the given sizes to h. Every byte of PRG
+// ROM holds the number of its 8 KiB bank and every byte of CHR ROM the
+// number of its 1 KiB bank, so reads show which bank is mapped.
+func image(h []byte, prgSize, chrSize int) []byte {
+	data := append([]byte(nil), h...)
+	for i := 0; i < prgSize; i++ {
+		data = append(data, uint8(i/0x2000))
+	}
+	for i := 0; i < chrSize; i++ {
+		data = append(data, uint8(i/0x400))
+	}
+	return data
+}
+
+func TestParseHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   []byte
+		want   Header
+		errSub string
+	}{
+		{
+			name: "iNES",
+			data: header(2, 1, 0x43, 0x10, 0, 1),
+			want: Header{
+				Format: FormatINES, PRGROMSize: 0x8000, CHRROMSize: 0x2000,
+				PRGNVRAMSize: 0x2000, Mapper: 0x14, Mirroring: MirrorVertical,
+				Battery: true, Timing: TimingPAL,
+			},
+		},
+		{
+			name: "iNES CHR RAM and PRG RAM count",
+			data: header(1, 0, 0x08, 0x01, 2),
+			want: Header{
+				Format: FormatINES, PRGROMSize: 0x4000, PRGRAMSize: 0x4000,
+				CHRRAMSize: 0x2000, Mirroring: MirrorFourScreen, FourScreen: true,
+				ConsoleType: ConsoleVsSystem,
+			},
+		},
+		{
+			name: "DiskDude! tail",
+			data: append(header(1, 1, 0x11)[:7], "DiskDude!"...),
+			want: Header{
+				Format: FormatArchaicINES, PRGROMSize: 0x4000, CHRROMSize: 0x2000,
+				PRGRAMSize: 0x2000, Mapper: 1, Mirroring: MirrorVertical,
+			},
+		},
+		{
+			name: "garbage in bytes 12-15",
+			data: header(1, 1, 0x40, 0x40, 0, 0, 0, 0, 'a', 'b', 'c', 'd'),
+			want: Header{
+				Format: FormatArchaicINES, PRGROMSize: 0x4000, CHRROMSize: 0x2000,
+				PRGRAMSize: 0x2000, Mapper: 4, Mirroring: MirrorHorizontal,
+			},
+		},
+		{
+			name: "NES 2.0",
+			data: header(0x02, 0x01, 0x12, 0x1B, 0x51, 0x21, 0x70, 0x07, 0x03, 0x02, 0x01, 0x05),
+			want: Header{
+				Format: FormatNES20, PRGROMSize: 0x102 * PRGBankSize, CHRROMSize: 0x201 * CHRBankSize,
+				PRGRAMSize: 0, PRGNVRAMSize: 0x2000, CHRRAMSize: 0x2000,
+				Mapper: 0x111, Submapper: 5, Mirroring: MirrorHorizontal,
+				Trainer: false, Battery: true, Timing: TimingDendy,
+				ConsoleType: ConsoleExtended, ExtendedConsoleType: 2, MiscROMs: 1,
+				ExpansionDevice: 5,
+			},
+		},
+		{
+			name: "NES 2.0 RAM shift counts",
+			data: header(1, 0, 0, 0x08, 0, 0, 0x91, 0x0C),
+			want: Header{
+				Format: FormatNES20, PRGROMSize: 0x4000,
+				PRGRAMSize: 128, PRGNVRAMSize: 0x8000, CHRRAMSize: 0x40000,
+				Mirroring: MirrorHorizontal,
+			},
+		},
+		{
+			name: "NES 2.0 exponent-multiplier PRG",
+			data: header(0x4E, 0, 0, 0x08, 0, 0x0F),
+			// 2^19 * (2*2+1)
+			want: Header{Format: FormatNES20, PRGROMSize: 5 << 19, Mirroring: MirrorHorizontal},
+		},
+		{
+			name: "NES 2.0 exponent-multiplier CHR",
+			data: header(1, 0x29, 0, 0x08, 0, 0xF0),
+			// 2^10 * (1*2+1)
+			want: Header{Format: FormatNES20, PRGROMSize: 0x4000, CHRROMSize: 3 << 10, Mirroring: MirrorHorizontal},
+		},
+		{
+			name:   "NES 2.0 exponent too large",
+			data:   header(0xFC, 0, 0, 0x08, 0, 0x0F),
+			errSub: "PRG ROM size 2^63",
+		},
+		{
+			name:   "no PRG ROM",
+			data:   header(0, 1),
+			errSub: "no PRG ROM",
+		},
+		{
+			name:   "truncated header",
+			data:   []byte("NES\x1A\x01"),
+			errSub: "header truncated",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseHeader(test.data)
+			if test.errSub != "" {
+				if err == nil || !strings.Contains(err.Error(), test.errSub) {
+					t.Fatalf("err = %v, want one containing %q", err, test.errSub)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("header = %+v\nwant     %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseHeaderNotINES(t *testing.T) {
+	for _, data := range [][]byte{[]byte("PK\x03\x04"), []byte("NOT AN INES FILE")} {
+		if _, err := ParseHeader(data); !errors.Is(err, ErrNotINES) {
+			t.Errorf("ParseHeader(%q) err = %v, want ErrNotINES", data, err)
+		}
+	}
+}
+
+func TestParseTruncated(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   []byte
+		errSub string
+	}{
+		{
+			name:   "PRG ROM",
+			data:   image(header(2, 1), 0x6000, 0),
+			errSub: "PRG ROM truncated: want 32768 bytes, have 24576",
+		},
+		{
+			name:   "CHR ROM",
+			data:   image(header(1, 2), 0x4000, 0x3000),
+			errSub: "CHR ROM truncated: want 16384 bytes, have 12288",
+		},
+		{
+			name:   "trainer",
+			data:   append(header(1, 0, flagTrainer), make([]byte, 100)...),
+			errSub: "trainer truncated: want 512 bytes, have 100",
+		},
+		{
+			name:   "PRG ROM after trainer",
+			data:   image(append(header(1, 0, flagTrainer), make([]byte, TrainerSize)...), 0x2000, 0),
+			errSub: "PRG ROM truncated: want 16384 bytes, have 8192",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseWithOptions(test.data, LoadOptions{DisableDatabase: true})
+			if err == nil || !strings.Contains(err.Error(), test.errSub) {
+				t.Errorf("err = %v, want one containing %q", err, test.errSub)
+			}
+		})
+	}
+}
+
+func TestParseTrainerAndTail(t *testing.T) {
+	trainer := make([]byte, TrainerSize)
+	trainer[0], trainer[TrainerSize-1] = 0xAA, 0xBB
+	data := image(append(header(1, 1, flagTrainer), trainer...), 0x4000, 0x2000)
+	// iNES images often carry junk after CHR ROM; it is ignored.
+	data = append(data, "junk"...)
+	cart, err := ParseWithOptions(data, LoadOptions{DisableDatabase: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cart.Trainer(); len(got) != TrainerSize || got[0] != 0xAA || got[TrainerSize-1] != 0xBB {
+		t.Errorf("trainer not split off the image")
+	}
+	if got := cart.ReadPRGByte(0x8000); got != 0 {
+		t.Errorf("PRG ROM starts with $%02X, want $00", got)
+	}
+	if got := cart.ReadPRGByte(0xBFFF); got != 1 {
+		t.Errorf("PRG ROM ends with $%02X, want $01", got)
+	}
+	if cart.MiscROM() != nil {
+		t.Errorf("iNES tail kept as miscellaneous ROM")
+	}
+}
+
+func TestTrainerWithoutWorkRAM(t *testing.T) {
+	trainer := make([]byte, TrainerSize)
+	trainer[0], trainer[TrainerSize-1] = 0xAA, 0xBB
+	// A NES 2.0 header that declares no work RAM.
+	data := image(append(header(1, 1, flagTrainer, 0x08), trainer...), 0x4000, 0x2000)
+	cart, err := ParseWithOptions(data, LoadOptions{DisableDatabase: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cart.PowerOn(func(buf []uint8) {
+		for i := range buf {
+			buf[i] = 0xFF
+		}
+	})
+	for address, want := range map[uint16]uint8{0x6FFF: 0xFF, 0x7000: 0xAA, 0x71FF: 0xBB, 0x7200: 0xFF} {
+		if got := cart.ReadPRGByte(address); got != want {
+			t.Errorf("$%04X = $%02X, want $%02X", address, got, want)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package cartridge
+
+func init() {
+	registerMapper(32, newIremG101)
+}
+
+// iremG101 is mapper 32, the Irem G-101: two switchable 8 KiB PRG banks,
+// one of which can be swapped with the fixed second-to-last bank, eight
+// 1 KiB CHR banks and mirroring control. The board used by Major League
+// (submapper 1) wires single-screen mirroring and has no PRG mode.
+type iremG101 struct {
+	*board
+
+	prgRegs [2]uint8
+	prgMode bool
+	chrRegs [8]uint8
+}
+
+func newIremG101(b *board) Mapper {
+	m := &iremG101{board: b}
+	if b.header.Submapper == 1 {
+		m.setMirroring(MirrorSingleLower)
+	}
+	m.updateBanks()
+	return m
+}
+
+func (m *iremG101) WritePRG(address uint16, data uint8) {
+	switch address & 0xF000 {
+	case 0x8000:
+		m.prgRegs[0] = data & 0x1F
+	case 0x9000:
+		if m.header.Submapper == 1 {
+			break
+		}
+		m.prgMode = data&0x02 != 0
+		if data&0x01 == 0 {
+			m.setMirroring(MirrorVertical)
+		} else {
+			m.setMirroring(MirrorHorizontal)
+		}
+	case 0xA000:
+		m.prgRegs[1] = data & 0x1F
+	case 0xB000:
+		m.chrRegs[address&0x07] = data
+	default:
+		if address < 0x8000 {
+			m.board.WritePRG(address, data)
+		}
+		return
+	}
+	m.updateBanks()
+}
+
+func (m *iremG101) updateBanks() {
+	if m.prgMode {
+		m.setPRGBank(0, prgWindow, -2)
+		m.setPRGBank(2, prgWindow, int(m.prgRegs[0]))
+	} else {
+		m.setPRGBank(0, prgWindow, int(m.prgRegs[0]))
+		m.setPRGBank(2, prgWindow, -2)
+	}
+	m.setPRGBank(1, prgWindow, int(m.prgRegs[1]))
+	m.setPRGBank(3, prgWindow, -1)
+	for window, bank := range m.chrRegs {
+		m.setCHRBank(window, chrWindow, int(bank))
+	}
+}
+
+func (m *iremG101) stateFields() []interface{} {
+	return append(m.board.stateFields(), &m.prgRegs, &m.prgMode, &m.chrRegs)
+}
@@ -0,0 +1,86 @@
+package cartridge
+
+func init() {
+	registerMapper(65, newIremH3001)
+}
+
+// iremH3001 is mapper 65, the Irem H3001: three switchable 8 KiB PRG banks
+// with the last fixed at $E000, eight 1 KiB CHR banks, mirroring control,
+// and a 16-bit CPU cycle counter that counts down to 0, raises an IRQ and
+// stops there.
+type iremH3001 struct {
+	*board
+
+	irqReload  uint16
+	irqCounter uint16
+	irqEnabled bool
+	irqPending bool
+}
+
+func newIremH3001(b *board) Mapper {
+	m := &iremH3001{board: b}
+	m.setPRGBank(0, prgWindow, 0)
+	m.setPRGBank(1, prgWindow, 1)
+	m.setPRGBank(2, prgWindow, -2)
+	m.setPRGBank(3, prgWindow, -1)
+	return m
+}
+
+func (m *iremH3001) WritePRG(address uint16, data uint8) {
+	switch address & 0xF000 {
+	case 0x8000:
+		m.setPRGBank(0, prgWindow, int(data))
+	case 0x9000:
+		m.writeControl(address&0x07, data)
+	case 0xA000:
+		m.setPRGBank(1, prgWindow, int(data))
+	case 0xB000:
+		m.setCHRBank(int(address&0x07), chrWindow, int(data))
+	case 0xC000:
+		m.setPRGBank(2, prgWindow, int(data))
+	default:
+		if address < 0x8000 {
+			m.board.WritePRG(address, data)
+		}
+	}
+}
+
+func (m *iremH3001) writeControl(register uint16, data uint8) {
+	switch register {
+	case 1:
+		if data&0x80 == 0 {
+			m.setMirroring(MirrorVertical)
+		} else {
+			m.setMirroring(MirrorHorizontal)
+		}
+	case 3:
+		m.irqEnabled = data&0x80 != 0
+		m.irqPending = false
+	case 4:
+		m.irqCounter = m.irqReload
+		m.irqPending = false
+	case 5:
+		m.irqReload = m.irqReload&0x00FF | uint16(data)<<8
+	case 6:
+		m.irqReload = m.irqReload&0xFF00 | uint16(data)
+	}
+}
+
+func (m *iremH3001) StepCPU() {
+	if !m.irqEnabled || m.irqCounter == 0 {
+		return
+	}
+	m.irqCounter--
+	if m.irqCounter == 0 {
+		m.irqPending = true
+	}
+}
+
+func (m *iremH3001) IRQ() bool {
+	return m.irqPending
+}
+
+func (m *iremH3001) stateFields() []interface{} {
+	return append(m.board.stateFields(),
+		&m.irqReload, &m.irqCounter, &m.irqEnabled, &m.irqPending)
+}
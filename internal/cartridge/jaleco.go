@@ -0,0 +1,134 @@
+package cartridge
+
+func init() {
+	registerMapper(18, newJaleco)
+}
+
+// jaleco is mapper 18, the Jaleco SS88006. Its bank registers are written
+// a nibble at a time: three 8 KiB PRG banks with the last fixed at $E000,
+// eight 1 KiB CHR banks, and a CPU cycle IRQ counter whose width can be cut
+// to 12, 8 or 4 bits. The ADPCM sound chip on some boards is not emulated.
+type jaleco struct {
+	*board
+
+	prgRegs    [3]uint8
+	chrRegs    [8]uint8
+	ramControl uint8
+
+	irqReload  uint16
+	irqCounter uint16
+	// irqMask selects the bits of the counter that count.
+	irqMask    uint16
+	irqEnabled bool
+	irqPending bool
+}
+
+func newJaleco(b *board) Mapper {
+	m := &jaleco{board: b, irqMask: 0xFFFF}
+	m.updateBanks()
+	return m
+}
+
+// setNibble writes the low or high nibble of *reg.
+func setNibble(reg *uint8, high bool, data uint8) {
+	if high {
+		*reg = *reg&0x0F | data<<4
+	} else {
+		*reg = *reg&0xF0 | data&0x0F
+	}
+}
+
+func (m *jaleco) WritePRG(address uint16, data uint8) {
+	if address < 0x8000 {
+		m.board.WritePRG(address, data)
+		return
+	}
+	index := int(address & 0x0003)
+	high := index&1 != 0
+	switch address & 0xF000 {
+	case 0x8000:
+		setNibble(&m.prgRegs[index>>1], high, data)
+	case 0x9000:
+		if index < 2 {
+			setNibble(&m.prgRegs[2], high, data)
+		} else if index == 2 {
+			m.ramControl = data
+		}
+	case 0xA000, 0xB000, 0xC000, 0xD000:
+		window := int(address-0xA000)>>12*2 + index>>1
+		setNibble(&m.chrRegs[window], high, data)
+	case 0xE000:
+		shift := uint(index) * 4
+		m.irqReload = m.irqReload&^(0x0F<<shift) | uint16(data&0x0F)<<shift
+	case 0xF000:
+		m.writeControl(index, data)
+	}
+	m.updateBanks()
+}
+
+func (m *jaleco) writeControl(index int, data uint8) {
+	switch index {
+	case 0:
+		m.irqCounter = m.irqReload
+		m.irqPending = false
+	case 1:
+		m.irqEnabled = data&0x01 != 0
+		switch {
+		case data&0x08 != 0:
+			m.irqMask = 0x000F
+		case data&0x04 != 0:
+			m.irqMask = 0x00FF
+		case data&0x02 != 0:
+			m.irqMask = 0x0FFF
+		default:
+			m.irqMask = 0xFFFF
+		}
+		m.irqPending = false
+	case 2:
+		switch data & 0x03 {
+		case 0:
+			m.setMirroring(MirrorHorizontal)
+		case 1:
+			m.setMirroring(MirrorVertical)
+		case 2:
+			m.setMirroring(MirrorSingleLower)
+		case 3:
+			m.setMirroring(MirrorSingleUpper)
+		}
+	}
+}
+
+func (m *jaleco) updateBanks() {
+	for slot, bank := range m.prgRegs {
+		m.setPRGBank(slot, prgWindow, int(bank&0x3F))
+	}
+	m.setPRGBank(3, prgWindow, -1)
+	for window, bank := range m.chrRegs {
+		m.setCHRBank(window, chrWindow, int(bank))
+	}
+	m.ramDisabled = m.ramControl&0x01 == 0
+	m.ramProtected = m.ramControl&0x02 == 0
+}
+
+// StepCPU decrements the counter bits selected by the mask, leaving the
+// others alone, and raises the IRQ when they wrap.
+func (m *jaleco) StepCPU() {
+	if !m.irqEnabled {
+		return
+	}
+	count := m.irqCounter & m.irqMask
+	if count == 0 {
+		m.irqPending = true
+	}
+	m.irqCounter = m.irqCounter&^m.irqMask | (count-1)&m.irqMask
+}
+
+func (m *jaleco) IRQ() bool {
+	return m.irqPending
+}
+
+func (m *jaleco) stateFields() []interface{} {
+	return append(m.board.stateFields(),
+		&m.prgRegs, &m.chrRegs, &m.ramControl,
+		&m.irqReload, &m.irqCounter, &m.irqMask, &m.irqEnabled, &m.irqPending)
+}
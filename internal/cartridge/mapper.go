@@ -0,0 +1,104 @@
+package cartridge
+
+import "fmt"
+
+// Mapper is the logic on a cartridge board that decodes CPU and PPU
+// addresses onto the board's memories. Each mapper lives in its own file
+// and registers itself by iNES mapper number from an init function.
+//
+// Mappers embed *board, which implements every method for a board with
+// fixed banks, and override only what their hardware changes.
+type Mapper interface {
+	// ReadPRG reads from $4020-$FFFF. ok is false when nothing on the
+	// board answers, leaving the CPU data bus floating.
+	ReadPRG(address uint16) (data uint8, ok bool)
+	WritePRG(address uint16, data uint8)
+
+	// ReadCHR and WriteCHR access the pattern tables at $0000-$1FFF.
+	ReadCHR(address uint16) uint8
+	WriteCHR(address uint16, data uint8)
+	// ReadNametable and WriteNametable access $2000-$3EFF.
+	ReadNametable(address uint16) uint8
+	WriteNametable(address uint16, data uint8)
+	// Mirroring returns the current nametable arrangement.
+	Mirroring() Mirroring
+
+	// IRQ reports whether the mapper is asserting the CPU's IRQ line.
+	IRQ() bool
+	// StepCPU is called once per CPU cycle.
+	StepCPU()
+	// OnA12Rise is called when PPU address line A12 rises after having
+	// been low for a few CPU cycles, the edge that scanline counters watch.
+	OnA12Rise()
+	// StartScanline and SpriteFetches follow the progress of rendering;
+	// see ppu.RenderWatcher.
+	StartScanline(scanline int, rendering bool)
+	SpriteFetches(active bool)
+	// SnoopWrite is called for CPU writes to the PPU registers, which some
+	// mappers watch to track the PPU's configuration.
+	SnoopWrite(address uint16, data uint8)
+
+	// AudioOutput returns the level of the mapper's expansion sound, on
+	// the scale used by apu.APU.ConnectExpansion.
+	AudioOutput() float32
+
+	// PRGBank reports which 8 KiB PRG bank is mapped at the CPU address,
+	// and whether that address is bank-switched at all.
+	PRGBank(address uint16) (int, bool)
+
+	// stateFields lists the mapper state captured in save states.
+	stateFields() []interface{}
+}
+
+// mapperFunc creates a mapper in its power-on state for a board.
+type mapperFunc func(b *board) Mapper
+
+// anySubmapper registers a mapper for every submapper of its number.
+const anySubmapper = -1
+
+type mapperKey struct {
+	mapper    int
+	submapper int
+}
+
+var mappers = map[mapperKey]mapperFunc{}
+
+// registerMapper makes newMapper available for every submapper of number.
+func registerMapper(number int, newMapper mapperFunc) {
+	registerSubmapper(number, anySubmapper, newMapper)
+}
+
+// registerSubmapper makes newMapper available for one submapper of number,
+// taking precedence over a mapper registered for all of them.
+func registerSubmapper(number, submapper int, newMapper mapperFunc) {
+	key := mapperKey{number, submapper}
+	if _, ok := mappers[key]; ok {
+		panic(fmt.Sprintf("cartridge: mapper %d.%d registered twice", number, submapper))
+	}
+	mappers[key] = newMapper
+}
+
+// lookupMapper returns the constructor for a mapper and submapper.
+func lookupMapper(number, submapper int) (mapperFunc, error) {
+	if newMapper, ok := mappers[mapperKey{number, submapper}]; ok {
+		return newMapper, nil
+	}
+	if newMapper, ok := mappers[mapperKey{number, anySubmapper}]; ok {
+		return newMapper, nil
+	}
+	return nil, &UnsupportedMapperError{Mapper: number, Submapper: submapper}
+}
+
+// UnsupportedMapperError is returned when loading a ROM whose mapper is not
+// implemented.
+type UnsupportedMapperError struct {
+	Mapper    int
+	Submapper int
+}
+
+func (e *UnsupportedMapperError) Error() string {
+	if e.Submapper != 0 {
+		return fmt.Sprintf("cartridge: mapper %d, submapper %d is not supported", e.Mapper, e.Submapper)
+	}
+	return fmt.Sprintf("cartridge: mapper %d is not supported", e.Mapper)
+}
@@ -0,0 +1,2206 @@
+package cartridge
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// nes20Header builds a NES 2.0 header for the given mapper with PRG and
+// CHR ROM sizes in bytes. Boards without CHR ROM get 8 KiB of CHR RAM, and
+// every board gets 8 KiB of work RAM.
+func nes20Header(mapper, submapper, prgSize, chrSize int) []byte {
+	chrRAM := uint8(0)
+	if chrSize == 0 {
+		chrRAM = 7
+	}
+	return header(
+		uint8(prgSize/PRGBankSize), uint8(chrSize/CHRBankSize),
+		uint8(mapper<<4), uint8(mapper&0xF0)|0x08,
+		uint8(submapper<<4|mapper>>8), 0, 7, chrRAM,
+	)
+}
+
+// write is a CPU write to a mapper register.
+type write struct {
+	address uint16
+	data    uint8
+}
+
+// mapperTest describes a cartridge, writes made to it and the banks and
+// mirroring expected afterwards. prg and chr map addresses to the 8 KiB PRG
+// and 1 KiB CHR bank numbers expected there.
+type mapperTest struct {
+	name      string
+	mapper    int
+	submapper int
+	prgSize   int
+	chrSize   int
+	// patch overwrites bytes of PRG ROM, by offset, before loading; it
+	// gives bus conflict tests ROM bytes other than the bank numbers.
+	patch     map[int]uint8
+	writes    []write
+	prg       map[uint16]uint8
+	chr       map[uint16]uint8
+	mirroring Mirroring
+}
+
+func newTestCartridge(t *testing.T, data []byte) *Cartridge {
+	t.Helper()
+	cart, err := ParseWithOptions(data, LoadOptions{DisableDatabase: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cart
+}
+
+// mapperCartridge loads an image for the given mapper from nes20Header and
+// image.
+func mapperCartridge(t *testing.T, mapper, submapper, prgSize, chrSize int) *Cartridge {
+	t.Helper()
+	return newTestCartridge(t, image(nes20Header(mapper, submapper, prgSize, chrSize), prgSize, chrSize))
+}
+
+// writeAll writes each register of writes in turn.
+func writeAll(cart *Cartridge, writes ...write) {
+	for _, w := range writes {
+		cart.WritePRGByte(w.address, w.data)
+	}
+}
+
+// stepCPU runs the cartridge for the given number of CPU cycles.
+func stepCPU(cart *Cartridge, cycles int) {
+	for i := 0; i < cycles; i++ {
+		cart.Step()
+	}
+}
+
+// riseA12 makes PPU A12 rise after being low long enough to pass the
+// filter, as the first sprite pattern fetch of a scanline does.
+func riseA12(cart *Cartridge) {
+	cart.ReadPPUByte(0x0000)
+	stepCPU(cart, a12FilterCycles)
+	cart.ReadPPUByte(0x1000)
+}
+
+func runMapperTests(t *testing.T, tests []mapperTest) {
+	t.Helper()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := image(nes20Header(test.mapper, test.submapper, test.prgSize, test.chrSize), test.prgSize, test.chrSize)
+			for offset, value := range test.patch {
+				data[HeaderSize+offset] = value
+			}
+			cart := newTestCartridge(t, data)
+			writeAll(cart, test.writes...)
+			checkBanks(t, cart, test)
+		})
+	}
+}
+
+// checkBanks checks the banks and mirroring that test expects of cart.
+func checkBanks(t *testing.T, cart *Cartridge, test mapperTest) {
+	t.Helper()
+	for address, bank := range test.prg {
+		if got := cart.ReadPRGByte(address); got != bank {
+			t.Errorf("PRG bank at $%04X = %d, want %d", address, got, bank)
+		}
+	}
+	for address, bank := range test.chr {
+		if got := cart.ReadPPUByte(address); got != bank {
+			t.Errorf("CHR bank at $%04X = %d, want %d", address, got, bank)
+		}
+	}
+	if got := cart.Mapper().Mirroring(); got != test.mirroring {
+		t.Errorf("mirroring = %v, want %v", got, test.mirroring)
+	}
+}
+
+func TestUxROM(t *testing.T) {
+	runMapperTests(t, []mapperTest{
+		{
+			name: "power on", mapper: 2, prgSize: 0x20000,
+			prg: map[uint16]uint8{0x8000: 0, 0xA000: 1, 0xC000: 14, 0xE000: 15},
+		},
+		{
+			name: "bank switch", mapper: 2, submapper: 1, prgSize: 0x20000,
+			writes: []write{{0x8000, 3}},
+			prg:    map[uint16]uint8{0x8000: 6, 0xA000: 7, 0xC000: 14, 0xE000: 15},
+		},
+		{
+			name: "last bank stays fixed", mapper: 2, submapper: 1, prgSize: 0x20000,
+			writes: []write{{0x8000, 3}, {0xFFFF, 5}},
+			prg:    map[uint16]uint8{0x8000: 10, 0xC000: 14, 0xFFFF: 15},
+		},
+		{
+			name: "bank number wraps", mapper: 2, submapper: 1, prgSize: 0x20000,
+			writes: []write{{0x8000, 9}},
+			prg:    map[uint16]uint8{0x8000: 2},
+		},
+		{
+			// The ROM byte at $C000 is 14: 7 & 14 selects bank 6.
+			name: "bus conflict", mapper: 2, prgSize: 0x20000,
+			writes: []write{{0xC000, 7}},
+			prg:    map[uint16]uint8{0x8000: 12},
+		},
+		{
+			name: "submapper 2 bus conflict", mapper: 2, submapper: 2, prgSize: 0x20000,
+			writes: []write{{0xC000, 7}},
+			prg:    map[uint16]uint8{0x8000: 12},
+		},
+		{
+			name: "submapper 1 no bus conflict", mapper: 2, submapper: 1, prgSize: 0x20000,
+			writes: []write{{0xC000, 7}},
+			prg:    map[uint16]uint8{0x8000: 14},
+		},
+	})
+}
+
+func TestCNROM(t *testing.T) {
+	runMapperTests(t, []mapperTest{
+		{
+			name: "power on", mapper: 3, prgSize: 0x8000, chrSize: 0x8000,
+			chr: map[uint16]uint8{0x0000: 0, 0x1C00: 7},
+		},
+		{
+			name: "bank switch", mapper: 3, submapper: 1, prgSize: 0x8000, chrSize: 0x8000,
+			writes: []write{{0x8000, 2}},
+			chr:    map[uint16]uint8{0x0000: 16, 0x1C00: 23},
+			prg:    map[uint16]uint8{0x8000: 0, 0xE000: 3},
+		},
+		{
+			// The ROM byte at $A000 is 1: 3 & 1 selects bank 1.
+			name: "bus conflict", mapper: 3, prgSize: 0x8000, chrSize: 0x8000,
+			writes: []write{{0xA000, 3}},
+			chr:    map[uint16]uint8{0x0000: 8},
+		},
+		{
+			name: "submapper 2 bus conflict", mapper: 3, submapper: 2, prgSize: 0x8000, chrSize: 0x8000,
+			writes: []write{{0xA000, 3}},
+			chr:    map[uint16]uint8{0x0000: 8},
+		},
+		{
+			name: "submapper 1 no bus conflict", mapper: 3, submapper: 1, prgSize: 0x8000, chrSize: 0x8000,
+			writes: []write{{0xA000, 3}},
+			chr:    map[uint16]uint8{0x0000: 24},
+		},
+	})
+}
+
+func TestAxROM(t *testing.T) {
+	runMapperTests(t, []mapperTest{
+		{
+			name: "power on", mapper: 7, prgSize: 0x40000,
+			prg:       map[uint16]uint8{0x8000: 0, 0xE000: 3},
+			mirroring: MirrorSingleLower,
+		},
+		{
+			name: "bank and upper screen", mapper: 7, prgSize: 0x40000,
+			writes:    []write{{0x8000, 0x15}},
+			prg:       map[uint16]uint8{0x8000: 20, 0xE000: 23},
+			mirroring: MirrorSingleUpper,
+		},
+		{
+			name: "back to lower screen", mapper: 7, prgSize: 0x40000,
+			writes:    []write{{0x8000, 0x15}, {0x8000, 0x06}},
+			prg:       map[uint16]uint8{0x8000: 24},
+			mirroring: MirrorSingleLower,
+		},
+		{
+			name: "high bits ignored", mapper: 7, prgSize: 0x40000,
+			writes:    []write{{0x8000, 0xEF}},
+			prg:       map[uint16]uint8{0x8000: 28},
+			mirroring: MirrorSingleLower,
+		},
+		{
+			name: "no bus conflict by default", mapper: 7, prgSize: 0x40000,
+			writes:    []write{{0xA000, 0x13}},
+			prg:       map[uint16]uint8{0x8000: 12},
+			mirroring: MirrorSingleUpper,
+		},
+		{
+			name: "submapper 1 no bus conflict", mapper: 7, submapper: 1, prgSize: 0x40000,
+			writes:    []write{{0xA000, 0x13}},
+			prg:       map[uint16]uint8{0x8000: 12},
+			mirroring: MirrorSingleUpper,
+		},
+		{
+			// The ROM byte at $A000 is 1, which also clears the screen bit.
+			name: "submapper 2 bus conflict", mapper: 7, submapper: 2, prgSize: 0x40000,
+			writes:    []write{{0xA000, 0x13}},
+			prg:       map[uint16]uint8{0x8000: 4},
+			mirroring: MirrorSingleLower,
+		},
+	})
+}
+
+func TestGxROM(t *testing.T) {
+	runMapperTests(t, []mapperTest{
+		{
+			name: "power on", mapper: 66, prgSize: 0x20000, chrSize: 0x8000,
+			prg: map[uint16]uint8{0x8000: 0, 0xE000: 3},
+			chr: map[uint16]uint8{0x0000: 0},
+		},
+		{
+			name: "PRG and CHR banks", mapper: 66, prgSize: 0x20000, chrSize: 0x8000,
+			patch:  map[int]uint8{0x0010: 0xFF},
+			writes: []write{{0x8010, 0x21}},
+			prg:    map[uint16]uint8{0x8000: 8, 0xE000: 11},
+			chr:    map[uint16]uint8{0x0000: 8, 0x1C00: 15},
+		},
+		{
+			// The ROM byte at $A000 is 1, masking off the PRG bits.
+			name: "bus conflict", mapper: 66, prgSize: 0x20000, chrSize: 0x8000,
+			writes: []write{{0xA000, 0x33}},
+			prg:    map[uint16]uint8{0x8000: 0},
+			chr:    map[uint16]uint8{0x0000: 8},
+		},
+	})
+}
+
+func TestBusConflict(t *testing.T) {
+	data := image(nes20Header(0, 0, 0x8000, 0x2000), 0x8000, 0x2000)
+	data[HeaderSize+0x1234] = 0x5A
+	b := &newTestCartridge(t, data).board
+	tests := []struct {
+		address    uint16
+		data, want uint8
+	}{
+		{0x9234, 0xFF, 0x5A},
+		{0x9234, 0x0F, 0x0A},
+		{0x8000, 0xFF, 0x00},
+		{0xE000, 0xFF, 0x03},
+	}
+	for _, test := range tests {
+		if got := b.busConflict(test.address, test.data); got != test.want {
+			t.Errorf("busConflict($%04X, $%02X) = $%02X, want $%02X", test.address, test.data, got, test.want)
+		}
+	}
+}
+
+func TestColorDreams(t *testing.T) {
+	runMapperTests(t, []mapperTest{
+		{
+			name: "PRG and CHR banks", mapper: 11, prgSize: 0x20000, chrSize: 0x20000,
+			patch:  map[int]uint8{0x0010: 0xFF},
+			writes: []write{{0x8010, 0x32}},
+			prg:    map[uint16]uint8{0x8000: 8, 0xE000: 11},
+			chr:    map[uint16]uint8{0x0000: 24, 0x1C00: 31},
+		},
+		{
+			// The ROM byte at $A000 is 1.
+			name: "bus conflict", mapper: 11, prgSize: 0x20000, chrSize: 0x20000,
+			writes: []write{{0xA000, 0xF3}},
+			prg:    map[uint16]uint8{0x8000: 4},
+			chr:    map[uint16]uint8{0x0000: 0},
+		},
+	})
+}
+
+func TestBNROM(t *testing.T) {
+	runMapperTests(t, []mapperTest{
+		{
+			name: "BNROM bank switch", mapper: 34, prgSize: 0x20000,
+			patch:  map[int]uint8{0x0010: 0xFF},
+			writes: []write{{0x8010, 3}},
+			prg:    map[uint16]uint8{0x8000: 12, 0xE000: 15},
+		},
+		{
+			name: "BNROM bus conflict", mapper: 34, prgSize: 0x20000,
+			writes: []write{{0xA000, 3}},
+			prg:    map[uint16]uint8{0x8000: 4},
+		},
+		{
+			name: "BNROM ignores NINA-001 registers", mapper: 34, prgSize: 0x20000,
+			writes: []write{{0x7FFD, 1}},
+			prg:    map[uint16]uint8{0x8000: 0, 0x7FFD: 1},
+		},
+		{
+			name: "BNROM with 8 KiB of CHR ROM", mapper: 34, prgSize: 0x10000, chrSize: 0x2000,
+			writes: []write{{0x7FFD, 1}},
+			prg:    map[uint16]uint8{0x8000: 0},
+		},
+		{
+			name: "NINA-001 detected from CHR ROM", mapper: 34, prgSize: 0x10000, chrSize: 0x10000,
+			writes: []write{{0x7FFD, 1}, {0x7FFE, 2}, {0x7FFF, 5}},
+			prg:    map[uint16]uint8{0x8000: 4, 0xE000: 7, 0x7FFD: 1, 0x7FFF: 5},
+			chr:    map[uint16]uint8{0x0000: 8, 0x0C00: 11, 0x1000: 20, 0x1C00: 23},
+		},
+		{
+			name: "NINA-001 ignores $8000", mapper: 34, prgSize: 0x10000, chrSize: 0x10000,
+			patch:  map[int]uint8{0x0010: 0xFF},
+			writes: []write{{0x8010, 1}},
+			prg:    map[uint16]uint8{0x8000: 0},
+		},
+		{
+			name: "submapper 1 is NINA-001", mapper: 34, submapper: 1, prgSize: 0x10000,
+			writes: []write{{0x7FFD, 1}},
+			prg:    map[uint16]uint8{0x8000: 4},
+		},
+		{
+			name: "submapper 2 is BNROM", mapper: 34, submapper: 2, prgSize: 0x10000, chrSize: 0x10000,
+			patch:  map[int]uint8{0x0010: 0xFF},
+			writes: []write{{0x7FFE, 2}, {0x8010, 1}},
+			prg:    map[uint16]uint8{0x8000: 4},
+			chr:    map[uint16]uint8{0x0000: 0},
+		},
+	})
+}
+
+func TestCamerica(t *testing.T) {
+	runMapperTests(t, []mapperTest{
+		{
+			name: "bank switch", mapper: 71, prgSize: 0x20000,
+			writes: []write{{0xC000, 3}},
+			prg:    map[uint16]uint8{0x8000: 6, 0xA000: 7, 0xC000: 14, 0xE000: 15},
+		},
+		{
+			name: "$8000-$BFFF does not switch", mapper: 71, prgSize: 0x20000,
+			writes: []write{{0xA000, 3}},
+			prg:    map[uint16]uint8{0x8000: 0},
+		},
+		{
+			name: "submapper 0 ignores $8000-$8FFF", mapper: 71, prgSize: 0x20000,
+			writes: []write{{0x8000, 0x10}},
+		},
+		{
+			name: "submapper 0 mirroring at $9000", mapper: 71, prgSize: 0x20000,
+			writes:    []write{{0x9000, 0x10}},
+			mirroring: MirrorSingleUpper,
+		},
+		{
+			name: "submapper 1 mirroring", mapper: 71, submapper: 1, prgSize: 0x20000,
+			writes:    []write{{0x8000, 0x10}, {0x8000, 0x00}},
+			mirroring: MirrorSingleLower,
+		},
+	})
+}
+
+func TestJaleco(t *testing.T) {
+	runMapperTests(t, []mapperTest{
+		{
+			name: "banks", mapper: 18, prgSize: 0x20000, chrSize: 0x20000,
+			writes: []write{
+				{0x8000, 0x3}, {0x8001, 0x0}, {0x8002, 0x4}, {0x9000, 0x7},
+				{0xA000, 0x5}, {0xA001, 0x1}, {0xD002, 0x3}, {0xD003, 0x6},
+				{0xF002, 1},
+			},
+			prg:       map[uint16]uint8{0x8000: 3, 0xA000: 4, 0xC000: 7, 0xE000: 15},
+			chr:       map[uint16]uint8{0x0000: 0x15, 0x1C00: 0x63},
+			mirroring: MirrorVertical,
+		},
+		{
+			name: "RAM disabled at power on", mapper: 18, prgSize: 0x20000, chrSize: 0x20000,
+			writes: []write{{0x6000, 0x42}},
+			prg:    map[uint16]uint8{0x6000: 0},
+		},
+		{
+			name: "RAM enabled", mapper: 18, prgSize: 0x20000, chrSize: 0x20000,
+			writes: []write{{0x9002, 0x03}, {0x6000, 0x42}},
+			prg:    map[uint16]uint8{0x6000: 0x42},
+		},
+		{
+			name: "RAM write protected", mapper: 18, prgSize: 0x20000, chrSize: 0x20000,
+			writes: []write{{0x9002, 0x03}, {0x6000, 0x42}, {0x9002, 0x01}, {0x6000, 0x17}},
+			prg:    map[uint16]uint8{0x6000: 0x42},
+		},
+		{
+			name: "single screen", mapper: 18, prgSize: 0x20000, chrSize: 0x20000,
+			writes:    []write{{0xF002, 3}},
+			mirroring: MirrorSingleUpper,
+		},
+	})
+}
+
+func TestJalecoIRQ(t *testing.T) {
+	tests := []struct {
+		name    string
+		control uint8
+		reload  [4]uint8
+		cycles  int
+		counter uint16
+	}{
+		// The counter raises the IRQ on the cycle after it reaches 0 and
+		// wraps; bits outside the mask are left alone.
+		{"16-bit", 0x01, [4]uint8{0x2, 0x0, 0x1, 0x0}, 0x103, 0xFFFF},
+		{"12-bit", 0x03, [4]uint8{0x2, 0x0, 0x1, 0x3}, 0x103, 0x3FFF},
+		{"8-bit", 0x05, [4]uint8{0x2, 0x1, 0x1, 0x3}, 0x13, 0x31FF},
+		{"4-bit", 0x09, [4]uint8{0x5, 0x3, 0x1, 0x3}, 0x6, 0x313F},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cart := mapperCartridge(t, 18, 0, 0x20000, 0x20000)
+			writeAll(cart,
+				write{0xE000, test.reload[0]}, write{0xE001, test.reload[1]},
+				write{0xE002, test.reload[2]}, write{0xE003, test.reload[3]},
+				write{0xF000, 0}, write{0xF001, test.control})
+			stepCPU(cart, test.cycles-1)
+			if cart.IRQ() {
+				t.Fatalf("IRQ after %d cycles, want %d", test.cycles-1, test.cycles)
+			}
+			stepCPU(cart, 1)
+			if !cart.IRQ() {
+				t.Fatalf("no IRQ after %d cycles", test.cycles)
+			}
+			if got := cart.Mapper().(*jaleco).irqCounter; got != test.counter {
+				t.Errorf("counter = $%04X, want $%04X", got, test.counter)
+			}
+			writeAll(cart, write{0xF001, test.control})
+			if cart.IRQ() {
+				t.Errorf("IRQ still asserted after $F001 write")
+			}
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		cart := mapperCartridge(t, 18, 0, 0x20000, 0x20000)
+		writeAll(cart, write{0xE000, 1}, write{0xF000, 0}, write{0xF001, 0x08})
+		stepCPU(cart, 100)
+		if cart.IRQ() {
+			t.Errorf("IRQ while disabled")
+		}
+	})
+}
+
+func TestIremG101(t *testing.T) {
+	runMapperTests(t, []mapperTest{
+		{
+			name: "banks", mapper: 32, prgSize: 0x20000, chrSize: 0x10000,
+			writes:    []write{{0x8000, 3}, {0xA000, 4}, {0xB003, 9}, {0x9000, 0}},
+			prg:       map[uint16]uint8{0x8000: 3, 0xA000: 4, 0xC000: 14, 0xE000: 15},
+			chr:       map[uint16]uint8{0x0C00: 9},
+			mirroring: MirrorVertical,
+		},
+		{
+			name: "PRG mode swaps $8000 and $C000", mapper: 32, prgSize: 0x20000, chrSize: 0x10000,
+			writes:    []write{{0x8000, 3}, {0x9000, 0x03}},
+			prg:       map[uint16]uint8{0x8000: 14, 0xA000: 0, 0xC000: 3, 0xE000: 15},
+			mirroring: MirrorHorizontal,
+		},
+		{
+			name: "submapper 1 single screen without PRG mode", mapper: 32, submapper: 1, prgSize: 0x20000, chrSize: 0x10000,
+			writes:    []write{{0x8000, 3}, {0x9000, 0x02}},
+			prg:       map[uint16]uint8{0x8000: 3, 0xC000: 14},
+			mirroring: MirrorSingleLower,
+		},
+	})
+}
+
+func TestIremH3001(t *testing.T) {
+	runMapperTests(t, []mapperTest{
+		{
+			name: "power on", mapper: 65, prgSize: 0x20000, chrSize: 0x10000,
+			prg: map[uint16]uint8{0x8000: 0, 0xA000: 1, 0xC000: 14, 0xE000: 15},
+		},
+		{
+			name: "banks", mapper: 65, prgSize: 0x20000, chrSize: 0x10000,
+			writes:    []write{{0x8000, 5}, {0xA000, 6}, {0xC000, 7}, {0xB005, 33}, {0x9001, 0x00}},
+			prg:       map[uint16]uint8{0x8000: 5, 0xA000: 6, 0xC000: 7, 0xE000: 15},
+			chr:       map[uint16]uint8{0x1400: 33},
+			mirroring: MirrorVertical,
+		},
+		{
+			name: "horizontal", mapper: 65, prgSize: 0x20000, chrSize: 0x10000,
+			writes:    []write{{0x9001, 0x80}},
+			mirroring: MirrorHorizontal,
+		},
+	})
+}
+
+func TestIremH3001IRQ(t *testing.T) {
+	cart := mapperCartridge(t, 65, 0, 0x20000, 0x10000)
+	writeAll(cart, write{0x9005, 0x01}, write{0x9006, 0x02}, write{0x9004, 0}, write{0x9003, 0x80})
+	stepCPU(cart, 0x101)
+	if cart.IRQ() {
+		t.Fatalf("IRQ before the counter reached 0")
+	}
+	stepCPU(cart, 1)
+	if !cart.IRQ() {
+		t.Fatalf("no IRQ when the counter reached 0")
+	}
+	writeAll(cart, write{0x9003, 0x80})
+	stepCPU(cart, 0x1000)
+	if cart.IRQ() {
+		t.Errorf("counter did not stop at 0")
+	}
+	writeAll(cart, write{0x9004, 0})
+	stepCPU(cart, 0x102)
+	if !cart.IRQ() {
+		t.Errorf("no IRQ after reloading the counter")
+	}
+}
+
+func TestTaito(t *testing.T) {
+	runMapperTests(t, []mapperTest{
+		{
+			name: "TC0190 banks", mapper: 33, prgSize: 0x20000, chrSize: 0x40000,
+			writes: []write{
+				{0x8000, 0x43}, {0x8001, 4}, {0x8002, 5}, {0x8003, 6},
+				{0xA000, 20}, {0xA001, 21}, {0xA002, 22}, {0xA003, 23},
+			},
+			prg:       map[uint16]uint8{0x8000: 3, 0xA000: 4, 0xC000: 14, 0xE000: 15},
+			chr:       map[uint16]uint8{0x0000: 10, 0x0400: 11, 0x0800: 12, 0x0C00: 13, 0x1000: 20, 0x1C00: 23},
+			mirroring: MirrorHorizontal,
+		},
+		{
+			name: "TC0190 mirroring from $8000", mapper: 33, prgSize: 0x20000, chrSize: 0x40000,
+			writes:    []write{{0x8000, 0x03}},
+			prg:       map[uint16]uint8{0x8000: 3},
+			mirroring: MirrorVertical,
+		},
+		{
+			name: "TC0690 has no mirroring at $8000", mapper: 48, prgSize: 0x20000, chrSize: 0x40000,
+			writes: []write{{0x8000, 0x03}},
+			prg:    map[uint16]uint8{0x8000: 3},
+		},
+		{
+			name: "TC0690 mirroring from $E000", mapper: 48, prgSize: 0x20000, chrSize: 0x40000,
+			writes:    []write{{0xE000, 0x00}},
+			mirroring: MirrorVertical,
+		},
+	})
+}
+
+func TestTaitoIRQ(t *testing.T) {
+	t.Run("TC0690 inverted latch", func(t *testing.T) {
+		cart := mapperCartridge(t, 48, 0, 0x20000, 0x40000)
+		// $FD inverted is a latch of 2: reload, 1, 0.
+		writeAll(cart, write{0xC000, 0xFD}, write{0xC001, 0}, write{0xC002, 0})
+		for i := 1; i <= 2; i++ {
+			riseA12(cart)
+			if cart.IRQ() {
+				t.Fatalf("IRQ after %d scanlines, want 3", i)
+			}
+		}
+		riseA12(cart)
+		if !cart.IRQ() {
+			t.Fatalf("no IRQ after 3 scanlines")
+		}
+		writeAll(cart, write{0xC003, 0})
+		if cart.IRQ() {
+			t.Errorf("IRQ still asserted after $C003 write")
+		}
+	})
+
+	t.Run("TC0190 has no counter", func(t *testing.T) {
+		cart := mapperCartridge(t, 33, 0, 0x20000, 0x40000)
+		writeAll(cart, write{0xC000, 0xFF}, write{0xC001, 0}, write{0xC002, 0})
+		for i := 0; i < 10; i++ {
+			riseA12(cart)
+		}
+		if cart.IRQ() {
+			t.Errorf("TC0190 raised an IRQ")
+		}
+	})
+}
+
+func TestRAMBO1(t *testing.T) {
+	runMapperTests(t, []mapperTest{
+		{
+			name: "PRG banks", mapper: 64, prgSize: 0x20000, chrSize: 0x40000,
+			writes:    []write{{0x8000, 6}, {0x8001, 3}, {0x8000, 7}, {0x8001, 4}, {0x8000, 15}, {0x8001, 5}, {0xA000, 0}},
+			prg:       map[uint16]uint8{0x8000: 3, 0xA000: 4, 0xC000: 5, 0xE000: 15},
+			mirroring: MirrorVertical,
+		},
+		{
+			name: "PRG mode", mapper: 64, prgSize: 0x20000, chrSize: 0x40000,
+			writes: []write{{0x8000, 6}, {0x8001, 3}, {0x8000, 7}, {0x8001, 4}, {0x8000, 15}, {0x8001, 5}, {0x8000, 0x40}},
+			prg:    map[uint16]uint8{0x8000: 5, 0xA000: 3, 0xC000: 4, 0xE000: 15},
+		},
+		{
+			name: "2 KiB CHR banks", mapper: 64, prgSize: 0x20000, chrSize: 0x40000,
+			writes: []write{{0x8000, 0}, {0x8001, 11}, {0x8000, 2}, {0x8001, 40}},
+			chr:    map[uint16]uint8{0x0000: 10, 0x0400: 11, 0x1000: 40},
+		},
+		{
+			name: "1 KiB CHR mode", mapper: 64, prgSize: 0x20000, chrSize: 0x40000,
+			writes: []write{{0x8000, 0x20}, {0x8001, 11}, {0x8000, 0x28}, {0x8001, 50}},
+			chr:    map[uint16]uint8{0x0000: 11, 0x0400: 50},
+		},
+		{
+			name: "CHR inversion", mapper: 64, prgSize: 0x20000, chrSize: 0x40000,
+			writes: []write{{0x8000, 0x80}, {0x8001, 10}, {0x8000, 0x82}, {0x8001, 40}},
+			chr:    map[uint16]uint8{0x1000: 10, 0x1400: 11, 0x0000: 40},
+		},
+	})
+}
+
+func TestRAMBO1IRQ(t *testing.T) {
+	t.Run("A12 mode", func(t *testing.T) {
+		cart := mapperCartridge(t, 64, 0, 0x20000, 0x40000)
+		// A latch of 2 reloads as 3 after a $C001 write.
+		writeAll(cart, write{0xC000, 2}, write{0xC001, 0}, write{0xE001, 0})
+		for i := 1; i <= 3; i++ {
+			riseA12(cart)
+			if cart.IRQ() {
+				t.Fatalf("IRQ after %d scanlines, want 4", i)
+			}
+		}
+		riseA12(cart)
+		if !cart.IRQ() {
+			t.Fatalf("no IRQ after 4 scanlines")
+		}
+		writeAll(cart, write{0xE000, 0})
+		if cart.IRQ() {
+			t.Errorf("IRQ still asserted after $E000 write")
+		}
+	})
+
+	t.Run("A12 mode latch of 1", func(t *testing.T) {
+		cart := mapperCartridge(t, 64, 0, 0x20000, 0x40000)
+		writeAll(cart, write{0xC000, 1}, write{0xC001, 0}, write{0xE001, 0})
+		riseA12(cart)
+		if cart.IRQ() {
+			t.Fatalf("IRQ on reload")
+		}
+		riseA12(cart)
+		if !cart.IRQ() {
+			t.Fatalf("no IRQ after 2 scanlines")
+		}
+	})
+
+	t.Run("cycle mode", func(t *testing.T) {
+		cart := mapperCartridge(t, 64, 0, 0x20000, 0x40000)
+		writeAll(cart, write{0xC000, 2}, write{0xC001, 1}, write{0xE001, 0})
+		// The counter is clocked every 4 CPU cycles: reload to 3, then
+		// 2, 1 and 0. A12 does not clock it.
+		for i := 0; i < 10; i++ {
+			cart.Mapper().OnA12Rise()
+		}
+		stepCPU(cart, 15)
+		if cart.IRQ() {
+			t.Fatalf("IRQ before 16 cycles")
+		}
+		stepCPU(cart, 1)
+		if !cart.IRQ() {
+			t.Fatalf("no IRQ after 16 cycles")
+		}
+	})
+}
+
+func TestSunsoft4(t *testing.T) {
+	runMapperTests(t, []mapperTest{
+		{
+			name: "banks", mapper: 68, prgSize: 0x20000, chrSize: 0x40000,
+			writes: []write{{0x8000, 3}, {0xB000, 5}, {0xF000, 0x13}},
+			prg:    map[uint16]uint8{0x8000: 6, 0xA000: 7, 0xC000: 14, 0xE000: 15},
+			chr:    map[uint16]uint8{0x0000: 6, 0x0400: 7, 0x1800: 10, 0x1C00: 11},
+		},
+		{
+			name: "RAM enabled", mapper: 68, prgSize: 0x20000, chrSize: 0x40000,
+			writes: []write{{0xF000, 0x10}, {0x6000, 0x42}},
+			prg:    map[uint16]uint8{0x6000: 0x42},
+		},
+		{
+			name: "RAM disabled", mapper: 68, prgSize: 0x20000, chrSize: 0x40000,
+			writes: []write{{0xF000, 0x10}, {0x6000, 0x42}, {0xF000, 0x00}},
+			prg:    map[uint16]uint8{0x6000: 0},
+		},
+		{
+			name: "single screen", mapper: 68, prgSize: 0x20000, chrSize: 0x40000,
+			writes:    []write{{0xE000, 3}},
+			mirroring: MirrorSingleUpper,
+		},
+		{
+			// Nametables come from the last 128 KiB of CHR ROM, banks
+			// $80 and up.
+			name: "CHR ROM nametables", mapper: 68, prgSize: 0x20000, chrSize: 0x40000,
+			writes:    []write{{0xC000, 0x05}, {0xD000, 0x06}, {0xE000, 0x10}},
+			chr:       map[uint16]uint8{0x2000: 0x85, 0x2400: 0x86, 0x2800: 0x85, 0x2C00: 0x86},
+			mirroring: MirrorVertical,
+		},
+	})
+}
+
+func TestSunsoft4NametableRAM(t *testing.T) {
+	cart := mapperCartridge(t, 68, 0, 0x20000, 0x40000)
+	ciram := make([]uint8, 0x800)
+	cart.ConnectNametableRAM(ciram)
+	writeAll(cart, write{0xC000, 0x05}, write{0xE000, 0x10})
+	cart.WritePPUByte(0x2000, 0x42)
+	if ciram[0] != 0 {
+		t.Errorf("write to a CHR ROM nametable reached nametable RAM")
+	}
+	writeAll(cart, write{0xE000, 0x00})
+	cart.WritePPUByte(0x2000, 0x42)
+	if got := cart.ReadPPUByte(0x2000); got != 0x42 {
+		t.Errorf("nametable RAM reads $%02X, want $42", got)
+	}
+}
+
+func TestNamco108(t *testing.T) {
+	runMapperTests(t, []mapperTest{
+		{
+			name: "power on", mapper: 206, prgSize: 0x20000, chrSize: 0x10000,
+			prg: map[uint16]uint8{0x8000: 0, 0xA000: 1, 0xC000: 14, 0xE000: 15},
+		},
+		{
+			name: "banks", mapper: 206, prgSize: 0x20000, chrSize: 0x10000,
+			writes: []write{
+				{0x8000, 0}, {0x8001, 5}, {0x8000, 1}, {0x8001, 8},
+				{0x8000, 2}, {0x8001, 9}, {0x8000, 5}, {0x8001, 63},
+				{0x8000, 6}, {0x8001, 3}, {0x8000, 7}, {0x8001, 4},
+			},
+			prg: map[uint16]uint8{0x8000: 3, 0xA000: 4, 0xC000: 14, 0xE000: 15},
+			chr: map[uint16]uint8{0x0000: 4, 0x0400: 5, 0x0800: 8, 0x0C00: 9, 0x1000: 9, 0x1C00: 63},
+		},
+		{
+			name: "no inversion or mirroring control", mapper: 206, prgSize: 0x20000, chrSize: 0x10000,
+			writes: []write{{0x8000, 0xC6}, {0x8001, 3}, {0xA000, 0}},
+			prg:    map[uint16]uint8{0x8000: 3, 0xC000: 14},
+		},
+	})
+}
+
+// mmc1Load loads value into the MMC1 register at address one bit at a
+// time, leaving CPU cycles between the writes as a program does.
+func mmc1Load(cart *Cartridge, address uint16, value uint8) {
+	for i := 0; i < 5; i++ {
+		cart.WritePRGByte(address, value>>i&1)
+		stepCPU(cart, 2)
+	}
+}
+
+// TestMMC1 loads each write of a test through the shift register.
+func TestMMC1(t *testing.T) {
+	tests := []mapperTest{
+		{
+			name: "power-on", prgSize: 0x20000, chrSize: 0x8000,
+			prg:       map[uint16]uint8{0x8000: 0, 0xC000: 14, 0xE000: 15},
+			mirroring: MirrorSingleLower,
+		},
+		{
+			name: "32K PRG", prgSize: 0x20000, chrSize: 0x8000,
+			writes:    []write{{0x8000, 0x02}, {0xE000, 3}},
+			prg:       map[uint16]uint8{0x8000: 4, 0xA000: 5, 0xC000: 6, 0xE000: 7},
+			mirroring: MirrorVertical,
+		},
+		{
+			name: "first bank fixed", prgSize: 0x20000, chrSize: 0x8000,
+			writes:    []write{{0x8000, 0x0B}, {0xE000, 5}},
+			prg:       map[uint16]uint8{0x8000: 0, 0xA000: 1, 0xC000: 10, 0xE000: 11},
+			mirroring: MirrorHorizontal,
+		},
+		{
+			name: "last bank fixed", prgSize: 0x20000, chrSize: 0x8000,
+			writes:    []write{{0x8000, 0x0D}, {0xE000, 5}},
+			prg:       map[uint16]uint8{0x8000: 10, 0xA000: 11, 0xC000: 14, 0xE000: 15},
+			mirroring: MirrorSingleUpper,
+		},
+		{
+			name: "8K CHR", prgSize: 0x20000, chrSize: 0x8000,
+			writes:    []write{{0xA000, 3}, {0xC000, 6}},
+			chr:       map[uint16]uint8{0x0000: 8, 0x1C00: 15},
+			mirroring: MirrorSingleLower,
+		},
+		{
+			name: "4K CHR", prgSize: 0x20000, chrSize: 0x8000,
+			writes:    []write{{0x8000, 0x1C}, {0xA000, 2}, {0xC000, 5}},
+			chr:       map[uint16]uint8{0x0000: 8, 0x0C00: 11, 0x1000: 20, 0x1C00: 23},
+			mirroring: MirrorSingleLower,
+		},
+		{
+			name: "SUROM lower 256K", prgSize: 0x80000,
+			writes:    []write{{0xE000, 2}},
+			prg:       map[uint16]uint8{0x8000: 4, 0xC000: 30},
+			mirroring: MirrorSingleLower,
+		},
+		{
+			name: "SUROM upper 256K", prgSize: 0x80000,
+			writes:    []write{{0xA000, 0x10}, {0xE000, 2}},
+			prg:       map[uint16]uint8{0x8000: 36, 0xC000: 62, 0xE000: 63},
+			mirroring: MirrorSingleLower,
+		},
+		{
+			name: "SUROM 4K CHR uses first register", prgSize: 0x80000,
+			writes:    []write{{0x8000, 0x1C}, {0xA000, 0x10}, {0xC000, 0x00}},
+			prg:       map[uint16]uint8{0xC000: 62},
+			mirroring: MirrorSingleLower,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cart := mapperCartridge(t, 1, test.submapper, test.prgSize, test.chrSize)
+			for _, w := range test.writes {
+				mmc1Load(cart, w.address, w.data)
+			}
+			checkBanks(t, cart, test)
+		})
+	}
+}
+
+func TestMMC1ShiftRegister(t *testing.T) {
+	cart := mapperCartridge(t, 1, 0, 0x20000, 0x8000)
+	mmc1Load(cart, 0x8000, 0x00)
+	mmc1Load(cart, 0xE000, 3)
+	if got := cart.ReadPRGByte(0xC000); got != 6 {
+		t.Fatalf("32K mode: PRG bank at $C000 = %d, want 6", got)
+	}
+
+	// Bit 7 discards the bits shifted in so far and restores PRG mode 3.
+	cart.WritePRGByte(0xE000, 1)
+	stepCPU(cart, 2)
+	cart.WritePRGByte(0xE000, 1)
+	stepCPU(cart, 2)
+	cart.WritePRGByte(0xE000, 0x80)
+	stepCPU(cart, 2)
+	if got := cart.ReadPRGByte(0xC000); got != 14 {
+		t.Errorf("after reset: PRG bank at $C000 = %d, want 14", got)
+	}
+	mmc1Load(cart, 0xE000, 2)
+	if got := cart.ReadPRGByte(0x8000); got != 4 {
+		t.Errorf("after reload: PRG bank at $8000 = %d, want 4", got)
+	}
+
+	// The second of two writes on consecutive cycles is ignored, as the
+	// dummy write of a read-modify-write instruction is, so this loads $1F
+	// rather than %10101.
+	for i := 0; i < 5; i++ {
+		cart.WritePRGByte(0xE000, 1)
+		stepCPU(cart, 1)
+		cart.WritePRGByte(0xE000, 0)
+		stepCPU(cart, 2)
+	}
+	if got := cart.ReadPRGByte(0x8000); got != 14 {
+		t.Errorf("after consecutive writes: PRG bank at $8000 = %d, want 14", got)
+	}
+}
+
+func TestMMC1RAM(t *testing.T) {
+	tests := []struct {
+		name      string
+		submapper int
+		prgSize   int
+		chrSize   int
+		// loads selects the RAM bank or disables RAM.
+		loads    []write
+		disabled bool
+	}{
+		{name: "enabled", prgSize: 0x20000},
+		{name: "disabled by PRG register", prgSize: 0x20000, chrSize: 0x8000, loads: []write{{0xE000, 0x10}}, disabled: true},
+		{name: "SNROM disabled by CHR register", prgSize: 0x40000, loads: []write{{0xA000, 0x10}}, disabled: true},
+		{name: "CHR ROM ignores CHR register bit 4", prgSize: 0x40000, chrSize: 0x20000, loads: []write{{0xA000, 0x10}}},
+		{name: "SUROM ignores CHR register bit 4", prgSize: 0x80000, loads: []write{{0xA000, 0x10}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cart := mapperCartridge(t, 1, test.submapper, test.prgSize, test.chrSize)
+			for _, w := range test.loads {
+				mmc1Load(cart, w.address, w.data)
+			}
+			cart.WritePRGByte(0x6000, 0x5A)
+			data, driven := cart.ReadPRGPartial(0x6000)
+			if enabled := driven != 0 && data == 0x5A; enabled == test.disabled {
+				t.Errorf("RAM enabled = %v, want %v", enabled, !test.disabled)
+			}
+		})
+	}
+}
+
+func TestMMC1RAMBanks(t *testing.T) {
+	tests := []struct {
+		name      string
+		submapper int
+		size      int
+		// banks maps CHR register values to the RAM bank they select.
+		banks map[uint8]int
+	}{
+		{name: "SOROM", submapper: mmc1SOROM, size: 0x4000, banks: map[uint8]int{0x00: 0, 0x08: 1, 0x04: 0}},
+		{name: "SXROM", submapper: mmc1SXROM, size: 0x8000, banks: map[uint8]int{0x00: 0, 0x04: 1, 0x08: 2, 0x0C: 3}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cart := mapperCartridge(t, 1, test.submapper, 0x40000, 0)
+			if got := len(cart.board.prgRAM); got != test.size {
+				t.Errorf("PRG RAM is %#x bytes, want %#x", got, test.size)
+			}
+			for value, bank := range test.banks {
+				mmc1Load(cart, 0xA000, value)
+				cart.WritePRGByte(0x6000, uint8(bank))
+			}
+			for value, bank := range test.banks {
+				mmc1Load(cart, 0xA000, value)
+				if got := cart.ReadPRGByte(0x6000); got != uint8(bank) {
+					t.Errorf("CHR register %#02x: RAM bank %d, want %d", value, got, bank)
+				}
+			}
+		})
+	}
+}
+
+func TestMMC3(t *testing.T) {
+	banks := []write{
+		{0x8000, 0}, {0x8001, 10}, {0x8000, 1}, {0x8001, 21},
+		{0x8000, 2}, {0x8001, 30}, {0x8000, 3}, {0x8001, 31},
+		{0x8000, 4}, {0x8001, 32}, {0x8000, 5}, {0x8001, 33},
+		{0x8000, 6}, {0x8001, 3}, {0x8000, 7}, {0x8001, 4},
+	}
+	runMapperTests(t, []mapperTest{
+		{
+			name: "power on", mapper: 4, prgSize: 0x20000, chrSize: 0x20000,
+			prg:       map[uint16]uint8{0x8000: 0, 0xA000: 0, 0xC000: 14, 0xE000: 15},
+			mirroring: MirrorVertical,
+		},
+		{
+			name: "banks", mapper: 4, prgSize: 0x20000, chrSize: 0x20000,
+			writes:    banks,
+			prg:       map[uint16]uint8{0x8000: 3, 0xA000: 4, 0xC000: 14, 0xE000: 15},
+			chr:       map[uint16]uint8{0x0000: 10, 0x0400: 11, 0x0800: 20, 0x0C00: 21, 0x1000: 30, 0x1400: 31, 0x1800: 32, 0x1C00: 33},
+			mirroring: MirrorVertical,
+		},
+		{
+			name: "PRG inversion", mapper: 4, prgSize: 0x20000, chrSize: 0x20000,
+			writes:    append(append([]write(nil), banks...), write{0x8000, 0x40}),
+			prg:       map[uint16]uint8{0x8000: 14, 0xA000: 4, 0xC000: 3, 0xE000: 15},
+			mirroring: MirrorVertical,
+		},
+		{
+			name: "CHR inversion", mapper: 4, prgSize: 0x20000, chrSize: 0x20000,
+			writes:    append(append([]write(nil), banks...), write{0x8000, 0x80}),
+			prg:       map[uint16]uint8{0x8000: 3, 0xC000: 14},
+			chr:       map[uint16]uint8{0x0000: 30, 0x0400: 31, 0x0800: 32, 0x0C00: 33, 0x1000: 10, 0x1400: 11, 0x1800: 20, 0x1C00: 21},
+			mirroring: MirrorVertical,
+		},
+		{
+			name: "horizontal mirroring", mapper: 4, prgSize: 0x20000, chrSize: 0x20000,
+			writes:    []write{{0xA000, 1}},
+			mirroring: MirrorHorizontal,
+		},
+		{
+			name: "RAM disabled", mapper: 4, prgSize: 0x20000, chrSize: 0x20000,
+			writes:    []write{{0x6000, 0x42}, {0xA001, 0x00}},
+			prg:       map[uint16]uint8{0x6000: 0},
+			mirroring: MirrorVertical,
+		},
+		{
+			name: "RAM write protected", mapper: 4, prgSize: 0x20000, chrSize: 0x20000,
+			writes:    []write{{0x6000, 0x42}, {0xA001, 0xC0}, {0x6000, 0x43}},
+			prg:       map[uint16]uint8{0x6000: 0x42},
+			mirroring: MirrorVertical,
+		},
+	})
+}
+
+func TestMMC3IRQ(t *testing.T) {
+	t.Run("counts down from the latch", func(t *testing.T) {
+		cart := mapperCartridge(t, 4, 0, 0x20000, 0x20000)
+		// The first rise reloads the counter to 2, then it reaches 0 on
+		// the third.
+		writeAll(cart, write{0xC000, 2}, write{0xC001, 0}, write{0xE001, 0})
+		for i := 1; i <= 2; i++ {
+			riseA12(cart)
+			if cart.IRQ() {
+				t.Fatalf("IRQ after %d scanlines, want 3", i)
+			}
+		}
+		riseA12(cart)
+		if !cart.IRQ() {
+			t.Fatalf("no IRQ after 3 scanlines")
+		}
+		writeAll(cart, write{0xE000, 0})
+		if cart.IRQ() {
+			t.Errorf("IRQ still asserted after $E000 write")
+		}
+		for i := 0; i < 3; i++ {
+			riseA12(cart)
+		}
+		if cart.IRQ() {
+			t.Errorf("IRQ raised while disabled")
+		}
+	})
+
+	t.Run("reload", func(t *testing.T) {
+		cart := mapperCartridge(t, 4, 0, 0x20000, 0x20000)
+		writeAll(cart, write{0xC000, 5}, write{0xC001, 0}, write{0xE001, 0})
+		riseA12(cart)
+		riseA12(cart)
+		// The new latch takes effect at the next rise after $C001.
+		writeAll(cart, write{0xC000, 1}, write{0xC001, 0})
+		riseA12(cart)
+		if cart.IRQ() {
+			t.Fatalf("IRQ on reload to 1")
+		}
+		riseA12(cart)
+		if !cart.IRQ() {
+			t.Fatalf("no IRQ one scanline after reload")
+		}
+	})
+
+	for _, test := range []struct {
+		name      string
+		submapper int
+		// irqs lists whether each of four scanlines raises an IRQ.
+		irqs [4]bool
+	}{
+		{"latch 0", 0, [4]bool{true, true, true, true}},
+		{"latch 0 MMC3A", mmc3RevA, [4]bool{true, false, false, false}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			cart := mapperCartridge(t, 4, test.submapper, 0x20000, 0x20000)
+			writeAll(cart, write{0xC000, 0}, write{0xC001, 0}, write{0xE001, 0})
+			for i, want := range test.irqs {
+				riseA12(cart)
+				if got := cart.IRQ(); got != want {
+					t.Errorf("scanline %d: IRQ = %v, want %v", i+1, got, want)
+				}
+				// Acknowledge and enable again.
+				writeAll(cart, write{0xE000, 0}, write{0xE001, 0})
+			}
+		})
+	}
+
+	t.Run("MMC3A decrement to 0", func(t *testing.T) {
+		cart := mapperCartridge(t, 4, mmc3RevA, 0x20000, 0x20000)
+		writeAll(cart, write{0xC000, 1}, write{0xC001, 0}, write{0xE001, 0})
+		riseA12(cart)
+		if cart.IRQ() {
+			t.Fatalf("IRQ on reload to 1")
+		}
+		riseA12(cart)
+		if !cart.IRQ() {
+			t.Fatalf("no IRQ when the counter reached 0")
+		}
+	})
+}
+
+// mmc6Cartridge loads an MMC6 image whose header declares no PRG RAM, so
+// the only RAM is the 1 KiB inside the chip.
+func mmc6Cartridge(t *testing.T) *Cartridge {
+	t.Helper()
+	h := nes20Header(4, mmc3MMC6, 0x20000, 0x20000)
+	h[10] = 0
+	return newTestCartridge(t, image(h, 0x20000, 0x20000))
+}
+
+func TestMMC6RAM(t *testing.T) {
+	driven := func(cart *Cartridge, address uint16) (uint8, bool) {
+		data, lines := cart.ReadPRGPartial(address)
+		return data, lines != 0
+	}
+
+	cart := mmc6Cartridge(t)
+	if got := len(cart.board.prgRAM); got != 0x0400 {
+		t.Fatalf("MMC6 RAM is %#x bytes, want $400", got)
+	}
+	writeAll(cart, write{0xA001, 0xF0}, write{0x7000, 0x11})
+	if _, ok := driven(cart, 0x7000); ok {
+		t.Errorf("RAM answers before $8000 bit 5 enables it")
+	}
+
+	writeAll(cart, write{0x8000, 0x20}, write{0xA001, 0xF0}, write{0x7000, 0x11}, write{0x7200, 0x22})
+	for _, test := range []struct {
+		address uint16
+		want    uint8
+	}{{0x7000, 0x11}, {0x7200, 0x22}, {0x7400, 0x11}, {0x7E00, 0x22}} {
+		if got, ok := driven(cart, test.address); !ok || got != test.want {
+			t.Errorf("$%04X = $%02X (driven %v), want $%02X", test.address, got, ok, test.want)
+		}
+	}
+	if _, ok := driven(cart, 0x6000); ok {
+		t.Errorf("$6000 is driven; MMC6 RAM is at $7000-$7FFF only")
+	}
+
+	// Clearing bit 4 protects the lower half; the upper stays writable.
+	writeAll(cart, write{0xA001, 0xE0}, write{0x7000, 0x99}, write{0x7200, 0x33})
+	if got, _ := driven(cart, 0x7000); got != 0x11 {
+		t.Errorf("protected $7000 = $%02X, want $11", got)
+	}
+	if got, _ := driven(cart, 0x7200); got != 0x33 {
+		t.Errorf("$7200 = $%02X, want $33", got)
+	}
+
+	// A half that cannot be read reads 0 while the other half is readable.
+	writeAll(cart, write{0xA001, 0x80})
+	if got, ok := driven(cart, 0x7000); !ok || got != 0 {
+		t.Errorf("unreadable $7000 = $%02X (driven %v), want $00", got, ok)
+	}
+	if got, _ := driven(cart, 0x7200); got != 0x33 {
+		t.Errorf("$7200 = $%02X, want $33", got)
+	}
+
+	// With neither half readable the RAM does not drive the bus.
+	writeAll(cart, write{0xA001, 0x50})
+	if _, ok := driven(cart, 0x7200); ok {
+		t.Errorf("RAM drives the bus with both halves unreadable")
+	}
+}
+
+func TestTxSROMNametables(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		writes []write
+		want   [4]int
+	}{
+		{
+			name:   "2 KiB banks",
+			writes: []write{{0x8000, 0}, {0x8001, 0x80}, {0x8000, 1}, {0x8001, 0x02}, {0xA000, 1}},
+			want:   [4]int{0x0400, 0x0400, 0, 0},
+		},
+		{
+			name: "1 KiB banks under CHR inversion",
+			writes: []write{
+				{0x8000, 0x82}, {0x8001, 0x00}, {0x8000, 0x83}, {0x8001, 0x81},
+				{0x8000, 0x84}, {0x8001, 0x02}, {0x8000, 0x85}, {0x8001, 0xFF},
+			},
+			want: [4]int{0, 0x0400, 0, 0x0400},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			cart := mapperCartridge(t, 118, 0, 0x20000, 0x20000)
+			writeAll(cart, test.writes...)
+			if got := cart.board.nametables; got != test.want {
+				t.Errorf("nametables = %#x, want %#x", got, test.want)
+			}
+		})
+	}
+}
+
+func TestTQROMCHRRAM(t *testing.T) {
+	cart := mapperCartridge(t, 119, 0, 0x20000, 0x10000)
+	writeAll(cart, write{0x8000, 2}, write{0x8001, 0x40})
+	cart.WritePPUByte(0x1000, 0x55)
+	if got := cart.ReadPPUByte(0x1000); got != 0x55 {
+		t.Errorf("CHR RAM at $1000 = $%02X, want $55", got)
+	}
+	writeAll(cart, write{0x8000, 3}, write{0x8001, 0x40})
+	if got := cart.ReadPPUByte(0x1400); got != 0x55 {
+		t.Errorf("CHR RAM page 0 at $1400 = $%02X, want $55", got)
+	}
+	writeAll(cart, write{0x8000, 2}, write{0x8001, 0x01})
+	if got := cart.ReadPPUByte(0x1000); got != 1 {
+		t.Errorf("CHR ROM at $1000 = %d, want bank 1", got)
+	}
+	cart.WritePPUByte(0x1000, 0x66)
+	if got := cart.ReadPPUByte(0x1000); got != 1 {
+		t.Errorf("write reached CHR ROM: $1000 = $%02X", got)
+	}
+}
+
+// mmc5Cartridge loads an MMC5 image with 128 KiB each of PRG and CHR ROM
+// and 64 KiB of PRG RAM, unlocks the RAM and fills the first byte of each
+// 8 KiB RAM bank with $40 plus the bank number.
+func mmc5Cartridge(t *testing.T) *Cartridge {
+	t.Helper()
+	h := nes20Header(5, 0, 0x20000, 0x20000)
+	h[10] = 10
+	cart := newTestCartridge(t, image(h, 0x20000, 0x20000))
+	cart.ConnectNametableRAM(make([]uint8, ciramSize))
+	writeAll(cart, write{0x5102, 2}, write{0x5103, 1})
+	for bank := 0; bank < 8; bank++ {
+		writeAll(cart, write{0x5113, uint8(bank)}, write{0x6000, 0x40 + uint8(bank)})
+	}
+	writeAll(cart, write{0x5113, 0})
+	return cart
+}
+
+func TestMMC5PRG(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []write
+		// prg maps addresses to the ROM bank number, or $40 plus the RAM
+		// bank number, expected there.
+		prg map[uint16]uint8
+	}{
+		{
+			name: "power on",
+			prg:  map[uint16]uint8{0x6000: 0x40, 0x8000: 15, 0xA000: 15, 0xC000: 15, 0xE000: 15},
+		},
+		{
+			name:   "$5113 selects the RAM at $6000",
+			writes: []write{{0x5113, 5}},
+			prg:    map[uint16]uint8{0x6000: 0x45},
+		},
+		{
+			name:   "mode 0",
+			writes: []write{{0x5100, 0}, {0x5117, 0x07}},
+			prg:    map[uint16]uint8{0x8000: 4, 0xA000: 5, 0xC000: 6, 0xE000: 7},
+		},
+		{
+			name:   "mode 1",
+			writes: []write{{0x5100, 1}, {0x5115, 0x83}, {0x5117, 0x8D}},
+			prg:    map[uint16]uint8{0x8000: 2, 0xA000: 3, 0xC000: 12, 0xE000: 13},
+		},
+		{
+			name:   "mode 1 RAM",
+			writes: []write{{0x5100, 1}, {0x5115, 0x03}},
+			prg:    map[uint16]uint8{0x8000: 0x42, 0xA000: 0x43, 0xC000: 14},
+		},
+		{
+			name:   "mode 2",
+			writes: []write{{0x5100, 2}, {0x5115, 0x84}, {0x5116, 0x09}, {0x5117, 0x8E}},
+			prg:    map[uint16]uint8{0x8000: 4, 0xA000: 5, 0xC000: 0x41, 0xE000: 14},
+		},
+		{
+			name:   "mode 3",
+			writes: []write{{0x5114, 0x81}, {0x5115, 0x02}, {0x5116, 0x8A}, {0x5117, 0x0B}},
+			prg:    map[uint16]uint8{0x8000: 1, 0xA000: 0x42, 0xC000: 10, 0xE000: 11},
+		},
+		{
+			name:   "RAM window writable",
+			writes: []write{{0x5114, 0x06}, {0x8000, 0x77}},
+			prg:    map[uint16]uint8{0x8000: 0x77, 0x6000: 0x40},
+		},
+		{
+			name:   "RAM write protected",
+			writes: []write{{0x5102, 0}, {0x6000, 0x77}, {0x5114, 0x06}, {0x8000, 0x77}},
+			prg:    map[uint16]uint8{0x6000: 0x40, 0x8000: 0x46},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cart := mmc5Cartridge(t)
+			writeAll(cart, test.writes...)
+			for address, want := range test.prg {
+				if got := cart.ReadPRGByte(address); got != want {
+					t.Errorf("$%04X = $%02X, want $%02X", address, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestMMC5CHR(t *testing.T) {
+	setA := []write{
+		{0x5120, 10}, {0x5121, 11}, {0x5122, 12}, {0x5123, 13},
+		{0x5124, 14}, {0x5125, 15}, {0x5126, 16}, {0x5127, 17},
+	}
+	setB := []write{{0x5128, 20}, {0x5129, 21}, {0x512A, 22}, {0x512B, 23}}
+	runMapperTests(t, []mapperTest{
+		{
+			name: "1 KiB set A", mapper: 5, prgSize: 0x20000, chrSize: 0x20000,
+			writes: setA,
+			chr:    map[uint16]uint8{0x0000: 10, 0x0C00: 13, 0x1000: 14, 0x1C00: 17},
+		},
+		{
+			name: "1 KiB set B written last", mapper: 5, prgSize: 0x20000, chrSize: 0x20000,
+			writes: append(append([]write(nil), setA...), setB...),
+			chr:    map[uint16]uint8{0x0000: 20, 0x0C00: 23, 0x1000: 20, 0x1C00: 23},
+		},
+		{
+			name: "2 KiB", mapper: 5, prgSize: 0x20000, chrSize: 0x20000,
+			writes: []write{{0x5101, 2}, {0x5121, 1}, {0x5123, 5}, {0x5127, 7}},
+			chr:    map[uint16]uint8{0x0000: 2, 0x0400: 3, 0x0800: 10, 0x1800: 14},
+		},
+		{
+			name: "4 KiB", mapper: 5, prgSize: 0x20000, chrSize: 0x20000,
+			writes: []write{{0x5101, 1}, {0x5123, 1}, {0x5127, 3}},
+			chr:    map[uint16]uint8{0x0000: 4, 0x0C00: 7, 0x1000: 12},
+		},
+		{
+			name: "8 KiB", mapper: 5, prgSize: 0x20000, chrSize: 0x20000,
+			writes: []write{{0x5101, 0}, {0x5127, 2}},
+			chr:    map[uint16]uint8{0x0000: 16, 0x1C00: 23},
+		},
+	})
+
+	t.Run("8x16 sprites", func(t *testing.T) {
+		cart := mmc5Cartridge(t)
+		writeAll(cart, append(append([]write(nil), setB...), setA...)...)
+		for _, tall := range []bool{false, true} {
+			control := uint8(0)
+			if tall {
+				control = 0x20
+			}
+			cart.SnoopWrite(0x2000, control)
+			cart.StartScanline(0, true)
+			cart.SpriteFetches(true)
+			if got := cart.ReadPPUByte(0x1000); got != 14 {
+				t.Errorf("tall %v: sprite fetch from bank %d, want set A's 14", tall, got)
+			}
+			cart.SpriteFetches(false)
+			want := uint8(14)
+			if tall {
+				want = 20
+			}
+			if got := cart.ReadPPUByte(0x1000); got != want {
+				t.Errorf("tall %v: background fetch from bank %d, want %d", tall, got, want)
+			}
+			cart.StartScanline(240, true)
+			if got := cart.ReadPPUByte(0x1000); got != 14 {
+				t.Errorf("tall %v: CPU access outside the frame from bank %d, want the last written set A's 14", tall, got)
+			}
+		}
+	})
+}
+
+func TestMMC5ExRAM(t *testing.T) {
+	driven := func(cart *Cartridge, address uint16) (uint8, bool) {
+		data, lines := cart.ReadPRGPartial(address)
+		return data, lines != 0
+	}
+
+	t.Run("modes 0 and 1 outside rendering", func(t *testing.T) {
+		for _, mode := range []uint8{0, 1} {
+			cart := mmc5Cartridge(t)
+			writeAll(cart, write{0x5104, mode}, write{0x5105, 0xAA}, write{0x5C00, 0x12})
+			if _, ok := driven(cart, 0x5C00); ok {
+				t.Errorf("mode %d: $5C00 is readable", mode)
+			}
+			if got := cart.ReadPPUByte(0x2000); got != 0 {
+				t.Errorf("mode %d: write outside rendering stored $%02X, want 0", mode, got)
+			}
+			cart.StartScanline(0, true)
+			writeAll(cart, write{0x5C00, 0x12})
+			cart.StartScanline(240, true)
+			if got := cart.ReadPPUByte(0x2000); got != 0x12 {
+				t.Errorf("mode %d: nametable in ExRAM = $%02X, want $12", mode, got)
+			}
+		}
+	})
+
+	t.Run("mode 2", func(t *testing.T) {
+		cart := mmc5Cartridge(t)
+		writeAll(cart, write{0x5104, 2}, write{0x5105, 0xAA}, write{0x5C00, 0x34})
+		if got, ok := driven(cart, 0x5C00); !ok || got != 0x34 {
+			t.Errorf("$5C00 = $%02X (driven %v), want $34", got, ok)
+		}
+		if got := cart.ReadPPUByte(0x2000); got != 0 {
+			t.Errorf("ExRAM nametable in mode 2 = $%02X, want 0", got)
+		}
+	})
+
+	t.Run("mode 3", func(t *testing.T) {
+		cart := mmc5Cartridge(t)
+		writeAll(cart, write{0x5104, 2}, write{0x5C00, 0x34}, write{0x5104, 3}, write{0x5C00, 0x56})
+		if got, ok := driven(cart, 0x5C00); !ok || got != 0x34 {
+			t.Errorf("$5C00 = $%02X (driven %v), want the read-only $34", got, ok)
+		}
+	})
+
+	t.Run("mode 1 extended attributes", func(t *testing.T) {
+		cart := mmc5Cartridge(t)
+		writeAll(cart, write{0x5104, 2}, write{0x5C05, 0xC3}, write{0x5104, 1})
+		cart.StartScanline(0, true)
+		cart.SpriteFetches(false)
+		cart.ReadPPUByte(0x2005)
+		if got := cart.ReadPPUByte(0x23C1); got != 0xFF {
+			t.Errorf("attribute = $%02X, want palette 3 as $FF", got)
+		}
+		if got := cart.ReadPPUByte(0x0010); got != 12 {
+			t.Errorf("pattern fetch from bank %d, want 4 KiB bank 3 (12)", got)
+		}
+	})
+}
+
+func TestMMC5Nametables(t *testing.T) {
+	cart := mmc5Cartridge(t)
+	ciram := make([]uint8, ciramSize)
+	cart.ConnectNametableRAM(ciram)
+	// Nametable 0 is CIRAM page 0, 1 page 1, 2 ExRAM and 3 fill mode.
+	writeAll(cart, write{0x5105, 0xE4}, write{0x5106, 0x5A}, write{0x5107, 2})
+	cart.WritePPUByte(0x2000, 1)
+	cart.WritePPUByte(0x2400, 2)
+	cart.WritePPUByte(0x2800, 3)
+	cart.WritePPUByte(0x2C00, 4)
+	if ciram[0] != 1 || ciram[0x400] != 2 {
+		t.Errorf("CIRAM = $%02X, $%02X; want $01, $02", ciram[0], ciram[0x400])
+	}
+	writeAll(cart, write{0x5104, 2})
+	if got := cart.ReadPRGByte(0x5C00); got != 3 {
+		t.Errorf("ExRAM = $%02X, want $03", got)
+	}
+	if got := cart.ReadPPUByte(0x2C00); got != 0x5A {
+		t.Errorf("fill tile = $%02X, want $5A", got)
+	}
+	if got := cart.ReadPPUByte(0x2FC0); got != 0xAA {
+		t.Errorf("fill attribute = $%02X, want $AA", got)
+	}
+}
+
+func TestMMC5Split(t *testing.T) {
+	cart := mmc5Cartridge(t)
+	ciram := make([]uint8, ciramSize)
+	cart.ConnectNametableRAM(ciram)
+	ciram[2] = 0x99
+	// Split the two leftmost tiles, drawn from ExRAM and 4 KiB CHR bank 1.
+	writeAll(cart,
+		write{0x5104, 2}, write{0x5C00, 0x21}, write{0x5C01, 0x22}, write{0x5FC0, 0x03},
+		write{0x5104, 0}, write{0x5200, 0x82}, write{0x5201, 0}, write{0x5202, 1})
+	cart.StartScanline(0, true)
+	cart.SpriteFetches(true)
+	cart.SpriteFetches(false)
+
+	if got := cart.ReadPPUByte(0x2000); got != 0x21 {
+		t.Errorf("tile 0 = $%02X, want $21 from ExRAM", got)
+	}
+	if got := cart.ReadPPUByte(0x23C0); got != 0xFF {
+		t.Errorf("tile 0 attribute = $%02X, want $FF", got)
+	}
+	if got := cart.ReadPPUByte(0x0210); got != 4 {
+		t.Errorf("tile 0 pattern from bank %d, want 4", got)
+	}
+	if got := cart.ReadPPUByte(0x2001); got != 0x22 {
+		t.Errorf("tile 1 = $%02X, want $22 from ExRAM", got)
+	}
+	if got := cart.ReadPPUByte(0x2002); got != 0x99 {
+		t.Errorf("tile 2 = $%02X, want $99 from the nametable", got)
+	}
+	if got := cart.ReadPPUByte(0x0210); got != 0 {
+		t.Errorf("tile 2 pattern from bank %d, want 0", got)
+	}
+}
+
+func TestMMC5IRQ(t *testing.T) {
+	cart := mmc5Cartridge(t)
+	writeAll(cart, write{0x5203, 2}, write{0x5204, 0x80})
+	cart.StartScanline(0, true)
+	cart.StartScanline(1, true)
+	if cart.IRQ() {
+		t.Fatalf("IRQ at scanline 1, want 2")
+	}
+	cart.StartScanline(2, true)
+	if !cart.IRQ() {
+		t.Fatalf("no IRQ at scanline 2")
+	}
+	if got := cart.ReadPRGByte(0x5204); got != 0xC0 {
+		t.Errorf("$5204 = $%02X, want $C0", got)
+	}
+	if cart.IRQ() {
+		t.Errorf("IRQ still asserted after reading $5204")
+	}
+	if got := cart.ReadPRGByte(0x5204); got != 0x40 {
+		t.Errorf("$5204 = $%02X after acknowledge, want $40", got)
+	}
+	cart.StartScanline(240, true)
+	if got := cart.ReadPRGByte(0x5204); got != 0 {
+		t.Errorf("$5204 = $%02X outside the frame, want 0", got)
+	}
+
+	writeAll(cart, write{0x5204, 0})
+	for scanline := 0; scanline <= 2; scanline++ {
+		cart.StartScanline(scanline, true)
+	}
+	if cart.IRQ() {
+		t.Errorf("IRQ asserted while disabled")
+	}
+	if got := cart.ReadPRGByte(0x5204); got != 0xC0 {
+		t.Errorf("$5204 = $%02X while disabled, want $C0", got)
+	}
+}
+
+func TestMMC5Multiplier(t *testing.T) {
+	cart := mmc5Cartridge(t)
+	writeAll(cart, write{0x5205, 200}, write{0x5206, 100})
+	if lo, hi := cart.ReadPRGByte(0x5205), cart.ReadPRGByte(0x5206); lo != 0x20 || hi != 0x4E {
+		t.Errorf("200 * 100 = $%02X%02X, want $4E20", hi, lo)
+	}
+}
+
+// vrcBoards lists the VRC2 and VRC4 variants with the address lines, as
+// masks, that select register bits 0 and 1.
+var vrcBoards = []struct {
+	name         string
+	mapper       int
+	submapper    int
+	line0, line1 uint16
+}{
+	{"mapper 21 A1/A2", 21, 0, lineA1, lineA2},
+	{"mapper 21 A6/A7", 21, 0, lineA6, lineA7},
+	{"VRC4a", 21, 1, lineA1, lineA2},
+	{"VRC4c", 21, 2, lineA6, lineA7},
+	{"VRC2a", 22, 0, lineA1, lineA0},
+	{"mapper 23 A0/A1", 23, 0, lineA0, lineA1},
+	{"mapper 23 A2/A3", 23, 0, lineA2, lineA3},
+	{"VRC4f", 23, 1, lineA0, lineA1},
+	{"VRC4e", 23, 2, lineA2, lineA3},
+	{"VRC2b", 23, 3, lineA0, lineA1},
+	{"mapper 25 A1/A0", 25, 0, lineA1, lineA0},
+	{"mapper 25 A3/A2", 25, 0, lineA3, lineA2},
+	{"VRC4b", 25, 1, lineA1, lineA0},
+	{"VRC4d", 25, 2, lineA3, lineA2},
+	{"VRC2c", 25, 3, lineA1, lineA0},
+}
+
+func TestVRC4AddressLines(t *testing.T) {
+	var tests []mapperTest
+	for _, board := range vrcBoards {
+		l0, l1 := board.line0, board.line1
+		// CHR bank 0 is $B000 (low) and $B000+line0 (high), bank 1
+		// $B000+line1 and $B000+both.
+		test := mapperTest{
+			name: board.name, mapper: board.mapper, submapper: board.submapper,
+			prgSize: 0x40000, chrSize: 0x40000,
+			writes: []write{
+				{0xB000, 5}, {0xB000 | l0, 1}, {0xB000 | l1, 6}, {0xB000 | l0 | l1, 0},
+				{0xE000 | l1, 3}, {0xE000 | l0 | l1, 2},
+			},
+			chr: map[uint16]uint8{0x0000: 0x15, 0x0400: 6, 0x1C00: 0x23},
+		}
+		if board.mapper == 22 {
+			// VRC2a drops the low bit of each CHR bank.
+			test.chr = map[uint16]uint8{0x0000: 0x0A, 0x0400: 3, 0x1C00: 0x11}
+		}
+		tests = append(tests, test)
+	}
+	runMapperTests(t, tests)
+}
+
+func TestVRC4OtherLinesIgnored(t *testing.T) {
+	runMapperTests(t, []mapperTest{
+		{
+			// VRC4a does not see A6, so $B040 is the low half of bank 0.
+			name: "VRC4a", mapper: 21, submapper: 1, prgSize: 0x40000, chrSize: 0x40000,
+			writes: []write{{0xB002, 1}, {0xB040, 7}},
+			chr:    map[uint16]uint8{0x0000: 0x17},
+		},
+		{
+			name: "VRC4c", mapper: 21, submapper: 2, prgSize: 0x40000, chrSize: 0x40000,
+			writes: []write{{0xB040, 1}, {0xB002, 7}},
+			chr:    map[uint16]uint8{0x0000: 0x17},
+		},
+		{
+			name: "VRC4e", mapper: 23, submapper: 2, prgSize: 0x40000, chrSize: 0x40000,
+			writes: []write{{0xB004, 1}, {0xB001, 7}},
+			chr:    map[uint16]uint8{0x0000: 0x17},
+		},
+	})
+}
+
+func TestVRC4(t *testing.T) {
+	runMapperTests(t, []mapperTest{
+		{
+			name: "PRG banks", mapper: 21, submapper: 1, prgSize: 0x40000, chrSize: 0x40000,
+			writes: []write{{0x8000, 3}, {0xA000, 4}},
+			prg:    map[uint16]uint8{0x8000: 3, 0xA000: 4, 0xC000: 30, 0xE000: 31},
+		},
+		{
+			name: "PRG swap mode", mapper: 21, submapper: 1, prgSize: 0x40000, chrSize: 0x40000,
+			writes: []write{{0x8000, 3}, {0xA000, 4}, {0x9004, 0x02}},
+			prg:    map[uint16]uint8{0x8000: 30, 0xA000: 4, 0xC000: 3, 0xE000: 31},
+		},
+		{
+			name: "single-screen mirroring", mapper: 21, submapper: 1, prgSize: 0x40000, chrSize: 0x40000,
+			writes:    []write{{0x9000, 3}},
+			mirroring: MirrorSingleUpper,
+		},
+		{
+			name: "VRC2 mirroring", mapper: 23, submapper: 3, prgSize: 0x40000, chrSize: 0x40000,
+			writes:    []write{{0x9000, 3}},
+			mirroring: MirrorHorizontal,
+		},
+		{
+			name: "VRC2 has no PRG swap mode", mapper: 23, submapper: 3, prgSize: 0x40000, chrSize: 0x40000,
+			writes:    []write{{0x8000, 3}, {0x9002, 0x02}},
+			prg:       map[uint16]uint8{0x8000: 3, 0xC000: 30},
+			mirroring: MirrorVertical,
+		},
+	})
+}
+
+func TestVRCIRQ(t *testing.T) {
+	t.Run("cycle mode", func(t *testing.T) {
+		// VRC4a: $F000/$F002 set the latch, $F004 is control and $F006
+		// acknowledge.
+		cart := mapperCartridge(t, 21, 1, 0x40000, 0x40000)
+		writeAll(cart, write{0xF000, 0x0D}, write{0xF002, 0x0F}, write{0xF004, 0x06})
+		stepCPU(cart, 2)
+		if cart.IRQ() {
+			t.Fatalf("IRQ after 2 cycles, want 3")
+		}
+		stepCPU(cart, 1)
+		if !cart.IRQ() {
+			t.Fatalf("no IRQ after 3 cycles")
+		}
+		writeAll(cart, write{0xF006, 0})
+		if cart.IRQ() {
+			t.Errorf("IRQ still asserted after acknowledge")
+		}
+		// Without enableOnAck the acknowledge also stops the counter.
+		stepCPU(cart, 1000)
+		if cart.IRQ() {
+			t.Errorf("IRQ after acknowledge disabled the counter")
+		}
+	})
+
+	t.Run("prescaler mode", func(t *testing.T) {
+		cart := mapperCartridge(t, 21, 1, 0x40000, 0x40000)
+		// Three counts take three scanlines: 341 CPU cycles.
+		writeAll(cart, write{0xF000, 0x0D}, write{0xF002, 0x0F}, write{0xF004, 0x02})
+		stepCPU(cart, 340)
+		if cart.IRQ() {
+			t.Fatalf("IRQ after 340 cycles, want 341")
+		}
+		stepCPU(cart, 1)
+		if !cart.IRQ() {
+			t.Fatalf("no IRQ after 341 cycles")
+		}
+	})
+
+	t.Run("enable on acknowledge", func(t *testing.T) {
+		var irq vrcIRQ
+		irq.latch = 0xFF
+		irq.writeControl(0x07)
+		irq.step()
+		if !irq.pending {
+			t.Fatalf("no IRQ at reload")
+		}
+		irq.acknowledge()
+		if irq.pending || !irq.enabled {
+			t.Fatalf("after acknowledge: pending %v, enabled %v; want false, true", irq.pending, irq.enabled)
+		}
+		// The counter reloaded from the latch and keeps running.
+		irq.step()
+		if !irq.pending {
+			t.Errorf("no IRQ after the acknowledge kept the counter enabled")
+		}
+	})
+
+	t.Run("control reloads the counter and clears the IRQ", func(t *testing.T) {
+		irq := vrcIRQ{latch: 0x10, counter: 0x80, pending: true}
+		irq.writeControl(0x04)
+		if irq.pending || irq.counter != 0x80 {
+			t.Errorf("disabled: pending %v, counter $%02X; want false, $80", irq.pending, irq.counter)
+		}
+		irq.writeControl(0x06)
+		if irq.counter != 0x10 {
+			t.Errorf("enabled: counter $%02X, want the latch $10", irq.counter)
+		}
+	})
+
+	t.Run("VRC2 has no IRQ", func(t *testing.T) {
+		cart := mapperCartridge(t, 23, 3, 0x40000, 0x40000)
+		writeAll(cart, write{0xF000, 0x0F}, write{0xF001, 0x0F}, write{0xF002, 0x06})
+		stepCPU(cart, 10)
+		if cart.IRQ() {
+			t.Errorf("VRC2 raised an IRQ")
+		}
+	})
+}
+
+func TestVRC6(t *testing.T) {
+	var tests []mapperTest
+	for _, board := range []struct {
+		mapper int
+		// addresses maps register numbers 1 and 2 to their offsets.
+		reg1, reg2 uint16
+	}{{24, 1, 2}, {26, 2, 1}} {
+		name := fmt.Sprintf("mapper %d ", board.mapper)
+		tests = append(tests,
+			mapperTest{
+				name: name + "PRG banks", mapper: board.mapper, prgSize: 0x40000, chrSize: 0x40000,
+				writes:    []write{{0x8000, 2}, {0xC000, 7}},
+				prg:       map[uint16]uint8{0x8000: 4, 0xA000: 5, 0xC000: 7, 0xE000: 31},
+				mirroring: MirrorVertical,
+			},
+			mapperTest{
+				name: name + "1 KiB CHR", mapper: board.mapper, prgSize: 0x40000, chrSize: 0x40000,
+				writes: []write{
+					{0xD000, 10}, {0xD000 | board.reg1, 11}, {0xD000 | board.reg2, 12}, {0xD003, 13},
+					{0xE000, 14}, {0xE000 | board.reg1, 15}, {0xE000 | board.reg2, 16}, {0xE003, 17},
+				},
+				chr: map[uint16]uint8{
+					0x0000: 10, 0x0400: 11, 0x0800: 12, 0x0C00: 13,
+					0x1000: 14, 0x1400: 15, 0x1800: 16, 0x1C00: 17,
+				},
+				mirroring: MirrorVertical,
+			},
+			mapperTest{
+				name: name + "2 KiB CHR", mapper: board.mapper, prgSize: 0x40000, chrSize: 0x40000,
+				writes:    []write{{0xB003, 0x01}, {0xD000 | board.reg1, 5}},
+				chr:       map[uint16]uint8{0x0800: 10, 0x0C00: 11},
+				mirroring: MirrorVertical,
+			},
+			mapperTest{
+				name: name + "mixed CHR", mapper: board.mapper, prgSize: 0x40000, chrSize: 0x40000,
+				writes:    []write{{0xB003, 0x02}, {0xD003, 9}, {0xE000, 3}, {0xE000 | board.reg1, 4}},
+				chr:       map[uint16]uint8{0x0C00: 9, 0x1000: 6, 0x1400: 7, 0x1800: 8, 0x1C00: 9},
+				mirroring: MirrorVertical,
+			},
+			mapperTest{
+				name: name + "mirroring", mapper: board.mapper, prgSize: 0x40000, chrSize: 0x40000,
+				writes:    []write{{0xB003, 0x0C}},
+				mirroring: MirrorSingleUpper,
+			},
+		)
+	}
+	runMapperTests(t, tests)
+
+	for _, board := range []struct {
+		mapper  int
+		control uint16
+	}{{24, 0xF001}, {26, 0xF002}} {
+		cart := mapperCartridge(t, board.mapper, 0, 0x40000, 0x40000)
+		writeAll(cart, write{0xF000, 0xFF}, write{board.control, 0x06})
+		stepCPU(cart, 1)
+		if !cart.IRQ() {
+			t.Errorf("mapper %d: $%04X did not start the IRQ counter", board.mapper, board.control)
+		}
+	}
+}
+
+func TestVRC7(t *testing.T) {
+	var tests []mapperTest
+	for _, board := range []struct {
+		name      string
+		submapper int
+		line      uint16
+	}{
+		{"both lines A3", 0, 0x08},
+		{"both lines A4", 0, 0x10},
+		{"VRC7b", 1, 0x08},
+		{"VRC7a", 2, 0x10},
+	} {
+		tests = append(tests,
+			mapperTest{
+				name: board.name + " banks", mapper: 85, submapper: board.submapper,
+				prgSize: 0x80000, chrSize: 0x40000,
+				writes: []write{
+					{0x8000, 1}, {0x8000 | board.line, 2}, {0x9000, 3},
+					{0xA000, 4}, {0xA000 | board.line, 5}, {0xD000, 10}, {0xD000 | board.line, 11},
+				},
+				prg:       map[uint16]uint8{0x8000: 1, 0xA000: 2, 0xC000: 3, 0xE000: 63},
+				chr:       map[uint16]uint8{0x0000: 4, 0x0400: 5, 0x1800: 10, 0x1C00: 11},
+				mirroring: MirrorVertical,
+			},
+			mapperTest{
+				name: board.name + " mirroring", mapper: 85, submapper: board.submapper,
+				prgSize: 0x80000, chrSize: 0x40000,
+				writes:    []write{{0xE000, 0x02}},
+				mirroring: MirrorSingleLower,
+			},
+		)
+	}
+	runMapperTests(t, tests)
+
+	cart := mapperCartridge(t, 85, 2, 0x80000, 0x40000)
+	writeAll(cart, write{0xE010, 0xFE}, write{0xF000, 0x06})
+	stepCPU(cart, 2)
+	if !cart.IRQ() {
+		t.Fatalf("no IRQ after 2 cycles from a latch of $FE")
+	}
+	writeAll(cart, write{0xF010, 0})
+	if cart.IRQ() {
+		t.Errorf("IRQ still asserted after acknowledge")
+	}
+}
+
+func TestMMC2(t *testing.T) {
+	runMapperTests(t, []mapperTest{
+		{
+			name: "MMC2 PRG", mapper: 9, prgSize: 0x20000, chrSize: 0x20000,
+			writes:    []write{{0xA000, 3}, {0xF000, 1}},
+			prg:       map[uint16]uint8{0x8000: 3, 0xA000: 13, 0xC000: 14, 0xE000: 15},
+			mirroring: MirrorHorizontal,
+		},
+		{
+			name: "MMC4 PRG", mapper: 10, prgSize: 0x20000, chrSize: 0x20000,
+			writes:    []write{{0xA000, 3}, {0xF000, 0}},
+			prg:       map[uint16]uint8{0x8000: 6, 0xA000: 7, 0xC000: 14, 0xE000: 15},
+			mirroring: MirrorVertical,
+		},
+	})
+}
+
+func TestMMC2Latches(t *testing.T) {
+	// The $FD banks are 4 KiB banks 1 and 3 and the $FE banks 2 and 4, so
+	// the first 1 KiB page of each table reads 4, 12, 8 or 16.
+	banks := []write{{0xB000, 1}, {0xC000, 2}, {0xD000, 3}, {0xE000, 4}}
+	tests := []struct {
+		name  string
+		reads []uint16
+		// mmc2 and mmc4 give the pages seen at $0000 and $1000 afterwards.
+		mmc2, mmc4 [2]uint8
+	}{
+		{"power on selects $FE", nil, [2]uint8{8, 16}, [2]uint8{8, 16}},
+		{"$0FD8", []uint16{0x0FD8}, [2]uint8{4, 16}, [2]uint8{4, 16}},
+		{"$0FDF", []uint16{0x0FDF}, [2]uint8{8, 16}, [2]uint8{4, 16}},
+		{"$0FD8 then $0FE8", []uint16{0x0FD8, 0x0FE8}, [2]uint8{8, 16}, [2]uint8{8, 16}},
+		{"$0FD8 then $0FEF", []uint16{0x0FD8, 0x0FEF}, [2]uint8{4, 16}, [2]uint8{8, 16}},
+		{"$1FD8", []uint16{0x1FD8}, [2]uint8{8, 12}, [2]uint8{8, 12}},
+		{"$1FDF", []uint16{0x1FDF}, [2]uint8{8, 12}, [2]uint8{8, 12}},
+		{"$1FDF then $1FEF", []uint16{0x1FDF, 0x1FEF}, [2]uint8{8, 16}, [2]uint8{8, 16}},
+		{"other tiles", []uint16{0x0FD0, 0x0FF8, 0x1FE0, 0x1FD7}, [2]uint8{8, 16}, [2]uint8{8, 16}},
+	}
+	for _, test := range tests {
+		for _, board := range []struct {
+			mapper int
+			want   [2]uint8
+		}{{9, test.mmc2}, {10, test.mmc4}} {
+			t.Run(fmt.Sprintf("mapper %d %s", board.mapper, test.name), func(t *testing.T) {
+				cart := mapperCartridge(t, board.mapper, 0, 0x20000, 0x20000)
+				writeAll(cart, banks...)
+				for _, address := range test.reads {
+					cart.ReadPPUByte(address)
+				}
+				got := [2]uint8{cart.ReadPPUByte(0x0000), cart.ReadPPUByte(0x1000)}
+				if got != board.want {
+					t.Errorf("pages %v, want %v", got, board.want)
+				}
+			})
+		}
+	}
+}
+
+func TestMMC2LatchTiming(t *testing.T) {
+	cart := mapperCartridge(t, 9, 0, 0x20000, 0x20000)
+	writeAll(cart, write{0xB000, 1}, write{0xC000, 2})
+	// The fetch that trips the latch still reads the old bank, 2.
+	if got := cart.ReadPPUByte(0x0FD8); got != 11 {
+		t.Errorf("tripping fetch read page %d, want 11 from the $FE bank", got)
+	}
+	if got := cart.ReadPPUByte(0x0FD8); got != 7 {
+		t.Errorf("next fetch read page %d, want 7 from the $FD bank", got)
+	}
+}
+
+func TestFME7(t *testing.T) {
+	command := func(cmd, param uint8) []write {
+		return []write{{0x8000, cmd}, {0xA000, param}}
+	}
+	var banks []write
+	for cmd := uint8(0); cmd < 8; cmd++ {
+		banks = append(banks, command(cmd, 10+cmd)...)
+	}
+	banks = append(banks, command(9, 3)...)
+	banks = append(banks, command(10, 4)...)
+	banks = append(banks, command(11, 5)...)
+	runMapperTests(t, []mapperTest{
+		{
+			name: "banks", mapper: 69, prgSize: 0x40000, chrSize: 0x40000,
+			writes:    banks,
+			prg:       map[uint16]uint8{0x8000: 3, 0xA000: 4, 0xC000: 5, 0xE000: 31},
+			chr:       map[uint16]uint8{0x0000: 10, 0x0400: 11, 0x1800: 16, 0x1C00: 17},
+			mirroring: MirrorVertical,
+		},
+		{
+			name: "ROM at $6000", mapper: 69, prgSize: 0x40000, chrSize: 0x40000,
+			writes:    append(command(8, 0x05), write{0x6000, 0x42}),
+			prg:       map[uint16]uint8{0x6000: 5, 0x7FFF: 5},
+			mirroring: MirrorVertical,
+		},
+		{
+			name: "mirroring", mapper: 69, prgSize: 0x40000, chrSize: 0x40000,
+			writes:    command(12, 2),
+			mirroring: MirrorSingleLower,
+		},
+	})
+}
+
+func TestFME7LowBank(t *testing.T) {
+	cart := mapperCartridge(t, 69, 0, 0x40000, 0x40000)
+	lowBank := func(data uint8) {
+		writeAll(cart, write{0x8000, 8}, write{0xA000, data})
+	}
+	lowBank(0xC0)
+	writeAll(cart, write{0x6000, 0x42})
+	if got := cart.ReadPRGByte(0x6000); got != 0x42 {
+		t.Errorf("RAM = $%02X, want $42", got)
+	}
+
+	lowBank(0x40)
+	if _, driven := cart.ReadPRGPartial(0x6000); driven != 0 {
+		t.Errorf("disabled RAM drives the bus")
+	}
+	writeAll(cart, write{0x6000, 0x43})
+
+	lowBank(0x07)
+	if got := cart.ReadPRGByte(0x6000); got != 7 {
+		t.Errorf("$6000 = %d, want ROM bank 7", got)
+	}
+	writeAll(cart, write{0x6000, 0x44})
+
+	lowBank(0xC0)
+	if got := cart.ReadPRGByte(0x6000); got != 0x42 {
+		t.Errorf("RAM = $%02X after writes while disabled or ROM, want $42", got)
+	}
+}
+
+func TestFME7IRQ(t *testing.T) {
+	command := func(cmd, param uint8) []write {
+		return []write{{0x8000, cmd}, {0xA000, param}}
+	}
+	tests := []struct {
+		name    string
+		counter uint16
+		control uint8
+		// cycles is when the IRQ is expected, or 0 for never.
+		cycles int
+	}{
+		{"underflow", 2, 0x81, 3},
+		{"16-bit", 0x0100, 0x81, 0x101},
+		{"IRQ disabled", 2, 0x80, 0},
+		{"counter stopped", 2, 0x01, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cart := mapperCartridge(t, 69, 0, 0x40000, 0x40000)
+			writeAll(cart, command(14, uint8(test.counter))...)
+			writeAll(cart, command(15, uint8(test.counter>>8))...)
+			writeAll(cart, command(13, test.control)...)
+			if test.cycles == 0 {
+				stepCPU(cart, 0x20000)
+				if cart.IRQ() {
+					t.Errorf("IRQ raised")
+				}
+				return
+			}
+			stepCPU(cart, test.cycles-1)
+			if cart.IRQ() {
+				t.Fatalf("IRQ after %d cycles, want %d", test.cycles-1, test.cycles)
+			}
+			stepCPU(cart, 1)
+			if !cart.IRQ() {
+				t.Fatalf("no IRQ after %d cycles", test.cycles)
+			}
+			writeAll(cart, command(13, test.control)...)
+			if cart.IRQ() {
+				t.Errorf("IRQ still asserted after writing command 13")
+			}
+		})
+	}
+}
+
+func TestSunsoft5B(t *testing.T) {
+	cart := mapperCartridge(t, 69, 0, 0x40000, 0x40000)
+	// Channel A: period 1 and full volume, tone only.
+	for _, reg := range [][2]uint8{{0, 1}, {1, 0}, {7, 0x3E}, {8, 0x0F}} {
+		writeAll(cart, write{0xC000, reg[0]}, write{0xE000, reg[1]})
+	}
+	full := sunsoft5BVolumes[31] * sunsoft5BLevel
+	for _, test := range []struct {
+		cycles int
+		want   float32
+	}{{15, 0}, {1, full}, {16, 0}, {16, full}} {
+		stepCPU(cart, test.cycles)
+		if got := cart.AudioOutput(); got != test.want {
+			t.Errorf("output %v, want %v", got, test.want)
+		}
+	}
+
+	t.Run("envelope", func(t *testing.T) {
+		var s sunsoft5B
+		s.reset()
+		for _, reg := range [][2]uint8{{11, 1}, {12, 0}, {13, 0x00}} {
+			s.writeAddress(reg[0])
+			s.writeData(reg[1])
+		}
+		if got := s.envelopeLevel(); got != 31 {
+			t.Fatalf("decay starts at %d, want 31", got)
+		}
+		for i := 0; i < 8; i++ {
+			s.step()
+		}
+		if got := s.envelopeLevel(); got != 30 {
+			t.Errorf("after one step the level is %d, want 30", got)
+		}
+		for i := 0; i < 31*8+64; i++ {
+			s.step()
+		}
+		if got := s.envelopeLevel(); got != 0 || !s.envelopeHeld {
+			t.Errorf("level %d, held %v after the decay; want 0, true", got, s.envelopeHeld)
+		}
+	})
+}
+
+func TestN163(t *testing.T) {
+	runMapperTests(t, []mapperTest{
+		{
+			name: "banks", mapper: 19, prgSize: 0x40000, chrSize: 0x40000,
+			writes: []write{
+				{0xE000, 3}, {0xE800, 4}, {0xF000, 5},
+				{0x8000, 10}, {0x8800, 11}, {0xB800, 17},
+			},
+			prg: map[uint16]uint8{0x8000: 3, 0xA000: 4, 0xC000: 5, 0xE000: 31},
+			chr: map[uint16]uint8{0x0000: 10, 0x0400: 11, 0x1C00: 17},
+		},
+		{
+			name: "CHR ROM nametables", mapper: 19, prgSize: 0x40000, chrSize: 0x40000,
+			writes: []write{{0xC000, 5}, {0xD800, 0xDF}},
+			chr:    map[uint16]uint8{0x2000: 5, 0x2C00: 0xDF},
+		},
+	})
+}
+
+func TestN163NametableRAM(t *testing.T) {
+	cart := mapperCartridge(t, 19, 0, 0x40000, 0x40000)
+	ciram := make([]uint8, ciramSize)
+	cart.ConnectNametableRAM(ciram)
+
+	// Banks $E0 and up select nametable RAM by their low bit.
+	writeAll(cart, write{0x8000, 0xE0}, write{0xA000, 0xE1}, write{0xC000, 0xE1}, write{0xC800, 0xFE})
+	cart.WritePPUByte(0x0000, 0x42)
+	cart.WritePPUByte(0x1000, 0x43)
+	if ciram[0] != 0x42 || ciram[0x400] != 0x43 {
+		t.Errorf("CIRAM = $%02X, $%02X; want $42, $43", ciram[0], ciram[0x400])
+	}
+	if got := cart.ReadPPUByte(0x2000); got != 0x43 {
+		t.Errorf("nametable 0 = $%02X, want page 1's $43", got)
+	}
+	if got := cart.ReadPPUByte(0x2400); got != 0x42 {
+		t.Errorf("nametable 1 = $%02X, want page 0's $42", got)
+	}
+
+	// $E800 bits 6 and 7 give the lower and upper pattern tables CHR ROM
+	// even for banks $E0 and up, but leave the nametables alone.
+	for _, test := range []struct {
+		e800             uint8
+		lower, upper, nt uint8
+	}{
+		{0x00, 0x42, 0x43, 0x43},
+		{0x40, 0xE0, 0x43, 0x43},
+		{0x80, 0x42, 0xE1, 0x43},
+		{0xC0, 0xE0, 0xE1, 0x43},
+	} {
+		writeAll(cart, write{0xE800, test.e800})
+		got := [3]uint8{cart.ReadPPUByte(0x0000), cart.ReadPPUByte(0x1000), cart.ReadPPUByte(0x2000)}
+		if want := [3]uint8{test.lower, test.upper, test.nt}; got != want {
+			t.Errorf("$E800 = $%02X: $0000, $1000, $2000 = $%02X, want $%02X", test.e800, got, want)
+		}
+	}
+}
+
+func TestN163IRQ(t *testing.T) {
+	cart := mapperCartridge(t, 19, 0, 0x40000, 0x40000)
+	writeAll(cart, write{0x5000, 0x34}, write{0x5800, 0x12})
+	if lo, hi := cart.ReadPRGByte(0x5000), cart.ReadPRGByte(0x5800); lo != 0x34 || hi != 0x12 {
+		t.Errorf("counter reads $%02X%02X, want $1234", hi, lo)
+	}
+	stepCPU(cart, 10)
+	if got := cart.ReadPRGByte(0x5000); got != 0x34 {
+		t.Errorf("disabled counter moved to $%02X", got)
+	}
+
+	writeAll(cart, write{0x5000, 0xFD}, write{0x5800, 0xFF})
+	if hi := cart.ReadPRGByte(0x5800); hi != 0xFF {
+		t.Errorf("$5800 = $%02X, want $FF with the enable bit", hi)
+	}
+	stepCPU(cart, 1)
+	if cart.IRQ() {
+		t.Fatalf("IRQ at $7FFE")
+	}
+	stepCPU(cart, 1)
+	if !cart.IRQ() {
+		t.Fatalf("no IRQ at $7FFF")
+	}
+	stepCPU(cart, 10)
+	if lo, hi := cart.ReadPRGByte(0x5000), cart.ReadPRGByte(0x5800); lo != 0xFF || hi != 0xFF {
+		t.Errorf("counter reads $%02X%02X, want it stopped at $7FFF with the enable bit", hi, lo)
+	}
+	writeAll(cart, write{0x5000, 0})
+	if cart.IRQ() {
+		t.Errorf("IRQ still asserted after a $5000 write")
+	}
+}
+
+func TestN163RAMProtect(t *testing.T) {
+	tests := []struct {
+		name    string
+		protect uint8
+		// writable lists whether each 2 KiB chunk takes writes.
+		writable [4]bool
+	}{
+		{"$40 unlocks", 0x40, [4]bool{true, true, true, true}},
+		{"$41 protects the first chunk", 0x41, [4]bool{false, true, true, true}},
+		{"$4A protects the second and fourth", 0x4A, [4]bool{true, false, true, false}},
+		{"$4F protects all", 0x4F, [4]bool{}},
+		{"$00 locks", 0x00, [4]bool{}},
+		{"$C0 locks", 0xC0, [4]bool{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cart := mapperCartridge(t, 19, 0, 0x40000, 0x40000)
+			writeAll(cart, write{0xF800, test.protect})
+			for chunk, want := range test.writable {
+				address := 0x6000 + uint16(chunk)*0x0800
+				writeAll(cart, write{address, 0x42})
+				if got := cart.ReadPRGByte(address) == 0x42; got != want {
+					t.Errorf("chunk %d writable = %v, want %v", chunk, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestN163Sound(t *testing.T) {
+	cart := mapperCartridge(t, 19, 0, 0x40000, 0x40000)
+	writeAll(cart, write{0xF800, 0x80}, write{0x4800, 1}, write{0x4800, 2}, write{0x4800, 3})
+	writeAll(cart, write{0xF800, 0x80})
+	for want := uint8(1); want <= 3; want++ {
+		if got := cart.ReadPRGByte(0x4800); got != want {
+			t.Errorf("sound RAM = %d, want %d", got, want)
+		}
+	}
+	writeAll(cart, write{0xF800, 0x01}, write{0x4800, 9}, write{0x4800, 8})
+	if got := cart.ReadPRGByte(0x4800); got != 8 {
+		t.Errorf("without auto-increment sound RAM = %d, want 8", got)
+	}
+
+	// One channel at $78 playing a 4-sample waveform whose first sample,
+	// 10, is 2 above the midpoint, at volume 15.
+	var audio n163Audio
+	audio.ram[0] = 0x3A
+	audio.ram[0x7C] = 0xFC
+	audio.ram[0x7F] = 0x0F
+	for i := 0; i < n163ChannelCycles; i++ {
+		audio.step()
+	}
+	if got, want := audio.output(), float32(2*15)*n163Level; got != want {
+		t.Errorf("output %v, want %v", got, want)
+	}
+}
+
+// submapperNROM is an NROM that records the submapper it was registered for.
+type submapperNROM struct {
+	*nrom
+	submapper int
+}
+
+func TestLookupMapper(t *testing.T) {
+	const number = 4095
+	registerMapper(number, func(b *board) Mapper { return &submapperNROM{&nrom{b}, anySubmapper} })
+	registerSubmapper(number, 3, func(b *board) Mapper { return &submapperNROM{&nrom{b}, 3} })
+	defer func() {
+		delete(mappers, mapperKey{number, anySubmapper})
+		delete(mappers, mapperKey{number, 3})
+	}()
+
+	tests := []struct {
+		submapper int
+		want      int
+	}{
+		{submapper: 3, want: 3},
+		{submapper: 0, want: anySubmapper},
+		{submapper: 5, want: anySubmapper},
+	}
+	for _, test := range tests {
+		newMapper, err := lookupMapper(number, test.submapper)
+		if err != nil {
+			t.Fatalf("lookupMapper(%d, %d): %v", number, test.submapper, err)
+		}
+		if got := newMapper(&board{}).(*submapperNROM).submapper; got != test.want {
+			t.Errorf("lookupMapper(%d, %d) found the mapper for submapper %d, want %d", number, test.submapper, got, test.want)
+		}
+	}
+}
+
+func TestRegisterMapperTwice(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("registering mapper 0 again did not panic")
+		}
+	}()
+	registerMapper(0, newNROM)
+}
+
+func TestUnsupportedMapper(t *testing.T) {
+	tests := []struct {
+		mapper, submapper int
+		message           string
+	}{
+		{mapper: 4094, message: "cartridge: mapper 4094 is not supported"},
+		{mapper: 4094, submapper: 2, message: "cartridge: mapper 4094, submapper 2 is not supported"},
+	}
+	for _, test := range tests {
+		_, err := ParseWithOptions(image(nes20Header(test.mapper, test.submapper, 0x8000, 0x2000), 0x8000, 0x2000), LoadOptions{DisableDatabase: true})
+		var unsupported *UnsupportedMapperError
+		if !errors.As(err, &unsupported) {
+			t.Fatalf("mapper %d.%d: error %v, want *UnsupportedMapperError", test.mapper, test.submapper, err)
+		}
+		if unsupported.Mapper != test.mapper || unsupported.Submapper != test.submapper {
+			t.Errorf("UnsupportedMapperError for %d.%d, want %d.%d", unsupported.Mapper, unsupported.Submapper, test.mapper, test.submapper)
+		}
+		if err.Error() != test.message {
+			t.Errorf("error %q, want %q", err, test.message)
+		}
+	}
+}
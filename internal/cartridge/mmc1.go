@@ -0,0 +1,165 @@
+package cartridge
+
+func init() {
+	registerMapper(1, newMMC1)
+}
+
+// mmc1 is mapper 1, the Nintendo MMC1 on SxROM boards. Its registers are
+// loaded one bit at a time through a 5-bit shift register at $8000-$FFFF;
+// the fifth write copies the value into the register selected by address
+// bits 13-14.
+//
+// The larger boards reuse the CHR bank lines for other purposes when CHR is
+// 8 KiB of RAM: SUROM and SXROM take bit 4 as the 256 KiB PRG outer bank,
+// SOROM and SXROM select the 8 KiB WRAM bank with bits 3 and 2-3, and SNROM
+// disables WRAM with bit 4.
+type mmc1 struct {
+	*board
+
+	shift      uint8
+	shiftCount uint8
+
+	control uint8
+	chr0    uint8
+	chr1    uint8
+	prgBank uint8
+
+	// cycles and lastWrite ignore the second of two writes on consecutive
+	// cycles, as the dummy write of a read-modify-write instruction is.
+	cycles    uint64
+	lastWrite uint64
+	written   bool
+
+	// fixedPRG is set for SEROM and SHROM, submapper 5, whose 32 KiB of
+	// PRG is not banked.
+	fixedPRG bool
+}
+
+// Fields of the control register.
+const (
+	mmc1Mirroring = 0x03
+	mmc1PRGMode   = 0x0C
+	mmc1CHR4K     = 0x10
+)
+
+// Deprecated NES 2.0 submappers that name boards with more WRAM than an
+// iNES header can describe.
+const (
+	mmc1SOROM = 2
+	mmc1SXROM = 4
+)
+
+func newMMC1(b *board) Mapper {
+	switch b.header.Submapper {
+	case mmc1SOROM:
+		b.growPRGRAM(0x4000, true)
+	case mmc1SXROM:
+		b.growPRGRAM(0x8000, true)
+	}
+	m := &mmc1{
+		board:    b,
+		control:  mmc1PRGMode,
+		fixedPRG: b.header.Submapper == 5,
+	}
+	m.updateBanks()
+	return m
+}
+
+func (m *mmc1) StepCPU() {
+	m.cycles++
+}
+
+func (m *mmc1) WritePRG(address uint16, data uint8) {
+	if address < 0x8000 {
+		m.board.WritePRG(address, data)
+		return
+	}
+	consecutive := m.written && m.cycles-m.lastWrite < 2
+	m.written = true
+	m.lastWrite = m.cycles
+	if consecutive {
+		return
+	}
+
+	if data&0x80 != 0 {
+		m.shift = 0
+		m.shiftCount = 0
+		m.control |= mmc1PRGMode
+		m.updateBanks()
+		return
+	}
+	m.shift |= (data & 1) << m.shiftCount
+	m.shiftCount++
+	if m.shiftCount < 5 {
+		return
+	}
+	switch (address >> 13) & 3 {
+	case 0:
+		m.control = m.shift
+	case 1:
+		m.chr0 = m.shift
+	case 2:
+		m.chr1 = m.shift
+	case 3:
+		m.prgBank = m.shift
+	}
+	m.shift = 0
+	m.shiftCount = 0
+	m.updateBanks()
+}
+
+// updateBanks rebuilds the bank tables from the registers.
+func (m *mmc1) updateBanks() {
+	switch m.control & mmc1Mirroring {
+	case 0:
+		m.setMirroring(MirrorSingleLower)
+	case 1:
+		m.setMirroring(MirrorSingleUpper)
+	case 2:
+		m.setMirroring(MirrorVertical)
+	case 3:
+		m.setMirroring(MirrorHorizontal)
+	}
+
+	if m.control&mmc1CHR4K != 0 {
+		m.setCHRBank(0, 0x1000, int(m.chr0))
+		m.setCHRBank(1, 0x1000, int(m.chr1))
+	} else {
+		m.setCHRBank(0, 0x2000, int(m.chr0>>1))
+	}
+
+	// The CHR bank register drives the extra PRG and WRAM lines on the
+	// large boards. In 4 KiB mode the first one is used.
+	outer := 0
+	if len(m.prg) > 0x40000 {
+		outer = int(m.chr0 & 0x10)
+	}
+	switch len(m.prgRAM) {
+	case 0x4000:
+		m.setRAMBank(int(m.chr0>>3) & 1)
+	case 0x8000:
+		m.setRAMBank(int(m.chr0>>2) & 3)
+	}
+	snrom := m.chrWritable && len(m.prgRAM) <= 0x2000 && len(m.prg) <= 0x40000
+	m.ramDisabled = m.prgBank&0x10 != 0 || snrom && m.chr0&0x10 != 0
+
+	bank := outer | int(m.prgBank&0x0F)
+	switch {
+	case m.fixedPRG:
+		m.setPRGBank(0, 0x8000, 0)
+	case m.control&mmc1PRGMode < 0x08:
+		m.setPRGBank(0, 0x8000, bank>>1)
+	case m.control&mmc1PRGMode == 0x08:
+		m.setPRGBank(0, 0x4000, outer)
+		m.setPRGBank(1, 0x4000, bank)
+	default:
+		m.setPRGBank(0, 0x4000, bank)
+		m.setPRGBank(1, 0x4000, outer|0x0F)
+	}
+}
+
+func (m *mmc1) stateFields() []interface{} {
+	return append(m.board.stateFields(),
+		&m.shift, &m.shiftCount, &m.control, &m.chr0, &m.chr1, &m.prgBank,
+		&m.cycles, &m.lastWrite, &m.written)
+}
@@ -0,0 +1,106 @@
+package cartridge
+
+func init() {
+	registerMapper(9, newMMC2)
+	registerMapper(10, newMMC4)
+}
+
+// mmc2 is mapper 9, the Nintendo MMC2 on PxROM boards, and mapper 10, the
+// MMC4 on FxROM boards. Each pattern table has two 4 KiB CHR banks and a
+// latch that picks between them; the latches flip when the PPU fetches
+// tile $FD or $FE, so a game can switch banks partway down the screen just
+// by placing those tiles. The MMC4 swaps 16 KiB of PRG instead of 8 KiB.
+type mmc2 struct {
+	*board
+
+	mmc4 bool
+
+	prgReg  uint8
+	chrRegs [2][2]uint8
+	// latches holds the selected bank of each pattern table: 0 for $FD
+	// and 1 for $FE.
+	latches [2]uint8
+}
+
+func newMMC2(b *board) Mapper {
+	return newLatchMapper(b, false)
+}
+
+func newMMC4(b *board) Mapper {
+	return newLatchMapper(b, true)
+}
+
+func newLatchMapper(b *board, mmc4 bool) *mmc2 {
+	m := &mmc2{
+		board:   b,
+		mmc4:    mmc4,
+		latches: [2]uint8{1, 1},
+	}
+	m.updateBanks()
+	return m
+}
+
+func (m *mmc2) WritePRG(address uint16, data uint8) {
+	if address < 0xA000 {
+		m.board.WritePRG(address, data)
+		return
+	}
+	switch address & 0xF000 {
+	case 0xA000:
+		m.prgReg = data & 0x0F
+	case 0xB000, 0xC000, 0xD000, 0xE000:
+		register := (address - 0xB000) >> 12
+		m.chrRegs[register>>1][register&1] = data & 0x1F
+	case 0xF000:
+		if data&1 == 0 {
+			m.setMirroring(MirrorVertical)
+		} else {
+			m.setMirroring(MirrorHorizontal)
+		}
+	}
+	m.updateBanks()
+}
+
+// updateBanks rebuilds the bank tables from the registers and latches.
+func (m *mmc2) updateBanks() {
+	if m.mmc4 {
+		m.setPRGBank(0, 0x4000, int(m.prgReg))
+		m.setPRGBank(1, 0x4000, -1)
+	} else {
+		m.setPRGBank(0, prgWindow, int(m.prgReg))
+		m.setPRGBank(1, prgWindow, -3)
+		m.setPRGBank(2, prgWindow, -2)
+		m.setPRGBank(3, prgWindow, -1)
+	}
+	for table, latch := range m.latches {
+		m.setCHRBank(table, 0x1000, int(m.chrRegs[table][latch]))
+	}
+}
+
+// ReadCHR reads pattern data and then updates the latches: the fetch that
+// trips a latch still comes from the old bank.
+func (m *mmc2) ReadCHR(address uint16) uint8 {
+	data := m.board.ReadCHR(address)
+
+	table := address >> 12
+	tile := address & 0x0FF8
+	if table == 0 && !m.mmc4 {
+		// The MMC2 only watches the first byte of the tile in the lower
+		// pattern table.
+		tile = address & 0x0FFF
+	}
+	switch tile {
+	case 0x0FD8:
+		m.latches[table] = 0
+	case 0x0FE8:
+		m.latches[table] = 1
+	default:
+		return data
+	}
+	m.updateBanks()
+	return data
+}
+
+func (m *mmc2) stateFields() []interface{} {
+	return append(m.board.stateFields(), &m.prgReg, &m.chrRegs, &m.latches)
+}
@@ -0,0 +1,245 @@
+package cartridge
+
+func init() {
+	registerMapper(4, newMMC3)
+	registerMapper(118, newTxSROM)
+	registerMapper(119, newTQROM)
+}
+
+// Submappers of mapper 4.
+const (
+	mmc3MMC6 = 1
+	// mmc3RevA selects the MMC3A, which uses the old IRQ behavior.
+	mmc3RevA = 4
+)
+
+// mmc3 is mapper 4, the Nintendo MMC3 on TxROM boards, which has eight bank
+// registers written through $8000/$8001 and a scanline counter clocked by
+// PPU A12. The same chip drives MMC6 (HKROM), TxSROM (mapper 118) and
+// TQROM (mapper 119).
+type mmc3 struct {
+	*board
+
+	bankSelect uint8
+	registers  [8]uint8
+	mirror     uint8
+	ramControl uint8
+
+	irqLatch   uint8
+	irqCounter uint8
+	irqReload  bool
+	irqEnabled bool
+	irqPending bool
+
+	// oldIRQ selects the MMC3A behavior, where reloading the counter to 0
+	// does not raise an IRQ.
+	oldIRQ bool
+	// mmc6 selects the 1 KiB of RAM and its protection scheme inside MMC6.
+	mmc6 bool
+	// txsrom takes the nametable arrangement from bit 7 of the CHR banks.
+	txsrom bool
+	// chrRAM is the 8 KiB of CHR RAM on TQROM, selected by bit 6 of a CHR
+	// bank; nil on other boards.
+	chrRAM []uint8
+	// chrPages holds the 1 KiB CHR bank number mapped in each window.
+	chrPages [8]int
+}
+
+// Fields of the bank select register.
+const (
+	mmc3Register   = 0x07
+	mmc6RAMEnable  = 0x20
+	mmc3PRGMode    = 0x40
+	mmc3CHRInverse = 0x80
+)
+
+func newMMC3(b *board) Mapper {
+	m := &mmc3{
+		board:      b,
+		ramControl: 0x80,
+		oldIRQ:     b.header.Submapper == mmc3RevA,
+		mmc6:       b.header.Submapper == mmc3MMC6,
+	}
+	if m.mmc6 {
+		b.growPRGRAM(0x0400, true)
+	}
+	m.updateBanks()
+	return m
+}
+
+func newTxSROM(b *board) Mapper {
+	m := newMMC3(b).(*mmc3)
+	m.txsrom = true
+	m.updateBanks()
+	return m
+}
+
+func newTQROM(b *board) Mapper {
+	m := newMMC3(b).(*mmc3)
+	m.chrRAM = make([]uint8, 0x2000)
+	return m
+}
+
+func (m *mmc3) ReadPRG(address uint16) (uint8, bool) {
+	if m.mmc6 && address >= 0x6000 && address < 0x8000 {
+		return m.readMMC6RAM(address)
+	}
+	return m.board.ReadPRG(address)
+}
+
+func (m *mmc3) WritePRG(address uint16, data uint8) {
+	if address < 0x8000 {
+		if m.mmc6 {
+			m.writeMMC6RAM(address, data)
+		} else {
+			m.board.WritePRG(address, data)
+		}
+		return
+	}
+	even := address&1 == 0
+	switch {
+	case address < 0xA000 && even:
+		m.bankSelect = data
+	case address < 0xA000:
+		m.registers[m.bankSelect&mmc3Register] = data
+	case address < 0xC000 && even:
+		m.mirror = data
+	case address < 0xC000:
+		m.ramControl = data
+	case address < 0xE000 && even:
+		m.irqLatch = data
+	case address < 0xE000:
+		m.irqCounter = 0
+		m.irqReload = true
+	case even:
+		m.irqEnabled = false
+		m.irqPending = false
+	default:
+		m.irqEnabled = true
+	}
+	m.updateBanks()
+}
+
+// readMMC6RAM reads the MMC6's internal RAM at $7000-$7FFF, which is
+// protected in two 512-byte halves by bits 4-7 of $A001.
+func (m *mmc3) readMMC6RAM(address uint16) (uint8, bool) {
+	if address < 0x7000 || m.bankSelect&mmc6RAMEnable == 0 || m.ramControl&0xA0 == 0 {
+		return 0, false
+	}
+	readEnable := uint8(0x20)
+	if address&0x0200 != 0 {
+		readEnable = 0x80
+	}
+	if m.ramControl&readEnable == 0 {
+		return 0, true
+	}
+	return m.prgRAM[int(address)%0x0400%len(m.prgRAM)], true
+}
+
+func (m *mmc3) writeMMC6RAM(address uint16, data uint8) {
+	if address < 0x7000 || m.bankSelect&mmc6RAMEnable == 0 {
+		return
+	}
+	writeEnable := uint8(0x30)
+	if address&0x0200 != 0 {
+		writeEnable = 0xC0
+	}
+	if m.ramControl&writeEnable == writeEnable {
+		m.prgRAM[int(address)%0x0400%len(m.prgRAM)] = data
+	}
+}
+
+// updateBanks rebuilds the bank tables from the registers.
+func (m *mmc3) updateBanks() {
+	r := m.registers
+	if m.bankSelect&mmc3PRGMode == 0 {
+		m.setPRGBank(0, prgWindow, int(r[6]))
+		m.setPRGBank(2, prgWindow, -2)
+	} else {
+		m.setPRGBank(0, prgWindow, -2)
+		m.setPRGBank(2, prgWindow, int(r[6]))
+	}
+	m.setPRGBank(1, prgWindow, int(r[7]))
+	m.setPRGBank(3, prgWindow, -1)
+
+	m.chrPages = [8]int{
+		int(r[0] &^ 1), int(r[0] | 1), int(r[1] &^ 1), int(r[1] | 1),
+		int(r[2]), int(r[3]), int(r[4]), int(r[5]),
+	}
+	if m.bankSelect&mmc3CHRInverse != 0 {
+		m.chrPages = [8]int{
+			m.chrPages[4], m.chrPages[5], m.chrPages[6], m.chrPages[7],
+			m.chrPages[0], m.chrPages[1], m.chrPages[2], m.chrPages[3],
+		}
+	}
+	for window, page := range m.chrPages {
+		m.setCHRBank(window, chrWindow, page)
+	}
+
+	switch {
+	case m.txsrom:
+		// CIRAM A10 follows CHR A17 of the bank in the matching window of
+		// the lower pattern table.
+		for table := 0; table < 4; table++ {
+			m.setNametable(table, m.chrPages[table]>>7&1)
+		}
+	case m.header.FourScreen:
+	case m.mirror&1 == 0:
+		m.setMirroring(MirrorVertical)
+	default:
+		m.setMirroring(MirrorHorizontal)
+	}
+
+	if !m.mmc6 {
+		m.ramDisabled = m.ramControl&0x80 == 0
+		m.ramProtected = m.ramControl&0x40 != 0
+	}
+}
+
+func (m *mmc3) ReadCHR(address uint16) uint8 {
+	if page := m.chrPages[address/chrWindow]; m.chrRAM != nil && page&0x40 != 0 {
+		return m.chrRAM[(page&7)*chrWindow+int(address)%chrWindow]
+	}
+	return m.board.ReadCHR(address)
+}
+
+func (m *mmc3) WriteCHR(address uint16, data uint8) {
+	if page := m.chrPages[address/chrWindow]; m.chrRAM != nil && page&0x40 != 0 {
+		m.chrRAM[(page&7)*chrWindow+int(address)%chrWindow] = data
+		return
+	}
+	m.board.WriteCHR(address, data)
+}
+
+// OnA12Rise clocks the scanline counter.
+func (m *mmc3) OnA12Rise() {
+	previous := m.irqCounter
+	if m.irqCounter == 0 || m.irqReload {
+		m.irqCounter = m.irqLatch
+	} else {
+		m.irqCounter--
+	}
+	fire := m.irqCounter == 0
+	if m.oldIRQ {
+		fire = fire && (previous > 0 || m.irqReload)
+	}
+	m.irqReload = false
+	if fire && m.irqEnabled {
+		m.irqPending = true
+	}
+}
+
+func (m *mmc3) IRQ() bool {
+	return m.irqPending
+}
+
+func (m *mmc3) stateFields() []interface{} {
+	fields := append(m.board.stateFields(),
+		&m.bankSelect, &m.registers, &m.mirror, &m.ramControl,
+		&m.irqLatch, &m.irqCounter, &m.irqReload, &m.irqEnabled, &m.irqPending,
+		&m.chrPages)
+	if m.chrRAM != nil {
+		fields = append(fields, &m.chrRAM)
+	}
+	return fields
+}
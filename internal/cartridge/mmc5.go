@@ -0,0 +1,458 @@
+package cartridge
+
+func init() {
+	registerMapper(5, newMMC5)
+}
+
+// mmc5 is mapper 5, the Nintendo MMC5 on ExROM boards: four PRG banking
+// modes with RAM in any window below $E000, two sets of CHR banks for
+// sprites and background when 8x16 sprites are used, 1 KiB of ExRAM usable
+// as a nametable, extended attributes or a vertical split, a fill-mode
+// nametable, a scanline IRQ, a multiplier and two extra pulse channels with
+// a PCM output.
+type mmc5 struct {
+	*board
+
+	prgMode     uint8
+	chrMode     uint8
+	ramProtect1 uint8
+	ramProtect2 uint8
+	exramMode   uint8
+	nametable   uint8
+	fillTile    uint8
+	fillColor   uint8
+	ramBank     uint8
+	prgRegs     [4]uint8
+
+	// chrA holds $5120-$5127, used for sprites, and chrB $5128-$512B,
+	// used for the background when sprites are 8x16. lastB records
+	// which set was written last, which is used everywhere otherwise.
+	chrA     [8]int
+	chrB     [4]int
+	chrUpper uint8
+	lastB    bool
+
+	// windowRAM marks the 8 KiB windows at $8000-$FFFF mapped to PRG RAM,
+	// and ramWindows gives their offsets in PRG RAM.
+	windowRAM  [4]bool
+	ramWindows [4]int
+
+	splitControl uint8
+	splitScroll  uint8
+	splitBank    uint8
+
+	irqCompare uint8
+	irqEnabled bool
+	irqPending bool
+	irqCount   int
+	inFrame    bool
+	scanline   int
+	rendering  bool
+
+	multiplicand uint8
+	multiplier   uint8
+
+	// PPU state seen by snooping and watching the fetches. bgTile counts
+	// background tiles fetched since the sprite fetches; the first two
+	// belong to the next scanline. exAttribute and inSplit describe the
+	// tile being fetched.
+	tallSprites bool
+	spriteFetch bool
+	bgTile      int
+	exAttribute uint8
+	inSplit     bool
+	splitY      int
+	splitTile   int
+
+	audio mmc5Audio
+}
+
+// ExRAM modes.
+const (
+	exramNametable = iota
+	exramAttributes
+	exramRAM
+	exramReadOnly
+)
+
+func newMMC5(b *board) Mapper {
+	if b.header.Format != FormatNES20 {
+		// iNES cannot describe the larger WRAM chips, so provide the most
+		// any board has. Only the RAM the header declares is saved, which
+		// keeps save files the size other emulators use.
+		b.growPRGRAM(0x10000, false)
+	}
+	if len(b.vram) < 0x0400 {
+		// ExRAM is page 2 of nametable RAM.
+		b.vram = make([]uint8, 0x0400)
+	}
+	m := &mmc5{
+		board:   b,
+		prgMode: 3,
+		chrMode: 3,
+		prgRegs: [4]uint8{0xFF, 0xFF, 0xFF, 0xFF},
+	}
+	m.updatePRG()
+	return m
+}
+
+func (m *mmc5) exram() []uint8 {
+	return m.vram[:0x0400]
+}
+
+func (m *mmc5) ReadPRG(address uint16) (uint8, bool) {
+	switch {
+	case address >= 0x8000:
+		window := int(address-0x8000) / prgWindow
+		if m.windowRAM[window] {
+			if len(m.prgRAM) == 0 {
+				return 0, false
+			}
+			return m.prgRAM[(m.ramWindows[window]+int(address)%prgWindow)%len(m.prgRAM)], true
+		}
+		data, _ := m.board.ReadPRG(address)
+		if address < 0xC000 {
+			m.audio.readPCM(data)
+		}
+		return data, true
+	case address >= 0x6000:
+		return m.board.ReadPRG(address)
+	case address >= 0x5C00:
+		if m.exramMode < exramRAM {
+			return 0, false
+		}
+		return m.exram()[address-0x5C00], true
+	case address == 0x5204:
+		var status uint8
+		if m.irqPending {
+			status |= 0x80
+		}
+		if m.inFrame {
+			status |= 0x40
+		}
+		m.irqPending = false
+		return status, true
+	case address == 0x5205:
+		return uint8(uint16(m.multiplicand) * uint16(m.multiplier)), true
+	case address == 0x5206:
+		return uint8(uint16(m.multiplicand) * uint16(m.multiplier) >> 8), true
+	case address >= 0x5000 && address <= 0x5015:
+		return m.audio.readRegister(address)
+	}
+	return 0, false
+}
+
+func (m *mmc5) WritePRG(address uint16, data uint8) {
+	switch {
+	case address >= 0x8000:
+		window := int(address-0x8000) / prgWindow
+		if m.windowRAM[window] && m.ramWritable() && len(m.prgRAM) > 0 {
+			m.prgRAM[(m.ramWindows[window]+int(address)%prgWindow)%len(m.prgRAM)] = data
+		}
+	case address >= 0x6000:
+		if m.ramWritable() {
+			m.board.WritePRG(address, data)
+		}
+	case address >= 0x5C00:
+		switch m.exramMode {
+		case exramNametable, exramAttributes:
+			// The PPU owns ExRAM while rendering; other writes store 0.
+			if !m.inFrame {
+				data = 0
+			}
+			m.exram()[address-0x5C00] = data
+		case exramRAM:
+			m.exram()[address-0x5C00] = data
+		}
+	case address >= 0x5000 && address <= 0x5015:
+		m.audio.writeRegister(address, data)
+	case address >= 0x5100 && address <= 0x5206:
+		m.writeRegister(address, data)
+	}
+}
+
+func (m *mmc5) writeRegister(address uint16, data uint8) {
+	switch {
+	case address == 0x5100:
+		m.prgMode = data & 3
+		m.updatePRG()
+	case address == 0x5101:
+		m.chrMode = data & 3
+	case address == 0x5102:
+		m.ramProtect1 = data & 3
+	case address == 0x5103:
+		m.ramProtect2 = data & 3
+	case address == 0x5104:
+		m.exramMode = data & 3
+	case address == 0x5105:
+		m.nametable = data
+		for table := 0; table < 4; table++ {
+			m.setNametable(table, int(data>>(table*2)&3))
+		}
+	case address == 0x5106:
+		m.fillTile = data
+	case address == 0x5107:
+		m.fillColor = data & 3
+	case address == 0x5113:
+		m.ramBank = data & 7
+		m.setRAMBank(int(m.ramBank))
+	case address >= 0x5114 && address <= 0x5117:
+		m.prgRegs[address-0x5114] = data
+		m.updatePRG()
+	case address >= 0x5120 && address <= 0x5127:
+		m.chrA[address-0x5120] = int(m.chrUpper)<<8 | int(data)
+		m.lastB = false
+	case address >= 0x5128 && address <= 0x512B:
+		m.chrB[address-0x5128] = int(m.chrUpper)<<8 | int(data)
+		m.lastB = true
+	case address == 0x5130:
+		m.chrUpper = data & 3
+	case address == 0x5200:
+		m.splitControl = data
+	case address == 0x5201:
+		m.splitScroll = data
+	case address == 0x5202:
+		m.splitBank = data
+	case address == 0x5203:
+		m.irqCompare = data
+	case address == 0x5204:
+		m.irqEnabled = data&0x80 != 0
+	case address == 0x5205:
+		m.multiplicand = data
+	case address == 0x5206:
+		m.multiplier = data
+	}
+}
+
+// ramWritable reports whether PRG RAM is unlocked, which takes $02 in $5102
+// and $01 in $5103.
+func (m *mmc5) ramWritable() bool {
+	return m.ramProtect1 == 2 && m.ramProtect2 == 1
+}
+
+// updatePRG rebuilds the PRG windows from the PRG mode and bank registers.
+func (m *mmc5) updatePRG() {
+	r := m.prgRegs
+	switch m.prgMode {
+	case 0:
+		m.mapPRG(0, 4, r[3]|0x80)
+	case 1:
+		m.mapPRG(0, 2, r[1])
+		m.mapPRG(2, 2, r[3]|0x80)
+	case 2:
+		m.mapPRG(0, 2, r[1])
+		m.mapPRG(2, 1, r[2])
+		m.mapPRG(3, 1, r[3]|0x80)
+	case 3:
+		m.mapPRG(0, 1, r[0])
+		m.mapPRG(1, 1, r[1])
+		m.mapPRG(2, 1, r[2])
+		m.mapPRG(3, 1, r[3]|0x80)
+	}
+}
+
+// mapPRG maps windows 8 KiB windows starting at first from a bank register:
+// bit 7 selects ROM over RAM and the rest is the 8 KiB bank number, with
+// the low bits ignored for larger banks.
+func (m *mmc5) mapPRG(first, windows int, value uint8) {
+	ram := value&0x80 == 0
+	bank := int(value&0x7F) &^ (windows - 1)
+	for i := 0; i < windows; i++ {
+		m.windowRAM[first+i] = ram
+		if ram {
+			m.ramWindows[first+i] = bankOffset(m.prgRAM, prgWindow, bank+i)
+		} else {
+			m.prgBanks[first+i] = bankOffset(m.prg, prgWindow, bank+i)
+		}
+	}
+}
+
+func (m *mmc5) PRGBank(address uint16) (int, bool) {
+	if address >= 0x8000 && m.windowRAM[(address-0x8000)/prgWindow] {
+		return 0, false
+	}
+	return m.board.PRGBank(address)
+}
+
+// backgroundFetch reports whether the PPU is fetching background data.
+func (m *mmc5) backgroundFetch() bool {
+	return m.inFrame && m.rendering && !m.spriteFetch
+}
+
+func (m *mmc5) ReadCHR(address uint16) uint8 {
+	if m.backgroundFetch() {
+		switch {
+		case m.inSplit:
+			fine := uint16(m.splitY & 7)
+			offset := bankOffset(m.chr, 0x1000, int(m.splitBank))
+			return m.chr[(offset+int(address&0x0FF8|fine))%len(m.chr)]
+		case m.exramMode == exramAttributes:
+			bank := int(m.chrUpper)<<6 | int(m.exAttribute&0x3F)
+			return m.chr[(bankOffset(m.chr, 0x1000, bank)+int(address)%0x1000)%len(m.chr)]
+		}
+	}
+	return m.chr[m.chrOffset(address)]
+}
+
+func (m *mmc5) WriteCHR(address uint16, data uint8) {
+	if m.chrWritable {
+		m.chr[m.chrOffset(address)] = data
+	}
+}
+
+// chrOffset maps a pattern table address through the bank set in use.
+// Each mode divides the pattern tables into 1 << mode banks, the register
+// for each being the last of those that cover it.
+func (m *mmc5) chrOffset(address uint16) int {
+	size := 0x2000 >> m.chrMode
+	slot := int(address) / size
+	register := (slot+1)*(8>>m.chrMode) - 1
+
+	useB := m.lastB
+	if m.tallSprites && m.inFrame && m.rendering {
+		useB = !m.spriteFetch
+	}
+	bank := m.chrA[register]
+	if useB {
+		bank = m.chrB[register&3]
+	}
+	return (bankOffset(m.chr, size, bank) + int(address)%size) % len(m.chr)
+}
+
+func (m *mmc5) ReadNametable(address uint16) uint8 {
+	offset := int(address-0x2000) & 0x03FF
+	attribute := offset >= 0x03C0
+	if m.backgroundFetch() {
+		if !attribute {
+			m.startTile(offset)
+		}
+		if m.inSplit {
+			return m.splitNametable(attribute)
+		}
+		if attribute && m.exramMode == exramAttributes {
+			return (m.exAttribute >> 6) * 0x55
+		}
+	}
+
+	switch m.nametable >> (int(address-0x2000) / 0x0400 % 4 * 2) & 3 {
+	case 2:
+		if m.exramMode >= exramRAM {
+			return 0
+		}
+	case 3:
+		if attribute {
+			return m.fillColor * 0x55
+		}
+		return m.fillTile
+	}
+	return m.board.ReadNametable(address)
+}
+
+func (m *mmc5) WriteNametable(address uint16, data uint8) {
+	switch m.nametable >> (int(address-0x2000) / 0x0400 % 4 * 2) & 3 {
+	case 2:
+		if m.exramMode < exramRAM {
+			m.board.WriteNametable(address, data)
+		}
+	case 3:
+	default:
+		m.board.WriteNametable(address, data)
+	}
+}
+
+// startTile is called for each background nametable fetch and works out how
+// the tile's attribute and pattern fetches are to be modified.
+func (m *mmc5) startTile(offset int) {
+	tile := m.bgTile
+	m.bgTile++
+
+	m.exAttribute = m.exram()[offset]
+
+	line := m.scanline
+	if tile < 2 {
+		line++
+	}
+	count := int(m.splitControl & 0x1F)
+	right := m.splitControl&0x40 != 0
+	m.inSplit = m.splitControl&0x80 != 0 && m.exramMode <= exramAttributes &&
+		tile < 32 && (tile < count) != right
+	if m.inSplit {
+		y := int(m.splitScroll) + line%262
+		if m.splitScroll < 240 {
+			y %= 240
+		} else {
+			y %= 256
+		}
+		m.splitY = y
+		m.splitTile = tile
+	}
+}
+
+// splitNametable returns the nametable or attribute byte of the split
+// region, which is drawn from ExRAM.
+func (m *mmc5) splitNametable(attribute bool) uint8 {
+	x, y := m.splitTile, m.splitY/8
+	if !attribute {
+		return m.exram()[y*32+x]
+	}
+	data := m.exram()[0x03C0+y/4*8+x/4]
+	shift := (y/2&1)*4 + (x/2&1)*2
+	return (data >> shift & 3) * 0x55
+}
+
+func (m *mmc5) StartScanline(scanline int, rendering bool) {
+	m.scanline = scanline
+	m.rendering = rendering
+	if !rendering || scanline >= 240 {
+		m.inFrame = false
+		return
+	}
+	if !m.inFrame {
+		m.inFrame = true
+		m.irqPending = false
+		m.irqCount = 0
+		return
+	}
+	m.irqCount++
+	if m.irqCount == int(m.irqCompare) {
+		m.irqPending = true
+	}
+}
+
+func (m *mmc5) SpriteFetches(active bool) {
+	m.spriteFetch = active
+	if !active {
+		m.bgTile = 0
+	}
+}
+
+func (m *mmc5) SnoopWrite(address uint16, data uint8) {
+	if address&0x2007 == 0x2000 {
+		m.tallSprites = data&0x20 != 0
+	}
+}
+
+func (m *mmc5) IRQ() bool {
+	return m.irqPending && m.irqEnabled || m.audio.pcmIRQ
+}
+
+func (m *mmc5) StepCPU() {
+	m.audio.step()
+}
+
+func (m *mmc5) AudioOutput() float32 {
+	return m.audio.output()
+}
+
+func (m *mmc5) stateFields() []interface{} {
+	fields := append(m.board.stateFields(),
+		&m.prgMode, &m.chrMode, &m.ramProtect1, &m.ramProtect2, &m.exramMode,
+		&m.nametable, &m.fillTile, &m.fillColor, &m.ramBank, &m.prgRegs,
+		&m.chrA, &m.chrB, &m.chrUpper, &m.lastB, &m.windowRAM, &m.ramWindows,
+		&m.splitControl, &m.splitScroll, &m.splitBank,
+		&m.irqCompare, &m.irqEnabled, &m.irqPending, &m.irqCount, &m.inFrame,
+		&m.scanline, &m.rendering, &m.multiplicand, &m.multiplier,
+		&m.tallSprites, &m.spriteFetch, &m.bgTile, &m.exAttribute,
+		&m.inSplit, &m.splitY, &m.splitTile)
+	return append(fields, m.audio.stateFields()...)
+}
@@ -0,0 +1,214 @@
+package cartridge
+
+// Sound of the MMC5: two pulse channels like those of the APU but without
+// sweep units, and an 8-bit PCM output written directly or captured from
+// reads of $8000-$BFFF.
+
+// mmc5FrameCycles is the period of the MMC5's fixed 240 Hz envelope and
+// length counter clock, in CPU cycles.
+const mmc5FrameCycles = 7457
+
+// Mixing levels, on the scale of the APU's mix, of one step of a pulse
+// channel and of the PCM output.
+const (
+	mmc5PulseLevel = 0.00752
+	mmc5PCMLevel   = 0.00166
+)
+
+var pulseLengths = [32]uint8{
+	10, 254, 20, 2, 40, 4, 80, 6, 160, 8, 60, 10, 14, 12, 26, 14,
+	12, 16, 24, 18, 48, 20, 96, 22, 192, 24, 72, 26, 16, 28, 32, 30,
+}
+
+var pulseDuties = [4][8]uint8{
+	{0, 1, 0, 0, 0, 0, 0, 0},
+	{0, 1, 1, 0, 0, 0, 0, 0},
+	{0, 1, 1, 1, 1, 0, 0, 0},
+	{1, 0, 0, 1, 1, 1, 1, 1},
+}
+
+// mmc5Pulse is one of the MMC5's pulse channels.
+type mmc5Pulse struct {
+	enabled    bool
+	duty       uint8
+	dutyStep   uint8
+	period     uint16
+	timer      uint16
+	length     uint8
+	lengthHalt bool
+	constant   bool
+	volume     uint8
+	envStart   bool
+	envDivider uint8
+	envDecay   uint8
+}
+
+func (p *mmc5Pulse) writeRegister(register uint16, data uint8) {
+	switch register {
+	case 0:
+		p.duty = data >> 6
+		p.lengthHalt = data&0x20 != 0
+		p.constant = data&0x10 != 0
+		p.volume = data & 0x0F
+	case 2:
+		p.period = p.period&0x0700 | uint16(data)
+	case 3:
+		p.period = p.period&0x00FF | uint16(data&7)<<8
+		if p.enabled {
+			p.length = pulseLengths[data>>3]
+		}
+		p.envStart = true
+		p.dutyStep = 0
+	}
+}
+
+func (p *mmc5Pulse) setEnabled(enabled bool) {
+	p.enabled = enabled
+	if !enabled {
+		p.length = 0
+	}
+}
+
+func (p *mmc5Pulse) stepTimer() {
+	if p.timer == 0 {
+		p.timer = p.period
+		p.dutyStep = (p.dutyStep + 1) & 7
+	} else {
+		p.timer--
+	}
+}
+
+func (p *mmc5Pulse) stepEnvelope() {
+	switch {
+	case p.envStart:
+		p.envStart = false
+		p.envDecay = 15
+		p.envDivider = p.volume
+	case p.envDivider > 0:
+		p.envDivider--
+	default:
+		p.envDivider = p.volume
+		if p.envDecay > 0 {
+			p.envDecay--
+		} else if p.lengthHalt {
+			p.envDecay = 15
+		}
+	}
+}
+
+func (p *mmc5Pulse) stepLength() {
+	if !p.lengthHalt && p.length > 0 {
+		p.length--
+	}
+}
+
+func (p *mmc5Pulse) output() uint8 {
+	if !p.enabled || p.length == 0 || pulseDuties[p.duty][p.dutyStep] == 0 {
+		return 0
+	}
+	if p.constant {
+		return p.volume
+	}
+	return p.envDecay
+}
+
+func (p *mmc5Pulse) stateFields() []interface{} {
+	return []interface{}{
+		&p.enabled, &p.duty, &p.dutyStep, &p.period, &p.timer,
+		&p.length, &p.lengthHalt, &p.constant, &p.volume,
+		&p.envStart, &p.envDivider, &p.envDecay,
+	}
+}
+
+// mmc5Audio holds the sound channels of the MMC5.
+type mmc5Audio struct {
+	pulses        [2]mmc5Pulse
+	pcm           uint8
+	pcmRead       bool
+	pcmIRQ        bool
+	pcmIRQEnabled bool
+
+	cycle      uint64
+	frameTimer int
+}
+
+func (a *mmc5Audio) readRegister(address uint16) (uint8, bool) {
+	switch address {
+	case 0x5010:
+		var status uint8
+		if a.pcmIRQ {
+			status |= 0x80
+		}
+		if a.pcmRead {
+			status |= 0x01
+		}
+		a.pcmIRQ = false
+		return status, true
+	case 0x5015:
+		var status uint8
+		for i := range a.pulses {
+			if a.pulses[i].length > 0 {
+				status |= 1 << i
+			}
+		}
+		return status, true
+	}
+	return 0, false
+}
+
+func (a *mmc5Audio) writeRegister(address uint16, data uint8) {
+	switch {
+	case address <= 0x5007:
+		a.pulses[(address-0x5000)/4].writeRegister(address%4, data)
+	case address == 0x5010:
+		a.pcmRead = data&0x01 != 0
+		a.pcmIRQEnabled = data&0x80 != 0
+	case address == 0x5011:
+		if !a.pcmRead && data != 0 {
+			a.pcm = data
+		}
+	case address == 0x5015:
+		a.pulses[0].setEnabled(data&0x01 != 0)
+		a.pulses[1].setEnabled(data&0x02 != 0)
+	}
+}
+
+// readPCM captures a byte read from $8000-$BFFF in PCM read mode. A zero
+// byte does not change the output and raises the PCM IRQ instead.
+func (a *mmc5Audio) readPCM(data uint8) {
+	if !a.pcmRead {
+		return
+	}
+	if data == 0 {
+		a.pcmIRQ = a.pcmIRQEnabled
+		return
+	}
+	a.pcm = data
+}
+
+// step advances the channels by one CPU cycle.
+func (a *mmc5Audio) step() {
+	a.cycle++
+	if a.cycle%2 == 0 {
+		a.pulses[0].stepTimer()
+		a.pulses[1].stepTimer()
+	}
+	a.frameTimer++
+	if a.frameTimer == mmc5FrameCycles {
+		a.frameTimer = 0
+		for i := range a.pulses {
+			a.pulses[i].stepEnvelope()
+			a.pulses[i].stepLength()
+		}
+	}
+}
+
+func (a *mmc5Audio) output() float32 {
+	pulses := a.pulses[0].output() + a.pulses[1].output()
+	return mmc5PulseLevel*float32(pulses) + mmc5PCMLevel*float32(a.pcm)
+}
+
+func (a *mmc5Audio) stateFields() []interface{} {
+	fields := append(a.pulses[0].stateFields(), a.pulses[1].stateFields()...)
+	return append(fields, &a.pcm, &a.pcmRead, &a.pcmIRQ, &a.pcmIRQEnabled, &a.cycle, &a.frameTimer)
+}
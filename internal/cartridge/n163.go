@@ -0,0 +1,181 @@
+package cartridge
+
+func init() {
+	registerMapper(19, newN163)
+}
+
+// n163 is mapper 19, the Namco 163. It banks 8 KiB of PRG three times,
+// 1 KiB of CHR eight times, and each of the four nametables separately,
+// where any CHR or nametable window can hold either CHR ROM or a page of
+// the console's nametable RAM. It also has a 15-bit CPU cycle IRQ counter
+// and 128 bytes of internal RAM that hold the waveforms and registers of
+// up to eight wavetable sound channels.
+type n163 struct {
+	*board
+
+	prgRegs [3]uint8
+	// chrRegs holds the banks of the eight pattern windows followed by
+	// the four nametable windows.
+	chrRegs [12]uint8
+	// highCIRAM disables nametable RAM in the lower and upper pattern
+	// tables, as bits 6 and 7 of $E800.
+	highCIRAM    uint8
+	soundEnabled bool
+	ramProtect   uint8
+
+	counter    uint16
+	irqEnabled bool
+	irqPending bool
+
+	audio n163Audio
+}
+
+// n163CIRAM is the first bank number that selects nametable RAM rather
+// than CHR ROM.
+const n163CIRAM = 0xE0
+
+func newN163(b *board) Mapper {
+	m := &n163{board: b}
+	m.updateBanks()
+	return m
+}
+
+func (m *n163) ReadPRG(address uint16) (uint8, bool) {
+	switch {
+	case address < 0x4800:
+		return 0, false
+	case address < 0x5000:
+		return m.audio.readData(), true
+	case address < 0x5800:
+		return uint8(m.counter), true
+	case address < 0x6000:
+		value := uint8(m.counter >> 8)
+		if m.irqEnabled {
+			value |= 0x80
+		}
+		return value, true
+	}
+	return m.board.ReadPRG(address)
+}
+
+func (m *n163) WritePRG(address uint16, data uint8) {
+	switch {
+	case address < 0x4800:
+	case address < 0x5000:
+		m.audio.writeData(data)
+	case address < 0x5800:
+		m.counter = m.counter&0x7F00 | uint16(data)
+		m.irqPending = false
+	case address < 0x6000:
+		m.counter = m.counter&0x00FF | uint16(data&0x7F)<<8
+		m.irqEnabled = data&0x80 != 0
+		m.irqPending = false
+	case address < 0x8000:
+		// Writes need $4x in the top half of $F800 and the 2 KiB chunk's
+		// bit in the bottom half clear.
+		chunk := uint8(1) << ((address - 0x6000) / 0x0800)
+		if m.ramProtect&0xF0 == 0x40 && m.ramProtect&chunk == 0 {
+			m.board.WritePRG(address, data)
+		}
+	case address < 0xE000:
+		m.chrRegs[(address-0x8000)/0x0800] = data
+	case address < 0xE800:
+		m.prgRegs[0] = data & 0x3F
+		m.soundEnabled = data&0x40 == 0
+	case address < 0xF000:
+		m.prgRegs[1] = data & 0x3F
+		m.highCIRAM = data >> 6
+	case address < 0xF800:
+		m.prgRegs[2] = data & 0x3F
+	default:
+		m.ramProtect = data
+		m.audio.writeAddress(data)
+	}
+	m.updateBanks()
+}
+
+func (m *n163) updateBanks() {
+	for slot, bank := range m.prgRegs {
+		m.setPRGBank(slot, prgWindow, int(bank))
+	}
+	m.setPRGBank(3, prgWindow, -1)
+}
+
+// chrWindowOffset resolves CHR or nametable window number window to an
+// offset, returning whether it is in nametable RAM rather than CHR.
+func (m *n163) chrWindowOffset(window int, address uint16) (int, bool) {
+	bank := m.chrRegs[window]
+	offset := int(address) % chrWindow
+	ciram := bank >= n163CIRAM
+	if window < 8 && m.highCIRAM&(1<<(window/4)) != 0 {
+		ciram = false
+	}
+	if ciram {
+		return int(bank&1)*chrWindow + offset, true
+	}
+	return (bankOffset(m.chr, chrWindow, int(bank)) + offset) % len(m.chr), false
+}
+
+func (m *n163) read(window int, address uint16) uint8 {
+	offset, ciram := m.chrWindowOffset(window, address)
+	if ciram {
+		return m.readVRAM(offset)
+	}
+	return m.chr[offset]
+}
+
+func (m *n163) write(window int, address uint16, data uint8) {
+	offset, ciram := m.chrWindowOffset(window, address)
+	switch {
+	case ciram:
+		m.writeVRAM(offset, data)
+	case m.chrWritable:
+		m.chr[offset] = data
+	}
+}
+
+func (m *n163) ReadCHR(address uint16) uint8 {
+	return m.read(int(address&0x1FFF)/chrWindow, address)
+}
+
+func (m *n163) WriteCHR(address uint16, data uint8) {
+	m.write(int(address&0x1FFF)/chrWindow, address, data)
+}
+
+func (m *n163) ReadNametable(address uint16) uint8 {
+	return m.read(8+int(address&0x0FFF)/chrWindow, address)
+}
+
+func (m *n163) WriteNametable(address uint16, data uint8) {
+	m.write(8+int(address&0x0FFF)/chrWindow, address, data)
+}
+
+func (m *n163) StepCPU() {
+	if m.irqEnabled && m.counter < 0x7FFF {
+		m.counter++
+		if m.counter == 0x7FFF {
+			m.irqPending = true
+		}
+	}
+	if m.soundEnabled {
+		m.audio.step()
+	}
+}
+
+func (m *n163) IRQ() bool {
+	return m.irqPending
+}
+
+func (m *n163) AudioOutput() float32 {
+	if !m.soundEnabled {
+		return 0
+	}
+	return m.audio.output()
+}
+
+func (m *n163) stateFields() []interface{} {
+	fields := append(m.board.stateFields(),
+		&m.prgRegs, &m.chrRegs, &m.highCIRAM, &m.soundEnabled, &m.ramProtect,
+		&m.counter, &m.irqEnabled, &m.irqPending)
+	return append(fields, m.audio.stateFields()...)
+}
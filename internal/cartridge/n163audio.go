@@ -0,0 +1,109 @@
+package cartridge
+
+// Sound of the Namco 163. Its 128 bytes of RAM hold 4-bit waveform samples,
+// two to a byte with the low nibble first, and the registers of up to
+// eight channels at $40-$7F, eight bytes per channel:
+//
+//	+0 frequency bits 0-7     +1 phase bits 0-7
+//	+2 frequency bits 8-15    +3 phase bits 8-15
+//	+4 frequency bits 16-17 and 256 minus the waveform length in bits 2-7
+//	+5 phase bits 16-23       +6 waveform address in samples
+//	+7 volume in bits 0-3, and at $7F the number of channels minus one in
+//	   bits 4-6
+//
+// The chip has one DAC, which it hands to the enabled channels in turn,
+// updating each for 15 CPU cycles. Channels are enabled from the one at
+// $78 downward.
+
+// n163Level is the mixing level of one unit of sample times volume, on the
+// scale of the APU's mix.
+const n163Level = 0.0012
+
+// n163ChannelCycles is the number of CPU cycles spent on each channel.
+const n163ChannelCycles = 15
+
+type n163Audio struct {
+	ram [128]uint8
+	// address selects the RAM byte for the data port, and autoIncrement
+	// advances it after every access.
+	address       uint8
+	autoIncrement bool
+
+	cycle   uint8
+	channel uint8
+	sample  int16
+}
+
+func (a *n163Audio) writeAddress(data uint8) {
+	a.address = data & 0x7F
+	a.autoIncrement = data&0x80 != 0
+}
+
+func (a *n163Audio) readData() uint8 {
+	data := a.ram[a.address]
+	a.advance()
+	return data
+}
+
+func (a *n163Audio) writeData(data uint8) {
+	a.ram[a.address] = data
+	a.advance()
+}
+
+func (a *n163Audio) advance() {
+	if a.autoIncrement {
+		a.address = (a.address + 1) & 0x7F
+	}
+}
+
+// channels returns the number of enabled channels.
+func (a *n163Audio) channels() uint8 {
+	return (a.ram[0x7F]>>4)&7 + 1
+}
+
+func (a *n163Audio) step() {
+	a.cycle++
+	if a.cycle < n163ChannelCycles {
+		return
+	}
+	a.cycle = 0
+
+	a.channel++
+	if a.channel >= a.channels() {
+		a.channel = 0
+	}
+	a.updateChannel(7 - a.channel)
+}
+
+// updateChannel advances the phase of channel number channel and latches
+// its output into the DAC.
+func (a *n163Audio) updateChannel(channel uint8) {
+	regs := a.ram[0x40+int(channel)*8:][:8]
+	frequency := uint32(regs[0]) | uint32(regs[2])<<8 | uint32(regs[4]&3)<<16
+	phase := uint32(regs[1]) | uint32(regs[3])<<8 | uint32(regs[5])<<16
+	length := 256 - uint32(regs[4]&0xFC)
+
+	phase = (phase + frequency) % (length << 16)
+	regs[1] = uint8(phase)
+	regs[3] = uint8(phase >> 8)
+	regs[5] = uint8(phase >> 16)
+
+	index := (phase>>16 + uint32(regs[6])) & 0xFF
+	sample := a.ram[index/2]
+	if index&1 == 0 {
+		sample &= 0x0F
+	} else {
+		sample >>= 4
+	}
+	a.sample = (int16(sample) - 8) * int16(regs[7]&0x0F)
+}
+
+func (a *n163Audio) output() float32 {
+	return float32(a.sample) * n163Level
+}
+
+func (a *n163Audio) stateFields() []interface{} {
+	return []interface{}{
+		&a.ram, &a.address, &a.autoIncrement, &a.cycle, &a.channel, &a.sample,
+	}
+}
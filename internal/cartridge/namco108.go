@@ -0,0 +1,45 @@
+package cartridge
+
+func init() {
+	registerMapper(206, newNamco108)
+}
+
+// namco108 is mapper 206, the Namco 108 (and Tengen MIMIC-1), the ancestor
+// of the MMC3: the same eight bank registers at $8000/$8001, without PRG or
+// CHR inversion, mirroring control, RAM or IRQ.
+type namco108 struct {
+	*board
+
+	bankSelect uint8
+}
+
+func newNamco108(b *board) Mapper {
+	m := &namco108{board: b}
+	m.setPRGBank(0, prgWindow, 0)
+	m.setPRGBank(1, prgWindow, 1)
+	m.setPRGBank(2, prgWindow, -2)
+	m.setPRGBank(3, prgWindow, -1)
+	return m
+}
+
+func (m *namco108) WritePRG(address uint16, data uint8) {
+	if address < 0x8000 || address >= 0xA000 {
+		return
+	}
+	if address&1 == 0 {
+		m.bankSelect = data & 0x07
+		return
+	}
+	switch r := m.bankSelect; {
+	case r < 2:
+		m.setCHRBank(int(r), 0x0800, int(data&0x3F)>>1)
+	case r < 6:
+		m.setCHRBank(int(r)+2, chrWindow, int(data&0x3F))
+	default:
+		m.setPRGBank(int(r-6), prgWindow, int(data&0x0F))
+	}
+}
+
+func (m *namco108) stateFields() []interface{} {
+	return append(m.board.stateFields(), &m.bankSelect)
+}
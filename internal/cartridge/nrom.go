@@ -0,0 +1,15 @@
+package cartridge
+
+func init() {
+	registerMapper(0, newNROM)
+}
+
+// nrom is mapper 0: up to 32 KiB of PRG and 8 KiB of CHR with no bank
+// switching. Boards with 16 KiB of PRG mirror it at $C000.
+type nrom struct {
+	*board
+}
+
+func newNROM(b *board) Mapper {
+	return &nrom{b}
+}
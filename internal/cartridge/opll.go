@@ -0,0 +1,330 @@
+package cartridge
+
+import "math"
+
+// FM synthesis of the VRC7, a cut-down YM2413 (OPLL) with six two-operator
+// channels, fifteen instruments in ROM and one user-defined instrument.
+//
+// The synthesis is modeled in floating point rather than with the chip's
+// log-sine and exponent tables: phases are in cycles, envelopes and other
+// attenuations in dB.
+
+// opllCycles is how many CPU cycles pass per OPLL output sample. The chip
+// runs from a 3.58 MHz clock and produces a sample every 72 clocks.
+const opllCycles = 36
+
+// opllRate is the OPLL sample rate in Hz.
+const opllRate = 3579545.0 / 72
+
+// vrc7Level is the mixing level of one channel at full volume, on the
+// scale of the APU's mix.
+const vrc7Level = 0.045
+
+// vrc7Patches are the instruments built into the VRC7, numbered from 1.
+var vrc7Patches = [15][8]uint8{
+	{0x03, 0x21, 0x05, 0x06, 0xE8, 0x81, 0x42, 0x27},
+	{0x13, 0x41, 0x14, 0x0D, 0xD8, 0xF6, 0x23, 0x12},
+	{0x11, 0x11, 0x08, 0x08, 0xFA, 0xB2, 0x20, 0x12},
+	{0x31, 0x61, 0x0C, 0x07, 0xA8, 0x64, 0x61, 0x27},
+	{0x32, 0x21, 0x1E, 0x06, 0xE1, 0x76, 0x01, 0x28},
+	{0x02, 0x01, 0x06, 0x00, 0xA3, 0xE2, 0xF4, 0xF4},
+	{0x21, 0x61, 0x1D, 0x07, 0x82, 0x81, 0x11, 0x07},
+	{0x23, 0x21, 0x22, 0x17, 0xA2, 0x72, 0x01, 0x17},
+	{0x35, 0x11, 0x25, 0x00, 0x40, 0x73, 0x72, 0x01},
+	{0xB5, 0x01, 0x0F, 0x0F, 0xA8, 0xA5, 0x51, 0x02},
+	{0x17, 0xC1, 0x24, 0x07, 0xF8, 0xF8, 0x22, 0x12},
+	{0x71, 0x23, 0x11, 0x06, 0x65, 0x74, 0x18, 0x16},
+	{0x01, 0x02, 0xD3, 0x05, 0xC9, 0x95, 0x03, 0x02},
+	{0x61, 0x63, 0x0C, 0x00, 0x94, 0xC0, 0x33, 0xF6},
+	{0x21, 0x72, 0x0D, 0x00, 0xC1, 0xD5, 0x56, 0x06},
+}
+
+// opllMultipliers gives the frequency multiple for each MULT value.
+var opllMultipliers = [16]float64{0.5, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 10, 12, 12, 15, 15}
+
+// opllKeyScale is the key scale attenuation in dB at 6 dB/octave for the
+// top four bits of the F-number in block 7. Each lower block is 6 dB less.
+var opllKeyScale = [16]float64{
+	0, 18, 24, 27.75, 30, 32.25, 33.75, 35.25,
+	36, 37.5, 38.25, 39, 39.75, 40.5, 41.25, 42,
+}
+
+// opllKeyScaleFactors scales opllKeyScale for KSL 0-3: 0, 1.5, 3 and
+// 6 dB/octave.
+var opllKeyScaleFactors = [4]float64{0, 0.25, 0.5, 1}
+
+// Envelope generator stages.
+const (
+	envAttack = iota
+	envDecay
+	envSustain
+	envRelease
+	envOff
+)
+
+// opllSilence is the attenuation at which an envelope is inaudible.
+const opllSilence = 96.0
+
+// LFO parameters shared by all channels.
+const (
+	opllAMRate    = 3.7
+	opllAMDepth   = 4.8
+	opllVibRate   = 6.4
+	opllVibDepth  = 0.004
+	opllFeedback0 = 1.0 / 32
+	// opllModulation is the carrier phase shift, in cycles, produced by a
+	// modulator at full amplitude.
+	opllModulation = 2.0
+)
+
+// opllOperator is one of the two operators of a channel.
+type opllOperator struct {
+	phase float64
+	env   float64
+	stage int
+	// out holds the last two outputs, used for modulator feedback.
+	out [2]float64
+}
+
+// opllChannel is one of the six FM channels.
+type opllChannel struct {
+	fnum       uint16
+	block      uint8
+	key        bool
+	sustain    bool
+	instrument uint8
+	volume     uint8
+
+	operators [2]opllOperator
+}
+
+// opll is the FM synthesizer of the VRC7.
+type opll struct {
+	address  uint8
+	custom   [8]uint8
+	channels [6]opllChannel
+
+	amPhase  float64
+	vibPhase float64
+	cycle    int
+	sample   float64
+}
+
+// reset silences every channel.
+func (o *opll) reset() {
+	*o = opll{}
+	for i := range o.channels {
+		for j := range o.channels[i].operators {
+			o.channels[i].operators[j].env = opllSilence
+			o.channels[i].operators[j].stage = envOff
+		}
+	}
+}
+
+func (o *opll) writeAddress(data uint8) {
+	o.address = data
+}
+
+func (o *opll) writeData(data uint8) {
+	address := o.address
+	switch {
+	case address < 8:
+		o.custom[address] = data
+	case address >= 0x10 && address <= 0x15:
+		c := &o.channels[address-0x10]
+		c.fnum = c.fnum&0x100 | uint16(data)
+	case address >= 0x20 && address <= 0x25:
+		c := &o.channels[address-0x20]
+		c.fnum = c.fnum&0xFF | uint16(data&1)<<8
+		c.block = data >> 1 & 7
+		c.sustain = data&0x20 != 0
+		key := data&0x10 != 0
+		switch {
+		case key && !c.key:
+			for i := range c.operators {
+				c.operators[i].phase = 0
+				c.operators[i].stage = envAttack
+			}
+		case !key && c.key:
+			for i := range c.operators {
+				if c.operators[i].stage != envOff {
+					c.operators[i].stage = envRelease
+				}
+			}
+		}
+		c.key = key
+	case address >= 0x30 && address <= 0x35:
+		c := &o.channels[address-0x30]
+		c.instrument = data >> 4
+		c.volume = data & 0x0F
+	}
+}
+
+// patch returns the instrument settings of a channel.
+func (o *opll) patch(c *opllChannel) *[8]uint8 {
+	if c.instrument == 0 {
+		return &o.custom
+	}
+	return &vrc7Patches[c.instrument-1]
+}
+
+// step advances the synthesizer by one CPU cycle.
+func (o *opll) step() {
+	o.cycle++
+	if o.cycle < opllCycles {
+		return
+	}
+	o.cycle = 0
+
+	o.amPhase = math.Mod(o.amPhase+opllAMRate/opllRate, 1)
+	o.vibPhase = math.Mod(o.vibPhase+opllVibRate/opllRate, 1)
+	am := opllAMDepth * (1 + math.Sin(2*math.Pi*o.amPhase)) / 2
+	vib := 1 + opllVibDepth*math.Sin(2*math.Pi*o.vibPhase)
+
+	o.sample = 0
+	for i := range o.channels {
+		o.sample += o.channels[i].output(o.patch(&o.channels[i]), am, vib)
+	}
+}
+
+func (o *opll) output() float32 {
+	return float32(o.sample * vrc7Level)
+}
+
+// output computes the channel's next sample, from -1 to 1.
+func (c *opllChannel) output(p *[8]uint8, am, vib float64) float64 {
+	mod, car := &c.operators[0], &c.operators[1]
+
+	// The modulator feeds back into itself.
+	feedback := 0.0
+	if fb := p[3] & 7; fb != 0 {
+		feedback = (mod.out[0] + mod.out[1]) / 2 * opllFeedback0 * float64(uint(1)<<(fb-1))
+	}
+	modAttenuation := float64(p[2]&0x3F) * 0.75
+	m := c.operate(mod, p, 0, modAttenuation, feedback, am, vib)
+	mod.out[1] = mod.out[0]
+	mod.out[0] = m
+
+	carAttenuation := float64(c.volume) * 3
+	return c.operate(car, p, 1, carAttenuation, m*opllModulation, am, vib)
+}
+
+// operate advances operator op of the channel by one sample and returns
+// its output. modulation shifts the phase, in cycles.
+func (c *opllChannel) operate(o *opllOperator, p *[8]uint8, op int, attenuation, modulation, am, vib float64) float64 {
+	flags := p[op]
+	increment := float64(c.fnum) * float64(uint(1)<<c.block) / (1 << 19) * opllMultipliers[flags&0x0F]
+	if flags&0x40 != 0 {
+		increment *= vib
+	}
+	o.phase = math.Mod(o.phase+increment, 1)
+
+	c.stepEnvelope(o, p, op)
+	if o.stage == envOff {
+		return 0
+	}
+
+	ksl := opllKeyScale[c.fnum>>5] - 6*float64(7-c.block)
+	if ksl < 0 {
+		ksl = 0
+	}
+	attenuation += ksl*opllKeyScaleFactors[p[2+op]>>6] + o.env
+	if flags&0x80 != 0 {
+		attenuation += am
+	}
+	if attenuation >= opllSilence {
+		return 0
+	}
+
+	wave := math.Sin(2 * math.Pi * (o.phase + modulation))
+	// DM and DC select a half-wave rectified sine for each operator.
+	rectify := p[3]&(0x08<<op) != 0
+	if rectify && wave < 0 {
+		wave = 0
+	}
+	return wave * math.Pow(10, -attenuation/20)
+}
+
+// rate returns the effective envelope rate, 0-63, for a 4-bit rate value,
+// raised by key scaling for higher notes.
+func (c *opllChannel) rate(p *[8]uint8, op int, value uint8) int {
+	if value == 0 {
+		return 0
+	}
+	keyScale := int(c.block)<<1 | int(c.fnum>>8)
+	if p[op]&0x10 == 0 {
+		keyScale >>= 2
+	}
+	rate := int(value)*4 + keyScale
+	if rate > 63 {
+		rate = 63
+	}
+	return rate
+}
+
+// envelopeStep returns the attenuation change per sample, in dB, of a
+// decay or release at rate, which sweeps 96 dB in about 39 s at rate 4
+// and twice as fast for every four steps above that.
+func envelopeStep(rate int) float64 {
+	if rate == 0 {
+		return 0
+	}
+	seconds := 39.28064 / math.Pow(2, float64(rate-4)/4)
+	return opllSilence / (seconds * opllRate)
+}
+
+func (c *opllChannel) stepEnvelope(o *opllOperator, p *[8]uint8, op int) {
+	sustainLevel := float64(p[6+op]>>4) * 3
+	switch o.stage {
+	case envAttack:
+		rate := c.rate(p, op, p[4+op]>>4)
+		switch {
+		case rate >= 60:
+			o.env = 0
+		case rate > 0:
+			// Attacks take about 14 times less time than decays.
+			o.env -= envelopeStep(rate) * 14
+		}
+		if o.env <= 0 {
+			o.env = 0
+			o.stage = envDecay
+		}
+	case envDecay:
+		o.env += envelopeStep(c.rate(p, op, p[4+op]&0x0F))
+		if o.env >= sustainLevel {
+			o.env = sustainLevel
+			o.stage = envSustain
+		}
+	case envSustain:
+		// Percussive instruments keep decaying at the release rate.
+		if p[op]&0x20 == 0 {
+			o.env += envelopeStep(c.rate(p, op, p[6+op]&0x0F))
+		}
+	case envRelease:
+		release := p[6+op] & 0x0F
+		switch {
+		case c.sustain:
+			release = 5
+		case p[op]&0x20 == 0:
+			release = 7
+		}
+		o.env += envelopeStep(c.rate(p, op, release))
+	}
+	if o.stage != envAttack && o.env >= opllSilence {
+		o.env = opllSilence
+		o.stage = envOff
+	}
+}
+
+func (o *opll) stateFields() []interface{} {
+	fields := []interface{}{&o.address, &o.custom, &o.amPhase, &o.vibPhase, &o.cycle, &o.sample}
+	for i := range o.channels {
+		c := &o.channels[i]
+		fields = append(fields, &c.fnum, &c.block, &c.key, &c.sustain, &c.instrument, &c.volume)
+		for j := range c.operators {
+			op := &c.operators[j]
+			fields = append(fields, &op.phase, &op.env, &op.stage, &op.out)
+		}
+	}
+	return fields
+}
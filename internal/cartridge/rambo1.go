@@ -0,0 +1,156 @@
+package cartridge
+
+func init() {
+	registerMapper(64, newRAMBO1)
+}
+
+// rambo1 is mapper 64, the Tengen RAMBO-1, an MMC3 relative. It adds a
+// third switchable PRG bank, a mode that splits the 2 KiB CHR banks into
+// 1 KiB ones, and an IRQ counter that is clocked either by PPU A12 or by a
+// prescaler every 4 CPU cycles.
+type rambo1 struct {
+	*board
+
+	bankSelect uint8
+	registers  [16]uint8
+
+	irqLatch   uint8
+	irqCounter uint8
+	irqReload  bool
+	irqEnabled bool
+	irqPending bool
+	// cycleMode clocks the counter from the CPU through prescaler.
+	cycleMode bool
+	prescaler uint8
+}
+
+// Fields of the bank select register.
+const (
+	rambo1Register   = 0x0F
+	rambo1CHR1K      = 0x20
+	rambo1PRGMode    = 0x40
+	rambo1CHRInverse = 0x80
+)
+
+func newRAMBO1(b *board) Mapper {
+	m := &rambo1{board: b}
+	m.updateBanks()
+	return m
+}
+
+func (m *rambo1) WritePRG(address uint16, data uint8) {
+	if address < 0x8000 {
+		m.board.WritePRG(address, data)
+		return
+	}
+	even := address&1 == 0
+	switch {
+	case address < 0xA000 && even:
+		m.bankSelect = data
+	case address < 0xA000:
+		m.registers[m.bankSelect&rambo1Register] = data
+	case address < 0xC000 && even:
+		if m.header.FourScreen {
+			break
+		}
+		if data&1 == 0 {
+			m.setMirroring(MirrorVertical)
+		} else {
+			m.setMirroring(MirrorHorizontal)
+		}
+	case address < 0xC000:
+	case address < 0xE000 && even:
+		m.irqLatch = data
+	case address < 0xE000:
+		m.cycleMode = data&1 != 0
+		m.irqReload = true
+		m.prescaler = 0
+	case even:
+		m.irqEnabled = false
+		m.irqPending = false
+	default:
+		m.irqEnabled = true
+	}
+	m.updateBanks()
+}
+
+// updateBanks rebuilds the bank tables from the registers.
+func (m *rambo1) updateBanks() {
+	r := m.registers
+	if m.bankSelect&rambo1PRGMode == 0 {
+		m.setPRGBank(0, prgWindow, int(r[6]))
+		m.setPRGBank(1, prgWindow, int(r[7]))
+		m.setPRGBank(2, prgWindow, int(r[15]))
+	} else {
+		m.setPRGBank(0, prgWindow, int(r[15]))
+		m.setPRGBank(1, prgWindow, int(r[6]))
+		m.setPRGBank(2, prgWindow, int(r[7]))
+	}
+	m.setPRGBank(3, prgWindow, -1)
+
+	pages := [8]int{
+		int(r[0] &^ 1), int(r[0] | 1), int(r[1] &^ 1), int(r[1] | 1),
+		int(r[2]), int(r[3]), int(r[4]), int(r[5]),
+	}
+	if m.bankSelect&rambo1CHR1K != 0 {
+		pages[0], pages[1], pages[2], pages[3] = int(r[0]), int(r[8]), int(r[1]), int(r[9])
+	}
+	if m.bankSelect&rambo1CHRInverse != 0 {
+		pages = [8]int{
+			pages[4], pages[5], pages[6], pages[7],
+			pages[0], pages[1], pages[2], pages[3],
+		}
+	}
+	for window, page := range pages {
+		m.setCHRBank(window, chrWindow, page)
+	}
+}
+
+// clockCounter clocks the IRQ counter. A reload after a $C001 write loads
+// one more than the latch when the latch is above 1, which the games'
+// timing expects.
+func (m *rambo1) clockCounter() {
+	switch {
+	case m.irqReload:
+		m.irqCounter = m.irqLatch
+		if m.irqLatch > 1 {
+			m.irqCounter++
+		}
+		m.irqReload = false
+	case m.irqCounter == 0:
+		m.irqCounter = m.irqLatch
+	default:
+		m.irqCounter--
+	}
+	if m.irqCounter == 0 && m.irqEnabled {
+		m.irqPending = true
+	}
+}
+
+func (m *rambo1) OnA12Rise() {
+	if !m.cycleMode {
+		m.clockCounter()
+	}
+}
+
+func (m *rambo1) StepCPU() {
+	if !m.cycleMode {
+		return
+	}
+	m.prescaler++
+	if m.prescaler == 4 {
+		m.prescaler = 0
+		m.clockCounter()
+	}
+}
+
+func (m *rambo1) IRQ() bool {
+	return m.irqPending
+}
+
+func (m *rambo1) stateFields() []interface{} {
+	return append(m.board.stateFields(),
+		&m.bankSelect, &m.registers,
+		&m.irqLatch, &m.irqCounter, &m.irqReload, &m.irqEnabled, &m.irqPending,
+		&m.cycleMode, &m.prescaler)
+}
@@ -0,0 +1,80 @@
+package cartridge
+
+func init() {
+	registerMapper(68, newSunsoft4)
+}
+
+// sunsoft4 is mapper 68, the Sunsoft-4: a switchable 16 KiB PRG bank with
+// the last fixed at $C000, four 2 KiB CHR banks, and two 1 KiB banks of
+// CHR ROM that can stand in for nametable RAM, taken from the last 128 KiB
+// of CHR.
+type sunsoft4 struct {
+	*board
+
+	ntRegs [2]uint8
+	// control holds the mirroring in bits 0-1 and the CHR ROM nametable
+	// enable in bit 4.
+	control uint8
+}
+
+func newSunsoft4(b *board) Mapper {
+	m := &sunsoft4{board: b}
+	m.setPRGBank(0, 0x4000, 0)
+	m.setPRGBank(1, 0x4000, -1)
+	return m
+}
+
+func (m *sunsoft4) WritePRG(address uint16, data uint8) {
+	switch address & 0xF000 {
+	case 0x8000, 0x9000, 0xA000, 0xB000:
+		m.setCHRBank(int(address-0x8000)>>12, 0x0800, int(data))
+	case 0xC000, 0xD000:
+		m.ntRegs[(address-0xC000)>>12] = data | 0x80
+	case 0xE000:
+		m.control = data
+		switch data & 0x03 {
+		case 0:
+			m.setMirroring(MirrorVertical)
+		case 1:
+			m.setMirroring(MirrorHorizontal)
+		case 2:
+			m.setMirroring(MirrorSingleLower)
+		case 3:
+			m.setMirroring(MirrorSingleUpper)
+		}
+	case 0xF000:
+		m.setPRGBank(0, 0x4000, int(data&0x0F))
+		m.ramDisabled = data&0x10 == 0
+	default:
+		m.board.WritePRG(address, data)
+	}
+}
+
+// romNametable returns the offset in CHR of the nametable at address when
+// nametables come from CHR ROM.
+func (m *sunsoft4) romNametable(address uint16) (int, bool) {
+	if m.control&0x10 == 0 {
+		return 0, false
+	}
+	page := m.nametableOffset(address) / 0x0400
+	offset := bankOffset(m.chr, chrWindow, int(m.ntRegs[page&1]))
+	return (offset + int(address)%chrWindow) % len(m.chr), true
+}
+
+func (m *sunsoft4) ReadNametable(address uint16) uint8 {
+	if offset, ok := m.romNametable(address); ok {
+		return m.chr[offset]
+	}
+	return m.board.ReadNametable(address)
+}
+
+func (m *sunsoft4) WriteNametable(address uint16, data uint8) {
+	if _, ok := m.romNametable(address); ok {
+		return
+	}
+	m.board.WriteNametable(address, data)
+}
+
+func (m *sunsoft4) stateFields() []interface{} {
+	return append(m.board.stateFields(), &m.ntRegs, &m.control)
+}
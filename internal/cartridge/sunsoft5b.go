@@ -0,0 +1,175 @@
+package cartridge
+
+import "math"
+
+// Sound of the Sunsoft 5B: an AY-3-8910 with three square wave channels, a
+// shared noise generator and a shared envelope generator. The 5B runs at
+// half the CPU clock, and its internal dividers halve that again.
+
+// sunsoft5BLevel is the mixing level of one channel at full volume, on the
+// scale of the APU's mix.
+const sunsoft5BLevel = 0.08
+
+// sunsoft5BVolumes gives the amplitude of each of the 32 output levels,
+// 1.5 dB apart with level 0 silent.
+var sunsoft5BVolumes [32]float32
+
+func init() {
+	for level := 1; level < len(sunsoft5BVolumes); level++ {
+		sunsoft5BVolumes[level] = float32(math.Pow(10, -1.5*float64(31-level)/20))
+	}
+}
+
+// Envelope shape bits of register 13.
+const (
+	envelopeHold      = 0x01
+	envelopeAlternate = 0x02
+	envelopeAttack    = 0x04
+	envelopeContinue  = 0x08
+)
+
+// sunsoft5B holds the 5B's sixteen registers and its generators.
+type sunsoft5B struct {
+	address   uint8
+	registers [16]uint8
+
+	cycle uint8
+
+	toneTimers [3]uint16
+	toneOut    [3]bool
+
+	noiseTimer uint8
+	noiseShift uint32
+
+	envelopeTimer uint16
+	// envelopeStep counts from 0 to 31 through one envelope period.
+	envelopeStep uint8
+	envelopeUp   bool
+	envelopeHeld bool
+}
+
+func (s *sunsoft5B) reset() {
+	*s = sunsoft5B{noiseShift: 1}
+}
+
+func (s *sunsoft5B) writeAddress(data uint8) {
+	s.address = data
+}
+
+func (s *sunsoft5B) writeData(data uint8) {
+	if s.address >= 16 {
+		return
+	}
+	s.registers[s.address] = data
+	if s.address == 13 {
+		s.envelopeStep = 0
+		s.envelopeUp = data&envelopeAttack != 0
+		s.envelopeHeld = false
+	}
+}
+
+func (s *sunsoft5B) tonePeriod(channel int) uint16 {
+	return uint16(s.registers[channel*2]) | uint16(s.registers[channel*2+1]&0x0F)<<8
+}
+
+// step advances the generators by one CPU cycle. Tone and noise timers
+// count every 16 CPU cycles and the envelope every 8.
+func (s *sunsoft5B) step() {
+	s.cycle++
+	if s.cycle%8 != 0 {
+		return
+	}
+	s.stepEnvelope()
+	if s.cycle%16 != 0 {
+		return
+	}
+	for channel := range s.toneTimers {
+		s.toneTimers[channel]++
+		if s.toneTimers[channel] >= s.tonePeriod(channel) {
+			s.toneTimers[channel] = 0
+			s.toneOut[channel] = !s.toneOut[channel]
+		}
+	}
+	s.noiseTimer++
+	if s.noiseTimer >= s.registers[6]&0x1F {
+		s.noiseTimer = 0
+		// 17-bit LFSR with taps at bits 0 and 3.
+		bit := (s.noiseShift ^ s.noiseShift>>3) & 1
+		s.noiseShift = s.noiseShift>>1 | bit<<16
+	}
+}
+
+func (s *sunsoft5B) stepEnvelope() {
+	period := uint16(s.registers[11]) | uint16(s.registers[12])<<8
+	s.envelopeTimer++
+	if s.envelopeTimer < period {
+		return
+	}
+	s.envelopeTimer = 0
+	if s.envelopeHeld {
+		return
+	}
+	s.envelopeStep++
+	if s.envelopeStep < 32 {
+		return
+	}
+	shape := s.registers[13]
+	s.envelopeStep = 0
+	switch {
+	case shape&envelopeContinue == 0:
+		s.envelopeUp = false
+		s.envelopeHeld = true
+	case shape&envelopeHold != 0:
+		if shape&envelopeAlternate != 0 {
+			s.envelopeUp = !s.envelopeUp
+		}
+		s.envelopeHeld = true
+	case shape&envelopeAlternate != 0:
+		s.envelopeUp = !s.envelopeUp
+	}
+}
+
+// envelopeLevel returns the current 5-bit envelope output.
+func (s *sunsoft5B) envelopeLevel() int {
+	if s.envelopeHeld {
+		if s.envelopeUp {
+			return 31
+		}
+		return 0
+	}
+	if s.envelopeUp {
+		return int(s.envelopeStep)
+	}
+	return 31 - int(s.envelopeStep)
+}
+
+func (s *sunsoft5B) output() float32 {
+	mixer := s.registers[7]
+	noise := s.noiseShift&1 != 0
+	var sample float32
+	for channel := 0; channel < 3; channel++ {
+		toneOff := mixer&(1<<channel) != 0
+		noiseOff := mixer&(8<<channel) != 0
+		if !(s.toneOut[channel] || toneOff) || !(noise || noiseOff) {
+			continue
+		}
+		volume := s.registers[8+channel]
+		level := 0
+		switch {
+		case volume&0x10 != 0:
+			level = s.envelopeLevel()
+		case volume&0x0F != 0:
+			level = int(volume&0x0F)*2 + 1
+		}
+		sample += sunsoft5BVolumes[level]
+	}
+	return sample * sunsoft5BLevel
+}
+
+func (s *sunsoft5B) stateFields() []interface{} {
+	return []interface{}{
+		&s.address, &s.registers, &s.cycle, &s.toneTimers, &s.toneOut,
+		&s.noiseTimer, &s.noiseShift,
+		&s.envelopeTimer, &s.envelopeStep, &s.envelopeUp, &s.envelopeHeld,
+	}
+}
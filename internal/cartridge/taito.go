@@ -0,0 +1,112 @@
+package cartridge
+
+func init() {
+	registerMapper(33, newTC0190)
+	registerMapper(48, newTC0690)
+}
+
+// taito is mapper 33, the Taito TC0190, and mapper 48, the TC0690. Both
+// have two switchable 8 KiB PRG banks with the last two fixed, two 2 KiB
+// and four 1 KiB CHR banks. The TC0190 takes mirroring from bit 6 of the
+// first PRG register; the TC0690 moves it to $E000 and adds a scanline
+// counter clocked by PPU A12 like the MMC3's, with its latch inverted.
+type taito struct {
+	*board
+
+	tc0690 bool
+
+	irqLatch   uint8
+	irqCounter uint8
+	irqReload  bool
+	irqEnabled bool
+	irqPending bool
+}
+
+func newTC0190(b *board) Mapper {
+	return newTaito(b, false)
+}
+
+func newTC0690(b *board) Mapper {
+	return newTaito(b, true)
+}
+
+func newTaito(b *board, tc0690 bool) *taito {
+	m := &taito{board: b, tc0690: tc0690}
+	m.setPRGBank(0, prgWindow, 0)
+	m.setPRGBank(1, prgWindow, 1)
+	m.setPRGBank(2, prgWindow, -2)
+	m.setPRGBank(3, prgWindow, -1)
+	return m
+}
+
+func (m *taito) WritePRG(address uint16, data uint8) {
+	if address < 0x8000 {
+		m.board.WritePRG(address, data)
+		return
+	}
+	switch address & 0xE003 {
+	case 0x8000:
+		if m.tc0690 {
+			m.setPRGBank(0, prgWindow, int(data))
+			break
+		}
+		m.setPRGBank(0, prgWindow, int(data&0x3F))
+		if data&0x40 == 0 {
+			m.setMirroring(MirrorVertical)
+		} else {
+			m.setMirroring(MirrorHorizontal)
+		}
+	case 0x8001:
+		m.setPRGBank(1, prgWindow, int(data))
+	case 0x8002, 0x8003:
+		m.setCHRBank(int(address&1), 0x0800, int(data))
+	case 0xA000, 0xA001, 0xA002, 0xA003:
+		m.setCHRBank(4+int(address&3), chrWindow, int(data))
+	}
+	if !m.tc0690 {
+		return
+	}
+	switch address & 0xE003 {
+	case 0xC000:
+		m.irqLatch = data ^ 0xFF
+	case 0xC001:
+		m.irqCounter = 0
+		m.irqReload = true
+	case 0xC002:
+		m.irqEnabled = true
+	case 0xC003:
+		m.irqEnabled = false
+		m.irqPending = false
+	case 0xE000:
+		if data&0x40 == 0 {
+			m.setMirroring(MirrorVertical)
+		} else {
+			m.setMirroring(MirrorHorizontal)
+		}
+	}
+}
+
+// OnA12Rise clocks the TC0690's scanline counter.
+func (m *taito) OnA12Rise() {
+	if !m.tc0690 {
+		return
+	}
+	if m.irqCounter == 0 || m.irqReload {
+		m.irqCounter = m.irqLatch
+	} else {
+		m.irqCounter--
+	}
+	m.irqReload = false
+	if m.irqCounter == 0 && m.irqEnabled {
+		m.irqPending = true
+	}
+}
+
+func (m *taito) IRQ() bool {
+	return m.irqPending
+}
+
+func (m *taito) stateFields() []interface{} {
+	return append(m.board.stateFields(),
+		&m.irqLatch, &m.irqCounter, &m.irqReload, &m.irqEnabled, &m.irqPending)
+}
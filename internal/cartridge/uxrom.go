@@ -0,0 +1,35 @@
+package cartridge
+
+func init() {
+	registerMapper(2, newUxROM)
+}
+
+// uxrom is mapper 2: a switchable 16 KiB PRG bank at $8000 and the last
+// bank fixed at $C000, with 8 KiB of CHR RAM. The bank is selected by
+// writing anywhere in $8000-$FFFF.
+type uxrom struct {
+	*board
+	busConflicts bool
+}
+
+func newUxROM(b *board) Mapper {
+	m := &uxrom{
+		board: b,
+		// Submapper 1 declares a board without bus conflicts.
+		busConflicts: b.header.Submapper != 1,
+	}
+	m.setPRGBank(0, 0x4000, 0)
+	m.setPRGBank(1, 0x4000, -1)
+	return m
+}
+
+func (m *uxrom) WritePRG(address uint16, data uint8) {
+	if address < 0x8000 {
+		m.board.WritePRG(address, data)
+		return
+	}
+	if m.busConflicts {
+		data = m.busConflict(address, data)
+	}
+	m.setPRGBank(0, 0x4000, int(data))
+}
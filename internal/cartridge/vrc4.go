@@ -0,0 +1,193 @@
+package cartridge
+
+func init() {
+	registerMapper(21, newVRC4Mapper21)
+	registerMapper(22, newVRC2a)
+	registerMapper(23, newVRC4Mapper23)
+	registerMapper(25, newVRC4Mapper25)
+}
+
+// vrc4 covers the Konami VRC2 and VRC4, which differ mainly in which CPU
+// address lines select among the four registers at each of $8000-$F000.
+// The mapper numbers group the boards by those lines and the submappers
+// tell them apart; without a submapper both candidate lines are decoded,
+// which works for every known game.
+//
+// The VRC4 adds a PRG swap mode, single-screen mirroring, a fifth CHR bank
+// bit and the VRC IRQ counter to the VRC2.
+type vrc4 struct {
+	*board
+
+	// lines gives the mask of the address lines that drive register
+	// select bits 0 and 1.
+	lines [2]uint16
+	vrc2  bool
+	// chrShift is 1 on VRC2a, which ignores the low bit of CHR banks.
+	chrShift uint
+
+	prgRegs [2]uint8
+	prgSwap bool
+	chrRegs [8]uint16
+	irq     vrcIRQ
+}
+
+// Address lines, as masks, of the register select bits of each board.
+const (
+	lineA0 = 1 << 0
+	lineA1 = 1 << 1
+	lineA2 = 1 << 2
+	lineA3 = 1 << 3
+	lineA6 = 1 << 6
+	lineA7 = 1 << 7
+)
+
+func newVRC4(b *board, line0, line1 uint16, vrc2 bool) *vrc4 {
+	m := &vrc4{
+		board: b,
+		lines: [2]uint16{line0, line1},
+		vrc2:  vrc2,
+	}
+	m.updateBanks()
+	return m
+}
+
+func newVRC4Mapper21(b *board) Mapper {
+	switch b.header.Submapper {
+	case 1:
+		return newVRC4(b, lineA1, lineA2, false) // VRC4a
+	case 2:
+		return newVRC4(b, lineA6, lineA7, false) // VRC4c
+	}
+	return newVRC4(b, lineA1|lineA6, lineA2|lineA7, false)
+}
+
+func newVRC2a(b *board) Mapper {
+	m := newVRC4(b, lineA1, lineA0, true)
+	m.chrShift = 1
+	m.updateBanks()
+	return m
+}
+
+func newVRC4Mapper23(b *board) Mapper {
+	switch b.header.Submapper {
+	case 1:
+		return newVRC4(b, lineA0, lineA1, false) // VRC4f
+	case 2:
+		return newVRC4(b, lineA2, lineA3, false) // VRC4e
+	case 3:
+		return newVRC4(b, lineA0, lineA1, true) // VRC2b
+	}
+	return newVRC4(b, lineA0|lineA2, lineA1|lineA3, false)
+}
+
+func newVRC4Mapper25(b *board) Mapper {
+	switch b.header.Submapper {
+	case 1:
+		return newVRC4(b, lineA1, lineA0, false) // VRC4b
+	case 2:
+		return newVRC4(b, lineA3, lineA2, false) // VRC4d
+	case 3:
+		return newVRC4(b, lineA1, lineA0, true) // VRC2c
+	}
+	return newVRC4(b, lineA1|lineA3, lineA0|lineA2, false)
+}
+
+// register returns the register number, 0-3, selected by address.
+func (m *vrc4) register(address uint16) int {
+	register := 0
+	if address&m.lines[0] != 0 {
+		register |= 1
+	}
+	if address&m.lines[1] != 0 {
+		register |= 2
+	}
+	return register
+}
+
+func (m *vrc4) WritePRG(address uint16, data uint8) {
+	if address < 0x8000 {
+		m.board.WritePRG(address, data)
+		return
+	}
+	register := m.register(address)
+	switch address & 0xF000 {
+	case 0x8000:
+		m.prgRegs[0] = data & 0x1F
+	case 0x9000:
+		switch {
+		case register == 0 || m.vrc2:
+			m.writeMirroring(data)
+		case register >= 2:
+			m.prgSwap = data&0x02 != 0
+		}
+	case 0xA000:
+		m.prgRegs[1] = data & 0x1F
+	case 0xB000, 0xC000, 0xD000, 0xE000:
+		bank := int(address-0xB000)>>12*2 + register>>1
+		if register&1 == 0 {
+			m.chrRegs[bank] = m.chrRegs[bank]&0x1F0 | uint16(data&0x0F)
+		} else {
+			m.chrRegs[bank] = m.chrRegs[bank]&0x0F | uint16(data&0x1F)<<4
+		}
+	case 0xF000:
+		if m.vrc2 {
+			return
+		}
+		switch register {
+		case 0:
+			m.irq.latch = m.irq.latch&0xF0 | data&0x0F
+		case 1:
+			m.irq.latch = m.irq.latch&0x0F | data<<4
+		case 2:
+			m.irq.writeControl(data)
+		case 3:
+			m.irq.acknowledge()
+		}
+	}
+	m.updateBanks()
+}
+
+func (m *vrc4) writeMirroring(data uint8) {
+	if m.vrc2 {
+		data &= 1
+	}
+	switch data & 3 {
+	case 0:
+		m.setMirroring(MirrorVertical)
+	case 1:
+		m.setMirroring(MirrorHorizontal)
+	case 2:
+		m.setMirroring(MirrorSingleLower)
+	case 3:
+		m.setMirroring(MirrorSingleUpper)
+	}
+}
+
+// updateBanks rebuilds the bank tables from the registers.
+func (m *vrc4) updateBanks() {
+	if m.prgSwap {
+		m.setPRGBank(0, prgWindow, -2)
+		m.setPRGBank(2, prgWindow, int(m.prgRegs[0]))
+	} else {
+		m.setPRGBank(0, prgWindow, int(m.prgRegs[0]))
+		m.setPRGBank(2, prgWindow, -2)
+	}
+	m.setPRGBank(1, prgWindow, int(m.prgRegs[1]))
+	m.setPRGBank(3, prgWindow, -1)
+	for window, bank := range m.chrRegs {
+		m.setCHRBank(window, chrWindow, int(bank)>>m.chrShift)
+	}
+}
+
+func (m *vrc4) StepCPU() {
+	m.irq.step()
+}
+
+func (m *vrc4) IRQ() bool {
+	return m.irq.pending
+}
+
+func (m *vrc4) stateFields() []interface{} {
+	fields := append(m.board.stateFields(), &m.prgRegs, &m.prgSwap, &m.chrRegs)
+	return append(fields, m.irq.stateFields()...)
+}
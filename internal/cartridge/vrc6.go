@@ -0,0 +1,139 @@
+package cartridge
+
+func init() {
+	registerMapper(24, newVRC6a)
+	registerMapper(26, newVRC6b)
+}
+
+// vrc6 is the Konami VRC6: mapper 24 (VRC6a) and mapper 26 (VRC6b), which
+// swap the two address lines that select among each group of registers.
+// It adds two pulse channels and a sawtooth channel to the console's sound.
+type vrc6 struct {
+	*board
+
+	swapLines bool
+
+	prg16   uint8
+	prg8    uint8
+	chrRegs [8]uint8
+	control uint8
+	irq     vrcIRQ
+
+	audio vrc6Audio
+}
+
+func newVRC6a(b *board) Mapper {
+	return newVRC6(b, false)
+}
+
+func newVRC6b(b *board) Mapper {
+	return newVRC6(b, true)
+}
+
+func newVRC6(b *board, swapLines bool) *vrc6 {
+	m := &vrc6{board: b, swapLines: swapLines}
+	m.updateBanks()
+	return m
+}
+
+// Fields of the $B003 control register.
+const (
+	vrc6CHRMode   = 0x03
+	vrc6Mirroring = 0x0C
+	vrc6RAMEnable = 0x80
+)
+
+func (m *vrc6) WritePRG(address uint16, data uint8) {
+	if address < 0x8000 {
+		m.board.WritePRG(address, data)
+		return
+	}
+	register := address & 3
+	if m.swapLines {
+		register = register>>1 | register&1<<1
+	}
+	switch address & 0xF000 {
+	case 0x8000:
+		m.prg16 = data & 0x0F
+	case 0x9000, 0xA000:
+		m.audio.writeRegister(address&0xF000, register, data)
+	case 0xB000:
+		if register == 3 {
+			m.control = data
+		} else {
+			m.audio.writeRegister(address&0xF000, register, data)
+		}
+	case 0xC000:
+		m.prg8 = data & 0x1F
+	case 0xD000:
+		m.chrRegs[register] = data
+	case 0xE000:
+		m.chrRegs[4+register] = data
+	case 0xF000:
+		switch register {
+		case 0:
+			m.irq.latch = data
+		case 1:
+			m.irq.writeControl(data)
+		case 2:
+			m.irq.acknowledge()
+		}
+	}
+	m.updateBanks()
+}
+
+// updateBanks rebuilds the bank tables from the registers.
+func (m *vrc6) updateBanks() {
+	m.setPRGBank(0, 0x4000, int(m.prg16))
+	m.setPRGBank(2, prgWindow, int(m.prg8))
+	m.setPRGBank(3, prgWindow, -1)
+
+	r := m.chrRegs
+	switch m.control & vrc6CHRMode {
+	case 0:
+		for window, bank := range r {
+			m.setCHRBank(window, chrWindow, int(bank))
+		}
+	case 1:
+		for slot := 0; slot < 4; slot++ {
+			m.setCHRBank(slot, 0x0800, int(r[slot]))
+		}
+	default:
+		for window := 0; window < 4; window++ {
+			m.setCHRBank(window, chrWindow, int(r[window]))
+		}
+		m.setCHRBank(2, 0x0800, int(r[4]))
+		m.setCHRBank(3, 0x0800, int(r[5]))
+	}
+
+	switch (m.control & vrc6Mirroring) >> 2 {
+	case 0:
+		m.setMirroring(MirrorVertical)
+	case 1:
+		m.setMirroring(MirrorHorizontal)
+	case 2:
+		m.setMirroring(MirrorSingleLower)
+	case 3:
+		m.setMirroring(MirrorSingleUpper)
+	}
+	m.ramDisabled = m.control&vrc6RAMEnable == 0
+}
+
+func (m *vrc6) StepCPU() {
+	m.irq.step()
+	m.audio.step()
+}
+
+func (m *vrc6) IRQ() bool {
+	return m.irq.pending
+}
+
+func (m *vrc6) AudioOutput() float32 {
+	return m.audio.output()
+}
+
+func (m *vrc6) stateFields() []interface{} {
+	fields := append(m.board.stateFields(), &m.prg16, &m.prg8, &m.chrRegs, &m.control)
+	fields = append(fields, m.irq.stateFields()...)
+	return append(fields, m.audio.stateFields()...)
+}
@@ -0,0 +1,171 @@
+package cartridge
+
+// Sound of the VRC6: two pulse channels with eight duty cycles and a
+// sawtooth channel, all with 12-bit periods counted in CPU cycles.
+
+// vrc6Level is the mixing level of one output step, on the scale of the
+// APU's mix.
+const vrc6Level = 0.00752
+
+// vrc6Pulse is one of the VRC6's pulse channels.
+type vrc6Pulse struct {
+	volume   uint8
+	duty     uint8
+	digital  bool
+	enabled  bool
+	period   uint16
+	timer    uint16
+	position uint8
+}
+
+func (p *vrc6Pulse) writeRegister(register uint16, data uint8) {
+	switch register {
+	case 0:
+		p.digital = data&0x80 != 0
+		p.duty = data >> 4 & 7
+		p.volume = data & 0x0F
+	case 1:
+		p.period = p.period&0x0F00 | uint16(data)
+	case 2:
+		p.period = p.period&0x00FF | uint16(data&0x0F)<<8
+		p.enabled = data&0x80 != 0
+		if !p.enabled {
+			p.position = 0
+		}
+	}
+}
+
+func (p *vrc6Pulse) stepTimer(shift uint) {
+	if !p.enabled {
+		return
+	}
+	if p.timer == 0 {
+		p.timer = p.period >> shift
+		p.position = (p.position + 1) & 15
+	} else {
+		p.timer--
+	}
+}
+
+func (p *vrc6Pulse) output() uint8 {
+	if !p.enabled || !p.digital && p.position > p.duty {
+		return 0
+	}
+	return p.volume
+}
+
+func (p *vrc6Pulse) stateFields() []interface{} {
+	return []interface{}{
+		&p.volume, &p.duty, &p.digital, &p.enabled, &p.period, &p.timer, &p.position,
+	}
+}
+
+// vrc6Saw is the VRC6's sawtooth channel: an accumulator that adds the rate
+// on every other clock and resets after seven additions.
+type vrc6Saw struct {
+	rate        uint8
+	enabled     bool
+	period      uint16
+	timer       uint16
+	step        uint8
+	accumulator uint8
+}
+
+func (s *vrc6Saw) writeRegister(register uint16, data uint8) {
+	switch register {
+	case 0:
+		s.rate = data & 0x3F
+	case 1:
+		s.period = s.period&0x0F00 | uint16(data)
+	case 2:
+		s.period = s.period&0x00FF | uint16(data&0x0F)<<8
+		s.enabled = data&0x80 != 0
+		if !s.enabled {
+			s.step = 0
+			s.accumulator = 0
+		}
+	}
+}
+
+func (s *vrc6Saw) stepTimer(shift uint) {
+	if !s.enabled {
+		return
+	}
+	if s.timer > 0 {
+		s.timer--
+		return
+	}
+	s.timer = s.period >> shift
+	s.step++
+	switch {
+	case s.step == 14:
+		s.step = 0
+		s.accumulator = 0
+	case s.step&1 == 0:
+		s.accumulator += s.rate
+	}
+}
+
+func (s *vrc6Saw) output() uint8 {
+	if !s.enabled {
+		return 0
+	}
+	return s.accumulator >> 3
+}
+
+func (s *vrc6Saw) stateFields() []interface{} {
+	return []interface{}{
+		&s.rate, &s.enabled, &s.period, &s.timer, &s.step, &s.accumulator,
+	}
+}
+
+// vrc6Audio holds the sound channels of the VRC6.
+type vrc6Audio struct {
+	pulses [2]vrc6Pulse
+	saw    vrc6Saw
+	// control is $9003: bit 0 halts the channels and bits 1 and 2 speed
+	// them up by 16 or 256 times.
+	control uint8
+}
+
+// writeRegister handles a write to the registers at base ($9000, $A000 or
+// $B000), with register selecting among them.
+func (a *vrc6Audio) writeRegister(base, register uint16, data uint8) {
+	switch {
+	case base == 0x9000 && register == 3:
+		a.control = data
+	case base == 0x9000:
+		a.pulses[0].writeRegister(register, data)
+	case base == 0xA000:
+		a.pulses[1].writeRegister(register, data)
+	case base == 0xB000:
+		a.saw.writeRegister(register, data)
+	}
+}
+
+func (a *vrc6Audio) step() {
+	if a.control&0x01 != 0 {
+		return
+	}
+	var shift uint
+	switch {
+	case a.control&0x04 != 0:
+		shift = 8
+	case a.control&0x02 != 0:
+		shift = 4
+	}
+	a.pulses[0].stepTimer(shift)
+	a.pulses[1].stepTimer(shift)
+	a.saw.stepTimer(shift)
+}
+
+func (a *vrc6Audio) output() float32 {
+	level := a.pulses[0].output() + a.pulses[1].output() + a.saw.output()
+	return vrc6Level * float32(level)
+}
+
+func (a *vrc6Audio) stateFields() []interface{} {
+	fields := append(a.pulses[0].stateFields(), a.pulses[1].stateFields()...)
+	fields = append(fields, a.saw.stateFields()...)
+	return append(fields, &a.control)
+}
@@ -0,0 +1,134 @@
+package cartridge
+
+func init() {
+	registerMapper(85, newVRC7)
+}
+
+// vrc7 is mapper 85, the Konami VRC7, with eight 1 KiB CHR banks, three
+// 8 KiB PRG banks, the VRC IRQ counter and a six-channel FM synthesizer
+// derived from the YM2413 (OPLL). VRC7a boards select the second register
+// of each pair with A4 and VRC7b boards with A3.
+type vrc7 struct {
+	*board
+
+	// secondLine is the address line that selects the second register
+	// of each pair.
+	secondLine uint16
+
+	prgRegs [3]uint8
+	chrRegs [8]uint8
+	control uint8
+	irq     vrcIRQ
+
+	audio opll
+}
+
+// Fields of the $E000 control register.
+const (
+	vrc7Mirroring = 0x03
+	vrc7Silence   = 0x40
+	vrc7RAMEnable = 0x80
+)
+
+func newVRC7(b *board) Mapper {
+	m := &vrc7{board: b}
+	m.audio.reset()
+	switch b.header.Submapper {
+	case 1:
+		m.secondLine = 0x08 // VRC7b
+	case 2:
+		m.secondLine = 0x10 // VRC7a
+	default:
+		m.secondLine = 0x18
+	}
+	m.updateBanks()
+	return m
+}
+
+func (m *vrc7) WritePRG(address uint16, data uint8) {
+	if address < 0x8000 {
+		m.board.WritePRG(address, data)
+		return
+	}
+	second := address&m.secondLine != 0
+	switch address & 0xF000 {
+	case 0x8000:
+		if second {
+			m.prgRegs[1] = data & 0x3F
+		} else {
+			m.prgRegs[0] = data & 0x3F
+		}
+	case 0x9000:
+		switch {
+		case address&0x0030 == 0x0030:
+			m.audio.writeData(data)
+		case address&0x0010 != 0:
+			m.audio.writeAddress(data)
+		default:
+			m.prgRegs[2] = data & 0x3F
+		}
+	case 0xA000, 0xB000, 0xC000, 0xD000:
+		bank := int(address-0xA000) >> 12 * 2
+		if second {
+			bank++
+		}
+		m.chrRegs[bank] = data
+	case 0xE000:
+		if second {
+			m.irq.latch = data
+		} else {
+			m.control = data
+		}
+	case 0xF000:
+		if second {
+			m.irq.acknowledge()
+		} else {
+			m.irq.writeControl(data)
+		}
+	}
+	m.updateBanks()
+}
+
+// updateBanks rebuilds the bank tables from the registers.
+func (m *vrc7) updateBanks() {
+	for slot, bank := range m.prgRegs {
+		m.setPRGBank(slot, prgWindow, int(bank))
+	}
+	m.setPRGBank(3, prgWindow, -1)
+	for window, bank := range m.chrRegs {
+		m.setCHRBank(window, chrWindow, int(bank))
+	}
+	switch m.control & vrc7Mirroring {
+	case 0:
+		m.setMirroring(MirrorVertical)
+	case 1:
+		m.setMirroring(MirrorHorizontal)
+	case 2:
+		m.setMirroring(MirrorSingleLower)
+	case 3:
+		m.setMirroring(MirrorSingleUpper)
+	}
+	m.ramDisabled = m.control&vrc7RAMEnable == 0
+}
+
+func (m *vrc7) StepCPU() {
+	m.irq.step()
+	m.audio.step()
+}
+
+func (m *vrc7) IRQ() bool {
+	return m.irq.pending
+}
+
+func (m *vrc7) AudioOutput() float32 {
+	if m.control&vrc7Silence != 0 {
+		return 0
+	}
+	return m.audio.output()
+}
+
+func (m *vrc7) stateFields() []interface{} {
+	fields := append(m.board.stateFields(), &m.prgRegs, &m.chrRegs, &m.control)
+	fields = append(fields, m.irq.stateFields()...)
+	return append(fields, m.audio.stateFields()...)
+}
@@ -0,0 +1,59 @@
+package cartridge
+
+// vrcIRQ is the IRQ counter shared by the Konami VRC4, VRC6 and VRC7. It is
+// clocked by the CPU, either on every cycle or, in scanline mode, through a
+// prescaler that approximates one clock per 341 PPU dots.
+type vrcIRQ struct {
+	latch     uint8
+	counter   uint8
+	prescaler int
+	enabled   bool
+	// enableOnAck is copied to enabled when the IRQ is acknowledged.
+	enableOnAck bool
+	cycleMode   bool
+	pending     bool
+}
+
+// writeControl handles a write to the control register (--- M E A).
+func (q *vrcIRQ) writeControl(data uint8) {
+	q.enableOnAck = data&0x01 != 0
+	q.enabled = data&0x02 != 0
+	q.cycleMode = data&0x04 != 0
+	q.pending = false
+	if q.enabled {
+		q.counter = q.latch
+		q.prescaler = 341
+	}
+}
+
+// acknowledge handles a write to the acknowledge register.
+func (q *vrcIRQ) acknowledge() {
+	q.pending = false
+	q.enabled = q.enableOnAck
+}
+
+// step advances the counter by one CPU cycle.
+func (q *vrcIRQ) step() {
+	if !q.enabled {
+		return
+	}
+	if !q.cycleMode {
+		q.prescaler -= 3
+		if q.prescaler > 0 {
+			return
+		}
+		q.prescaler += 341
+	}
+	if q.counter == 0xFF {
+		q.counter = q.latch
+		q.pending = true
+	} else {
+		q.counter++
+	}
+}
+
+func (q *vrcIRQ) stateFields() []interface{} {
+	return []interface{}{
+		&q.latch, &q.counter, &q.prescaler, &q.enabled, &q.enableOnAck, &q.cycleMode, &q.pending,
+	}
+}
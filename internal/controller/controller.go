@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"encoding/gob"
+
+	"github.com/tejasdeepakmasne/NESemu/internal/savestate"
+)
+
+// Button identifies one of the eight buttons of a standard controller, in
+// the order the controller reports them.
+type Button uint8
+
+const (
+	ButtonA Button = iota
+	ButtonB
+	ButtonSelect
+	ButtonStart
+	ButtonUp
+	ButtonDown
+	ButtonLeft
+	ButtonRight
+)
+
+// Controller represents a standard NES joypad attached to $4016 or $4017.
+type Controller struct {
+	buttons uint8
+	index   uint8
+	strobe  bool
+}
+
+// NewController creates a controller with no buttons held.
+func NewController() *Controller {
+	return &Controller{}
+}
+
+// SetButtons replaces the set of held buttons. Bit n of buttons corresponds
+// to Button n.
+func (c *Controller) SetButtons(buttons uint8) {
+	c.buttons = buttons
+}
+
+// SetButton presses or releases a single button.
+func (c *Controller) SetButton(button Button, pressed bool) {
+	if pressed {
+		c.buttons |= 1 << button
+	} else {
+		c.buttons &^= 1 << button
+	}
+}
+
+// Buttons returns the set of held buttons.
+func (c *Controller) Buttons() uint8 {
+	return c.buttons
+}
+
+// Read shifts out the next button state. After all eight buttons have been
+// read, an official controller returns 1.
+func (c *Controller) Read() uint8 {
+	if c.strobe {
+		return c.buttons & 1
+	}
+	if c.index >= 8 {
+		return 1
+	}
+	value := (c.buttons >> c.index) & 1
+	c.index++
+	return value
+}
+
+// Write sets the strobe line. While strobe is high the shift register is
+// continuously reloaded.
+func (c *Controller) Write(data uint8) {
+	c.strobe = data&1 == 1
+	if c.strobe {
+		c.index = 0
+	}
+}
+
+// Save writes the controller state to encoder.
+func (c *Controller) Save(encoder *gob.Encoder) error {
+	return savestate.Encode(encoder, &c.buttons, &c.index, &c.strobe)
+}
+
+// Load restores controller state written by Save.
+func (c *Controller) Load(decoder *gob.Decoder) error {
+	return savestate.Decode(decoder, &c.buttons, &c.index, &c.strobe)
+}
@@ -1,8 +1,10 @@
 package cpu
 
 import (
+	"encoding/gob"
 	"fmt"
-	"os"
+
+	"github.com/tejasdeepakmasne/NESemu/internal/savestate"
 )
 
 // CPU represents the Central Processing Unit of the NES.
@@ -17,6 +19,24 @@ func extractBit(val uint8, pos uint8) uint8 {
 	return (val & (1 << pos)) >> pos
 }
 
+// Bus is the CPU's view of the address space. The console connects the CPU
+// to the NES memory map; a bare CPU runs against 64 KiB of flat RAM.
+type Bus interface {
+	Read(address uint16) uint8
+	Write(address uint16, data uint8)
+}
+
+// flatMemory is a Bus backed by a plain 64 KiB array with no mapping.
+type flatMemory []uint8
+
+func (m flatMemory) Read(address uint16) uint8 {
+	return m[address]
+}
+
+func (m flatMemory) Write(address uint16, data uint8) {
+	m[address] = data
+}
+
 type CPU struct {
 	accumulator    uint8
 	xIndex         uint8
@@ -25,7 +45,33 @@ type CPU struct {
 	programCounter uint16
 	statusRegister uint8
 
-	memory []uint8
+	// instructionAddress is where the instruction being executed began.
+	instructionAddress uint16
+	// onFetch, if set, is told the address of every opcode fetch.
+	onFetch func(address uint16)
+
+	bus Bus
+
+	// cycles counts CPU cycles since power-on.
+	cycles uint64
+	// stall holds cycles the CPU must sit idle for, such as during OAM DMA.
+	stall int
+
+	nmiPending bool
+	irqLine    bool
+
+	// err records the first opcode the CPU could not execute.
+	err error
+}
+
+// UnknownOpcodeError reports an opcode the CPU does not implement.
+type UnknownOpcodeError struct {
+	Opcode  uint8
+	Address uint16
+}
+
+func (e *UnknownOpcodeError) Error() string {
+	return fmt.Sprintf("cpu: unknown opcode $%02X at $%04X", e.Opcode, e.Address)
 }
 
 type Flags uint8
@@ -59,119 +105,137 @@ const (
 	modeNoneAddressing
 )
 
+// instructionCycles holds the base cycle count of each opcode. Page-crossing
+// reads and taken branches add to it while the instruction executes.
+var instructionCycles = [256]uint8{
+	7, 6, 2, 8, 3, 3, 5, 5, 3, 2, 2, 2, 4, 4, 6, 6,
+	2, 5, 2, 8, 4, 4, 6, 6, 2, 4, 2, 7, 4, 4, 7, 7,
+	6, 6, 2, 8, 3, 3, 5, 5, 4, 2, 2, 2, 4, 4, 6, 6,
+	2, 5, 2, 8, 4, 4, 6, 6, 2, 4, 2, 7, 4, 4, 7, 7,
+	6, 6, 2, 8, 3, 3, 5, 5, 3, 2, 2, 2, 3, 4, 6, 6,
+	2, 5, 2, 8, 4, 4, 6, 6, 2, 4, 2, 7, 4, 4, 7, 7,
+	6, 6, 2, 8, 3, 3, 5, 5, 4, 2, 2, 2, 5, 4, 6, 6,
+	2, 5, 2, 8, 4, 4, 6, 6, 2, 4, 2, 7, 4, 4, 7, 7,
+	2, 6, 2, 6, 3, 3, 3, 3, 2, 2, 2, 2, 4, 4, 4, 4,
+	2, 6, 2, 6, 4, 4, 4, 4, 2, 5, 2, 5, 5, 5, 5, 5,
+	2, 6, 2, 6, 3, 3, 3, 3, 2, 2, 2, 2, 4, 4, 4, 4,
+	2, 5, 2, 5, 4, 4, 4, 4, 2, 4, 2, 4, 4, 4, 4, 4,
+	2, 6, 2, 8, 3, 3, 5, 5, 2, 2, 2, 2, 4, 4, 6, 6,
+	2, 5, 2, 8, 4, 4, 6, 6, 2, 4, 2, 7, 4, 4, 7, 7,
+	2, 6, 2, 8, 3, 3, 5, 5, 2, 2, 2, 2, 4, 4, 6, 6,
+	2, 5, 2, 8, 4, 4, 6, 6, 2, 4, 2, 7, 4, 4, 7, 7,
+}
+
 func (c *CPU) readMemory(address uint16) uint8 {
-	// Implement memory read logic here
-	return c.memory[address]
+	return c.bus.Read(address)
 }
 func (c *CPU) writeMemory(address uint16, value uint8) {
-	// Implement memory write logic here
-	c.memory[address] = value
+	c.bus.Write(address, value)
+}
+
+// readForModify reads the operand of a read-modify-write instruction. The
+// 6502 writes the unmodified value back before writing the result, and
+// mappers such as the MMC1 see that dummy write.
+func (c *CPU) readForModify(address uint16) uint8 {
+	value := c.readMemory(address)
+	c.writeMemory(address, value)
+	return value
 }
 func (c *CPU) pushStack(value uint8) {
-	// Implement stack pushStack logic here
-	c.memory[StackBase+uint16(c.stackPointer)] = value
+	c.writeMemory(StackBase+uint16(c.stackPointer), value)
 	c.stackPointer--
 }
 func (c *CPU) popStack() uint8 {
-	// Implement stack popStack logic here
-	top := c.memory[StackBase+uint16(c.stackPointer)]
 	c.stackPointer++
-	return top
+	return c.readMemory(StackBase + uint16(c.stackPointer))
 }
 func (c *CPU) readMemory16(address uint16) uint16 {
-	// Implement memory read logic here
-	lsb := uint16(c.memory[address])
-	msb := uint16(c.memory[address+1])
+	lsb := uint16(c.readMemory(address))
+	msb := uint16(c.readMemory(address + 1))
 	return (msb << 8) | lsb
 }
 func (c *CPU) writeMemory16(address uint16, value uint16) {
-	// Implement memory write logic here
 	lsb := uint8(value & 0xFF)
 	msb := uint8(value >> 8)
 	c.writeMemory(address, lsb)
 	c.writeMemory(address+1, msb)
 }
 func (c *CPU) popStack16() uint16 {
-	// Implement stack popStack logic here
-	msb := uint16(c.memory[c.stackPointer])
-	c.stackPointer++
-	lsb := uint16(c.memory[c.stackPointer])
-	c.stackPointer++
+	lsb := uint16(c.popStack())
+	msb := uint16(c.popStack())
 	return (msb << 8) | lsb
 }
 func (c *CPU) pushStack16(value uint16) {
-	// Implement stack pushStack logic here
 	lsb := uint8(value & 0xFF)
 	msb := uint8(value >> 8)
-	c.memory[StackBase+uint16(c.stackPointer)] = lsb
-	c.stackPointer--
-	c.memory[StackBase+uint16(c.stackPointer)] = msb
-	c.stackPointer--
+	c.pushStack(msb)
+	c.pushStack(lsb)
 }
-func (c *CPU) addressMode(mode AddressingMode) uint16 {
+
+// addressMode resolves the effective address of the operand for the given
+// addressing mode, with the program counter pointing at the first operand
+// byte. The second return value reports whether indexing crossed a page
+// boundary, which costs an extra cycle on some instructions.
+func (c *CPU) addressMode(mode AddressingMode) (uint16, bool) {
 	var address uint16
+	var pageCrossed bool
 	switch mode {
 	case modeImmediate:
 		// Immediate addressing mode: The operand is the next byte after the instruction.
-		// Implement logic to fetch the operand from memory and return the address.
 		address = c.programCounter
 
 	case modeZeroPage:
 		// Zero Page addressing mode: The operand is the byte at the zero page address.
-		// Implement logic to fetch the operand from memory and return the address.
 		address = uint16(c.readMemory(c.programCounter))
 
 	case modeAbsolute:
 		// Absolute addressing mode: The operand is the byte at the specified address.
-		// Implement logic to fetch the operand from memory and return the address.
 		address = c.readMemory16(c.programCounter)
 
 	case modeZeroPageX:
-		// Zero Page X addressing mode: The operand is the byte at the zero page address plus the value of the X register.
-		// Implement logic to fetch the operand from memory and return the address.
+		// Zero Page X addressing mode: The zero page address plus X, wrapping within the zero page.
 		base_address := c.readMemory(c.programCounter)
 		address = uint16(base_address + c.xIndex)
 
 	case modeZeroPageY:
-		// Zero Page Y addressing mode: The operand is the byte at the zero page address plus the value of the Y register.
-		// Implement logic to fetch the operand from memory and return the address.
+		// Zero Page Y addressing mode: The zero page address plus Y, wrapping within the zero page.
 		base_address := c.readMemory(c.programCounter)
 		address = uint16(base_address + c.yIndex)
 
 	case modeAbsoluteX:
 		// Absolute X addressing mode: The operand is the byte at the specified address plus the value of the X register.
-		// Implement logic to fetch the operand from memory and return the address.
 		base_address := c.readMemory16(c.programCounter)
 		address = base_address + uint16(c.xIndex)
+		pageCrossed = pagesDiffer(base_address, address)
 
 	case modeAbsoluteY:
 		// Absolute Y addressing mode: The operand is the byte at the specified address plus the value of the Y register.
-		// Implement logic to fetch the operand from memory and return the address.
 		base_address := c.readMemory16(c.programCounter)
 		address = base_address + uint16(c.yIndex)
+		pageCrossed = pagesDiffer(base_address, address)
 
 	case modeIndirectX:
-		// Indirect X addressing mode: The operand is the byte at the address formed by adding the X register to the zero page address.
-		// Implement logic to fetch the operand from memory and return the address.
+		// Indexed Indirect (zp,X) addressing mode: X is added to the zero page address before the
+		// pointer is read, and both the sum and the pointer's high byte wrap within the zero page.
 		base := c.readMemory(c.programCounter)
 		var offset uint8 = base + c.xIndex
-		lsb := c.readMemory(uint16(offset))
-		msb := c.readMemory(uint16(offset + 1))
-		address = uint16(msb)<<8 | uint16(lsb)
+		address = c.readZeroPage16(offset)
 
 	case modeIndirectY:
-		// Indirect Y addressing mode: The operand is the byte at the address formed by adding the Y register to the zero page address.
-		// Implement logic to fetch the operand from memory and return the address.
+		// Indirect Indexed (zp),Y addressing mode: The pointer is read from the zero page (wrapping
+		// within it) and Y is then added to the full 16-bit pointer, carrying into the high byte.
 		base := c.readMemory(c.programCounter)
-		var offset uint8 = base + c.yIndex
-		lsb := c.readMemory(uint16(offset))
-		msb := c.readMemory(uint16(offset + 1))
-		address = uint16(msb)<<8 | uint16(lsb)
+		deref := c.readZeroPage16(base)
+		address = deref + uint16(c.yIndex)
+		pageCrossed = pagesDiffer(deref, address)
 
 	case modeRelative:
-		// Relative addressing mode: The operand is a signed 8-bit offset relative to the program counter.
-		// Implement logic to calculate the target address based on the offset and return it.
-		address = c.programCounter
+		// Relative addressing mode: The operand is a signed 8-bit offset relative to the address
+		// of the next instruction. The branch target is returned.
+		offset := int8(c.readMemory(c.programCounter))
+		next := c.programCounter + 1
+		address = next + uint16(offset)
+		pageCrossed = pagesDiffer(next, address)
 
 	case modeAccumulator:
 		// Accumulator addressing mode: The operand is the accumulator register itself.
@@ -179,15 +243,11 @@ func (c *CPU) addressMode(mode AddressingMode) uint16 {
 
 	case modeIndirect:
 		// Indirect addressing mode: The operand is the address stored at the specified address.
-		// Implement logic to fetch the operand from memory and return the address.
-		lsb := uint16(c.readMemory(c.programCounter))
-		msb := uint16(c.readMemory(c.programCounter + 1))
-		indirectVector := (msb << 8) | lsb
+		// The 6502 does not carry into the high byte of the pointer, so JMP ($xxFF) reads the
+		// high byte of the target from $xx00 instead of the next page.
+		indirectVector := c.readMemory16(c.programCounter)
 		address_lsb := uint16(c.readMemory(indirectVector))
-		address_msb := uint16(c.readMemory(indirectVector + 1))
-		if indirectVector&0x00ff == 0x00ff {
-			address_msb = address_lsb & 0xff00
-		}
+		address_msb := uint16(c.readMemory((indirectVector & 0xFF00) | uint16(uint8(indirectVector)+1)))
 		address = (address_msb << 8) | address_lsb
 
 	case modeNoneAddressing:
@@ -195,7 +255,20 @@ func (c *CPU) addressMode(mode AddressingMode) uint16 {
 		// No additional logic is needed, simply return 0 for both addresses.
 	}
 
-	return address
+	return address, pageCrossed
+}
+
+// readZeroPage16 reads a little-endian pointer from the zero page, wrapping
+// the high byte read from $FF to $00.
+func (c *CPU) readZeroPage16(address uint8) uint16 {
+	lsb := uint16(c.readMemory(uint16(address)))
+	msb := uint16(c.readMemory(uint16(address + 1)))
+	return (msb << 8) | lsb
+}
+
+// pagesDiffer reports whether two addresses lie on different 256-byte pages.
+func pagesDiffer(a, b uint16) bool {
+	return a&0xFF00 != b&0xFF00
 }
 
 // NewCPU creates and initializes a new CPU instance.
@@ -208,11 +281,71 @@ func NewCPU() *CPU {
 		statusRegister: 0b00100100,
 		programCounter: 0,
 		stackPointer:   StackReset,
-		memory:         make([]uint8, 0x10000),
+		bus:            make(flatMemory, 0x10000),
 	}
 	return cpu
 }
 
+// ConnectBus attaches the CPU to the given address space, replacing the flat
+// RAM it starts with.
+func (c *CPU) ConnectBus(bus Bus) {
+	c.bus = bus
+}
+
+// ProgramCounter returns the address of the next instruction to execute.
+func (c *CPU) ProgramCounter() uint16 {
+	return c.programCounter
+}
+
+// InstructionAddress returns the address of the instruction currently or
+// most recently executed, which is what memory watchers report as the PC.
+func (c *CPU) InstructionAddress() uint16 {
+	return c.instructionAddress
+}
+
+// OnFetch registers a function told the address of every opcode fetch.
+func (c *CPU) OnFetch(handler func(address uint16)) {
+	c.onFetch = handler
+}
+
+// Err returns the first error the CPU ran into, such as an opcode it does
+// not implement. Execution carries on past errors as it would on hardware.
+func (c *CPU) Err() error {
+	return c.err
+}
+
+// Cycles returns the number of CPU cycles elapsed since power-on.
+func (c *CPU) Cycles() uint64 {
+	return c.cycles
+}
+
+// TriggerNMI latches a non-maskable interrupt, which is serviced before the
+// next instruction.
+func (c *CPU) TriggerNMI() {
+	c.nmiPending = true
+}
+
+// SetIRQ drives the level-sensitive IRQ line. While it is asserted and the
+// interrupt disable flag is clear, an IRQ is serviced before each instruction.
+func (c *CPU) SetIRQ(asserted bool) {
+	c.irqLine = asserted
+}
+
+// Stall suspends the CPU for the given number of cycles, as happens while
+// the DMA unit owns the bus.
+func (c *CPU) Stall(cycles int) {
+	c.stall += cycles
+}
+
+// interrupt pushes the return address and status and jumps through vector.
+func (c *CPU) interrupt(vector uint16) {
+	c.pushStack16(c.programCounter)
+	c.pushStack((c.statusRegister &^ (1 << B)) | 1<<X)
+	c.setFlag(I)
+	c.programCounter = c.readMemory16(vector)
+	c.cycles += 7
+}
+
 // Helper FUnctions for setting and clearing flags
 func (c *CPU) setFlag(flags ...Flags) {
 	for _, f := range flags {
@@ -245,32 +378,68 @@ func (c *CPU) updateZeroAndNegativeFlag(value uint8) {
 		c.clearFlag(Z)
 	}
 
-	if value&128 == 128 {
-		c.setFlag(Z)
-	} else {
-		c.clearFlag(Z)
-	}
+	c.setFlagToValue(N, extractBit(value, 7))
 }
 
-// INSTRUCTIONS
-func (c *CPU) adc(mode AddressingMode) {
-	address := c.addressMode(mode)
-	value := c.readMemory(address)
-	res := c.accumulator + value + c.getFlag(C)
-	if res > 255 {
-		c.setFlag(C)
+// addWithCarry adds value and the carry flag to the accumulator, setting
+// carry on unsigned overflow and V when the signed result changes sign.
+// SBC is ADC of the complemented operand.
+func (c *CPU) addWithCarry(value uint8) {
+	sum := uint16(c.accumulator) + uint16(value) + uint16(c.getFlag(C))
+	res := uint8(sum)
+	c.setFlagToValue(C, uint8(sum>>8))
+	c.setFlagToValue(V, ((c.accumulator^res)&(value^res))>>7)
+	c.accumulator = res
+	c.updateZeroAndNegativeFlag(c.accumulator)
+}
+
+// compare sets the flags for register minus value: carry when no borrow is
+// needed, and Z and N from the difference.
+func (c *CPU) compare(register uint8, value uint8) {
+	c.setFlagToValue(C, boolToBit(register >= value))
+	c.updateZeroAndNegativeFlag(register - value)
+}
+
+func boolToBit(b bool) uint8 {
+	if b {
+		return 1
 	}
-	if res > 127 {
-		c.setFlag(V)
+	return 0
+}
+
+// branch moves the program counter to the relative branch target when the
+// condition holds, and past the offset byte otherwise.
+// A taken branch costs one extra cycle, and another if the target lies on a
+// different page.
+func (c *CPU) branch(condition bool) {
+	if condition {
+		target, pageCrossed := c.addressMode(modeRelative)
+		c.programCounter = target
+		c.cycles++
+		c.addPageCrossCycle(pageCrossed)
+	} else {
+		c.programCounter++
 	}
+}
 
-	c.accumulator = res
-	c.updateZeroAndNegativeFlag(c.accumulator)
+// addPageCrossCycle charges the extra cycle taken by reads whose indexed
+// address crossed a page boundary.
+func (c *CPU) addPageCrossCycle(pageCrossed bool) {
+	if pageCrossed {
+		c.cycles++
+	}
+}
 
+// INSTRUCTIONS
+func (c *CPU) adc(mode AddressingMode) {
+	address, pageCrossed := c.addressMode(mode)
+	c.addPageCrossCycle(pageCrossed)
+	c.addWithCarry(c.readMemory(address))
 }
 
 func (c *CPU) and(mode AddressingMode) {
-	address := c.addressMode(mode)
+	address, pageCrossed := c.addressMode(mode)
+	c.addPageCrossCycle(pageCrossed)
 	value := c.readMemory(address)
 	c.accumulator &= value
 	c.updateZeroAndNegativeFlag(c.accumulator)
@@ -280,43 +449,31 @@ func (c *CPU) asl(mode AddressingMode) {
 	if mode == modeAccumulator {
 		c.setFlagToValue(C, extractBit(c.accumulator, 7))
 		c.accumulator = c.accumulator << 1
+		c.updateZeroAndNegativeFlag(c.accumulator)
 	} else {
-		address := c.addressMode(mode)
-		value := c.readMemory(address)
+		address, _ := c.addressMode(mode)
+		value := c.readForModify(address)
 		c.setFlagToValue(C, extractBit(value, 7))
 		value = value << 1
 		c.writeMemory(address, value)
+		c.updateZeroAndNegativeFlag(value)
 	}
-
-	c.updateZeroAndNegativeFlag(c.statusRegister)
 }
 
 func (c *CPU) bcc() {
-	if c.getFlag(C) == 0 {
-		address := c.addressMode(modeRelative)
-		value := c.readMemory(address)
-		c.programCounter += uint16(value)
-	}
+	c.branch(c.getFlag(C) == 0)
 }
 
 func (c *CPU) bcs() {
-	if c.getFlag(C) == 1 {
-		address := c.addressMode(modeRelative)
-		value := c.readMemory(address)
-		c.programCounter += uint16(value)
-	}
+	c.branch(c.getFlag(C) == 1)
 }
 
 func (c *CPU) beq() {
-	if c.getFlag(Z) == 1 {
-		address := c.addressMode(modeRelative)
-		value := c.readMemory(address)
-		c.programCounter += uint16(value)
-	}
+	c.branch(c.getFlag(Z) == 1)
 }
 
 func (c *CPU) bit(mode AddressingMode) {
-	address := c.addressMode(mode)
+	address, _ := c.addressMode(mode)
 	value := c.readMemory(address)
 	res := c.accumulator & value
 	if res == 0 {
@@ -324,55 +481,35 @@ func (c *CPU) bit(mode AddressingMode) {
 	} else {
 		c.clearFlag(Z)
 	}
-	c.setFlagToValue(V, extractBit(res, 6))
-	c.setFlagToValue(N, extractBit(res, 7))
+	c.setFlagToValue(V, extractBit(value, 6))
+	c.setFlagToValue(N, extractBit(value, 7))
 }
 
 func (c *CPU) bmi() {
-	if c.getFlag(N) == 1 {
-		address := c.addressMode(modeRelative)
-		value := c.readMemory(address)
-		c.programCounter += uint16(value)
-	}
+	c.branch(c.getFlag(N) == 1)
 }
 
 func (c *CPU) bne() {
-	if c.getFlag(C) == 0 {
-		address := c.addressMode(modeRelative)
-		value := c.readMemory(address)
-		c.programCounter += uint16(value)
-	}
+	c.branch(c.getFlag(Z) == 0)
 }
 
 func (c *CPU) bpl() {
-	if c.getFlag(N) == 0 {
-		address := c.addressMode(modeRelative)
-		value := c.readMemory(address)
-		c.programCounter += uint16(value)
-	}
+	c.branch(c.getFlag(N) == 0)
 }
 
 func (c *CPU) brk() {
-	c.pushStack16(c.programCounter)
-	c.pushStack(c.statusRegister)
+	c.pushStack16(c.programCounter + 1)
+	c.pushStack(c.statusRegister | 1<<B | 1<<X)
+	c.setFlag(I)
 	c.programCounter = c.readMemory16(InterruptRequestVector)
-	c.setFlag(B)
 }
 
 func (c *CPU) bvc() {
-	if c.getFlag(V) == 0 {
-		address := c.addressMode(modeRelative)
-		value := c.readMemory(address)
-		c.programCounter += uint16(value)
-	}
+	c.branch(c.getFlag(V) == 0)
 }
 
 func (c *CPU) bvs() {
-	if c.getFlag(V) == 1 {
-		address := c.addressMode(modeRelative)
-		value := c.readMemory(address)
-		c.programCounter += uint16(value)
-	}
+	c.branch(c.getFlag(V) == 1)
 }
 
 func (c *CPU) clc() {
@@ -392,40 +529,24 @@ func (c *CPU) clv() {
 }
 
 func (c *CPU) cmp(mode AddressingMode) {
-	address := c.addressMode(mode)
-	value := c.readMemory(address)
-	res := c.accumulator - value
-	if res >= uint8(0) {
-		c.setFlag(C)
-	}
-	c.updateZeroAndNegativeFlag(res)
+	address, pageCrossed := c.addressMode(mode)
+	c.addPageCrossCycle(pageCrossed)
+	c.compare(c.accumulator, c.readMemory(address))
 }
 
 func (c *CPU) cpx(mode AddressingMode) {
-	address := c.addressMode(mode)
-	value := c.readMemory(address)
-	res := c.xIndex - value
-	if res >= uint8(0) {
-		c.setFlag(C)
-	}
-	c.updateZeroAndNegativeFlag(res)
-
+	address, _ := c.addressMode(mode)
+	c.compare(c.xIndex, c.readMemory(address))
 }
 
 func (c *CPU) cpy(mode AddressingMode) {
-	address := c.addressMode(mode)
-	value := c.readMemory(address)
-	res := c.yIndex - value
-	if res >= uint8(0) {
-		c.setFlag(C)
-	}
-	c.updateZeroAndNegativeFlag(res)
-
+	address, _ := c.addressMode(mode)
+	c.compare(c.yIndex, c.readMemory(address))
 }
 
 func (c *CPU) dec(mode AddressingMode) {
-	address := c.addressMode(mode)
-	value := c.readMemory(address)
+	address, _ := c.addressMode(mode)
+	value := c.readForModify(address)
 	value--
 	c.writeMemory(address, value)
 	c.updateZeroAndNegativeFlag(value)
@@ -442,15 +563,16 @@ func (c *CPU) dey() {
 }
 
 func (c *CPU) eor(mode AddressingMode) {
-	address := c.addressMode(mode)
+	address, pageCrossed := c.addressMode(mode)
+	c.addPageCrossCycle(pageCrossed)
 	value := c.readMemory(address)
 	c.accumulator = c.accumulator ^ value
 	c.updateZeroAndNegativeFlag(c.accumulator)
 }
 
 func (c *CPU) inc(mode AddressingMode) {
-	address := c.addressMode(mode)
-	value := c.readMemory(address)
+	address, _ := c.addressMode(mode)
+	value := c.readForModify(address)
 	value++
 	c.writeMemory(address, value)
 	c.updateZeroAndNegativeFlag(value)
@@ -467,31 +589,34 @@ func (c *CPU) iny() {
 }
 
 func (c *CPU) jmp(mode AddressingMode) {
-	address := c.addressMode(mode)
+	address, _ := c.addressMode(mode)
 	c.programCounter = address
 
 }
 
 func (c *CPU) jsr() {
-	c.pushStack16(c.programCounter - 1)
-	address := c.addressMode(modeAbsolute)
+	address, _ := c.addressMode(modeAbsolute)
+	c.pushStack16(c.programCounter + 1)
 	c.programCounter = address
 }
 
 func (c *CPU) lda(mode AddressingMode) {
-	address := c.addressMode(mode)
+	address, pageCrossed := c.addressMode(mode)
+	c.addPageCrossCycle(pageCrossed)
 	c.accumulator = c.readMemory(address)
 	c.updateZeroAndNegativeFlag(c.accumulator)
 }
 
 func (c *CPU) ldx(mode AddressingMode) {
-	address := c.addressMode(mode)
+	address, pageCrossed := c.addressMode(mode)
+	c.addPageCrossCycle(pageCrossed)
 	c.xIndex = c.readMemory(address)
 	c.updateZeroAndNegativeFlag(c.xIndex)
 }
 
 func (c *CPU) ldy(mode AddressingMode) {
-	address := c.addressMode(mode)
+	address, pageCrossed := c.addressMode(mode)
+	c.addPageCrossCycle(pageCrossed)
 	c.yIndex = c.readMemory(address)
 	c.updateZeroAndNegativeFlag(c.yIndex)
 }
@@ -502,8 +627,8 @@ func (c *CPU) lsr(mode AddressingMode) {
 		c.accumulator = c.accumulator >> 1
 		c.updateZeroAndNegativeFlag(c.accumulator)
 	} else {
-		address := c.addressMode(mode)
-		value := c.readMemory(address)
+		address, _ := c.addressMode(mode)
+		value := c.readForModify(address)
 		c.setFlagToValue(C, extractBit(value, 0))
 		value = value >> 1
 		c.writeMemory(address, value)
@@ -516,7 +641,8 @@ func (c *CPU) nop() {
 }
 
 func (c *CPU) ora(mode AddressingMode) {
-	address := c.addressMode(mode)
+	address, pageCrossed := c.addressMode(mode)
+	c.addPageCrossCycle(pageCrossed)
 	value := c.readMemory(address)
 	c.accumulator = c.accumulator | value
 	c.updateZeroAndNegativeFlag(c.accumulator)
@@ -526,8 +652,9 @@ func (c *CPU) pha() {
 	c.pushStack(c.accumulator)
 }
 
+// php pushes the status with B and the unused bit set, as BRK does.
 func (c *CPU) php() {
-	c.pushStack(c.statusRegister)
+	c.pushStack(c.statusRegister | 1<<B | 1<<X)
 }
 
 func (c *CPU) pla() {
@@ -535,9 +662,10 @@ func (c *CPU) pla() {
 	c.updateZeroAndNegativeFlag(c.accumulator)
 }
 
+// plp pulls the status. B exists only on the stack and the unused bit always
+// reads as set, as with RTI.
 func (c *CPU) plp() {
-	c.statusRegister = c.popStack()
-	c.updateZeroAndNegativeFlag(c.statusRegister)
+	c.statusRegister = (c.popStack() &^ (1 << B)) | 1<<X
 }
 
 func (c *CPU) rol(mode AddressingMode) {
@@ -547,8 +675,8 @@ func (c *CPU) rol(mode AddressingMode) {
 		c.accumulator = (c.accumulator << 1) | prevCarry
 		c.updateZeroAndNegativeFlag(c.accumulator)
 	} else {
-		address := c.addressMode(mode)
-		value := c.readMemory(address)
+		address, _ := c.addressMode(mode)
+		value := c.readForModify(address)
 		prevCarry := extractBit(c.statusRegister, 0)
 		c.setFlagToValue(C, extractBit(value, 7))
 		value = (value << 1) | prevCarry
@@ -564,10 +692,10 @@ func (c *CPU) ror(mode AddressingMode) {
 		c.accumulator = (c.accumulator >> 1) | (prevCarry << 7)
 		c.updateZeroAndNegativeFlag(c.accumulator)
 	} else {
-		address := c.addressMode(mode)
-		value := c.readMemory(address)
+		address, _ := c.addressMode(mode)
+		value := c.readForModify(address)
 		prevCarry := extractBit(c.statusRegister, 0)
-		c.setFlagToValue(C, extractBit(c.accumulator, 0))
+		c.setFlagToValue(C, extractBit(value, 0))
 		value = (value >> 1) | (prevCarry << 7)
 		c.writeMemory(address, value)
 		c.updateZeroAndNegativeFlag(value)
@@ -575,28 +703,18 @@ func (c *CPU) ror(mode AddressingMode) {
 }
 
 func (c *CPU) rti() {
-	c.statusRegister = c.popStack()
+	c.statusRegister = (c.popStack() &^ (1 << B)) | 1<<X
 	c.programCounter = c.popStack16()
 }
 
 func (c *CPU) rts() {
-	c.programCounter = c.popStack16()
+	c.programCounter = c.popStack16() + 1
 }
 
 func (c *CPU) sbc(mode AddressingMode) {
-	address := c.addressMode(mode)
-	value := c.readMemory(address)
-	res := c.accumulator - value - (1 - c.getFlag(C))
-	if res > 255 {
-		c.setFlag(C)
-	}
-	if res > 127 {
-		c.setFlag(V)
-	}
-
-	c.accumulator = res
-	c.updateZeroAndNegativeFlag(c.accumulator)
-
+	address, pageCrossed := c.addressMode(mode)
+	c.addPageCrossCycle(pageCrossed)
+	c.addWithCarry(^c.readMemory(address))
 }
 
 func (c *CPU) sec() {
@@ -612,17 +730,17 @@ func (c *CPU) sei() {
 }
 
 func (c *CPU) sta(mode AddressingMode) {
-	address := c.addressMode(mode)
+	address, _ := c.addressMode(mode)
 	c.writeMemory(address, c.accumulator)
 }
 
 func (c *CPU) stx(mode AddressingMode) {
-	address := c.addressMode(mode)
+	address, _ := c.addressMode(mode)
 	c.writeMemory(address, c.xIndex)
 }
 
 func (c *CPU) sty(mode AddressingMode) {
-	address := c.addressMode(mode)
+	address, _ := c.addressMode(mode)
 	c.writeMemory(address, c.yIndex)
 }
 
@@ -637,7 +755,7 @@ func (c *CPU) tay() {
 }
 
 func (c *CPU) tsx() {
-	c.xIndex = c.statusRegister
+	c.xIndex = c.stackPointer
 	c.updateZeroAndNegativeFlag(c.xIndex)
 }
 
@@ -646,9 +764,9 @@ func (c *CPU) txa() {
 	c.updateZeroAndNegativeFlag(c.accumulator)
 }
 
+// txs sets the stack pointer and, unlike the other transfers, no flags.
 func (c *CPU) txs() {
-	c.statusRegister = c.xIndex
-	c.updateZeroAndNegativeFlag(c.xIndex)
+	c.stackPointer = c.xIndex
 }
 
 func (c *CPU) tya() {
@@ -656,501 +774,537 @@ func (c *CPU) tya() {
 	c.updateZeroAndNegativeFlag(c.accumulator)
 }
 
-func (c *CPU) reset() {
+// Reset puts the CPU in its reset state and jumps through the reset vector.
+func (c *CPU) Reset() {
 	c.accumulator = 0
 	c.xIndex = 0
 	c.yIndex = 0
 	c.stackPointer = StackReset
-	c.programCounter = c.readMemory16(0xFFFC)
+	c.programCounter = c.readMemory16(ResetVector)
 	c.statusRegister = 0b00100100
+	c.nmiPending = false
+	c.stall = 0
+	c.cycles += 7
 }
 
 func (c *CPU) loadProgram(program []uint8) {
 	for i, value := range program {
-		c.memory[0x8000+i] = value
+		c.writeMemory(0x8000+uint16(i), value)
+	}
+	c.writeMemory16(ResetVector, 0x8000)
+}
+
+// ExecuteInstruction executes one instruction on the CPU, servicing any
+// pending interrupt first, and returns the number of cycles it took.
+func (c *CPU) ExecuteInstruction() int {
+	start := c.cycles
+
+	if c.stall > 0 {
+		c.stall--
+		c.cycles++
+		return 1
+	}
+
+	if c.nmiPending {
+		c.nmiPending = false
+		c.interrupt(NonMaskableInterruptVector)
+	} else if c.irqLine && c.getFlag(I) == 0 {
+		c.interrupt(InterruptRequestVector)
 	}
-	c.writeMemory16(0xFFFC, 0x8000)
-}
-
-// ExecuteInstruction executes one instruction on the CPU.
-func (c *CPU) ExecuteInstruction() {
-	// Implement instruction execution logic here
-	for {
-		opcode := c.memory[c.programCounter]
-		c.programCounter++
-		switch opcode {
-
-		case 0x69:
-			c.adc(modeImmediate)
-			c.programCounter++
-		case 0x65:
-			c.adc(modeZeroPage)
-			c.programCounter++
-		case 0x75:
-			c.adc(modeZeroPageX)
-			c.programCounter++
-		case 0x6D:
-			c.adc(modeAbsolute)
-			c.programCounter += 2
-		case 0x7d:
-			c.adc(modeAbsoluteX)
-			c.programCounter += 2
-		case 0x79:
-			c.adc(modeAbsoluteY)
-			c.programCounter += 2
-		case 0x61:
-			c.adc(modeIndirectX)
-			c.programCounter++
-		case 0x71:
-			c.adc(modeIndirectY)
-			c.programCounter++
-
-		case 0x29:
-			c.and(modeImmediate)
-			c.programCounter++
-		case 0x25:
-			c.and(modeZeroPage)
-			c.programCounter++
-		case 0x35:
-			c.and(modeZeroPageX)
-			c.programCounter++
-		case 0x2d:
-			c.and(modeAbsolute)
-			c.programCounter += 2
-		case 0x3d:
-			c.and(modeAbsoluteX)
-			c.programCounter += 2
-		case 0x39:
-			c.and(modeAbsoluteY)
-			c.programCounter += 2
-		case 0x21:
-			c.and(modeIndirectX)
-			c.programCounter++
-		case 0x31:
-			c.and(modeIndirectY)
-			c.programCounter++
-
-		case 0x0a:
-			c.asl(modeAccumulator)
-		case 0x06:
-			c.asl(modeZeroPage)
-			c.programCounter++
-		case 0x16:
-			c.asl(modeZeroPageX)
-			c.programCounter++
-		case 0x0e:
-			c.asl(modeAbsolute)
-			c.programCounter += 2
-		case 0x1e:
-			c.asl(modeAbsoluteX)
-			c.programCounter += 2
-
-		case 0x90:
-			c.bcc()
-			c.programCounter++
-
-		case 0xb0:
-			c.bcs()
-			c.programCounter++
-
-		case 0xf0:
-			c.beq()
-			c.programCounter++
-
-		case 0x24:
-			c.bit(modeZeroPage)
-			c.programCounter++
-		case 0x2c:
-			c.bit(modeAbsolute)
-			c.programCounter += 2
-
-		case 0x30:
-			c.bmi()
-			c.programCounter++
-
-		case 0xd0:
-			c.bne()
-			c.programCounter++
-
-		case 0x10:
-			c.bpl()
-			c.programCounter++
-
-		case 0x00:
-			c.brk()
-
-		case 0x50:
-			c.bvc()
-			c.programCounter++
-
-		case 0x70:
-			c.bvs()
-			c.programCounter++
-
-		case 0x18:
-			c.clc()
-		case 0xd8:
-			c.cld()
-		case 0x58:
-			c.cli()
-		case 0xb8:
-			c.clv()
-
-		case 0xc9:
-			c.cmp(modeImmediate)
-			c.programCounter++
-		case 0xc5:
-			c.cmp(modeZeroPage)
-			c.programCounter++
-		case 0xd5:
-			c.cmp(modeZeroPageX)
-			c.programCounter++
-		case 0xcd:
-			c.cmp(modeAbsolute)
-			c.programCounter += 2
-		case 0xdd:
-			c.cmp(modeAbsoluteX)
-			c.programCounter += 2
-		case 0xd9:
-			c.cmp(modeAbsoluteY)
-			c.programCounter += 2
-		case 0xc1:
-			c.cmp(modeIndirectX)
-			c.programCounter++
-		case 0xd1:
-			c.cmp(modeIndirectY)
-			c.programCounter++
-
-		case 0xe0:
-			c.cpx(modeImmediate)
-			c.programCounter++
-		case 0xe4:
-			c.cpx(modeZeroPage)
-			c.programCounter++
-		case 0xec:
-			c.cpx(modeAbsolute)
-			c.programCounter += 2
-
-		case 0xc0:
-			c.cpy(modeImmediate)
-			c.programCounter++
-
-		case 0xc4:
-			c.cpy(modeZeroPage)
-			c.programCounter++
-		case 0xcc:
-			c.cpy(modeAbsolute)
-			c.programCounter += 2
-
-		case 0xc6:
-			c.dec(modeZeroPage)
-			c.programCounter++
-		case 0xd6:
-			c.dec(modeZeroPageX)
-			c.programCounter++
-		case 0xce:
-			c.dec(modeAbsolute)
-			c.programCounter += 2
-		case 0xde:
-			c.dec(modeAbsoluteX)
-			c.programCounter += 2
-
-		case 0xca:
-			c.dex()
-		case 0x88:
-			c.dey()
-
-		case 0x49:
-			c.eor(modeImmediate)
-			c.programCounter++
-		case 0x45:
-			c.eor(modeZeroPage)
-			c.programCounter++
-		case 0x55:
-			c.eor(modeZeroPageX)
-			c.programCounter++
-		case 0x4d:
-			c.eor(modeAbsolute)
-			c.programCounter += 2
-		case 0x5d:
-			c.eor(modeAbsoluteX)
-			c.programCounter += 2
-		case 0x59:
-			c.eor(modeAbsoluteY)
-			c.programCounter += 2
-		case 0x41:
-			c.eor(modeIndirectX)
-			c.programCounter++
-		case 0x51:
-			c.eor(modeIndirectY)
-			c.programCounter++
-
-		case 0xe6:
-			c.inc(modeZeroPage)
-			c.programCounter++
-		case 0xf6:
-			c.inc(modeZeroPageX)
-			c.programCounter++
-		case 0xee:
-			c.inc(modeAbsolute)
-			c.programCounter += 2
-		case 0xfe:
-			c.inc(modeAbsoluteX)
-			c.programCounter += 2
-
-		case 0xe8:
-			c.inx()
-		case 0xc8:
-			c.iny()
-
-		case 0x4c:
-			c.jmp(modeAbsolute)
-			c.programCounter += 2
-		case 0x6c:
-			c.jmp(modeIndirect)
-			c.programCounter += 2
-
-		case 0x20:
-			c.jsr()
-			c.programCounter += 2
-
-		case 0xa9:
-			c.lda(modeImmediate)
-			c.programCounter++
-		case 0xa5:
-			c.lda(modeZeroPage)
-			c.programCounter++
-		case 0xb5:
-			c.lda(modeZeroPageX)
-			c.programCounter++
-		case 0xad:
-			c.lda(modeAbsolute)
-			c.programCounter += 2
-		case 0xbd:
-			c.lda(modeAbsoluteX)
-			c.programCounter += 2
-		case 0xb9:
-			c.lda(modeAbsoluteY)
-			c.programCounter += 2
-		case 0xa1:
-			c.lda(modeIndirectX)
-			c.programCounter++
-		case 0xb1:
-			c.lda(modeIndirectY)
-			c.programCounter++
-
-		case 0xa2:
-			c.ldx(modeImmediate)
-			c.programCounter++
-		case 0xa6:
-			c.ldx(modeZeroPage)
-			c.programCounter++
-		case 0xae:
-			c.ldx(modeAbsolute)
-			c.programCounter += 2
-		case 0xbe:
-			c.ldx(modeAbsoluteY)
-			c.programCounter += 2
-
-		case 0xa0:
-			c.ldy(modeImmediate)
-			c.programCounter++
-		case 0xa4:
-			c.ldy(modeZeroPage)
-			c.programCounter++
-		case 0xb4:
-			c.ldy(modeZeroPageX)
-			c.programCounter++
-		case 0xac:
-			c.ldy(modeAbsolute)
-			c.programCounter += 2
-		case 0xbc:
-			c.ldy(modeAbsoluteX)
-			c.programCounter += 2
-
-		case 0x4a:
-			c.lsr(modeAccumulator)
-		case 0x46:
-			c.lsr(modeZeroPage)
-			c.programCounter++
-		case 0x56:
-			c.lsr(modeZeroPageX)
-			c.programCounter++
-		case 0x4e:
-			c.lsr(modeAbsolute)
-			c.programCounter += 2
-		case 0x5e:
-			c.lsr(modeAbsoluteX)
-			c.programCounter += 2
-
-		case 0xea:
-			c.nop()
-
-		case 0x09:
-			c.ora(modeImmediate)
-			c.programCounter++
-		case 0x05:
-			c.ora(modeZeroPage)
-			c.programCounter++
-		case 0x015:
-			c.ora(modeZeroPageX)
-			c.programCounter++
-		case 0x0d:
-			c.ora(modeAbsolute)
-			c.programCounter += 2
-		case 0x1d:
-			c.ora(modeAbsoluteX)
-			c.programCounter += 2
-		case 0x19:
-			c.ora(modeAbsoluteY)
-			c.programCounter += 2
-		case 0x01:
-			c.ora(modeIndirectX)
-			c.programCounter++
-		case 0x11:
-			c.ora(modeIndirectY)
-			c.programCounter++
-
-		case 0x48:
-			c.pha()
-		case 0x08:
-			c.php()
-		case 0x68:
-			c.pla()
-		case 0x28:
-			c.plp()
-
-		case 0x2a:
-			c.rol(modeAccumulator)
-		case 0x26:
-			c.rol(modeZeroPage)
-			c.programCounter++
-		case 0x36:
-			c.rol(modeZeroPageX)
-			c.programCounter++
-		case 0x2e:
-			c.rol(modeAbsolute)
-			c.programCounter += 2
-		case 0x3e:
-			c.rol(modeAbsoluteX)
-			c.programCounter += 2
-
-		case 0x6a:
-			c.ror(modeAccumulator)
-		case 0x66:
-			c.ror(modeZeroPage)
-			c.programCounter++
-		case 0x76:
-			c.ror(modeZeroPageX)
-			c.programCounter++
-		case 0x6e:
-			c.ror(modeAbsolute)
-			c.programCounter += 2
-		case 0x7e:
-			c.ror(modeAbsoluteX)
-			c.programCounter += 2
-
-		case 0x40:
-			c.rti()
-		case 0x060:
-			c.rts()
-
-		case 0xe9:
-			c.sbc(modeImmediate)
-			c.programCounter++
-		case 0xe5:
-			c.sbc(modeZeroPage)
-			c.programCounter++
-		case 0xf5:
-			c.sbc(modeZeroPageX)
-			c.programCounter++
-		case 0xed:
-			c.sbc(modeAbsolute)
-			c.programCounter += 2
-		case 0xfd:
-			c.sbc(modeAbsoluteX)
-			c.programCounter += 2
-		case 0xf9:
-			c.sbc(modeAbsoluteY)
-			c.programCounter += 2
-		case 0xe1:
-			c.sbc(modeIndirectX)
-			c.programCounter++
-		case 0xf1:
-			c.sbc(modeIndirectY)
-			c.programCounter++
-
-		case 0x38:
-			c.sec()
-		case 0xf8:
-			c.sed()
-		case 0x78:
-			c.sei()
-
-		case 0x85:
-			c.sta(modeZeroPage)
-			c.programCounter++
-		case 0x95:
-			c.sta(modeZeroPageX)
-			c.programCounter++
-		case 0x8d:
-			c.sta(modeAbsolute)
-			c.programCounter += 2
-		case 0x9d:
-			c.sta(modeAbsoluteX)
-			c.programCounter += 2
-		case 0x99:
-			c.sta(modeAbsoluteY)
-			c.programCounter += 2
-		case 0x81:
-			c.sta(modeIndirectX)
-			c.programCounter++
-		case 0x91:
-			c.sta(modeIndirectY)
-			c.programCounter++
-
-		case 0x86:
-			c.stx(modeZeroPage)
-			c.programCounter++
-		case 0x96:
-			c.stx(modeZeroPageY)
-			c.programCounter++
-		case 0x8e:
-			c.stx(modeAbsolute)
-			c.programCounter += 2
-
-		case 0x84:
-			c.sty(modeZeroPage)
-			c.programCounter++
-		case 0x94:
-			c.sty(modeZeroPageX)
-			c.programCounter++
-		case 0x8c:
-			c.sty(modeAbsolute)
-			c.programCounter++
-
-		case 0xaa:
-			c.tax()
-		case 0xa8:
-			c.tay()
-		case 0xba:
-			c.tsx()
-		case 0x8a:
-			c.txa()
-		case 0x9a:
-			c.txs()
-		case 0x98:
-			c.tya()
-
-		default:
-			fmt.Fprintf(os.Stdout, "UNDEFINED BEHAVIOUR %v at %v", opcode, c.programCounter)
 
+	c.instructionAddress = c.programCounter
+	if c.onFetch != nil {
+		c.onFetch(c.programCounter)
+	}
+	opcode := c.readMemory(c.programCounter)
+	c.programCounter++
+	c.cycles += uint64(instructionCycles[opcode])
+	switch opcode {
+
+	case 0x69:
+		c.adc(modeImmediate)
+		c.programCounter++
+	case 0x65:
+		c.adc(modeZeroPage)
+		c.programCounter++
+	case 0x75:
+		c.adc(modeZeroPageX)
+		c.programCounter++
+	case 0x6D:
+		c.adc(modeAbsolute)
+		c.programCounter += 2
+	case 0x7d:
+		c.adc(modeAbsoluteX)
+		c.programCounter += 2
+	case 0x79:
+		c.adc(modeAbsoluteY)
+		c.programCounter += 2
+	case 0x61:
+		c.adc(modeIndirectX)
+		c.programCounter++
+	case 0x71:
+		c.adc(modeIndirectY)
+		c.programCounter++
+
+	case 0x29:
+		c.and(modeImmediate)
+		c.programCounter++
+	case 0x25:
+		c.and(modeZeroPage)
+		c.programCounter++
+	case 0x35:
+		c.and(modeZeroPageX)
+		c.programCounter++
+	case 0x2d:
+		c.and(modeAbsolute)
+		c.programCounter += 2
+	case 0x3d:
+		c.and(modeAbsoluteX)
+		c.programCounter += 2
+	case 0x39:
+		c.and(modeAbsoluteY)
+		c.programCounter += 2
+	case 0x21:
+		c.and(modeIndirectX)
+		c.programCounter++
+	case 0x31:
+		c.and(modeIndirectY)
+		c.programCounter++
+
+	case 0x0a:
+		c.asl(modeAccumulator)
+	case 0x06:
+		c.asl(modeZeroPage)
+		c.programCounter++
+	case 0x16:
+		c.asl(modeZeroPageX)
+		c.programCounter++
+	case 0x0e:
+		c.asl(modeAbsolute)
+		c.programCounter += 2
+	case 0x1e:
+		c.asl(modeAbsoluteX)
+		c.programCounter += 2
+
+	case 0x90:
+		c.bcc()
+
+	case 0xb0:
+		c.bcs()
+
+	case 0xf0:
+		c.beq()
+
+	case 0x24:
+		c.bit(modeZeroPage)
+		c.programCounter++
+	case 0x2c:
+		c.bit(modeAbsolute)
+		c.programCounter += 2
+
+	case 0x30:
+		c.bmi()
+
+	case 0xd0:
+		c.bne()
+
+	case 0x10:
+		c.bpl()
+
+	case 0x00:
+		c.brk()
+
+	case 0x50:
+		c.bvc()
+
+	case 0x70:
+		c.bvs()
+
+	case 0x18:
+		c.clc()
+	case 0xd8:
+		c.cld()
+	case 0x58:
+		c.cli()
+	case 0xb8:
+		c.clv()
+
+	case 0xc9:
+		c.cmp(modeImmediate)
+		c.programCounter++
+	case 0xc5:
+		c.cmp(modeZeroPage)
+		c.programCounter++
+	case 0xd5:
+		c.cmp(modeZeroPageX)
+		c.programCounter++
+	case 0xcd:
+		c.cmp(modeAbsolute)
+		c.programCounter += 2
+	case 0xdd:
+		c.cmp(modeAbsoluteX)
+		c.programCounter += 2
+	case 0xd9:
+		c.cmp(modeAbsoluteY)
+		c.programCounter += 2
+	case 0xc1:
+		c.cmp(modeIndirectX)
+		c.programCounter++
+	case 0xd1:
+		c.cmp(modeIndirectY)
+		c.programCounter++
+
+	case 0xe0:
+		c.cpx(modeImmediate)
+		c.programCounter++
+	case 0xe4:
+		c.cpx(modeZeroPage)
+		c.programCounter++
+	case 0xec:
+		c.cpx(modeAbsolute)
+		c.programCounter += 2
+
+	case 0xc0:
+		c.cpy(modeImmediate)
+		c.programCounter++
+
+	case 0xc4:
+		c.cpy(modeZeroPage)
+		c.programCounter++
+	case 0xcc:
+		c.cpy(modeAbsolute)
+		c.programCounter += 2
+
+	case 0xc6:
+		c.dec(modeZeroPage)
+		c.programCounter++
+	case 0xd6:
+		c.dec(modeZeroPageX)
+		c.programCounter++
+	case 0xce:
+		c.dec(modeAbsolute)
+		c.programCounter += 2
+	case 0xde:
+		c.dec(modeAbsoluteX)
+		c.programCounter += 2
+
+	case 0xca:
+		c.dex()
+	case 0x88:
+		c.dey()
+
+	case 0x49:
+		c.eor(modeImmediate)
+		c.programCounter++
+	case 0x45:
+		c.eor(modeZeroPage)
+		c.programCounter++
+	case 0x55:
+		c.eor(modeZeroPageX)
+		c.programCounter++
+	case 0x4d:
+		c.eor(modeAbsolute)
+		c.programCounter += 2
+	case 0x5d:
+		c.eor(modeAbsoluteX)
+		c.programCounter += 2
+	case 0x59:
+		c.eor(modeAbsoluteY)
+		c.programCounter += 2
+	case 0x41:
+		c.eor(modeIndirectX)
+		c.programCounter++
+	case 0x51:
+		c.eor(modeIndirectY)
+		c.programCounter++
+
+	case 0xe6:
+		c.inc(modeZeroPage)
+		c.programCounter++
+	case 0xf6:
+		c.inc(modeZeroPageX)
+		c.programCounter++
+	case 0xee:
+		c.inc(modeAbsolute)
+		c.programCounter += 2
+	case 0xfe:
+		c.inc(modeAbsoluteX)
+		c.programCounter += 2
+
+	case 0xe8:
+		c.inx()
+	case 0xc8:
+		c.iny()
+
+	case 0x4c:
+		c.jmp(modeAbsolute)
+	case 0x6c:
+		c.jmp(modeIndirect)
+
+	case 0x20:
+		c.jsr()
+
+	case 0xa9:
+		c.lda(modeImmediate)
+		c.programCounter++
+	case 0xa5:
+		c.lda(modeZeroPage)
+		c.programCounter++
+	case 0xb5:
+		c.lda(modeZeroPageX)
+		c.programCounter++
+	case 0xad:
+		c.lda(modeAbsolute)
+		c.programCounter += 2
+	case 0xbd:
+		c.lda(modeAbsoluteX)
+		c.programCounter += 2
+	case 0xb9:
+		c.lda(modeAbsoluteY)
+		c.programCounter += 2
+	case 0xa1:
+		c.lda(modeIndirectX)
+		c.programCounter++
+	case 0xb1:
+		c.lda(modeIndirectY)
+		c.programCounter++
+
+	case 0xa2:
+		c.ldx(modeImmediate)
+		c.programCounter++
+	case 0xa6:
+		c.ldx(modeZeroPage)
+		c.programCounter++
+	case 0xae:
+		c.ldx(modeAbsolute)
+		c.programCounter += 2
+	case 0xbe:
+		c.ldx(modeAbsoluteY)
+		c.programCounter += 2
+
+	case 0xa0:
+		c.ldy(modeImmediate)
+		c.programCounter++
+	case 0xa4:
+		c.ldy(modeZeroPage)
+		c.programCounter++
+	case 0xb4:
+		c.ldy(modeZeroPageX)
+		c.programCounter++
+	case 0xac:
+		c.ldy(modeAbsolute)
+		c.programCounter += 2
+	case 0xbc:
+		c.ldy(modeAbsoluteX)
+		c.programCounter += 2
+
+	case 0x4a:
+		c.lsr(modeAccumulator)
+	case 0x46:
+		c.lsr(modeZeroPage)
+		c.programCounter++
+	case 0x56:
+		c.lsr(modeZeroPageX)
+		c.programCounter++
+	case 0x4e:
+		c.lsr(modeAbsolute)
+		c.programCounter += 2
+	case 0x5e:
+		c.lsr(modeAbsoluteX)
+		c.programCounter += 2
+
+	case 0xea:
+		c.nop()
+
+	case 0x09:
+		c.ora(modeImmediate)
+		c.programCounter++
+	case 0x05:
+		c.ora(modeZeroPage)
+		c.programCounter++
+	case 0x015:
+		c.ora(modeZeroPageX)
+		c.programCounter++
+	case 0x0d:
+		c.ora(modeAbsolute)
+		c.programCounter += 2
+	case 0x1d:
+		c.ora(modeAbsoluteX)
+		c.programCounter += 2
+	case 0x19:
+		c.ora(modeAbsoluteY)
+		c.programCounter += 2
+	case 0x01:
+		c.ora(modeIndirectX)
+		c.programCounter++
+	case 0x11:
+		c.ora(modeIndirectY)
+		c.programCounter++
+
+	case 0x48:
+		c.pha()
+	case 0x08:
+		c.php()
+	case 0x68:
+		c.pla()
+	case 0x28:
+		c.plp()
+
+	case 0x2a:
+		c.rol(modeAccumulator)
+	case 0x26:
+		c.rol(modeZeroPage)
+		c.programCounter++
+	case 0x36:
+		c.rol(modeZeroPageX)
+		c.programCounter++
+	case 0x2e:
+		c.rol(modeAbsolute)
+		c.programCounter += 2
+	case 0x3e:
+		c.rol(modeAbsoluteX)
+		c.programCounter += 2
+
+	case 0x6a:
+		c.ror(modeAccumulator)
+	case 0x66:
+		c.ror(modeZeroPage)
+		c.programCounter++
+	case 0x76:
+		c.ror(modeZeroPageX)
+		c.programCounter++
+	case 0x6e:
+		c.ror(modeAbsolute)
+		c.programCounter += 2
+	case 0x7e:
+		c.ror(modeAbsoluteX)
+		c.programCounter += 2
+
+	case 0x40:
+		c.rti()
+	case 0x060:
+		c.rts()
+
+	case 0xe9:
+		c.sbc(modeImmediate)
+		c.programCounter++
+	case 0xe5:
+		c.sbc(modeZeroPage)
+		c.programCounter++
+	case 0xf5:
+		c.sbc(modeZeroPageX)
+		c.programCounter++
+	case 0xed:
+		c.sbc(modeAbsolute)
+		c.programCounter += 2
+	case 0xfd:
+		c.sbc(modeAbsoluteX)
+		c.programCounter += 2
+	case 0xf9:
+		c.sbc(modeAbsoluteY)
+		c.programCounter += 2
+	case 0xe1:
+		c.sbc(modeIndirectX)
+		c.programCounter++
+	case 0xf1:
+		c.sbc(modeIndirectY)
+		c.programCounter++
+
+	case 0x38:
+		c.sec()
+	case 0xf8:
+		c.sed()
+	case 0x78:
+		c.sei()
+
+	case 0x85:
+		c.sta(modeZeroPage)
+		c.programCounter++
+	case 0x95:
+		c.sta(modeZeroPageX)
+		c.programCounter++
+	case 0x8d:
+		c.sta(modeAbsolute)
+		c.programCounter += 2
+	case 0x9d:
+		c.sta(modeAbsoluteX)
+		c.programCounter += 2
+	case 0x99:
+		c.sta(modeAbsoluteY)
+		c.programCounter += 2
+	case 0x81:
+		c.sta(modeIndirectX)
+		c.programCounter++
+	case 0x91:
+		c.sta(modeIndirectY)
+		c.programCounter++
+
+	case 0x86:
+		c.stx(modeZeroPage)
+		c.programCounter++
+	case 0x96:
+		c.stx(modeZeroPageY)
+		c.programCounter++
+	case 0x8e:
+		c.stx(modeAbsolute)
+		c.programCounter += 2
+
+	case 0x84:
+		c.sty(modeZeroPage)
+		c.programCounter++
+	case 0x94:
+		c.sty(modeZeroPageX)
+		c.programCounter++
+	case 0x8c:
+		c.sty(modeAbsolute)
+		c.programCounter += 2
+
+	case 0xaa:
+		c.tax()
+	case 0xa8:
+		c.tay()
+	case 0xba:
+		c.tsx()
+	case 0x8a:
+		c.txa()
+	case 0x9a:
+		c.txs()
+	case 0x98:
+		c.tya()
+
+	default:
+		if c.err == nil {
+			c.err = &UnknownOpcodeError{Opcode: opcode, Address: c.programCounter - 1}
 		}
+
 	}
+
+	return int(c.cycles - start)
 }
 
 func (c *CPU) loadAndInterpret(program []uint8) {
 	c.loadProgram(program)
-	c.reset()
-	c.ExecuteInstruction()
+	c.Reset()
+	for c.readMemory(c.programCounter) != 0x00 {
+		c.ExecuteInstruction()
+	}
+}
+
+// stateFields lists the CPU state that is captured in save states.
+func (c *CPU) stateFields() []interface{} {
+	return []interface{}{
+		&c.accumulator, &c.xIndex, &c.yIndex, &c.stackPointer,
+		&c.programCounter, &c.statusRegister,
+		&c.cycles, &c.stall, &c.nmiPending, &c.irqLine,
+	}
+}
+
+// Save writes the CPU state to encoder.
+func (c *CPU) Save(encoder *gob.Encoder) error {
+	return savestate.Encode(encoder, c.stateFields()...)
+}
+
+// Load restores CPU state written by Save.
+func (c *CPU) Load(decoder *gob.Decoder) error {
+	return savestate.Decode(decoder, c.stateFields()...)
 }
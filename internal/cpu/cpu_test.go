@@ -0,0 +1,396 @@
+package cpu
+
+import "testing"
+
+func TestAddressMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    AddressingMode
+		pc      uint16
+		x, y    uint8
+		memory  map[uint16]uint8
+		address uint16
+		crossed bool
+	}{
+		{
+			name:    "zero page X wraps",
+			mode:    modeZeroPageX,
+			pc:      0x0200,
+			x:       0x20,
+			memory:  map[uint16]uint8{0x0200: 0xF0},
+			address: 0x0010,
+		},
+		{
+			name:    "zero page Y wraps",
+			mode:    modeZeroPageY,
+			pc:      0x0200,
+			y:       0x01,
+			memory:  map[uint16]uint8{0x0200: 0xFF},
+			address: 0x0000,
+		},
+		{
+			name:    "absolute X crosses page",
+			mode:    modeAbsoluteX,
+			pc:      0x0200,
+			x:       0x01,
+			memory:  map[uint16]uint8{0x0200: 0xFF, 0x0201: 0x12},
+			address: 0x1300,
+			crossed: true,
+		},
+		{
+			name:    "(zp),Y within page",
+			mode:    modeIndirectY,
+			pc:      0x0200,
+			y:       0x10,
+			memory:  map[uint16]uint8{0x0200: 0x40, 0x0040: 0x00, 0x0041: 0x30},
+			address: 0x3010,
+		},
+		{
+			name:    "(zp),Y carries into high byte",
+			mode:    modeIndirectY,
+			pc:      0x0200,
+			y:       0x20,
+			memory:  map[uint16]uint8{0x0200: 0x40, 0x0040: 0xF0, 0x0041: 0x30},
+			address: 0x3110,
+			crossed: true,
+		},
+		{
+			name:    "(zp),Y pointer at $FF wraps",
+			mode:    modeIndirectY,
+			pc:      0x0200,
+			y:       0x01,
+			memory:  map[uint16]uint8{0x0200: 0xFF, 0x00FF: 0x34, 0x0000: 0x12, 0x0100: 0x99},
+			address: 0x1235,
+		},
+		{
+			name:    "(zp,X) wraps within zero page",
+			mode:    modeIndirectX,
+			pc:      0x0200,
+			x:       0x10,
+			memory:  map[uint16]uint8{0x0200: 0xF8, 0x0008: 0x00, 0x0009: 0x40, 0x0108: 0x99},
+			address: 0x4000,
+		},
+		{
+			name:    "(zp,X) pointer high byte wraps at $FF",
+			mode:    modeIndirectX,
+			pc:      0x0200,
+			x:       0x0F,
+			memory:  map[uint16]uint8{0x0200: 0xF0, 0x00FF: 0x78, 0x0000: 0x56, 0x0100: 0x99},
+			address: 0x5678,
+		},
+		{
+			name:    "JMP indirect",
+			mode:    modeIndirect,
+			pc:      0x0200,
+			memory:  map[uint16]uint8{0x0200: 0x80, 0x0201: 0x30, 0x3080: 0x00, 0x3081: 0xC0},
+			address: 0xC000,
+		},
+		{
+			name:    "JMP ($xxFF) reads high byte from $xx00",
+			mode:    modeIndirect,
+			pc:      0x0200,
+			memory:  map[uint16]uint8{0x0200: 0xFF, 0x0201: 0x30, 0x30FF: 0x00, 0x3000: 0x40, 0x3100: 0x50},
+			address: 0x4000,
+		},
+		{
+			name:    "branch forward within page",
+			mode:    modeRelative,
+			pc:      0x0210,
+			memory:  map[uint16]uint8{0x0210: 0x10},
+			address: 0x0221,
+		},
+		{
+			name:    "branch forward across page",
+			mode:    modeRelative,
+			pc:      0x02F0,
+			memory:  map[uint16]uint8{0x02F0: 0x20},
+			address: 0x0311,
+			crossed: true,
+		},
+		{
+			name:    "branch backward across page",
+			mode:    modeRelative,
+			pc:      0x0300,
+			memory:  map[uint16]uint8{0x0300: 0xF0},
+			address: 0x02F1,
+			crossed: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := NewCPU()
+			for address, value := range test.memory {
+				c.writeMemory(address, value)
+			}
+			c.programCounter = test.pc
+			c.xIndex = test.x
+			c.yIndex = test.y
+			address, crossed := c.addressMode(test.mode)
+			if address != test.address || crossed != test.crossed {
+				t.Errorf("addressMode = $%04X, %v; want $%04X, %v", address, crossed, test.address, test.crossed)
+			}
+		})
+	}
+}
+
+func TestPageCrossCycles(t *testing.T) {
+	tests := []struct {
+		name    string
+		program []uint8
+		y       uint8
+		cycles  int
+	}{
+		{"LDA (zp),Y", []uint8{0xB1, 0x40}, 0x0F, 5},
+		{"LDA (zp),Y page cross", []uint8{0xB1, 0x40}, 0x20, 6},
+		{"STA (zp),Y page cross", []uint8{0x91, 0x40}, 0x20, 6},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := NewCPU()
+			c.loadProgram(test.program)
+			c.writeMemory(0x0040, 0xF0)
+			c.writeMemory(0x0041, 0x30)
+			c.Reset()
+			c.yIndex = test.y
+			if cycles := c.ExecuteInstruction(); cycles != test.cycles {
+				t.Errorf("took %d cycles, want %d", cycles, test.cycles)
+			}
+		})
+	}
+}
+
+func TestBranchCycles(t *testing.T) {
+	tests := []struct {
+		name   string
+		offset uint8
+		zero   bool
+		cycles int
+		pc     uint16
+	}{
+		{"not taken", 0x10, true, 2, 0x8002},
+		{"taken", 0x10, false, 3, 0x8012},
+		{"taken across page", 0x80, false, 4, 0x7F82},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := NewCPU()
+			c.loadProgram([]uint8{0xD0, test.offset}) // BNE
+			c.Reset()
+			c.setFlagToValue(Z, boolToBit(test.zero))
+			if cycles := c.ExecuteInstruction(); cycles != test.cycles {
+				t.Errorf("took %d cycles, want %d", cycles, test.cycles)
+			}
+			if c.programCounter != test.pc {
+				t.Errorf("PC = $%04X, want $%04X", c.programCounter, test.pc)
+			}
+		})
+	}
+}
+
+// flags builds a status register value from the given flags.
+func flags(fs ...Flags) uint8 {
+	var status uint8
+	for _, f := range fs {
+		status |= 1 << f
+	}
+	return status
+}
+
+func TestInstructionFlags(t *testing.T) {
+	const mask = 1<<C | 1<<Z | 1<<V | 1<<N
+	tests := []struct {
+		name    string
+		program []uint8
+		a, x    uint8
+		carry   bool
+		memory  uint8 // the byte at $10
+		wantA   uint8
+		wantX   uint8
+		wantMem uint8
+		status  uint8 // expected C, Z, V and N
+	}{
+		{name: "LDA zero", program: []uint8{0xA9, 0x00}, wantA: 0x00, status: flags(Z)},
+		{name: "LDA negative", program: []uint8{0xA9, 0x80}, wantA: 0x80, status: flags(N)},
+		{name: "LDA positive", program: []uint8{0xA9, 0x7F}, wantA: 0x7F, status: 0},
+
+		{name: "ADC simple", program: []uint8{0x69, 0x10}, a: 0x20, wantA: 0x30},
+		{name: "ADC carry in", program: []uint8{0x69, 0x10}, a: 0x20, carry: true, wantA: 0x31},
+		{name: "ADC carry out", program: []uint8{0x69, 0x01}, a: 0xFF, wantA: 0x00, status: flags(C, Z)},
+		{name: "ADC signed overflow", program: []uint8{0x69, 0x50}, a: 0x50, wantA: 0xA0, status: flags(V, N)},
+		{name: "ADC negative overflow", program: []uint8{0x69, 0x90}, a: 0xD0, wantA: 0x60, status: flags(C, V)},
+		{name: "ADC no overflow across signs", program: []uint8{0x69, 0xFF}, a: 0x01, wantA: 0x00, status: flags(C, Z)},
+
+		{name: "SBC no borrow", program: []uint8{0xE9, 0x10}, a: 0x30, carry: true, wantA: 0x20, status: flags(C)},
+		{name: "SBC borrow in", program: []uint8{0xE9, 0x10}, a: 0x30, wantA: 0x1F, status: flags(C)},
+		{name: "SBC borrow out", program: []uint8{0xE9, 0x01}, a: 0x00, carry: true, wantA: 0xFF, status: flags(N)},
+		{name: "SBC signed overflow", program: []uint8{0xE9, 0x01}, a: 0x80, carry: true, wantA: 0x7F, status: flags(C, V)},
+
+		{name: "CMP greater", program: []uint8{0xC9, 0x10}, a: 0x20, wantA: 0x20, status: flags(C)},
+		{name: "CMP equal", program: []uint8{0xC9, 0x20}, a: 0x20, wantA: 0x20, status: flags(C, Z)},
+		{name: "CMP less", program: []uint8{0xC9, 0x30}, a: 0x20, wantA: 0x20, status: flags(N)},
+		{name: "CPX less", program: []uint8{0xE0, 0x01}, x: 0x00, status: flags(N)},
+		{name: "CPX equal", program: []uint8{0xE0, 0x42}, x: 0x42, wantX: 0x42, status: flags(C, Z)},
+
+		{name: "ASL A", program: []uint8{0x0A}, a: 0x81, wantA: 0x02, status: flags(C)},
+		{name: "ASL A to zero", program: []uint8{0x0A}, a: 0x80, wantA: 0x00, status: flags(C, Z)},
+		{name: "ASL zp", program: []uint8{0x06, 0x10}, memory: 0x40, wantMem: 0x80, status: flags(N)},
+		{name: "ROR zp takes carry from memory", program: []uint8{0x66, 0x10}, a: 0x00, memory: 0x01, carry: true, wantMem: 0x80, status: flags(C, N)},
+		{name: "ROR zp clears carry", program: []uint8{0x66, 0x10}, a: 0x01, memory: 0x02, wantA: 0x01, wantMem: 0x01},
+		{name: "ROL A", program: []uint8{0x2A}, a: 0x80, carry: true, wantA: 0x01, status: flags(C)},
+		{name: "LSR A", program: []uint8{0x4A}, a: 0x01, wantA: 0x00, status: flags(C, Z)},
+
+		{name: "BIT takes V and N from memory", program: []uint8{0x24, 0x10}, a: 0x01, wantA: 0x01, memory: 0xC1, wantMem: 0xC1, status: flags(V, N)},
+		{name: "BIT zero", program: []uint8{0x24, 0x10}, a: 0x02, wantA: 0x02, memory: 0x41, wantMem: 0x41, status: flags(Z, V)},
+
+		{name: "INC zp wraps", program: []uint8{0xE6, 0x10}, memory: 0xFF, wantMem: 0x00, status: flags(Z)},
+		{name: "DEX negative", program: []uint8{0xCA}, x: 0x00, wantX: 0xFF, status: flags(N)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := NewCPU()
+			c.loadProgram(test.program)
+			c.writeMemory(0x0010, test.memory)
+			c.Reset()
+			c.accumulator = test.a
+			c.xIndex = test.x
+			c.setFlagToValue(C, boolToBit(test.carry))
+			c.ExecuteInstruction()
+			if c.accumulator != test.wantA {
+				t.Errorf("A = $%02X, want $%02X", c.accumulator, test.wantA)
+			}
+			if c.xIndex != test.wantX {
+				t.Errorf("X = $%02X, want $%02X", c.xIndex, test.wantX)
+			}
+			if mem := c.readMemory(0x0010); mem != test.wantMem {
+				t.Errorf("$10 = $%02X, want $%02X", mem, test.wantMem)
+			}
+			if status := c.statusRegister & mask; status != test.status {
+				t.Errorf("status = %08b, want %08b", status, test.status)
+			}
+		})
+	}
+}
+
+func TestStackTransfers(t *testing.T) {
+	c := NewCPU()
+	// LDX #$80; TXS; LDX #$00; TSX
+	c.loadProgram([]uint8{0xA2, 0x80, 0x9A, 0xA2, 0x00, 0xBA})
+	c.Reset()
+	status := c.statusRegister
+	c.ExecuteInstruction()
+	c.ExecuteInstruction()
+	if c.stackPointer != 0x80 {
+		t.Fatalf("after TXS, S = $%02X, want $80", c.stackPointer)
+	}
+	if c.statusRegister != status|flags(N) {
+		t.Errorf("TXS changed status to %08b", c.statusRegister)
+	}
+	c.ExecuteInstruction()
+	c.ExecuteInstruction()
+	if c.xIndex != 0x80 {
+		t.Errorf("after TSX, X = $%02X, want $80", c.xIndex)
+	}
+	if c.getFlag(N) != 1 || c.getFlag(Z) != 0 {
+		t.Errorf("TSX status = %08b, want N set and Z clear", c.statusRegister)
+	}
+}
+
+func TestStatusPushPull(t *testing.T) {
+	c := NewCPU()
+	// PHP; PLA; LDA #$FF; PHA; PLP
+	c.loadProgram([]uint8{0x08, 0x68, 0xA9, 0xFF, 0x48, 0x28})
+	c.Reset()
+	c.statusRegister = flags(C, X)
+	c.ExecuteInstruction()
+	c.ExecuteInstruction()
+	if want := flags(C, B, X); c.accumulator != want {
+		t.Errorf("PHP pushed %08b, want %08b", c.accumulator, want)
+	}
+	for i := 0; i < 3; i++ {
+		c.ExecuteInstruction()
+	}
+	if want := uint8(0xFF) &^ flags(B); c.statusRegister != want {
+		t.Errorf("PLP set status to %08b, want %08b", c.statusRegister, want)
+	}
+}
+
+func TestSubroutineAndInterrupt(t *testing.T) {
+	c := NewCPU()
+	// JSR $8010; BRK; ... $8010: RTS
+	c.loadProgram([]uint8{0x20, 0x10, 0x80})
+	c.writeMemory(0x8010, 0x60)
+	c.writeMemory16(InterruptRequestVector, 0x9000)
+	c.writeMemory(0x9000, 0x40) // RTI
+	c.Reset()
+	c.ExecuteInstruction()
+	if c.programCounter != 0x8010 || c.stackPointer != StackReset-2 {
+		t.Fatalf("after JSR, PC = $%04X S = $%02X", c.programCounter, c.stackPointer)
+	}
+	if ret := c.readMemory16(StackBase + uint16(c.stackPointer) + 1); ret != 0x8002 {
+		t.Errorf("JSR pushed $%04X, want $8002", ret)
+	}
+	c.ExecuteInstruction()
+	if c.programCounter != 0x8003 || c.stackPointer != StackReset {
+		t.Fatalf("after RTS, PC = $%04X S = $%02X", c.programCounter, c.stackPointer)
+	}
+	c.ExecuteInstruction() // BRK at $8003
+	if c.programCounter != 0x9000 || c.getFlag(I) != 1 {
+		t.Fatalf("after BRK, PC = $%04X I = %d", c.programCounter, c.getFlag(I))
+	}
+	if pushed := c.readMemory(StackBase + uint16(c.stackPointer) + 1); pushed&flags(B, X) != flags(B, X) {
+		t.Errorf("BRK pushed status %08b without B and bit 5", pushed)
+	}
+	c.ExecuteInstruction()
+	if c.programCounter != 0x8005 {
+		t.Errorf("RTI returned to $%04X, want $8005", c.programCounter)
+	}
+}
+
+// recordingBus is flat memory that logs every write.
+type recordingBus struct {
+	flatMemory
+	writes []uint8
+}
+
+func (b *recordingBus) Write(address uint16, data uint8) {
+	if address == 0x0010 {
+		b.writes = append(b.writes, data)
+	}
+	b.flatMemory.Write(address, data)
+}
+
+func TestReadModifyWriteDummyWrite(t *testing.T) {
+	tests := []struct {
+		name    string
+		program []uint8
+		writes  []uint8
+	}{
+		{"INC", []uint8{0xE6, 0x10}, []uint8{0x41, 0x42}},
+		{"DEC", []uint8{0xC6, 0x10}, []uint8{0x41, 0x40}},
+		{"ASL", []uint8{0x06, 0x10}, []uint8{0x41, 0x82}},
+		{"LSR", []uint8{0x46, 0x10}, []uint8{0x41, 0x20}},
+		{"ROL", []uint8{0x26, 0x10}, []uint8{0x41, 0x82}},
+		{"ROR", []uint8{0x66, 0x10}, []uint8{0x41, 0x20}},
+		{"STA", []uint8{0x85, 0x10}, []uint8{0x00}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bus := &recordingBus{flatMemory: make(flatMemory, 0x10000)}
+			c := NewCPU()
+			c.ConnectBus(bus)
+			c.loadProgram(test.program)
+			c.writeMemory(0x0010, 0x41)
+			c.Reset()
+			bus.writes = nil
+			c.ExecuteInstruction()
+			if len(bus.writes) != len(test.writes) {
+				t.Fatalf("writes = %02X, want %02X", bus.writes, test.writes)
+			}
+			for i := range bus.writes {
+				if bus.writes[i] != test.writes[i] {
+					t.Fatalf("writes = %02X, want %02X", bus.writes, test.writes)
+				}
+			}
+		})
+	}
+}
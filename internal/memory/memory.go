@@ -1,28 +1,218 @@
 package memory
 
+import (
+	"encoding/gob"
+
+	"github.com/tejasdeepakmasne/NESemu/internal/savestate"
+)
+
+// Device is a component that answers CPU reads and writes within a region
+// of the address space. Devices receive the full CPU address and do their
+// own decoding of any mirrors.
+type Device interface {
+	Read(address uint16) uint8
+	Write(address uint16, data uint8)
+}
+
+// PartialDevice is implemented by devices that drive only some of the data
+// lines on certain reads. Bits clear in the driven mask float and read back
+// as whatever was last on the data bus.
+type PartialDevice interface {
+	Device
+	ReadPartial(address uint16) (data, driven uint8)
+}
+
+// DeviceFuncs adapts functions to the Device and PartialDevice interfaces.
+// PartialReadFunc takes precedence over ReadFunc when both are set. With
+// neither set the device never drives the bus, so reads return open bus;
+// a nil WriteFunc ignores writes.
+type DeviceFuncs struct {
+	ReadFunc        func(address uint16) uint8
+	PartialReadFunc func(address uint16) (data, driven uint8)
+	WriteFunc       func(address uint16, data uint8)
+}
+
+func (d DeviceFuncs) Read(address uint16) uint8 {
+	data, _ := d.ReadPartial(address)
+	return data
+}
+
+func (d DeviceFuncs) ReadPartial(address uint16) (uint8, uint8) {
+	switch {
+	case d.PartialReadFunc != nil:
+		return d.PartialReadFunc(address)
+	case d.ReadFunc != nil:
+		return d.ReadFunc(address), 0xFF
+	}
+	return 0, 0
+}
+
+func (d DeviceFuncs) Write(address uint16, data uint8) {
+	if d.WriteFunc != nil {
+		d.WriteFunc(address, data)
+	}
+}
+
+// Region is an inclusive range of CPU addresses.
+type Region struct {
+	Start uint16
+	End   uint16
+}
+
+// Regions of the NES CPU address map.
+var (
+	// RegionRAM is the 2 KiB of internal RAM, mirrored four times.
+	RegionRAM = Region{0x0000, 0x1FFF}
+	// RegionPPU holds the eight PPU registers, mirrored every 8 bytes.
+	RegionPPU = Region{0x2000, 0x3FFF}
+	// RegionIO holds the APU, OAM DMA and controller registers.
+	RegionIO = Region{0x4000, 0x4017}
+	// RegionTestMode holds the normally disabled APU test registers.
+	RegionTestMode = Region{0x4018, 0x401F}
+	// RegionCartridge is everything decoded by the cartridge: expansion
+	// area, work RAM and PRG ROM.
+	RegionCartridge = Region{0x4020, 0xFFFF}
+)
+
+// RAMSize is the size of the console's internal RAM.
+const RAMSize = 0x0800
+
 // Memory represents the memory of the NES.
 type Memory struct {
-	// Define memory regions and variables here
-	// For example:
-	// RAM []uint8
-	// ROM []uint8
+	ram [RAMSize]uint8
+
+	// devices holds the attached devices; index 0 is reserved for unmapped.
+	devices []Device
+	// lookup gives the index in devices of the device handling each address.
+	lookup [0x10000]uint8
+
+	// bus holds the value last driven onto the CPU data bus, which is what
+	// reads from unmapped addresses return.
+	bus uint8
+
+	uninit *UninitChecker
+	stats  *AccessStats
 }
 
-// NewMemory creates and initializes a new Memory instance.
+// NewMemory creates and initializes a new Memory instance with internal RAM
+// attached and every other region unmapped.
 func NewMemory() *Memory {
 	mem := &Memory{
-		// Initialize memory regions here
+		devices: []Device{nil},
 	}
+	mem.Attach(RegionRAM, DeviceFuncs{
+		ReadFunc:  mem.readRAM,
+		WriteFunc: mem.writeRAM,
+	})
 	return mem
 }
 
-// Read reads data from memory at the specified address.
+// Attach maps device into region, replacing whatever handled those
+// addresses before. Devices can be attached to arbitrary ranges, so new
+// hardware can claim part of a standard region.
+func (m *Memory) Attach(region Region, device Device) {
+	if len(m.devices) > 0xFF {
+		panic("memory: too many devices attached")
+	}
+	m.devices = append(m.devices, device)
+	index := uint8(len(m.devices) - 1)
+	for address := int(region.Start); address <= int(region.End); address++ {
+		m.lookup[address] = index
+	}
+}
+
+// Detach unmaps region so that reads return open bus and writes are ignored.
+func (m *Memory) Detach(region Region) {
+	for address := int(region.Start); address <= int(region.End); address++ {
+		m.lookup[address] = 0
+	}
+}
+
+// Read reads data from memory at the specified address. Data lines not
+// driven by any device keep the value last seen on the bus.
 func (m *Memory) Read(address uint16) uint8 {
-	// Implement memory read logic here
-	return 0 // Placeholder return value
+	if m.uninit != nil {
+		m.uninit.observeRead(address)
+	}
+	if m.stats != nil {
+		m.stats.RecordRead(address)
+	}
+	switch device := m.devices[m.lookup[address]].(type) {
+	case nil:
+	case PartialDevice:
+		data, driven := device.ReadPartial(address)
+		m.bus = (data & driven) | (m.bus &^ driven)
+	default:
+		m.bus = device.Read(address)
+	}
+	return m.bus
 }
 
 // Write writes data to memory at the specified address.
 func (m *Memory) Write(address uint16, data uint8) {
-	// Implement memory write logic here
+	if m.uninit != nil {
+		m.uninit.observeWrite(address)
+	}
+	if m.stats != nil {
+		m.stats.RecordWrite(address)
+	}
+	m.bus = data
+	device := m.devices[m.lookup[address]]
+	if device != nil {
+		device.Write(address, data)
+	}
+}
+
+// Peek reads the byte at address the way a debugger would: the data bus and
+// any attached instrumentation are left untouched. Reads of registers with
+// side effects still have them, so Peek is meant for RAM and ROM.
+func (m *Memory) Peek(address uint16) uint8 {
+	device := m.devices[m.lookup[address]]
+	if device == nil {
+		return m.bus
+	}
+	return device.Read(address)
+}
+
+// SetUninitChecker attaches a checker for reads of uninitialized RAM, or
+// removes it when checker is nil.
+func (m *Memory) SetUninitChecker(checker *UninitChecker) {
+	m.uninit = checker
+}
+
+// SetAccessStats attaches access counting, or removes it when stats is nil.
+func (m *Memory) SetAccessStats(stats *AccessStats) {
+	m.stats = stats
+}
+
+// OpenBus returns the value last driven onto the CPU data bus.
+func (m *Memory) OpenBus() uint8 {
+	return m.bus
+}
+
+// PowerOn fills internal RAM with its power-on contents and clears the bus.
+func (m *Memory) PowerOn(initializer *Initializer) {
+	initializer.Fill(m.ram[:])
+	m.bus = 0
+	if m.uninit != nil {
+		m.uninit.Reset()
+	}
+}
+
+func (m *Memory) readRAM(address uint16) uint8 {
+	return m.ram[address%RAMSize]
+}
+
+func (m *Memory) writeRAM(address uint16, data uint8) {
+	m.ram[address%RAMSize] = data
+}
+
+// Save writes the contents of internal RAM and the data bus to encoder.
+func (m *Memory) Save(encoder *gob.Encoder) error {
+	return savestate.Encode(encoder, &m.ram, &m.bus)
+}
+
+// Load restores memory state written by Save.
+func (m *Memory) Load(decoder *gob.Decoder) error {
+	return savestate.Decode(decoder, &m.ram, &m.bus)
 }
@@ -0,0 +1,187 @@
+package memory
+
+import "testing"
+
+// recordingDevice remembers the last address it was read or written at.
+type recordingDevice struct {
+	data      uint8
+	lastRead  uint16
+	lastWrite uint16
+	written   uint8
+}
+
+func (d *recordingDevice) Read(address uint16) uint8 {
+	d.lastRead = address
+	return d.data
+}
+
+func (d *recordingDevice) Write(address uint16, data uint8) {
+	d.lastWrite = address
+	d.written = data
+}
+
+func TestRAMMirroring(t *testing.T) {
+	mem := NewMemory()
+	for _, address := range []uint16{0x0000, 0x0800, 0x1000, 0x1800} {
+		mem.Write(address+0x0123, uint8(address>>8))
+		for _, mirror := range []uint16{0x0123, 0x0923, 0x1123, 0x1923} {
+			if got := mem.Read(mirror); got != uint8(address>>8) {
+				t.Errorf("after writing $%04X: $%04X = $%02X, want $%02X", address+0x0123, mirror, got, uint8(address>>8))
+			}
+		}
+	}
+}
+
+func TestRegionDispatch(t *testing.T) {
+	mem := NewMemory()
+	ppu := &recordingDevice{data: 0x20}
+	cart := &recordingDevice{data: 0x80}
+	mem.Attach(RegionPPU, ppu)
+	mem.Attach(RegionCartridge, cart)
+
+	tests := []struct {
+		address uint16
+		device  *recordingDevice
+	}{
+		{0x2000, ppu},
+		{0x2002, ppu},
+		// Devices see the full address and decode mirrors themselves.
+		{0x3FFA, ppu},
+		{0x4020, cart},
+		{0x6000, cart},
+		{0xFFFF, cart},
+	}
+	for _, test := range tests {
+		if got := mem.Read(test.address); got != test.device.data {
+			t.Errorf("Read($%04X) = $%02X, want $%02X", test.address, got, test.device.data)
+		}
+		if test.device.lastRead != test.address {
+			t.Errorf("Read($%04X) reached the device as $%04X", test.address, test.device.lastRead)
+		}
+		mem.Write(test.address, 0x5A)
+		if test.device.lastWrite != test.address || test.device.written != 0x5A {
+			t.Errorf("Write($%04X) reached the device as $%04X = $%02X", test.address, test.device.lastWrite, test.device.written)
+		}
+	}
+}
+
+func TestAttachReplacesPartOfRegion(t *testing.T) {
+	mem := NewMemory()
+	cart := &recordingDevice{data: 0x80}
+	expansion := &recordingDevice{data: 0x50}
+	mem.Attach(RegionCartridge, cart)
+	mem.Attach(Region{0x5000, 0x5FFF}, expansion)
+
+	for address, want := range map[uint16]uint8{0x4FFF: 0x80, 0x5000: 0x50, 0x5FFF: 0x50, 0x6000: 0x80} {
+		if got := mem.Read(address); got != want {
+			t.Errorf("Read($%04X) = $%02X, want $%02X", address, got, want)
+		}
+	}
+
+	mem.Detach(Region{0x5000, 0x5FFF})
+	mem.Write(0x5000, 0x12)
+	if expansion.written != 0 {
+		t.Errorf("detached device received a write of $%02X", expansion.written)
+	}
+	if got := mem.Read(0x5000); got != 0x12 {
+		t.Errorf("Read($5000) after Detach = $%02X, want open bus $12", got)
+	}
+}
+
+func TestOpenBus(t *testing.T) {
+	mem := NewMemory()
+	mem.Write(0x0010, 0x42)
+	mem.Read(0x0010)
+	if got := mem.Read(0x4018); got != 0x42 {
+		t.Errorf("unmapped read after reading $42 = $%02X, want $42", got)
+	}
+	mem.Write(0x0011, 0x99)
+	if got := mem.Read(0x4018); got != 0x99 {
+		t.Errorf("unmapped read after writing $99 = $%02X, want $99", got)
+	}
+	if got := mem.OpenBus(); got != 0x99 {
+		t.Errorf("OpenBus = $%02X, want $99", got)
+	}
+}
+
+func TestPartialDevice(t *testing.T) {
+	tests := []struct {
+		name   string
+		device DeviceFuncs
+		want   uint8
+	}{
+		{
+			name: "upper bits driven",
+			device: DeviceFuncs{PartialReadFunc: func(uint16) (uint8, uint8) {
+				return 0xA5, 0xE0
+			}},
+			want: 0xBF,
+		},
+		{
+			name: "nothing driven",
+			device: DeviceFuncs{PartialReadFunc: func(uint16) (uint8, uint8) {
+				return 0xA5, 0x00
+			}},
+			want: 0x1F,
+		},
+		{
+			name:   "full read",
+			device: DeviceFuncs{ReadFunc: func(uint16) uint8 { return 0xA5 }},
+			want:   0xA5,
+		},
+		{
+			name:   "no read function",
+			device: DeviceFuncs{},
+			want:   0x1F,
+		},
+		{
+			name: "partial read preferred",
+			device: DeviceFuncs{
+				ReadFunc:        func(uint16) uint8 { return 0x00 },
+				PartialReadFunc: func(uint16) (uint8, uint8) { return 0xA5, 0x0F },
+			},
+			want: 0x15,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mem := NewMemory()
+			mem.Attach(RegionPPU, test.device)
+			mem.Write(0x0000, 0x1F)
+			if got := mem.Read(0x2002); got != test.want {
+				t.Errorf("Read = $%02X, want $%02X", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPeek(t *testing.T) {
+	mem := NewMemory()
+	mem.Write(0x0010, 0x42)
+	mem.Write(0x0011, 0x99)
+	var reports []UninitializedRead
+	checker := NewUninitChecker(func() uint16 { return 0 }, func(read UninitializedRead) {
+		reports = append(reports, read)
+	})
+	checker.Reset()
+	mem.SetUninitChecker(checker)
+	stats := NewAccessStats(false)
+	mem.SetAccessStats(stats)
+
+	if got := mem.Peek(0x0010); got != 0x42 {
+		t.Errorf("Peek($0010) = $%02X, want $42", got)
+	}
+	if got := mem.Peek(0x4018); got != 0x99 {
+		t.Errorf("Peek of unmapped address = $%02X, want open bus $99", got)
+	}
+	if got := mem.OpenBus(); got != 0x99 {
+		t.Errorf("OpenBus after Peek = $%02X, want $99", got)
+	}
+	if len(reports) != 0 {
+		t.Errorf("Peek reported uninitialized reads %+v", reports)
+	}
+	stats.EndFrame()
+	if got := stats.Counts(0x0010); got != (AccessCounts{}) {
+		t.Errorf("Peek counted as %+v", got)
+	}
+}
@@ -0,0 +1,91 @@
+package memory
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// PowerOnPattern selects what the console's RAM chips contain at power-on.
+// Real hardware leaves them in an unpredictable state that depends on the
+// chip and the temperature, and some games seed random numbers from it.
+type PowerOnPattern int
+
+const (
+	// PowerOnZero fills RAM with $00.
+	PowerOnZero PowerOnPattern = iota
+	// PowerOnFF fills RAM with $FF.
+	PowerOnFF
+	// PowerOnAlternating fills RAM with four bytes of $00 followed by four
+	// bytes of $FF, repeating, the pattern most often seen on real consoles.
+	PowerOnAlternating
+	// PowerOnRandom fills RAM from a random generator seeded with
+	// PowerOnState.Seed, so runs are reproducible.
+	PowerOnRandom
+)
+
+var powerOnPatternNames = [...]string{
+	PowerOnZero:        "zero",
+	PowerOnFF:          "ff",
+	PowerOnAlternating: "alternating",
+	PowerOnRandom:      "random",
+}
+
+func (p PowerOnPattern) String() string {
+	if int(p) < len(powerOnPatternNames) {
+		return powerOnPatternNames[p]
+	}
+	return fmt.Sprintf("PowerOnPattern(%d)", int(p))
+}
+
+// ParsePowerOnPattern returns the pattern with the given name, as printed by
+// PowerOnPattern.String.
+func ParsePowerOnPattern(name string) (PowerOnPattern, error) {
+	for pattern, patternName := range powerOnPatternNames {
+		if name == patternName {
+			return PowerOnPattern(pattern), nil
+		}
+	}
+	return 0, fmt.Errorf("memory: unknown power-on pattern %q", name)
+}
+
+// PowerOnState describes the contents of every RAM in the system at power-on.
+type PowerOnState struct {
+	Pattern PowerOnPattern
+	Seed    int64
+}
+
+// Initializer fills RAMs according to a PowerOnState. Memories filled in
+// turn from one Initializer draw successive parts of the random stream, so
+// they do not all receive the same bytes.
+type Initializer struct {
+	pattern PowerOnPattern
+	rng     *rand.Rand
+}
+
+// NewInitializer returns an Initializer for the given power-on state.
+func (s PowerOnState) NewInitializer() *Initializer {
+	return &Initializer{
+		pattern: s.Pattern,
+		rng:     rand.New(rand.NewSource(s.Seed)),
+	}
+}
+
+// Fill overwrites buf with power-on contents.
+func (i *Initializer) Fill(buf []uint8) {
+	for index := range buf {
+		switch i.pattern {
+		case PowerOnFF:
+			buf[index] = 0xFF
+		case PowerOnAlternating:
+			if index&4 == 0 {
+				buf[index] = 0x00
+			} else {
+				buf[index] = 0xFF
+			}
+		case PowerOnRandom:
+			buf[index] = uint8(i.rng.Intn(0x100))
+		default:
+			buf[index] = 0x00
+		}
+	}
+}
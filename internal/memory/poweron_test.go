@@ -0,0 +1,72 @@
+package memory
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPowerOnPatterns(t *testing.T) {
+	tests := []struct {
+		pattern PowerOnPattern
+		want    []uint8
+	}{
+		{PowerOnZero, []uint8{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}},
+		{PowerOnFF, []uint8{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}},
+		{PowerOnAlternating, []uint8{0x00, 0x00, 0x00, 0x00, 0xFF, 0xFF, 0xFF, 0xFF, 0x00, 0x00}},
+	}
+	for _, test := range tests {
+		t.Run(test.pattern.String(), func(t *testing.T) {
+			buf := bytes.Repeat([]uint8{0x5A}, len(test.want))
+			PowerOnState{Pattern: test.pattern}.NewInitializer().Fill(buf)
+			if !bytes.Equal(buf, test.want) {
+				t.Errorf("Fill = % X, want % X", buf, test.want)
+			}
+		})
+	}
+}
+
+func TestPowerOnRandom(t *testing.T) {
+	fill := func(seed int64) (first, second []uint8) {
+		initializer := PowerOnState{Pattern: PowerOnRandom, Seed: seed}.NewInitializer()
+		first, second = make([]uint8, 64), make([]uint8, 64)
+		initializer.Fill(first)
+		initializer.Fill(second)
+		return first, second
+	}
+	first, second := fill(1)
+	again, _ := fill(1)
+	other, _ := fill(2)
+	if !bytes.Equal(first, again) {
+		t.Error("the same seed gave different contents")
+	}
+	if bytes.Equal(first, other) {
+		t.Error("different seeds gave the same contents")
+	}
+	if bytes.Equal(first, second) {
+		t.Error("successive memories received the same contents")
+	}
+}
+
+func TestParsePowerOnPattern(t *testing.T) {
+	for _, pattern := range []PowerOnPattern{PowerOnZero, PowerOnFF, PowerOnAlternating, PowerOnRandom} {
+		got, err := ParsePowerOnPattern(pattern.String())
+		if err != nil || got != pattern {
+			t.Errorf("ParsePowerOnPattern(%q) = %v, %v; want %v", pattern.String(), got, err, pattern)
+		}
+	}
+	if _, err := ParsePowerOnPattern("checkerboard"); err == nil {
+		t.Error("ParsePowerOnPattern accepted an unknown name")
+	}
+}
+
+func TestMemoryPowerOn(t *testing.T) {
+	mem := NewMemory()
+	mem.Write(0x0010, 0x42)
+	mem.PowerOn(PowerOnState{Pattern: PowerOnFF}.NewInitializer())
+	if got := mem.OpenBus(); got != 0 {
+		t.Errorf("OpenBus after PowerOn = $%02X, want $00", got)
+	}
+	if got := mem.Read(0x0010); got != 0xFF {
+		t.Errorf("$0010 after PowerOn = $%02X, want $FF", got)
+	}
+}
@@ -0,0 +1,250 @@
+package memory
+
+import (
+	"encoding/csv"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// AccessCounts holds the number of reads, writes and opcode fetches seen at
+// one address. Opcode fetches are counted as reads as well as executes.
+type AccessCounts struct {
+	Reads    uint64
+	Writes   uint64
+	Executes uint64
+}
+
+// BankedAddress identifies a byte of a switchable bank: the bank number
+// and the CPU address it was accessed through.
+type BankedAddress struct {
+	Bank    int
+	Address uint16
+}
+
+// BankResolver reports which PRG bank is mapped at a CPU address, and
+// whether the address lies in a bank-switched region at all.
+type BankResolver func(address uint16) (bank int, banked bool)
+
+// AccessStats counts CPU accesses per address over a run, or per frame.
+// Accesses to bank-switched regions are also counted per bank when a
+// BankResolver is set.
+type AccessStats struct {
+	current  []AccessCounts
+	previous []AccessCounts
+
+	banks         map[BankedAddress]*AccessCounts
+	previousBanks map[BankedAddress]*AccessCounts
+
+	resolver BankResolver
+	perFrame bool
+}
+
+// NewAccessStats creates empty statistics. In per-frame mode the counts are
+// cleared at every EndFrame and the exports show the last complete frame,
+// which makes a game's hot loops stand out.
+func NewAccessStats(perFrame bool) *AccessStats {
+	return &AccessStats{
+		current:  make([]AccessCounts, 0x10000),
+		previous: make([]AccessCounts, 0x10000),
+		banks:    make(map[BankedAddress]*AccessCounts),
+		perFrame: perFrame,
+	}
+}
+
+// SetBankResolver sets the function used to attribute accesses to banks.
+func (s *AccessStats) SetBankResolver(resolver BankResolver) {
+	s.resolver = resolver
+}
+
+func (s *AccessStats) bankCounts(address uint16) *AccessCounts {
+	if s.resolver == nil {
+		return nil
+	}
+	bank, banked := s.resolver(address)
+	if !banked {
+		return nil
+	}
+	key := BankedAddress{Bank: bank, Address: address}
+	counts := s.banks[key]
+	if counts == nil {
+		counts = &AccessCounts{}
+		s.banks[key] = counts
+	}
+	return counts
+}
+
+// RecordRead counts a read of address.
+func (s *AccessStats) RecordRead(address uint16) {
+	s.current[address].Reads++
+	if counts := s.bankCounts(address); counts != nil {
+		counts.Reads++
+	}
+}
+
+// RecordWrite counts a write to address.
+func (s *AccessStats) RecordWrite(address uint16) {
+	s.current[address].Writes++
+	if counts := s.bankCounts(address); counts != nil {
+		counts.Writes++
+	}
+}
+
+// RecordExecute counts an opcode fetch from address.
+func (s *AccessStats) RecordExecute(address uint16) {
+	s.current[address].Executes++
+	if counts := s.bankCounts(address); counts != nil {
+		counts.Executes++
+	}
+}
+
+// EndFrame marks a frame boundary. In per-frame mode it keeps the frame's
+// counts for export and starts counting afresh.
+func (s *AccessStats) EndFrame() {
+	if !s.perFrame {
+		return
+	}
+	s.previous, s.current = s.current, s.previous
+	for i := range s.current {
+		s.current[i] = AccessCounts{}
+	}
+	s.previousBanks = s.banks
+	s.banks = make(map[BankedAddress]*AccessCounts)
+}
+
+// Reset clears all counts.
+func (s *AccessStats) Reset() {
+	for i := range s.current {
+		s.current[i] = AccessCounts{}
+		s.previous[i] = AccessCounts{}
+	}
+	s.banks = make(map[BankedAddress]*AccessCounts)
+	s.previousBanks = nil
+}
+
+// Counts returns the counts for address: the total so far, or the last
+// complete frame in per-frame mode.
+func (s *AccessStats) Counts(address uint16) AccessCounts {
+	return s.snapshot()[address]
+}
+
+// BankCounts returns the per-bank counts: the total so far, or the last
+// complete frame in per-frame mode.
+func (s *AccessStats) BankCounts() map[BankedAddress]AccessCounts {
+	banks := s.banks
+	if s.perFrame {
+		banks = s.previousBanks
+	}
+	result := make(map[BankedAddress]AccessCounts, len(banks))
+	for key, counts := range banks {
+		result[key] = *counts
+	}
+	return result
+}
+
+func (s *AccessStats) snapshot() []AccessCounts {
+	if s.perFrame {
+		return s.previous
+	}
+	return s.current
+}
+
+// WriteCSV writes one row per accessed address with the columns address,
+// bank, reads, writes and executes. Rows for bank-switched addresses follow
+// the flat rows and carry their bank number; the bank column of flat rows
+// is empty.
+func (s *AccessStats) WriteCSV(w io.Writer) error {
+	out := csv.NewWriter(w)
+	if err := out.Write([]string{"address", "bank", "reads", "writes", "executes"}); err != nil {
+		return err
+	}
+
+	row := func(address uint16, bank string, counts AccessCounts) error {
+		return out.Write([]string{
+			"$" + strconv.FormatUint(uint64(address)|0x10000, 16)[1:],
+			bank,
+			strconv.FormatUint(counts.Reads, 10),
+			strconv.FormatUint(counts.Writes, 10),
+			strconv.FormatUint(counts.Executes, 10),
+		})
+	}
+
+	for address, counts := range s.snapshot() {
+		if counts == (AccessCounts{}) {
+			continue
+		}
+		if err := row(uint16(address), "", counts); err != nil {
+			return err
+		}
+	}
+
+	banks := s.BankCounts()
+	keys := make([]BankedAddress, 0, len(banks))
+	for key := range banks {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Bank != keys[j].Bank {
+			return keys[i].Bank < keys[j].Bank
+		}
+		return keys[i].Address < keys[j].Address
+	})
+	for _, key := range keys {
+		if err := row(key.Address, strconv.Itoa(key.Bank), banks[key]); err != nil {
+			return err
+		}
+	}
+
+	out.Flush()
+	return out.Error()
+}
+
+// Heatmap renders the counts as a 256x256 image with one pixel per address:
+// the low byte of the address is the column and the high byte the row.
+// Writes are drawn in red, reads in green and executes in blue, each on a
+// logarithmic scale relative to the busiest address.
+func (s *AccessStats) Heatmap() *image.RGBA {
+	counts := s.snapshot()
+	var maxCounts AccessCounts
+	for _, c := range counts {
+		maxCounts.Reads = maxUint64(maxCounts.Reads, c.Reads)
+		maxCounts.Writes = maxUint64(maxCounts.Writes, c.Writes)
+		maxCounts.Executes = maxUint64(maxCounts.Executes, c.Executes)
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, 256, 256))
+	for address, c := range counts {
+		img.SetRGBA(address&0xFF, address>>8, color.RGBA{
+			R: logScale(c.Writes, maxCounts.Writes),
+			G: logScale(c.Reads, maxCounts.Reads),
+			B: logScale(c.Executes, maxCounts.Executes),
+			A: 0xFF,
+		})
+	}
+	return img
+}
+
+// WritePNG writes the heatmap to w as a PNG image.
+func (s *AccessStats) WritePNG(w io.Writer) error {
+	return png.Encode(w, s.Heatmap())
+}
+
+func logScale(value, max uint64) uint8 {
+	if value == 0 || max == 0 {
+		return 0
+	}
+	scaled := math.Log1p(float64(value)) / math.Log1p(float64(max))
+	// Keep any access visible against the black background.
+	return uint8(48 + scaled*207)
+}
+
+func maxUint64(a, b uint64) uint64 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,87 @@
+package memory
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestAccessStatsEndFrame(t *testing.T) {
+	s := NewAccessStats(true)
+	s.RecordRead(0x0010)
+	s.RecordRead(0x0010)
+	s.RecordWrite(0x0010)
+	if got := s.Counts(0x0010); got != (AccessCounts{}) {
+		t.Errorf("counts before the first EndFrame = %+v, want none", got)
+	}
+
+	s.EndFrame()
+	if got, want := s.Counts(0x0010), (AccessCounts{Reads: 2, Writes: 1}); got != want {
+		t.Errorf("first frame = %+v, want %+v", got, want)
+	}
+
+	s.RecordExecute(0x0010)
+	s.EndFrame()
+	if got, want := s.Counts(0x0010), (AccessCounts{Executes: 1}); got != want {
+		t.Errorf("second frame = %+v, want %+v", got, want)
+	}
+
+	s.EndFrame()
+	if got := s.Counts(0x0010); got != (AccessCounts{}) {
+		t.Errorf("empty frame = %+v, want none", got)
+	}
+}
+
+func TestAccessStatsTotals(t *testing.T) {
+	s := NewAccessStats(false)
+	s.RecordRead(0x0200)
+	s.EndFrame()
+	s.RecordRead(0x0200)
+	if got, want := s.Counts(0x0200), (AccessCounts{Reads: 2}); got != want {
+		t.Errorf("counts = %+v, want %+v", got, want)
+	}
+}
+
+func TestAccessStatsBankCSV(t *testing.T) {
+	s := NewAccessStats(false)
+	bank := 0
+	s.SetBankResolver(func(address uint16) (int, bool) {
+		return bank, address >= 0x8000
+	})
+	s.RecordExecute(0x8000)
+	s.RecordRead(0x0300)
+	bank = 3
+	s.RecordRead(0x8000)
+	s.RecordWrite(0x8001)
+
+	var buf bytes.Buffer
+	if err := s.WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		"address,bank,reads,writes,executes",
+		"$0300,,1,0,0",
+		"$8000,,1,0,1",
+		"$8001,,0,1,0",
+		"$8000,0,0,0,1",
+		"$8000,3,1,0,0",
+		"$8001,3,0,1,0",
+		"",
+	}, "\n")
+	if got := buf.String(); got != want {
+		t.Errorf("CSV:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestAccessStatsBankEndFrame(t *testing.T) {
+	s := NewAccessStats(true)
+	s.SetBankResolver(func(address uint16) (int, bool) { return 1, true })
+	s.RecordRead(0xC000)
+	s.EndFrame()
+	s.RecordRead(0xC000)
+	s.RecordRead(0xC000)
+	got := s.BankCounts()
+	if counts := got[BankedAddress{Bank: 1, Address: 0xC000}]; counts.Reads != 1 || len(got) != 1 {
+		t.Errorf("BankCounts = %+v, want one read of bank 1 $C000", got)
+	}
+}
@@ -0,0 +1,81 @@
+package memory
+
+// RegionWorkRAM is where cartridges map their work RAM, if they have any.
+var RegionWorkRAM = Region{0x6000, 0x7FFF}
+
+// RegionTrainer is where the trainer of a ROM image is loaded at power-on.
+var RegionTrainer = Region{0x7000, 0x71FF}
+
+// UninitializedRead describes a CPU read of a byte that had not been
+// written since power-on.
+type UninitializedRead struct {
+	// Address is the address read, folded onto the first mirror for
+	// internal RAM.
+	Address uint16
+	// PC is the address of the instruction that performed the read.
+	PC uint16
+}
+
+// UninitChecker watches RAM for reads of bytes that have never been written
+// since power-on. Code that depends on such bytes works or fails depending
+// on the console it runs on. Each address is reported once.
+type UninitChecker struct {
+	watched  [0x10000]bool
+	written  [0x10000]bool
+	reported [0x10000]bool
+
+	pc     func() uint16
+	report func(UninitializedRead)
+}
+
+// NewUninitChecker creates a checker that watches internal RAM. pc supplies
+// the address of the executing instruction and report is called for every
+// uninitialized read.
+func NewUninitChecker(pc func() uint16, report func(UninitializedRead)) *UninitChecker {
+	checker := &UninitChecker{pc: pc, report: report}
+	checker.Watch(Region{0x0000, RAMSize - 1})
+	return checker
+}
+
+// Watch adds region to the addresses being checked. Addresses in the
+// internal RAM mirrors are always folded onto $0000-$07FF.
+func (u *UninitChecker) Watch(region Region) {
+	for address := int(region.Start); address <= int(region.End); address++ {
+		u.watched[canonicalAddress(uint16(address))] = true
+	}
+}
+
+// MarkWritten treats every address in region as written, for memory whose
+// contents are known at power-on such as battery-backed RAM restored from a
+// save.
+func (u *UninitChecker) MarkWritten(region Region) {
+	for address := int(region.Start); address <= int(region.End); address++ {
+		u.written[canonicalAddress(uint16(address))] = true
+	}
+}
+
+// Reset forgets every write and report, as at power-on.
+func (u *UninitChecker) Reset() {
+	u.written = [0x10000]bool{}
+	u.reported = [0x10000]bool{}
+}
+
+func (u *UninitChecker) observeRead(address uint16) {
+	address = canonicalAddress(address)
+	if !u.watched[address] || u.written[address] || u.reported[address] {
+		return
+	}
+	u.reported[address] = true
+	u.report(UninitializedRead{Address: address, PC: u.pc()})
+}
+
+func (u *UninitChecker) observeWrite(address uint16) {
+	u.written[canonicalAddress(address)] = true
+}
+
+func canonicalAddress(address uint16) uint16 {
+	if address <= RegionRAM.End {
+		return address % RAMSize
+	}
+	return address
+}
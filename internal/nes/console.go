@@ -0,0 +1,333 @@
+package nes
+
+import (
+	"encoding/gob"
+	"errors"
+	"io"
+
+	"github.com/tejasdeepakmasne/NESemu/internal/apu"
+	"github.com/tejasdeepakmasne/NESemu/internal/cartridge"
+	"github.com/tejasdeepakmasne/NESemu/internal/controller"
+	"github.com/tejasdeepakmasne/NESemu/internal/cpu"
+	"github.com/tejasdeepakmasne/NESemu/internal/memory"
+	"github.com/tejasdeepakmasne/NESemu/internal/ppu"
+)
+
+// PPUDotsPerCPUCycle is the number of PPU dots that elapse during one CPU
+// cycle on an NTSC console.
+const PPUDotsPerCPUCycle = 3
+
+// dmcFetchCycles is how long the CPU is halted while the DMC fetches a sample byte.
+const dmcFetchCycles = 4
+
+// stateMagic identifies save states written by Console.Save and changes
+// whenever the state layout does.
+const stateMagic = "NESemu-state-6"
+
+// ErrStateMismatch is returned when loading a save state written by an
+// incompatible version of the emulator or for a different cartridge.
+var ErrStateMismatch = errors.New("nes: save state format not recognized")
+
+// Console represents a complete NES: it owns every component, connects them
+// to one another and drives them from a single master clock.
+type Console struct {
+	cpu       *cpu.CPU
+	ppu       *ppu.PPU
+	apu       *apu.APU
+	memory    *memory.Memory
+	cartridge *cartridge.Cartridge
+
+	controllers [2]*controller.Controller
+
+	powerOnState memory.PowerOnState
+
+	// breakErr is set while emulation is stopped at a breakpoint.
+	breakErr error
+
+	stats      *memory.AccessStats
+	statsFrame uint64
+
+	uninit *memory.UninitChecker
+}
+
+// NewConsole creates a console with the given cartridge inserted. The
+// console is not running until PowerOn is called.
+func NewConsole(cart *cartridge.Cartridge) *Console {
+	console := &Console{
+		cpu:       cpu.NewCPU(),
+		ppu:       ppu.NewPPU(),
+		apu:       apu.NewAPU(),
+		memory:    memory.NewMemory(),
+		cartridge: cart,
+		controllers: [2]*controller.Controller{
+			controller.NewController(),
+			controller.NewController(),
+		},
+	}
+
+	console.memory.Attach(memory.RegionPPU, memory.DeviceFuncs{
+		ReadFunc:  console.ppu.ReadRegister,
+		WriteFunc: console.writePPURegister,
+	})
+	console.memory.Attach(memory.RegionIO, memory.DeviceFuncs{
+		PartialReadFunc: console.readIO,
+		WriteFunc:       console.writeIO,
+	})
+	if cart != nil {
+		console.memory.Attach(memory.RegionCartridge, memory.DeviceFuncs{
+			PartialReadFunc: cart.ReadPRGPartial,
+			WriteFunc:       cart.WritePRGByte,
+		})
+		console.ppu.ConnectCartridge(cart)
+		cart.ConnectNametableRAM(console.ppu.NametableRAM())
+		console.apu.ConnectExpansion(cart.AudioOutput)
+	}
+
+	console.cpu.ConnectBus(console.memory)
+	console.ppu.OnNMI(console.cpu.TriggerNMI)
+	console.apu.ConnectMemory(console.readDMC)
+
+	return console
+}
+
+// CPU returns the console's CPU.
+func (c *Console) CPU() *cpu.CPU {
+	return c.cpu
+}
+
+// PPU returns the console's PPU.
+func (c *Console) PPU() *ppu.PPU {
+	return c.ppu
+}
+
+// APU returns the console's APU.
+func (c *Console) APU() *apu.APU {
+	return c.apu
+}
+
+// Memory returns the CPU memory map of the console.
+func (c *Console) Memory() *memory.Memory {
+	return c.memory
+}
+
+// Cartridge returns the inserted cartridge, or nil if there is none.
+func (c *Console) Cartridge() *cartridge.Cartridge {
+	return c.cartridge
+}
+
+// Controller returns the controller plugged into the given port, 0 or 1.
+func (c *Console) Controller(port int) *controller.Controller {
+	return c.controllers[port]
+}
+
+// Err returns the reason emulation is stopped at a breakpoint, if it is,
+// or else the first emulation error encountered by any component.
+func (c *Console) Err() error {
+	if c.breakErr != nil {
+		return c.breakErr
+	}
+	return c.cpu.Err()
+}
+
+// Break stops emulation after the current instruction. StepFrame returns
+// early and Err reports reason until Resume is called.
+func (c *Console) Break(reason error) {
+	c.breakErr = reason
+}
+
+// Resume continues emulation after a Break.
+func (c *Console) Resume() {
+	c.breakErr = nil
+}
+
+// EnableUninitChecker starts reporting reads of internal RAM, and of work
+// RAM if the cartridge has any, that have not been written since power-on.
+// Work RAM restored from a battery save and a trainer count as written. Enable it before
+// PowerOn so that every write since power-on is seen.
+func (c *Console) EnableUninitChecker(report func(memory.UninitializedRead)) *memory.UninitChecker {
+	checker := memory.NewUninitChecker(c.cpu.InstructionAddress, report)
+	if c.cartridge != nil && c.cartridge.HasWorkRAM() {
+		checker.Watch(memory.RegionWorkRAM)
+	}
+	c.memory.SetUninitChecker(checker)
+	c.uninit = checker
+	return checker
+}
+
+// writePPURegister writes a PPU register, letting the cartridge see the
+// write as it would on the shared CPU bus.
+func (c *Console) writePPURegister(address uint16, data uint8) {
+	c.ppu.WriteRegister(address, data)
+	if c.cartridge != nil {
+		c.cartridge.SnoopWrite(address, data)
+	}
+}
+
+// readDMC fetches a DMC sample byte, halting the CPU while it does.
+func (c *Console) readDMC(address uint16) uint8 {
+	c.cpu.Stall(dmcFetchCycles)
+	return c.memory.Read(address)
+}
+
+// SetPowerOnState selects what RAM contains the next time PowerOn is called.
+func (c *Console) SetPowerOnState(state memory.PowerOnState) {
+	c.powerOnState = state
+}
+
+// PowerOn brings every component up from its power-on state and starts the
+// CPU at the reset vector. Internal RAM, cartridge work RAM and PPU memory
+// are filled according to the power-on state.
+func (c *Console) PowerOn() {
+	initializer := c.powerOnState.NewInitializer()
+	c.memory.PowerOn(initializer)
+	c.ppu.PowerOn(initializer.Fill)
+	if c.cartridge != nil {
+		c.cartridge.PowerOn(initializer.Fill)
+		if c.uninit != nil && c.cartridge.WorkRAMRestored() {
+			c.uninit.MarkWritten(memory.RegionWorkRAM)
+		}
+		if c.uninit != nil && c.cartridge.Trainer() != nil {
+			c.uninit.MarkWritten(memory.RegionTrainer)
+		}
+	}
+	c.apu.Reset()
+	c.cpu.Reset()
+}
+
+// Reset presses the console's reset button. Unlike PowerOn, the contents of
+// RAM are left untouched.
+func (c *Console) Reset() {
+	c.ppu.Reset()
+	c.apu.Reset()
+	c.cpu.Reset()
+}
+
+// EnableAccessStats starts counting CPU reads, writes and opcode fetches
+// per address, and per PRG bank for bank-switched cartridge space.
+func (c *Console) EnableAccessStats(perFrame bool) *memory.AccessStats {
+	c.stats = memory.NewAccessStats(perFrame)
+	if c.cartridge != nil {
+		c.stats.SetBankResolver(c.cartridge.PRGBank)
+	}
+	c.statsFrame = c.ppu.Frame()
+	c.memory.SetAccessStats(c.stats)
+	c.cpu.OnFetch(c.stats.RecordExecute)
+	return c.stats
+}
+
+// StepInstruction executes one CPU instruction and advances the PPU and APU
+// by the same amount of time. It returns the number of CPU cycles taken.
+func (c *Console) StepInstruction() int {
+	cycles := c.cpu.ExecuteInstruction()
+	for i := 0; i < cycles; i++ {
+		for dot := 0; dot < PPUDotsPerCPUCycle; dot++ {
+			c.ppu.Step()
+		}
+		c.apu.Step()
+		if c.cartridge != nil {
+			c.cartridge.Step()
+		}
+	}
+	c.cpu.SetIRQ(c.apu.IRQ() || c.cartridge != nil && c.cartridge.IRQ())
+	if c.stats != nil && c.ppu.Frame() != c.statsFrame {
+		c.statsFrame = c.ppu.Frame()
+		c.stats.EndFrame()
+	}
+	return cycles
+}
+
+// StepFrame runs the console until the PPU finishes the current frame, or
+// until emulation breaks, and returns the number of CPU cycles taken.
+func (c *Console) StepFrame() int {
+	cycles := 0
+	frame := c.ppu.Frame()
+	for c.ppu.Frame() == frame && c.breakErr == nil {
+		cycles += c.StepInstruction()
+	}
+	return cycles
+}
+
+// Save writes a snapshot of the whole console to w.
+func (c *Console) Save(w io.Writer) error {
+	encoder := gob.NewEncoder(w)
+	if err := encoder.Encode(stateMagic); err != nil {
+		return err
+	}
+	if err := encoder.Encode(c.cartridgeChecksum()); err != nil {
+		return err
+	}
+	if err := c.cpu.Save(encoder); err != nil {
+		return err
+	}
+	if err := c.memory.Save(encoder); err != nil {
+		return err
+	}
+	if err := c.ppu.Save(encoder); err != nil {
+		return err
+	}
+	if err := c.apu.Save(encoder); err != nil {
+		return err
+	}
+	if c.cartridge != nil {
+		if err := c.cartridge.Save(encoder); err != nil {
+			return err
+		}
+	}
+	for _, controller := range c.controllers {
+		if err := controller.Save(encoder); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cartridgeChecksum identifies the inserted cartridge in save states.
+func (c *Console) cartridgeChecksum() uint32 {
+	if c.cartridge == nil {
+		return 0
+	}
+	return c.cartridge.Checksum()
+}
+
+// Load restores a snapshot written by Save. The same cartridge must be
+// inserted as when the snapshot was taken.
+func (c *Console) Load(r io.Reader) error {
+	decoder := gob.NewDecoder(r)
+	var magic string
+	if err := decoder.Decode(&magic); err != nil {
+		return err
+	}
+	if magic != stateMagic {
+		return ErrStateMismatch
+	}
+	var checksum uint32
+	if err := decoder.Decode(&checksum); err != nil {
+		return err
+	}
+	if checksum != c.cartridgeChecksum() {
+		return ErrStateMismatch
+	}
+	if err := c.cpu.Load(decoder); err != nil {
+		return err
+	}
+	if err := c.memory.Load(decoder); err != nil {
+		return err
+	}
+	if err := c.ppu.Load(decoder); err != nil {
+		return err
+	}
+	if err := c.apu.Load(decoder); err != nil {
+		return err
+	}
+	if c.cartridge != nil {
+		if err := c.cartridge.Load(decoder); err != nil {
+			return err
+		}
+	}
+	for _, controller := range c.controllers {
+		if err := controller.Load(decoder); err != nil {
+			return err
+		}
+	}
+	return nil
+}
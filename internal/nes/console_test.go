@@ -0,0 +1,134 @@
+package nes
+
+import (
+	"testing"
+
+	"github.com/tejasdeepakmasne/NESemu/internal/cartridge"
+	"github.com/tejasdeepakmasne/NESemu/internal/memory"
+)
+
+// readProgram reads $0010 and $6000 and then loops.
+var readProgram = []uint8{
+	0xA5, 0x10, // LDA $10
+	0xAD, 0x00, 0x60, // LDA $6000
+	0x4C, 0x05, 0x80, // JMP *
+}
+
+// newTestConsole builds a console around an NROM image with the given
+// header flags 6 and 7 and NES 2.0 RAM size byte 10.
+func newTestConsole(t *testing.T, flags6, flags7, ramSizes uint8) *Console {
+	t.Helper()
+	prg := make([]uint8, 0x4000)
+	copy(prg, readProgram)
+	prg[0x3FFC], prg[0x3FFD] = 0x00, 0x80
+	header := []uint8{'N', 'E', 'S', 0x1A, 1, 0, flags6, flags7, 0, 0, ramSizes, 0, 0, 0, 0, 0}
+	cart, err := cartridge.ParseWithOptions(append(header, prg...), cartridge.LoadOptions{DisableDatabase: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewConsole(cart)
+}
+
+func TestUninitCheckerWorkRAM(t *testing.T) {
+	tests := []struct {
+		name    string
+		flags6  uint8
+		flags7  uint8
+		ram     uint8
+		battery bool
+		want    []uint16
+	}{
+		{name: "iNES work RAM", want: []uint16{0x0010, 0x6000}},
+		{name: "NES 2.0 without work RAM", flags7: 0x08, want: []uint16{0x0010}},
+		{name: "NES 2.0 work RAM", flags7: 0x08, ram: 0x07, want: []uint16{0x0010, 0x6000}},
+		{name: "battery without save", flags6: 0x02, want: []uint16{0x0010, 0x6000}},
+		{name: "battery restored", flags6: 0x02, battery: true, want: []uint16{0x0010}},
+		{name: "volatile RAM beside battery", flags7: 0x08, ram: 0x77, battery: true, want: []uint16{0x0010, 0x6000}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			console := newTestConsole(t, test.flags6, test.flags7, test.ram)
+			var reads []uint16
+			console.EnableUninitChecker(func(read memory.UninitializedRead) {
+				reads = append(reads, read.Address)
+			})
+			if test.battery {
+				console.Cartridge().LoadBatteryRAM([]uint8{0x12})
+			}
+			console.PowerOn()
+			for i := 0; i < 4; i++ {
+				console.StepInstruction()
+			}
+			if len(reads) != len(test.want) {
+				t.Fatalf("reported %04X, want %04X", reads, test.want)
+			}
+			for i := range reads {
+				if reads[i] != test.want[i] {
+					t.Errorf("reported %04X, want %04X", reads, test.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestUninitCheckerTrainer(t *testing.T) {
+	prg := make([]uint8, 0x4000)
+	copy(prg, []uint8{
+		0xAD, 0x00, 0x70, // LDA $7000
+		0xAD, 0xFF, 0x71, // LDA $71FF
+		0xAD, 0x00, 0x72, // LDA $7200
+		0x4C, 0x09, 0x80, // JMP *
+	})
+	prg[0x3FFC], prg[0x3FFD] = 0x00, 0x80
+	// A NES 2.0 header with a trainer and no work RAM.
+	header := []uint8{'N', 'E', 'S', 0x1A, 1, 0, 0x04, 0x08, 0, 0, 0, 0, 0, 0, 0, 0}
+	data := append(append(header, make([]uint8, cartridge.TrainerSize)...), prg...)
+	cart, err := cartridge.ParseWithOptions(data, cartridge.LoadOptions{DisableDatabase: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	console := NewConsole(cart)
+	var reads []uint16
+	console.EnableUninitChecker(func(read memory.UninitializedRead) {
+		reads = append(reads, read.Address)
+	})
+	console.PowerOn()
+	for i := 0; i < 4; i++ {
+		console.StepInstruction()
+	}
+	if len(reads) != 1 || reads[0] != 0x7200 {
+		t.Errorf("reported %04X, want [7200]", reads)
+	}
+}
+
+func TestMMC1IgnoresReadModifyWriteSecondWrite(t *testing.T) {
+	prg := make([]uint8, 0x8000)
+	prg[0] = 0x01 // the byte INC $8000 reads and writes back
+	program := []uint8{
+		0xA9, 0x80, 0x8D, 0x00, 0x80, // LDA #$80; STA $8000: reset the shift register
+		0xEE, 0x00, 0x80, // INC $8000: writes $01, then $02
+		0xA9, 0x01, 0x8D, 0x00, 0x80, // LDA #1; STA $8000
+		0xA9, 0x00, 0x8D, 0x00, 0x80, // LDA #0; STA $8000, three times
+		0x8D, 0x00, 0x80,
+		0x8D, 0x00, 0x80,
+		0x4C, 0x18, 0xC0, // JMP *
+	}
+	copy(prg[0x4000:], program)
+	prg[0x7FFC], prg[0x7FFD] = 0x00, 0xC0
+	header := []uint8{'N', 'E', 'S', 0x1A, 2, 0, 0x10, 0x08, 0, 0, 0, 0x07, 0, 0, 0, 0}
+	cart, err := cartridge.ParseWithOptions(append(header, prg...), cartridge.LoadOptions{DisableDatabase: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	console := NewConsole(cart)
+	console.PowerOn()
+	for i := 0; i < 10; i++ {
+		console.StepInstruction()
+	}
+	// The control register received 1, 1, 0, 0, 0: horizontal mirroring.
+	// Taking INC's second write as well would have loaded 1, 0, 1, 0, 0.
+	if got := cart.Mapper().Mirroring(); got != cartridge.MirrorHorizontal {
+		t.Errorf("mirroring = %v, want horizontal", got)
+	}
+}
@@ -0,0 +1,61 @@
+package nes
+
+// CPU-side registers in $4000-$4017 that do not belong to the APU.
+const (
+	oamDMAAddress      = 0x4014
+	apuStatusAddress   = 0x4015
+	controller1Address = 0x4016
+	controller2Address = 0x4017
+)
+
+// oamDMACycles is how long the CPU is halted by an OAM DMA transfer; one
+// more cycle is needed when the transfer starts on an odd CPU cycle.
+const oamDMACycles = 513
+
+// Data lines driven by reads of the I/O registers. Bit 5 of $4015 and the
+// upper three bits of the controller ports are not connected, and the
+// write-only registers drive nothing at all.
+const (
+	apuStatusDriven  = 0xDF
+	controllerDriven = 0x1F
+)
+
+// readIO handles CPU reads from the APU and I/O region.
+func (c *Console) readIO(address uint16) (uint8, uint8) {
+	switch address {
+	case apuStatusAddress:
+		return c.apu.ReadRegister(address), apuStatusDriven
+	case controller1Address:
+		return c.controllers[0].Read(), controllerDriven
+	case controller2Address:
+		return c.controllers[1].Read(), controllerDriven
+	}
+	return 0, 0
+}
+
+// writeIO handles CPU writes to the APU and I/O region. $4017 is shared:
+// writes go to the APU frame counter, reads come from controller 2.
+func (c *Console) writeIO(address uint16, data uint8) {
+	switch address {
+	case oamDMAAddress:
+		c.oamDMA(data)
+	case controller1Address:
+		c.controllers[0].Write(data)
+		c.controllers[1].Write(data)
+	default:
+		c.apu.WriteRegister(address, data)
+	}
+}
+
+// oamDMA copies a 256-byte page of CPU memory into the PPU's sprite memory.
+func (c *Console) oamDMA(page uint8) {
+	address := uint16(page) << 8
+	for i := 0; i < 256; i++ {
+		c.ppu.WriteOAM(c.memory.Read(address + uint16(i)))
+	}
+	stall := oamDMACycles
+	if c.cpu.Cycles()%2 == 1 {
+		stall++
+	}
+	c.cpu.Stall(stall)
+}
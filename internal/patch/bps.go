@@ -0,0 +1,111 @@
+package patch
+
+// BPS actions, in the low two bits of each action number.
+const (
+	bpsSourceRead = iota
+	bpsTargetRead
+	bpsSourceCopy
+	bpsTargetCopy
+)
+
+// applyBPS applies a BPS patch: the source, target and metadata sizes, the
+// metadata, then actions that build the target from the source at the same
+// position, from literal bytes, or by copying from anywhere in the source
+// or the target written so far, then the CRC32s of source, target and
+// patch.
+func applyBPS(source, patch []byte) ([]byte, error) {
+	body, err := verifyFooter(source, patch)
+	if err != nil {
+		return nil, err
+	}
+	r := reader{data: body[len(magics[BPS]):]}
+	sourceSize := r.number()
+	targetSize := r.number()
+	metadataSize := r.number()
+	if r.err != nil || sourceSize != uint64(len(source)) || targetSize > maxSize || metadataSize > uint64(len(r.data)) {
+		return nil, ErrCorrupt
+	}
+	r.data = r.data[metadataSize:]
+
+	target := make([]byte, 0, targetSize)
+	var sourceOffset, targetOffset int64
+	for len(r.data) > 0 {
+		action := r.number()
+		length := int(action>>2) + 1
+		if r.err != nil || uint64(len(target)+length) > targetSize {
+			return nil, ErrCorrupt
+		}
+		switch action & 3 {
+		case bpsSourceRead:
+			at := len(target)
+			if at+length > len(source) {
+				return nil, ErrCorrupt
+			}
+			target = append(target, source[at:at+length]...)
+		case bpsTargetRead:
+			if length > len(r.data) {
+				return nil, ErrCorrupt
+			}
+			target = append(target, r.data[:length]...)
+			r.data = r.data[length:]
+		case bpsSourceCopy:
+			sourceOffset += r.offset()
+			if r.err != nil || sourceOffset < 0 || sourceOffset+int64(length) > int64(len(source)) {
+				return nil, ErrCorrupt
+			}
+			target = append(target, source[sourceOffset:sourceOffset+int64(length)]...)
+			sourceOffset += int64(length)
+		case bpsTargetCopy:
+			targetOffset += r.offset()
+			if r.err != nil || targetOffset < 0 || targetOffset >= int64(len(target)) {
+				return nil, ErrCorrupt
+			}
+			// The copy may overlap the bytes it produces, so go one at a time.
+			for i := 0; i < length; i++ {
+				target = append(target, target[targetOffset])
+				targetOffset++
+			}
+		}
+	}
+	if uint64(len(target)) != targetSize {
+		return nil, ErrCorrupt
+	}
+	return target, checkTarget(patch, target)
+}
+
+// offset decodes a signed relative offset: the magnitude shifted left by
+// one with the sign in bit 0.
+func (r *reader) offset() int64 {
+	value := r.number()
+	if value&1 != 0 {
+		return -int64(value >> 1)
+	}
+	return int64(value >> 1)
+}
+
+// createBPS writes a linear patch: runs that match the source in place are
+// source reads and the rest is literal target data.
+func createBPS(source, target []byte) []byte {
+	patch := append([]byte(nil), magics[BPS]...)
+	patch = appendNumber(patch, uint64(len(source)))
+	patch = appendNumber(patch, uint64(len(target)))
+	patch = appendNumber(patch, 0)
+	matches := func(i int) bool {
+		return i < len(source) && source[i] == target[i]
+	}
+	for i := 0; i < len(target); {
+		start := i
+		match := matches(i)
+		for i < len(target) && matches(i) == match {
+			i++
+		}
+		length := uint64(i - start)
+		if match {
+			patch = appendNumber(patch, (length-1)<<2|bpsSourceRead)
+		} else {
+			patch = appendNumber(patch, (length-1)<<2|bpsTargetRead)
+			patch = append(patch, target[start:i]...)
+		}
+	}
+	return appendFooter(patch, source, target)
+}
@@ -0,0 +1,124 @@
+package patch
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Limits of the IPS format.
+const (
+	ipsMaxOffset = 0xFFFFFF
+	ipsMaxRecord = 0xFFFF
+	// ipsEOFOffset spells "EOF", so a record cannot start there.
+	ipsEOFOffset = 0x454F46
+)
+
+var ipsEOF = []byte("EOF")
+
+var errIPSTooLarge = errors.New("patch: target too large for IPS")
+
+// applyIPS applies an IPS patch: records of a 3-byte offset and a 2-byte
+// length followed by the data, or by a 2-byte count and a fill byte when the
+// length is 0, up to "EOF" and an optional 3-byte truncated size.
+func applyIPS(source, patch []byte) ([]byte, error) {
+	target := append([]byte(nil), source...)
+	p := patch[len(magics[IPS]):]
+	for {
+		if len(p) < 3 {
+			return nil, ErrCorrupt
+		}
+		if string(p[:3]) == string(ipsEOF) {
+			p = p[3:]
+			break
+		}
+		if len(p) < 5 {
+			return nil, ErrCorrupt
+		}
+		offset := int(p[0])<<16 | int(binary.BigEndian.Uint16(p[1:]))
+		size := int(binary.BigEndian.Uint16(p[3:]))
+		p = p[5:]
+
+		var data []byte
+		if size == 0 {
+			if len(p) < 3 {
+				return nil, ErrCorrupt
+			}
+			count := int(binary.BigEndian.Uint16(p))
+			data = make([]byte, count)
+			for i := range data {
+				data[i] = p[2]
+			}
+			p = p[3:]
+		} else {
+			if len(p) < size {
+				return nil, ErrCorrupt
+			}
+			data, p = p[:size], p[size:]
+		}
+		if end := offset + len(data); end > len(target) {
+			target = append(target, make([]byte, end-len(target))...)
+		}
+		copy(target[offset:], data)
+	}
+	if len(p) >= 3 {
+		size := int(p[0])<<16 | int(binary.BigEndian.Uint16(p[1:]))
+		if size <= len(target) {
+			target = target[:size]
+		}
+	}
+	return target, nil
+}
+
+// createIPS writes a record for every run of differing bytes, using fill
+// records for long runs of one value.
+func createIPS(source, target []byte) ([]byte, error) {
+	if len(target) > ipsMaxOffset+1 {
+		return nil, errIPSTooLarge
+	}
+	patch := append([]byte(nil), magics[IPS]...)
+	differs := func(i int) bool {
+		return i >= len(source) || source[i] != target[i]
+	}
+	for i := 0; i < len(target); {
+		if !differs(i) {
+			i++
+			continue
+		}
+		start := i
+		if start == ipsEOFOffset {
+			// Start a byte early rather than write "EOF" as an offset.
+			start--
+		}
+		end := i
+		for end < len(target) && end-start < ipsMaxRecord && differs(end) {
+			end++
+		}
+		patch = appendIPSRecord(patch, start, target[start:end])
+		i = end
+	}
+	if len(target) < len(source) {
+		patch = append(patch, ipsEOF...)
+		patch = append(patch, byte(len(target)>>16), byte(len(target)>>8), byte(len(target)))
+		return patch, nil
+	}
+	return append(patch, ipsEOF...), nil
+}
+
+// ipsMinFill is the shortest run written as a fill record.
+const ipsMinFill = 8
+
+func appendIPSRecord(patch []byte, offset int, data []byte) []byte {
+	header := func(offset, size int) {
+		patch = append(patch, byte(offset>>16), byte(offset>>8), byte(offset), byte(size>>8), byte(size))
+	}
+	run := 1
+	for run < len(data) && data[run] == data[0] {
+		run++
+	}
+	if run == len(data) && run >= ipsMinFill {
+		header(offset, 0)
+		return append(patch, byte(run>>8), byte(run), data[0])
+	}
+	header(offset, len(data))
+	return append(patch, data...)
+}
@@ -0,0 +1,151 @@
+// Package patch applies and creates soft patches for ROM images in the IPS,
+// UPS and BPS formats.
+//
+// IPS records replace bytes at fixed offsets and carry no checksums. UPS
+// stores the XOR of changed bytes and BPS a list of copy and insert
+// actions; both end with CRC32s of the source, the target and the patch
+// itself, which Apply verifies.
+package patch
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Format is a patch file format.
+type Format int
+
+const (
+	IPS Format = iota
+	UPS
+	BPS
+)
+
+// Formats lists the supported formats in the order sibling patch files are
+// looked for: the checksummed formats first.
+var Formats = []Format{BPS, UPS, IPS}
+
+func (f Format) String() string {
+	switch f {
+	case IPS:
+		return "IPS"
+	case UPS:
+		return "UPS"
+	case BPS:
+		return "BPS"
+	}
+	return fmt.Sprintf("Format(%d)", int(f))
+}
+
+// Extension returns the file extension of the format, such as ".ips".
+func (f Format) Extension() string {
+	return "." + strings.ToLower(f.String())
+}
+
+// ParseFormat returns the format named "ips", "ups" or "bps".
+func ParseFormat(name string) (Format, error) {
+	for _, format := range Formats {
+		if strings.EqualFold(name, format.String()) {
+			return format, nil
+		}
+	}
+	return 0, fmt.Errorf("patch: unknown format %q", name)
+}
+
+var (
+	// ErrUnknownFormat is returned for data that is not a patch in any
+	// supported format.
+	ErrUnknownFormat = errors.New("patch: unrecognized patch format")
+	// ErrCorrupt is returned for patches that end early or contain
+	// impossible offsets.
+	ErrCorrupt = errors.New("patch: patch data is corrupt")
+)
+
+// ChecksumError is returned when a UPS or BPS checksum does not match,
+// which usually means the patch was made for a different ROM.
+type ChecksumError struct {
+	// What is "source", "target" or "patch".
+	What       string
+	Want, Have uint32
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("patch: %s checksum mismatch: want %08X, have %08X", e.What, e.Want, e.Have)
+}
+
+var magics = map[Format][]byte{
+	IPS: []byte("PATCH"),
+	UPS: []byte("UPS1"),
+	BPS: []byte("BPS1"),
+}
+
+// Detect returns the format of patch data from its signature.
+func Detect(patch []byte) (Format, error) {
+	for _, format := range Formats {
+		if bytes.HasPrefix(patch, magics[format]) {
+			return format, nil
+		}
+	}
+	return 0, ErrUnknownFormat
+}
+
+// Apply returns source with patch applied, detecting the patch format from
+// its signature. source is not modified.
+func Apply(source, patch []byte) ([]byte, error) {
+	format, err := Detect(patch)
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case IPS:
+		return applyIPS(source, patch)
+	case UPS:
+		return applyUPS(source, patch)
+	default:
+		return applyBPS(source, patch)
+	}
+}
+
+// Create returns a patch in format that turns source into target.
+func Create(format Format, source, target []byte) ([]byte, error) {
+	switch format {
+	case IPS:
+		return createIPS(source, target)
+	case UPS:
+		return createUPS(source, target), nil
+	case BPS:
+		return createBPS(source, target), nil
+	}
+	return nil, fmt.Errorf("patch: unknown format %v", format)
+}
+
+// ApplyFile applies the patch file at path to source.
+func ApplyFile(source []byte, path string) ([]byte, error) {
+	patch, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	patched, err := Apply(source, patch)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%s)", err, path)
+	}
+	return patched, nil
+}
+
+// FindSibling returns the patch file next to romPath with the same name and
+// a patch extension, such as game.ips for game.nes, or "" if there is none.
+// When several exist the first in Formats wins.
+func FindSibling(romPath string) string {
+	base := strings.TrimSuffix(romPath, filepath.Ext(romPath))
+	for _, format := range Formats {
+		path := base + format.Extension()
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			return path
+		}
+	}
+	return ""
+}
@@ -0,0 +1,146 @@
+package patch
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// pattern returns size bytes of a repeating, non-constant pattern.
+func pattern(size, seed int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i*7 + seed)
+	}
+	return data
+}
+
+// modified returns a copy of data resized to size, with a few runs of
+// bytes changed.
+func modified(data []byte, size int) []byte {
+	target := make([]byte, size)
+	copy(target, data)
+	for _, at := range []int{0, 100, 101, 102, 500} {
+		if at < size {
+			target[at] ^= 0x5A
+		}
+	}
+	for i := 200; i < 240 && i < size; i++ {
+		target[i] = 0xEE
+	}
+	for i := len(data); i < size; i++ {
+		target[i] = byte(i)
+	}
+	return target
+}
+
+func TestRoundTrip(t *testing.T) {
+	source := pattern(1024, 3)
+	tests := []struct {
+		name           string
+		source, target []byte
+	}{
+		{"identical", source, source},
+		{"same size", source, modified(source, len(source))},
+		{"smaller", source, modified(source, 600)},
+		{"larger", source, modified(source, 1500)},
+		{"empty source", nil, pattern(300, 1)},
+		{"empty target", source, []byte{}},
+	}
+	for _, format := range Formats {
+		for _, tt := range tests {
+			t.Run(format.String()+"/"+tt.name, func(t *testing.T) {
+				patch, err := Create(format, tt.source, tt.target)
+				if err != nil {
+					t.Fatalf("Create: %v", err)
+				}
+				if got, err := Detect(patch); err != nil || got != format {
+					t.Errorf("Detect = %v, %v; want %v", got, err, format)
+				}
+				got, err := Apply(tt.source, patch)
+				if err != nil {
+					t.Fatalf("Apply: %v", err)
+				}
+				if !bytes.Equal(got, tt.target) {
+					t.Errorf("Apply produced %d bytes that differ from the %d-byte target", len(got), len(tt.target))
+				}
+			})
+		}
+	}
+}
+
+func TestIPSEOFOffset(t *testing.T) {
+	source := make([]byte, ipsEOFOffset+16)
+	target := append([]byte(nil), source...)
+	target[ipsEOFOffset] = 1
+	target[ipsEOFOffset+1] = 2
+
+	patch, err := Create(IPS, source, target)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if record := patch[len(magics[IPS]):]; bytes.HasPrefix(record, ipsEOF) {
+		t.Fatal("the patch has a record at offset \"EOF\"")
+	}
+	got, err := Apply(source, patch)
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if !bytes.Equal(got, target) {
+		t.Error("Apply did not reproduce the target")
+	}
+}
+
+func TestChecksumError(t *testing.T) {
+	source := pattern(512, 0)
+	target := modified(source, len(source))
+	other := modified(source, len(source)+1)[1:]
+	for _, format := range []Format{UPS, BPS} {
+		patch, err := Create(format, source, target)
+		if err != nil {
+			t.Fatalf("%v: Create: %v", format, err)
+		}
+		_, err = Apply(other, patch)
+		var checksum *ChecksumError
+		if !errors.As(err, &checksum) || checksum.What != "source" {
+			t.Errorf("%v: Apply to the wrong source: %v, want a source ChecksumError", format, err)
+		}
+
+		patch[len(patch)-13] ^= 1
+		_, err = Apply(source, patch)
+		if !errors.As(err, &checksum) || checksum.What != "patch" {
+			t.Errorf("%v: Apply of a damaged patch: %v, want a patch ChecksumError", format, err)
+		}
+	}
+}
+
+func TestTruncated(t *testing.T) {
+	source := pattern(512, 0)
+	target := modified(source, len(source))
+	for _, format := range Formats {
+		patch, err := Create(format, source, target)
+		if err != nil {
+			t.Fatalf("%v: Create: %v", format, err)
+		}
+		for n := len(magics[format]); n < len(patch); n++ {
+			cut := patch[:n]
+			if format != IPS && n >= len(magics[format])+12 {
+				// Give the truncated body a valid footer so the damage is
+				// found by decoding rather than by the patch checksum.
+				body := patch[:n-12]
+				cut = appendFooter(append([]byte(nil), body...), source, target)
+			}
+			_, err := Apply(source, cut)
+			var checksum *ChecksumError
+			if !errors.Is(err, ErrCorrupt) && !(errors.As(err, &checksum) && checksum.What == "target") {
+				t.Errorf("%v truncated to %d of %d bytes: %v, want ErrCorrupt", format, n, len(patch), err)
+			}
+		}
+	}
+}
+
+func TestApplyUnknownFormat(t *testing.T) {
+	if _, err := Apply(nil, []byte("NOT A PATCH")); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("Apply = %v, want ErrUnknownFormat", err)
+	}
+}
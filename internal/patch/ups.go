@@ -0,0 +1,161 @@
+package patch
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+)
+
+// applyUPS applies a UPS patch: the source and target sizes, then hunks of
+// a skip count followed by bytes XORed with the source up to a terminating
+// 0, then the CRC32s of source, target and patch.
+func applyUPS(source, patch []byte) ([]byte, error) {
+	body, err := verifyFooter(source, patch)
+	if err != nil {
+		return nil, err
+	}
+	r := reader{data: body[len(magics[UPS]):]}
+	sourceSize := r.number()
+	targetSize := r.number()
+	if r.err != nil || sourceSize != uint64(len(source)) || targetSize > maxSize {
+		return nil, ErrCorrupt
+	}
+	target := make([]byte, targetSize)
+	copy(target, source)
+	position := uint64(0)
+	for r.err == nil && len(r.data) > 0 {
+		position += r.number()
+		for {
+			x := r.byte()
+			if r.err != nil || x == 0 {
+				position++
+				break
+			}
+			if position < targetSize {
+				target[position] ^= x
+			}
+			position++
+		}
+	}
+	if r.err != nil {
+		return nil, ErrCorrupt
+	}
+	return target, checkTarget(patch, target)
+}
+
+func createUPS(source, target []byte) []byte {
+	patch := append([]byte(nil), magics[UPS]...)
+	patch = appendNumber(patch, uint64(len(source)))
+	patch = appendNumber(patch, uint64(len(target)))
+	at := func(data []byte, i int) byte {
+		if i < len(data) {
+			return data[i]
+		}
+		return 0
+	}
+	last := 0
+	for i := 0; i < len(target); {
+		x := at(source, i) ^ target[i]
+		if x == 0 {
+			i++
+			continue
+		}
+		patch = appendNumber(patch, uint64(i-last))
+		for ; i < len(target); i++ {
+			x := at(source, i) ^ target[i]
+			if x == 0 {
+				break
+			}
+			patch = append(patch, x)
+		}
+		patch = append(patch, 0)
+		i++
+		last = i
+	}
+	return appendFooter(patch, source, target)
+}
+
+// verifyFooter checks the source and patch CRC32s at the end of a UPS or
+// BPS patch and returns the patch without its footer.
+func verifyFooter(source, patch []byte) ([]byte, error) {
+	if len(patch) < 4+12 {
+		return nil, ErrCorrupt
+	}
+	footer := patch[len(patch)-12:]
+	if want, have := binary.LittleEndian.Uint32(footer[8:]), crc32.ChecksumIEEE(patch[:len(patch)-4]); want != have {
+		return nil, &ChecksumError{What: "patch", Want: want, Have: have}
+	}
+	if want, have := binary.LittleEndian.Uint32(footer), crc32.ChecksumIEEE(source); want != have {
+		return nil, &ChecksumError{What: "source", Want: want, Have: have}
+	}
+	return patch[:len(patch)-12], nil
+}
+
+// checkTarget checks the target CRC32 in the footer of a UPS or BPS patch.
+func checkTarget(patch, target []byte) error {
+	footer := patch[len(patch)-12:]
+	if want, have := binary.LittleEndian.Uint32(footer[4:]), crc32.ChecksumIEEE(target); want != have {
+		return &ChecksumError{What: "target", Want: want, Have: have}
+	}
+	return nil
+}
+
+func appendFooter(patch, source, target []byte) []byte {
+	patch = binary.LittleEndian.AppendUint32(patch, crc32.ChecksumIEEE(source))
+	patch = binary.LittleEndian.AppendUint32(patch, crc32.ChecksumIEEE(target))
+	return binary.LittleEndian.AppendUint32(patch, crc32.ChecksumIEEE(patch))
+}
+
+// maxSize bounds the target sizes accepted from UPS and BPS headers, so a
+// corrupt patch cannot ask for an enormous allocation.
+const maxSize = 1 << 30
+
+// reader decodes the variable-length numbers shared by UPS and BPS. The
+// first error sticks and further reads return 0.
+type reader struct {
+	data []byte
+	err  error
+}
+
+func (r *reader) byte() byte {
+	if len(r.data) == 0 {
+		r.err = ErrCorrupt
+		return 0
+	}
+	b := r.data[0]
+	r.data = r.data[1:]
+	return b
+}
+
+// number decodes a number stored 7 bits per byte, least significant first,
+// with the top bit marking the last byte and each continuation adding one
+// so that every number has a single encoding.
+func (r *reader) number() uint64 {
+	var value uint64
+	shift := uint64(1)
+	for i := 0; i < 10; i++ {
+		x := r.byte()
+		if r.err != nil {
+			return 0
+		}
+		value += uint64(x&0x7F) * shift
+		if x&0x80 != 0 {
+			return value
+		}
+		shift <<= 7
+		value += shift
+	}
+	r.err = ErrCorrupt
+	return 0
+}
+
+func appendNumber(data []byte, value uint64) []byte {
+	for {
+		x := byte(value & 0x7F)
+		value >>= 7
+		if value == 0 {
+			return append(data, 0x80|x)
+		}
+		data = append(data, x)
+		value--
+	}
+}
@@ -1,23 +1,409 @@
 package ppu
 
+import (
+	"encoding/gob"
+	"image"
+
+	"github.com/tejasdeepakmasne/NESemu/internal/savestate"
+)
+
+// Cartridge is the PPU's view of the game cartridge, which decodes the
+// pattern tables and nametables at $0000-$3EFF. Nametable RAM sits in the
+// console, but the cartridge decides which of its two banks, if any, each
+// address selects. Every PPU memory access, including each rendering fetch
+// in hardware order, goes through the cartridge, so mappers can watch the
+// address bus the way latch- and A12-based boards do.
+type Cartridge interface {
+	ReadPPUByte(address uint16) uint8
+	WritePPUByte(address uint16, data uint8)
+}
+
+// RenderWatcher is implemented by cartridges that follow the progress of
+// rendering, as MMC5 does by decoding the pattern of PPU fetches. The PPU
+// calls it directly rather than have every such cartridge decode the bus.
+type RenderWatcher interface {
+	// StartScanline is called at dot 0 of every scanline. rendering is set
+	// when the background or sprites are enabled.
+	StartScanline(scanline int, rendering bool)
+	// SpriteFetches is called with true before the sprite pattern fetches
+	// of a scanline and with false after them.
+	SpriteFetches(active bool)
+}
+
+// NametableRAMSize is the size of the nametable RAM inside the console.
+const NametableRAMSize = 0x0800
+
+// Timing constants for an NTSC PPU.
+const (
+	DotsPerScanline    = 341
+	ScanlinesPerFrame  = 262
+	VBlankScanline     = 241
+	PreRenderScanline  = 261
+	VisibleScanlines   = 240
+	VisibleDotsPerLine = 256
+)
+
 // PPU represents the Picture Processing Unit of the NES.
 type PPU struct {
-	// Define PPU state and registers here
-	// For example:
-	// VRAM []uint8
-	// OAM []uint8
-	// Registers struct { ... }
+	// Current position of the PPU within the frame.
+	cycle    int
+	scanline int
+	frame    uint64
+
+	// Memory owned by the PPU: nametable RAM, palette RAM and object
+	// attribute memory.
+	nametableRAM [NametableRAMSize]uint8
+	paletteRAM   [32]uint8
+	oam          [256]uint8
+
+	cartridge Cartridge
+	watcher   RenderWatcher
+
+	// Memory-mapped registers.
+	ctrl    uint8 // $2000 PPUCTRL
+	mask    uint8 // $2001 PPUMASK
+	status  uint8 // $2002 PPUSTATUS
+	oamAddr uint8 // $2003 OAMADDR
+
+	// Internal scroll and address registers (loopy v, t, x and w).
+	v uint16
+	t uint16
+	x uint8
+	w bool
+
+	// readBuffer holds the delayed result of $2007 reads below the palette.
+	readBuffer uint8
+	// register is the PPU's I/O latch: the last value driven on its data
+	// bus, which is what the write-only registers and unused status bits
+	// read back as. Each bit decays to 0 if it is not refreshed.
+	register       uint8
+	latchRefreshed [8]uint64
+
+	nmiPrevious bool
+	onNMI       func()
+
+	renderState
+
+	// front holds the last completed frame while back is being drawn.
+	front *image.RGBA
+	back  *image.RGBA
 }
 
+// Flags in PPUCTRL, PPUMASK and PPUSTATUS.
+const (
+	ctrlIncrement32     = 1 << 2
+	ctrlSpriteTable     = 1 << 3
+	ctrlBackgroundTable = 1 << 4
+	ctrlSpriteSize      = 1 << 5
+	ctrlNMIEnable       = 1 << 7
+
+	maskGrayscale          = 1 << 0
+	maskShowBackgroundLeft = 1 << 1
+	maskShowSpritesLeft    = 1 << 2
+	maskShowBackground     = 1 << 3
+	maskShowSprites        = 1 << 4
+
+	statusSpriteOverflow = 1 << 5
+	statusSpriteZeroHit  = 1 << 6
+	statusVBlank         = 1 << 7
+)
+
+// latchDecayFrames is roughly how long, in frames, a bit of the I/O latch
+// holds its value without being refreshed (about 600ms).
+const latchDecayFrames = 36
+
 // NewPPU creates and initializes a new PPU instance.
 func NewPPU() *PPU {
 	ppu := &PPU{
-		// Initialize PPU state and registers here
+		front: image.NewRGBA(image.Rect(0, 0, VisibleDotsPerLine, VisibleScanlines)),
+		back:  image.NewRGBA(image.Rect(0, 0, VisibleDotsPerLine, VisibleScanlines)),
 	}
+	ppu.Reset()
 	return ppu
 }
 
+// Reset puts the PPU in its power-up state at the top of the frame. The
+// frame counter keeps running, as the I/O latch decay is timed by it.
+func (p *PPU) Reset() {
+	p.cycle = 0
+	p.scanline = 0
+	p.ctrl = 0
+	p.mask = 0
+	p.oamAddr = 0
+	p.w = false
+	p.readBuffer = 0
+}
+
+// PowerOn fills nametable, palette and sprite memory using fill, clears the
+// frame counter and I/O latch, and then resets the PPU.
+func (p *PPU) PowerOn(fill func(buf []uint8)) {
+	fill(p.nametableRAM[:])
+	fill(p.paletteRAM[:])
+	for i := range p.paletteRAM {
+		p.paletteRAM[i] &= 0x3F
+	}
+	fill(p.oam[:])
+	p.frame = 0
+	p.register = 0
+	p.latchRefreshed = [8]uint64{}
+	p.Reset()
+}
+
+// ConnectCartridge attaches the cartridge that decodes pattern table and
+// nametable addresses.
+func (p *PPU) ConnectCartridge(cartridge Cartridge) {
+	p.cartridge = cartridge
+	p.watcher, _ = cartridge.(RenderWatcher)
+}
+
+// NametableRAM returns the console's nametable RAM for the cartridge to
+// map into the PPU address space.
+func (p *PPU) NametableRAM() []uint8 {
+	return p.nametableRAM[:]
+}
+
+// OnNMI registers the function called when the PPU raises an NMI.
+func (p *PPU) OnNMI(handler func()) {
+	p.onNMI = handler
+}
+
+// Frame returns the number of frames completed since power-on.
+func (p *PPU) Frame() uint64 {
+	return p.frame
+}
+
+// Scanline returns the current scanline, 0-261.
+func (p *PPU) Scanline() int {
+	return p.scanline
+}
+
+// Cycle returns the current dot within the scanline, 0-340.
+func (p *PPU) Cycle() int {
+	return p.cycle
+}
+
+// Buffer returns the most recently completed frame. The image is reused for
+// later frames, so callers that keep it must copy it.
+func (p *PPU) Buffer() *image.RGBA {
+	return p.front
+}
+
+// Step advances the PPU by one dot.
+func (p *PPU) Step() {
+	p.tick()
+
+	if p.cycle == 0 && p.watcher != nil {
+		p.watcher.StartScanline(p.scanline, p.renderingEnabled())
+	}
+	if p.renderingEnabled() {
+		p.render()
+	}
+
+	if p.scanline == VBlankScanline && p.cycle == 1 {
+		p.front, p.back = p.back, p.front
+		p.status |= statusVBlank
+		p.updateNMI()
+	}
+	if p.scanline == PreRenderScanline && p.cycle == 1 {
+		p.status &^= statusVBlank | statusSpriteZeroHit | statusSpriteOverflow
+		p.updateNMI()
+	}
+}
+
+// tick moves to the next dot, skipping the last dot of the pre-render line
+// on odd frames while rendering is enabled.
+func (p *PPU) tick() {
+	if p.renderingEnabled() && p.frame%2 == 1 && p.scanline == PreRenderScanline && p.cycle == 339 {
+		p.cycle = 0
+		p.scanline = 0
+		p.frame++
+		return
+	}
+
+	p.cycle++
+	if p.cycle == DotsPerScanline {
+		p.cycle = 0
+		p.scanline++
+		if p.scanline == ScanlinesPerFrame {
+			p.scanline = 0
+			p.frame++
+		}
+	}
+}
+
+func (p *PPU) renderingEnabled() bool {
+	return p.mask&(maskShowBackground|maskShowSprites) != 0
+}
+
+// updateNMI raises an NMI on the rising edge of (vblank && NMI enabled).
+func (p *PPU) updateNMI() {
+	nmi := p.status&statusVBlank != 0 && p.ctrl&ctrlNMIEnable != 0
+	if nmi && !p.nmiPrevious && p.onNMI != nil {
+		p.onNMI()
+	}
+	p.nmiPrevious = nmi
+}
+
+// ReadRegister reads one of the eight PPU registers at $2000-$2007. Only the
+// low three bits of the address are decoded.
+func (p *PPU) ReadRegister(address uint16) uint8 {
+	switch address & 0x0007 {
+	case 0x0002:
+		p.refreshLatch(p.status, 0xE0)
+		p.status &^= statusVBlank
+		p.updateNMI()
+		p.w = false
+	case 0x0004:
+		p.refreshLatch(p.oam[p.oamAddr], 0xFF)
+	case 0x0007:
+		address := p.v & 0x3FFF
+		if address < 0x3F00 {
+			p.refreshLatch(p.readBuffer, 0xFF)
+			p.readBuffer = p.Read(address)
+		} else {
+			// Palette reads are not buffered, but the buffer is still
+			// filled with the nametable byte underneath the palette.
+			p.refreshLatch(p.Read(address), 0x3F)
+			p.readBuffer = p.Read(address - 0x1000)
+		}
+		p.incrementAddress()
+	}
+	return p.latch()
+}
+
+// refreshLatch drives the bits of data selected by mask into the I/O latch.
+func (p *PPU) refreshLatch(data, mask uint8) {
+	p.register = (p.register &^ mask) | (data & mask)
+	for bit := 0; bit < 8; bit++ {
+		if mask&(1<<bit) != 0 {
+			p.latchRefreshed[bit] = p.frame
+		}
+	}
+}
+
+// latch returns the I/O latch after letting stale bits decay.
+func (p *PPU) latch() uint8 {
+	for bit := 0; bit < 8; bit++ {
+		if p.frame-p.latchRefreshed[bit] > latchDecayFrames {
+			p.register &^= 1 << bit
+		}
+	}
+	return p.register
+}
+
+// WriteRegister writes one of the eight PPU registers at $2000-$2007.
+func (p *PPU) WriteRegister(address uint16, data uint8) {
+	p.refreshLatch(data, 0xFF)
+	switch address & 0x0007 {
+	case 0x0000:
+		p.ctrl = data
+		p.t = (p.t & 0xF3FF) | (uint16(data)&0x03)<<10
+		p.updateNMI()
+	case 0x0001:
+		p.mask = data
+	case 0x0003:
+		p.oamAddr = data
+	case 0x0004:
+		p.oam[p.oamAddr] = data
+		p.oamAddr++
+	case 0x0005:
+		if !p.w {
+			p.t = (p.t & 0xFFE0) | uint16(data)>>3
+			p.x = data & 0x07
+		} else {
+			p.t = (p.t & 0x8FFF) | (uint16(data)&0x07)<<12
+			p.t = (p.t & 0xFC1F) | (uint16(data)&0xF8)<<2
+		}
+		p.w = !p.w
+	case 0x0006:
+		if !p.w {
+			p.t = (p.t & 0x00FF) | (uint16(data)&0x3F)<<8
+		} else {
+			p.t = (p.t & 0xFF00) | uint16(data)
+			p.v = p.t
+		}
+		p.w = !p.w
+	case 0x0007:
+		p.Write(p.v&0x3FFF, data)
+		p.incrementAddress()
+	}
+}
+
+// WriteOAM writes one byte of an OAM DMA transfer.
+func (p *PPU) WriteOAM(data uint8) {
+	p.oam[p.oamAddr] = data
+	p.oamAddr++
+}
+
+func (p *PPU) incrementAddress() {
+	if p.ctrl&ctrlIncrement32 != 0 {
+		p.v += 32
+	} else {
+		p.v++
+	}
+}
+
+// Read reads a byte from the PPU address space. Without a cartridge
+// nothing answers below the palette and reads return 0.
+func (p *PPU) Read(address uint16) uint8 {
+	address &= 0x3FFF
+	switch {
+	case address >= 0x3F00:
+		return p.paletteRAM[paletteIndex(address)]
+	case p.cartridge != nil:
+		return p.cartridge.ReadPPUByte(address)
+	}
+	return 0
+}
+
+// Write writes a byte to the PPU address space.
+func (p *PPU) Write(address uint16, data uint8) {
+	address &= 0x3FFF
+	switch {
+	case address >= 0x3F00:
+		p.paletteRAM[paletteIndex(address)] = data & 0x3F
+	case p.cartridge != nil:
+		p.cartridge.WritePPUByte(address, data)
+	}
+}
+
+// paletteIndex maps an address in $3F00-$3FFF to palette RAM. The backdrop
+// entries of the sprite palettes mirror those of the background palettes.
+func paletteIndex(address uint16) uint16 {
+	index := address & 0x001F
+	if index >= 0x10 && index%4 == 0 {
+		index -= 0x10
+	}
+	return index
+}
+
 // RenderFrame renders one frame of the PPU.
 func (p *PPU) RenderFrame() {
-	// Implement frame rendering logic here
+	frame := p.frame
+	for p.frame == frame {
+		p.Step()
+	}
+}
+
+// stateFields lists the PPU state that is captured in save states.
+func (p *PPU) stateFields() []interface{} {
+	return []interface{}{
+		&p.cycle, &p.scanline, &p.frame,
+		&p.nametableRAM, &p.paletteRAM, &p.oam,
+		&p.ctrl, &p.mask, &p.status, &p.oamAddr,
+		&p.v, &p.t, &p.x, &p.w,
+		&p.readBuffer, &p.register, &p.latchRefreshed, &p.nmiPrevious,
+		&p.nametableByte, &p.attributeByte, &p.lowTileByte, &p.highTileByte, &p.tileData,
+		&p.spriteCount, &p.spritePatterns, &p.spritePosition, &p.spritePriority, &p.spriteIndex,
+	}
+}
+
+// Save writes the PPU state to encoder.
+func (p *PPU) Save(encoder *gob.Encoder) error {
+	return savestate.Encode(encoder, p.stateFields()...)
+}
+
+// Load restores PPU state written by Save.
+func (p *PPU) Load(decoder *gob.Decoder) error {
+	return savestate.Decode(decoder, p.stateFields()...)
 }
@@ -0,0 +1,37 @@
+package ppu
+
+import "testing"
+
+func TestLatchAcrossReset(t *testing.T) {
+	p := NewPPU()
+	p.frame = 100
+	p.WriteRegister(0x2003, 0xA5)
+	p.Reset()
+	if p.Frame() != 100 {
+		t.Errorf("Frame() = %d after reset, want 100", p.Frame())
+	}
+	if got := p.ReadRegister(0x2000); got != 0xA5 {
+		t.Errorf("latch = $%02X after reset, want $A5", got)
+	}
+
+	p.frame += latchDecayFrames
+	if got := p.ReadRegister(0x2000); got != 0xA5 {
+		t.Errorf("latch = $%02X after %d frames, want $A5", got, latchDecayFrames)
+	}
+	p.frame++
+	if got := p.ReadRegister(0x2000); got != 0 {
+		t.Errorf("latch = $%02X after decay, want $00", got)
+	}
+}
+
+func TestLatchPartialRefresh(t *testing.T) {
+	p := NewPPU()
+	p.WriteRegister(0x2003, 0xFF)
+	p.frame = latchDecayFrames
+	// Reading $2002 drives the top three bits and leaves the rest decaying.
+	p.ReadRegister(0x2002)
+	p.frame = latchDecayFrames + 1
+	if got := p.ReadRegister(0x2000); got&0x1F != 0 || got&0xE0 != p.register&0xE0 {
+		t.Errorf("latch = $%02X, want the low five bits decayed", got)
+	}
+}
@@ -0,0 +1,311 @@
+package ppu
+
+// Background and sprite pipeline of the PPU. Background fetches are made
+// on the same dots as on hardware, but sprite evaluation and all eight
+// sprite pattern fetches, dummy fetches of tile $FF included, happen in one
+// burst at dot 257 rather than spread over dots 257-320. Cartridges
+// watching the PPU address bus therefore see the accesses in the order
+// they expect, though not with hardware timing within the sprite fetches.
+
+// renderState holds the shift registers and latches of the rendering pipeline.
+type renderState struct {
+	nametableByte  uint8
+	attributeByte  uint8
+	lowTileByte    uint8
+	highTileByte   uint8
+	tileData       uint64
+	spriteCount    int
+	spritePatterns [8]uint32
+	spritePosition [8]uint8
+	spritePriority [8]uint8
+	spriteIndex    [8]uint8
+}
+
+// render performs the rendering work for the current dot.
+func (p *PPU) render() {
+	preLine := p.scanline == PreRenderScanline
+	visibleLine := p.scanline < VisibleScanlines
+	renderLine := preLine || visibleLine
+	preFetchCycle := p.cycle >= 321 && p.cycle <= 336
+	visibleCycle := p.cycle >= 1 && p.cycle <= VisibleDotsPerLine
+	fetchCycle := preFetchCycle || visibleCycle
+
+	if visibleLine && visibleCycle {
+		p.renderPixel()
+	}
+
+	if renderLine && fetchCycle {
+		p.tileData <<= 4
+		switch p.cycle % 8 {
+		case 1:
+			p.fetchNametableByte()
+		case 3:
+			p.fetchAttributeByte()
+		case 5:
+			p.fetchLowTileByte()
+		case 7:
+			p.fetchHighTileByte()
+		case 0:
+			p.storeTileData()
+		}
+	}
+
+	if preLine && p.cycle >= 280 && p.cycle <= 304 {
+		p.copyY()
+	}
+	if renderLine {
+		if fetchCycle && p.cycle%8 == 0 {
+			p.incrementX()
+		}
+		if p.cycle == 256 {
+			p.incrementY()
+		}
+		if p.cycle == 257 {
+			p.copyX()
+		}
+	}
+
+	if renderLine && p.cycle == 257 {
+		p.evaluateSprites(visibleLine)
+	}
+}
+
+func (p *PPU) fetchNametableByte() {
+	address := 0x2000 | (p.v & 0x0FFF)
+	p.nametableByte = p.Read(address)
+}
+
+func (p *PPU) fetchAttributeByte() {
+	address := 0x23C0 | (p.v & 0x0C00) | ((p.v >> 4) & 0x38) | ((p.v >> 2) & 0x07)
+	shift := ((p.v >> 4) & 4) | (p.v & 2)
+	p.attributeByte = ((p.Read(address) >> shift) & 3) << 2
+}
+
+func (p *PPU) backgroundPatternAddress() uint16 {
+	fineY := (p.v >> 12) & 7
+	table := uint16(0)
+	if p.ctrl&ctrlBackgroundTable != 0 {
+		table = 0x1000
+	}
+	return table + uint16(p.nametableByte)*16 + fineY
+}
+
+func (p *PPU) fetchLowTileByte() {
+	p.lowTileByte = p.Read(p.backgroundPatternAddress())
+}
+
+func (p *PPU) fetchHighTileByte() {
+	p.highTileByte = p.Read(p.backgroundPatternAddress() + 8)
+}
+
+// storeTileData packs the eight 4-bit pixels of the fetched tile into the
+// low half of the background shift register.
+func (p *PPU) storeTileData() {
+	var data uint32
+	for i := 0; i < 8; i++ {
+		p1 := (p.lowTileByte & 0x80) >> 7
+		p2 := (p.highTileByte & 0x80) >> 6
+		p.lowTileByte <<= 1
+		p.highTileByte <<= 1
+		data <<= 4
+		data |= uint32(p.attributeByte | p1 | p2)
+	}
+	p.tileData |= uint64(data)
+}
+
+// incrementX advances coarse X, switching horizontal nametable on wrap.
+func (p *PPU) incrementX() {
+	if p.v&0x001F == 31 {
+		p.v &= 0xFFE0
+		p.v ^= 0x0400
+	} else {
+		p.v++
+	}
+}
+
+// incrementY advances fine Y, carrying into coarse Y and switching vertical
+// nametable after row 29.
+func (p *PPU) incrementY() {
+	if p.v&0x7000 != 0x7000 {
+		p.v += 0x1000
+		return
+	}
+	p.v &= 0x8FFF
+	y := (p.v & 0x03E0) >> 5
+	switch y {
+	case 29:
+		y = 0
+		p.v ^= 0x0800
+	case 31:
+		y = 0
+	default:
+		y++
+	}
+	p.v = (p.v & 0xFC1F) | (y << 5)
+}
+
+func (p *PPU) copyX() {
+	p.v = (p.v & 0xFBE0) | (p.t & 0x041F)
+}
+
+func (p *PPU) copyY() {
+	p.v = (p.v & 0x841F) | (p.t & 0x7BE0)
+}
+
+func (p *PPU) backgroundPixel() uint8 {
+	if p.mask&maskShowBackground == 0 {
+		return 0
+	}
+	data := uint32(p.tileData>>32) >> ((7 - p.x) * 4)
+	return uint8(data & 0x0F)
+}
+
+func (p *PPU) spritePixel() (int, uint8) {
+	if p.mask&maskShowSprites == 0 {
+		return 0, 0
+	}
+	for i := 0; i < p.spriteCount; i++ {
+		offset := (p.cycle - 1) - int(p.spritePosition[i])
+		if offset < 0 || offset > 7 {
+			continue
+		}
+		offset = 7 - offset
+		color := uint8((p.spritePatterns[i] >> uint8(offset*4)) & 0x0F)
+		if color%4 == 0 {
+			continue
+		}
+		return i, color
+	}
+	return 0, 0
+}
+
+func (p *PPU) renderPixel() {
+	x := p.cycle - 1
+	y := p.scanline
+	background := p.backgroundPixel()
+	i, sprite := p.spritePixel()
+	if x < 8 && p.mask&maskShowBackgroundLeft == 0 {
+		background = 0
+	}
+	if x < 8 && p.mask&maskShowSpritesLeft == 0 {
+		sprite = 0
+	}
+	b := background%4 != 0
+	s := sprite%4 != 0
+	var color uint8
+	switch {
+	case !b && !s:
+		color = 0
+	case !b && s:
+		color = sprite | 0x10
+	case b && !s:
+		color = background
+	default:
+		if p.spriteIndex[i] == 0 && x < 255 {
+			p.status |= statusSpriteZeroHit
+		}
+		if p.spritePriority[i] == 0 {
+			color = sprite | 0x10
+		} else {
+			color = background
+		}
+	}
+	index := p.Read(0x3F00+uint16(color)) & 0x3F
+	if p.mask&maskGrayscale != 0 {
+		index &= 0x30
+	}
+	p.back.SetRGBA(x, y, Palette[index])
+}
+
+func (p *PPU) spriteHeight() int {
+	if p.ctrl&ctrlSpriteSize != 0 {
+		return 16
+	}
+	return 8
+}
+
+// spritePatternAddress returns the pattern address of the given row of a
+// sprite tile.
+func (p *PPU) spritePatternAddress(tile, attributes uint8, row int) uint16 {
+	height := p.spriteHeight()
+	if attributes&0x80 != 0 {
+		row = height - 1 - row
+	}
+	if height == 8 {
+		table := uint16(0)
+		if p.ctrl&ctrlSpriteTable != 0 {
+			table = 0x1000
+		}
+		return table + uint16(tile)*16 + uint16(row)
+	}
+	table := uint16(tile&1) * 0x1000
+	tile &= 0xFE
+	if row > 7 {
+		tile++
+		row -= 8
+	}
+	return table + uint16(tile)*16 + uint16(row)
+}
+
+// fetchSpritePattern reads the two bit planes of one sprite row and packs
+// them with the palette bits, flipping horizontally if requested.
+func (p *PPU) fetchSpritePattern(tile, attributes uint8, row int) uint32 {
+	address := p.spritePatternAddress(tile, attributes, row)
+	lowTileByte := p.Read(address)
+	highTileByte := p.Read(address + 8)
+	a := (attributes & 3) << 2
+	var data uint32
+	for i := 0; i < 8; i++ {
+		var p1, p2 uint8
+		if attributes&0x40 == 0x40 {
+			p1 = (lowTileByte & 1) << 0
+			p2 = (highTileByte & 1) << 1
+			lowTileByte >>= 1
+			highTileByte >>= 1
+		} else {
+			p1 = (lowTileByte & 0x80) >> 7
+			p2 = (highTileByte & 0x80) >> 6
+			lowTileByte <<= 1
+			highTileByte <<= 1
+		}
+		data <<= 4
+		data |= uint32(a | p1 | p2)
+	}
+	return data
+}
+
+// evaluateSprites selects up to eight sprites on the next scanline and
+// fetches their patterns. Unused slots fetch tile $FF as the hardware does,
+// which keeps the A12 line toggling for scanline counters.
+func (p *PPU) evaluateSprites(visibleLine bool) {
+	if p.watcher != nil {
+		p.watcher.SpriteFetches(true)
+		defer p.watcher.SpriteFetches(false)
+	}
+	height := p.spriteHeight()
+	count := 0
+	if visibleLine {
+		for i := 0; i < 64; i++ {
+			y := p.oam[i*4+0]
+			a := p.oam[i*4+2]
+			x := p.oam[i*4+3]
+			row := p.scanline - int(y)
+			if row < 0 || row >= height {
+				continue
+			}
+			if count == 8 {
+				p.status |= statusSpriteOverflow
+				break
+			}
+			p.spritePatterns[count] = p.fetchSpritePattern(p.oam[i*4+1], a, row)
+			p.spritePosition[count] = x
+			p.spritePriority[count] = (a >> 5) & 1
+			p.spriteIndex[count] = uint8(i)
+			count++
+		}
+	}
+	for i := count; i < 8; i++ {
+		p.fetchSpritePattern(0xFF, 0, 0)
+	}
+	p.spriteCount = count
+}
@@ -0,0 +1,26 @@
+// Package savestate holds the helpers components use to serialize their
+// state. Each component lists pointers to its fields in a fixed order; the
+// same list is used for saving and loading so the two cannot drift apart.
+package savestate
+
+import "encoding/gob"
+
+// Encode writes the values pointed to by fields to encoder, in order.
+func Encode(encoder *gob.Encoder, fields ...interface{}) error {
+	for _, field := range fields {
+		if err := encoder.Encode(field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Decode reads values from decoder into the pointers in fields, in order.
+func Decode(decoder *gob.Decoder, fields ...interface{}) error {
+	for _, field := range fields {
+		if err := decoder.Decode(field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
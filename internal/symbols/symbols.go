@@ -0,0 +1,134 @@
+// Package symbols loads label files produced by 6502 assemblers so that
+// addresses can be reported by name.
+//
+// Two formats are recognized: VICE label files as written by ld65 -Ln
+// ("al 00C123 .label") and FCEUX name lists ("$C123#label#comment").
+package symbols
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxOffset is the largest distance from a label at which an address is
+// still described relative to it.
+const maxOffset = 0xFF
+
+// Table maps CPU addresses to labels.
+type Table struct {
+	labels    map[uint16]string
+	addresses []uint16
+}
+
+// NewTable returns an empty table.
+func NewTable() *Table {
+	return &Table{labels: make(map[uint16]string)}
+}
+
+// Load reads a label file from path.
+func Load(path string) (*Table, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	table, err := Parse(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return table, nil
+}
+
+// Parse reads label definitions in either supported format from r.
+func Parse(r io.Reader) (*Table, error) {
+	table := NewTable()
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") || strings.HasPrefix(text, ";") {
+			continue
+		}
+		address, label, ok := parseLine(text)
+		if !ok {
+			return nil, fmt.Errorf("line %d: unrecognized label definition %q", line, text)
+		}
+		table.Add(address, label)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return table, nil
+}
+
+func parseLine(text string) (uint16, string, bool) {
+	// VICE: al 00C123 .label
+	if fields := strings.Fields(text); len(fields) == 3 && fields[0] == "al" {
+		address, err := strconv.ParseUint(fields[1], 16, 32)
+		if err != nil {
+			return 0, "", false
+		}
+		return uint16(address), strings.TrimPrefix(fields[2], "."), true
+	}
+	// FCEUX: $C123#label#comment
+	if strings.HasPrefix(text, "$") {
+		parts := strings.SplitN(text[1:], "#", 3)
+		if len(parts) < 2 {
+			return 0, "", false
+		}
+		address, err := strconv.ParseUint(parts[0], 16, 16)
+		if err != nil {
+			return 0, "", false
+		}
+		return uint16(address), parts[1], true
+	}
+	return 0, "", false
+}
+
+// Add defines label at address. The first label defined for an address wins.
+func (t *Table) Add(address uint16, label string) {
+	if _, exists := t.labels[address]; exists || label == "" {
+		return
+	}
+	t.labels[address] = label
+	i := sort.Search(len(t.addresses), func(i int) bool { return t.addresses[i] >= address })
+	t.addresses = append(t.addresses, 0)
+	copy(t.addresses[i+1:], t.addresses[i:])
+	t.addresses[i] = address
+}
+
+// Lookup returns the label defined exactly at address.
+func (t *Table) Lookup(address uint16) (string, bool) {
+	if t == nil {
+		return "", false
+	}
+	label, ok := t.labels[address]
+	return label, ok
+}
+
+// Describe names address by the nearest label at or below it, as "label" or
+// "label+offset". It returns "" when there is no label close enough.
+func (t *Table) Describe(address uint16) string {
+	if t == nil || len(t.addresses) == 0 {
+		return ""
+	}
+	i := sort.Search(len(t.addresses), func(i int) bool { return t.addresses[i] > address }) - 1
+	if i < 0 {
+		return ""
+	}
+	base := t.addresses[i]
+	offset := address - base
+	if offset > maxOffset {
+		return ""
+	}
+	if offset == 0 {
+		return t.labels[base]
+	}
+	return fmt.Sprintf("%s+%d", t.labels[base], offset)
+}
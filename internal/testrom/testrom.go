@@ -0,0 +1,161 @@
+// Package testrom runs accuracy test ROMs that report their results through
+// the $6000 status protocol used by blargg's test suites (instr_test-v5,
+// cpu_timing_test, ppu_vbl_nmi, apu_test and others).
+//
+// Such a ROM writes the signature DE B0 61 to $6001-$6003 once the protocol
+// is active, keeps $80 in $6000 while the test runs, writes $81 when it needs
+// the console's reset button pressed, and finally writes a result code to
+// $6000 with a NUL-terminated message at $6004. A result code of 0 is a pass.
+package testrom
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/tejasdeepakmasne/NESemu/internal/cartridge"
+	"github.com/tejasdeepakmasne/NESemu/internal/nes"
+)
+
+// Addresses and values of the status protocol.
+const (
+	StatusAddress    = 0x6000
+	SignatureAddress = 0x6001
+	MessageAddress   = 0x6004
+
+	StatusRunning       = 0x80
+	StatusResetRequired = 0x81
+)
+
+var signature = [3]uint8{0xDE, 0xB0, 0x61}
+
+// maxMessageLength bounds how far the message is read if the ROM never
+// terminates it.
+const maxMessageLength = 0x1000
+
+// Defaults applied to zero fields of Options.
+const (
+	DefaultMaxFrames  = 60 * 60
+	DefaultResetDelay = 6
+)
+
+// ErrTimeout is returned when a ROM does not report a result within the
+// frame limit.
+var ErrTimeout = errors.New("testrom: no result before frame limit")
+
+// Options controls how a test ROM is run.
+type Options struct {
+	// MaxFrames is the number of frames to wait for a result.
+	MaxFrames int
+	// ResetDelay is the number of frames to wait after the ROM asks for a
+	// reset before pressing it. The ROMs require at least 100ms.
+	ResetDelay int
+}
+
+func (o Options) withDefaults() Options {
+	if o.MaxFrames <= 0 {
+		o.MaxFrames = DefaultMaxFrames
+	}
+	if o.ResetDelay <= 0 {
+		o.ResetDelay = DefaultResetDelay
+	}
+	return o
+}
+
+// Result is the outcome reported by a test ROM.
+type Result struct {
+	// Status is the result code written to $6000; 0 means the test passed.
+	Status uint8
+	// Message is the text the ROM left at $6004.
+	Message string
+	// Frames is the number of frames emulated before the result appeared.
+	Frames int
+}
+
+// Passed reports whether the ROM reported success.
+func (r Result) Passed() bool {
+	return r.Status == 0
+}
+
+func (r Result) String() string {
+	verdict := "PASS"
+	if !r.Passed() {
+		verdict = fmt.Sprintf("FAIL (status %d)", r.Status)
+	}
+	message := strings.TrimSpace(r.Message)
+	if message == "" {
+		return verdict
+	}
+	return verdict + ": " + message
+}
+
+// Run loads the ROM at path and runs it until it reports a result.
+func Run(path string, options Options) (Result, error) {
+	cart, err := cartridge.LoadCartridge(path)
+	if err != nil {
+		return Result{}, err
+	}
+	console := nes.NewConsole(cart)
+	console.PowerOn()
+	return RunConsole(console, options)
+}
+
+// RunConsole runs an already powered-on console until its ROM reports a
+// result through the status protocol.
+func RunConsole(console *nes.Console, options Options) (Result, error) {
+	options = options.withDefaults()
+	resetAt := -1
+
+	for frame := 1; frame <= options.MaxFrames; frame++ {
+		console.StepFrame()
+		if err := console.Err(); err != nil {
+			return Result{Frames: frame}, err
+		}
+
+		if frame == resetAt {
+			console.Reset()
+			resetAt = -1
+			continue
+		}
+		if !hasSignature(console) {
+			continue
+		}
+
+		switch status := console.Memory().Peek(StatusAddress); status {
+		case StatusRunning:
+		case StatusResetRequired:
+			if resetAt < 0 {
+				resetAt = frame + options.ResetDelay
+			}
+		default:
+			return Result{
+				Status:  status,
+				Message: readMessage(console),
+				Frames:  frame,
+			}, nil
+		}
+	}
+
+	return Result{Frames: options.MaxFrames, Message: readMessage(console)}, ErrTimeout
+}
+
+func hasSignature(console *nes.Console) bool {
+	for i, b := range signature {
+		if console.Memory().Peek(SignatureAddress+uint16(i)) != b {
+			return false
+		}
+	}
+	return true
+}
+
+func readMessage(console *nes.Console) string {
+	var message strings.Builder
+	for i := uint16(0); i < maxMessageLength; i++ {
+		b := console.Memory().Peek(MessageAddress + i)
+		if b == 0 {
+			break
+		}
+		message.WriteByte(b)
+	}
+	return message.String()
+}
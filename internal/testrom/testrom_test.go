@@ -0,0 +1,101 @@
+package testrom_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tejasdeepakmasne/NESemu/internal/cartridge"
+	"github.com/tejasdeepakmasne/NESemu/internal/nes"
+	"github.com/tejasdeepakmasne/NESemu/internal/testrom"
+	"github.com/tejasdeepakmasne/NESemu/internal/testrom/testromtest"
+)
+
+// resetROM is the program of a test ROM that asks for a reset and reports
+// success with the message "ok" after it. $6010 remembers across the reset
+// that the first run is over.
+var resetROM = []uint8{
+	0xAD, 0x10, 0x60, // LDA $6010
+	0xC9, 0xA5, // CMP #$A5
+	0xF0, 0x21, // BEQ second
+	0xA9, 0xDE, 0x8D, 0x01, 0x60, // signature
+	0xA9, 0xB0, 0x8D, 0x02, 0x60,
+	0xA9, 0x61, 0x8D, 0x03, 0x60,
+	0xA9, 0x80, 0x8D, 0x00, 0x60, // status running
+	0xA9, 0xA5, 0x8D, 0x10, 0x60,
+	0xA9, 0x81, 0x8D, 0x00, 0x60, // status reset required
+	0x4C, 0x25, 0x80, // JMP *
+	// second:
+	0xA9, 'o', 0x8D, 0x04, 0x60,
+	0xA9, 'k', 0x8D, 0x05, 0x60,
+	0xA9, 0x00, 0x8D, 0x06, 0x60,
+	0x8D, 0x00, 0x60, // status 0
+	0x4C, 0x3A, 0x80, // JMP *
+	0x40, // RTI
+}
+
+// hangROM writes the signature and stays in the running state forever.
+var hangROM = []uint8{
+	0xA9, 0xDE, 0x8D, 0x01, 0x60,
+	0xA9, 0xB0, 0x8D, 0x02, 0x60,
+	0xA9, 0x61, 0x8D, 0x03, 0x60,
+	0xA9, 0x80, 0x8D, 0x00, 0x60,
+	0x4C, 0x14, 0x80, // JMP *
+}
+
+// nromImage builds an iNES image with 16 KiB of PRG holding program at $8000
+// and 8 KiB of CHR RAM.
+func nromImage(program []uint8) []uint8 {
+	prg := make([]uint8, 0x4000)
+	copy(prg, program)
+	prg[0x3FFA], prg[0x3FFB] = 0x3D, 0x80 // NMI
+	prg[0x3FFC], prg[0x3FFD] = 0x00, 0x80 // reset
+	prg[0x3FFE], prg[0x3FFF] = 0x3D, 0x80 // IRQ
+	header := []uint8{'N', 'E', 'S', 0x1A, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	return append(header, prg...)
+}
+
+func newConsole(t *testing.T, program []uint8) *nes.Console {
+	t.Helper()
+	cart, err := cartridge.Parse(nromImage(program))
+	if err != nil {
+		t.Fatal(err)
+	}
+	console := nes.NewConsole(cart)
+	console.PowerOn()
+	return console
+}
+
+func TestRunConsoleReset(t *testing.T) {
+	console := newConsole(t, resetROM)
+	result, err := testrom.RunConsole(console, testrom.Options{MaxFrames: 60, ResetDelay: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Passed() || result.Message != "ok" {
+		t.Errorf("result = %v, want PASS: ok", result)
+	}
+	if result.Frames <= 10 {
+		t.Errorf("result after %d frames, before the reset delay", result.Frames)
+	}
+}
+
+func TestRunConsoleTimeout(t *testing.T) {
+	console := newConsole(t, hangROM)
+	result, err := testrom.RunConsole(console, testrom.Options{MaxFrames: 5})
+	if !errors.Is(err, testrom.ErrTimeout) {
+		t.Fatalf("err = %v, want ErrTimeout", err)
+	}
+	if result.Frames != 5 {
+		t.Errorf("Frames = %d, want 5", result.Frames)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reset.nes")
+	if err := os.WriteFile(path, nromImage(resetROM), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	testromtest.Check(t, path, testrom.Options{MaxFrames: 60})
+}
@@ -0,0 +1,30 @@
+// Package testromtest provides helpers for running test ROMs from Go tests.
+package testromtest
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"testing"
+
+	"github.com/tejasdeepakmasne/NESemu/internal/testrom"
+)
+
+// Check runs the ROM at path from a Go test and fails the test with the
+// ROM's own message if it does not pass. ROMs that are missing from the
+// checkout are skipped, so suites can live outside the repository.
+func Check(tb testing.TB, path string, options testrom.Options) {
+	tb.Helper()
+
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		tb.Skipf("%s: test ROM not found", path)
+	}
+
+	result, err := testrom.Run(path, options)
+	if err != nil {
+		tb.Fatalf("%s: %v", path, err)
+	}
+	if !result.Passed() {
+		tb.Errorf("%s: %v", path, result)
+	}
+}
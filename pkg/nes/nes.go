@@ -0,0 +1,536 @@
+// Package nes is the public, embeddable interface to the NESemu emulator.
+//
+// An Emulator is created from a ROM file and advanced one video frame at a
+// time. Between frames the host feeds controller input, reads the finished
+// picture from Framebuffer and drains the audio produced during the frame
+// with AudioSamples. The full machine state can be captured with SaveState
+// and restored with LoadState.
+//
+// The types in this package are stable; the emulator internals they wrap are
+// not, and are deliberately kept out of the API.
+package nes
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/tejasdeepakmasne/NESemu/internal/cartridge"
+	"github.com/tejasdeepakmasne/NESemu/internal/controller"
+	"github.com/tejasdeepakmasne/NESemu/internal/memory"
+	core "github.com/tejasdeepakmasne/NESemu/internal/nes"
+	"github.com/tejasdeepakmasne/NESemu/internal/symbols"
+)
+
+// Dimensions of the picture produced by the emulator, in pixels.
+const (
+	Width  = 256
+	Height = 240
+)
+
+// DefaultSampleRate is the audio sample rate used unless SetSampleRate is called.
+const DefaultSampleRate = 44100
+
+// Button is a button on a standard NES controller.
+type Button uint8
+
+const (
+	ButtonA Button = iota
+	ButtonB
+	ButtonSelect
+	ButtonStart
+	ButtonUp
+	ButtonDown
+	ButtonLeft
+	ButtonRight
+)
+
+// Buttons is a set of held buttons, with bit n set when Button n is held.
+type Buttons uint8
+
+// With returns the set with button added.
+func (b Buttons) With(button Button) Buttons {
+	return b | 1<<button
+}
+
+// Has reports whether button is in the set.
+func (b Buttons) Has(button Button) bool {
+	return b&(1<<button) != 0
+}
+
+// Players supported by SetButtons.
+const (
+	Player1 = 0
+	Player2 = 1
+)
+
+// DefaultSaveInterval is the number of frames between checks for changed
+// battery-backed RAM, about five seconds, unless Options.SaveInterval is set.
+const DefaultSaveInterval = 300
+
+// ErrInvalidPlayer is returned when a controller port other than Player1 or
+// Player2 is addressed.
+var ErrInvalidPlayer = errors.New("nes: invalid player")
+
+// ErrProfilingDisabled is returned by the access exports when the emulator
+// was not opened with Options.ProfileMemory.
+var ErrProfilingDisabled = errors.New("nes: memory profiling not enabled")
+
+// Errors held by an *ArchiveError.
+var (
+	// ErrNoROMInArchive is returned when a ROM is opened from an archive
+	// without a ROM image.
+	ErrNoROMInArchive = errors.New("no ROM image in archive")
+	// ErrAmbiguousArchive is returned when a ROM is opened from an archive
+	// holding several ROM images and Options.SelectROM is not set.
+	ErrAmbiguousArchive = errors.New("several ROM images in archive")
+)
+
+// ArchiveError reports a problem with a zip, gzip or tar archive a ROM was
+// opened from, as opposed to the ROM itself.
+type ArchiveError struct {
+	// Path is the archive's path.
+	Path string
+	Err  error
+	// Entries lists the candidate ROM images when Err is
+	// ErrAmbiguousArchive.
+	Entries []string
+}
+
+func (e *ArchiveError) Error() string {
+	if len(e.Entries) > 0 {
+		return fmt.Sprintf("nes: %s: %v: %s", e.Path, e.Err, strings.Join(e.Entries, ", "))
+	}
+	return fmt.Sprintf("nes: %s: %v", e.Path, e.Err)
+}
+
+func (e *ArchiveError) Unwrap() error {
+	return e.Err
+}
+
+// archiveError translates an archive error from the cartridge loader into
+// an *ArchiveError, and returns other errors unchanged.
+func archiveError(err error) error {
+	var archiveErr *cartridge.ArchiveError
+	if !errors.As(err, &archiveErr) {
+		return err
+	}
+	public := &ArchiveError{Path: archiveErr.Path, Err: archiveErr.Err, Entries: archiveErr.Entries}
+	switch {
+	case errors.Is(archiveErr.Err, cartridge.ErrAmbiguousArchive):
+		public.Err = ErrAmbiguousArchive
+	case errors.Is(archiveErr.Err, cartridge.ErrNoROMInArchive):
+		public.Err = ErrNoROMInArchive
+	}
+	return public
+}
+
+// ErrIncompatibleState is returned by LoadState for data that was not
+// written by a compatible SaveState for the same game.
+var ErrIncompatibleState = errors.New("nes: incompatible save state")
+
+// RAMInit selects what the console's RAM contains at power-on. Games can
+// behave differently depending on it, so it is configurable to reproduce
+// bugs and to flush out reads of uninitialized memory.
+type RAMInit int
+
+const (
+	// RAMZero fills RAM with $00.
+	RAMZero RAMInit = iota
+	// RAMFF fills RAM with $FF.
+	RAMFF
+	// RAMAlternating fills RAM with repeating runs of four $00 and four $FF
+	// bytes, as commonly found on real consoles.
+	RAMAlternating
+	// RAMRandom fills RAM with random bytes drawn from Options.RAMSeed.
+	RAMRandom
+)
+
+// ramInitPatterns maps each RAMInit to the memory pattern implementing it.
+var ramInitPatterns = map[RAMInit]memory.PowerOnPattern{
+	RAMZero:        memory.PowerOnZero,
+	RAMFF:          memory.PowerOnFF,
+	RAMAlternating: memory.PowerOnAlternating,
+	RAMRandom:      memory.PowerOnRandom,
+}
+
+func (r RAMInit) String() string {
+	if pattern, ok := ramInitPatterns[r]; ok {
+		return pattern.String()
+	}
+	return fmt.Sprintf("RAMInit(%d)", int(r))
+}
+
+// ParseRAMInit returns the RAMInit named "zero", "ff", "alternating" or "random".
+func ParseRAMInit(name string) (RAMInit, error) {
+	pattern, err := memory.ParsePowerOnPattern(name)
+	if err != nil {
+		return RAMZero, err
+	}
+	for r, p := range ramInitPatterns {
+		if p == pattern {
+			return r, nil
+		}
+	}
+	return RAMZero, fmt.Errorf("nes: unknown RAM init %q", name)
+}
+
+// Options configures an emulator created by OpenWithOptions.
+type Options struct {
+	// RAMInit is applied to internal RAM, cartridge work RAM and PPU memory.
+	RAMInit RAMInit
+	// RAMSeed seeds RAMRandom; the same seed gives the same contents.
+	RAMSeed int64
+
+	// SymbolFile names a label file, as written by ld65 -Ln or FCEUX, used
+	// to name addresses in UninitializedRead reports.
+	SymbolFile string
+	// UninitializedRead, when set, is called the first time each byte of
+	// internal RAM or cartridge work RAM is read without having been written
+	// since power-on. Returning true breaks emulation: StepFrame returns
+	// early and Err reports an *UninitializedReadError until Resume.
+	UninitializedRead func(UninitializedRead) bool
+
+	// ProfileMemory counts CPU reads, writes and executes per address so
+	// they can be exported with WriteAccessCSV and WriteAccessHeatmap.
+	ProfileMemory bool
+	// ProfilePerFrame restarts the counts every frame, so the exports
+	// show only the last complete frame.
+	ProfilePerFrame bool
+
+	// DisableGameDatabase uses ROM headers exactly as found instead of
+	// correcting them from the game database.
+	DisableGameDatabase bool
+	// GameDatabase names a file in the NES 2.0 XML database format to use
+	// instead of the built-in game database.
+	GameDatabase string
+
+	// SelectROM picks the ROM image to run, by name, when the file opened
+	// is an archive holding several.
+	SelectROM func(names []string) (string, error)
+
+	// Patches names IPS, UPS or BPS files applied in order to the ROM as
+	// it is loaded. When there are none, a patch next to the ROM with the
+	// same name, such as game.ips for game.nes, is applied unless
+	// DisableAutoPatch is set.
+	Patches          []string
+	DisableAutoPatch bool
+
+	// SaveDirectory is where the .sav files of games with battery-backed
+	// RAM are kept. If empty, they are kept next to the ROM.
+	SaveDirectory string
+	// DisableSaveFile keeps battery-backed RAM in memory only: no save
+	// file is loaded or written.
+	DisableSaveFile bool
+	// SaveInterval is the number of frames between writes of changed
+	// battery-backed RAM to the save file. Zero means DefaultSaveInterval.
+	SaveInterval int
+	// SaveError, when set, is called with the error of each failed write
+	// of the save file made by StepFrame.
+	SaveError func(error)
+}
+
+// UninitializedRead describes a read of RAM that was never written.
+type UninitializedRead struct {
+	// Address is the address read; internal RAM mirrors are folded onto
+	// $0000-$07FF.
+	Address uint16
+	// PC is the address of the instruction that performed the read.
+	PC uint16
+	// AddressSymbol and PCSymbol name the addresses using the symbol file,
+	// or are empty.
+	AddressSymbol string
+	PCSymbol      string
+}
+
+func (r UninitializedRead) String() string {
+	return fmt.Sprintf("uninitialized read of %s at PC %s",
+		describeAddress(r.Address, r.AddressSymbol), describeAddress(r.PC, r.PCSymbol))
+}
+
+func describeAddress(address uint16, symbol string) string {
+	if symbol == "" {
+		return fmt.Sprintf("$%04X", address)
+	}
+	return fmt.Sprintf("$%04X (%s)", address, symbol)
+}
+
+// UninitializedReadError is reported by Err when emulation broke on an
+// uninitialized read.
+type UninitializedReadError struct {
+	Read UninitializedRead
+}
+
+func (e *UninitializedReadError) Error() string {
+	return "nes: " + e.Read.String()
+}
+
+// Emulator is a running NES with a game inserted. It is not safe for
+// concurrent use.
+type Emulator struct {
+	console *core.Console
+	stats   *memory.AccessStats
+
+	// savePath is the save file, or empty when the game has no battery or
+	// save files are disabled. saved holds the battery RAM last written.
+	savePath     string
+	saved        []uint8
+	saveInterval int
+	saveFrames   int
+	saveError    func(error)
+}
+
+// Open loads the ROM at path and returns an emulator that has been powered
+// on. The ROM may be inside a zip, gzip or tar archive.
+func Open(path string) (*Emulator, error) {
+	return OpenWithOptions(path, Options{})
+}
+
+// OpenWithOptions is like Open but applies options before powering on.
+func OpenWithOptions(path string, options Options) (*Emulator, error) {
+	loadOptions := cartridge.LoadOptions{
+		DisableDatabase:  options.DisableGameDatabase,
+		Patches:          options.Patches,
+		DisableAutoPatch: options.DisableAutoPatch,
+		SelectEntry:      options.SelectROM,
+	}
+	if options.GameDatabase != "" && !options.DisableGameDatabase {
+		db, err := loadDatabase(options.GameDatabase)
+		if err != nil {
+			return nil, err
+		}
+		loadOptions.Database = db
+	}
+	cart, err := cartridge.LoadCartridgeWithOptions(path, loadOptions)
+	if err != nil {
+		return nil, archiveError(err)
+	}
+	console := core.NewConsole(cart)
+	console.SetPowerOnState(memory.PowerOnState{
+		Pattern: ramInitPatterns[options.RAMInit],
+		Seed:    options.RAMSeed,
+	})
+	if options.UninitializedRead != nil {
+		table := symbols.NewTable()
+		if options.SymbolFile != "" {
+			table, err = symbols.Load(options.SymbolFile)
+			if err != nil {
+				return nil, err
+			}
+		}
+		console.EnableUninitChecker(func(read memory.UninitializedRead) {
+			report := UninitializedRead{
+				Address:       read.Address,
+				PC:            read.PC,
+				AddressSymbol: table.Describe(read.Address),
+				PCSymbol:      table.Describe(read.PC),
+			}
+			if options.UninitializedRead(report) {
+				console.Break(&UninitializedReadError{Read: report})
+			}
+		})
+	}
+	emu := &Emulator{
+		console:      console,
+		saveInterval: options.SaveInterval,
+		saveError:    options.SaveError,
+	}
+	if emu.saveInterval <= 0 {
+		emu.saveInterval = DefaultSaveInterval
+	}
+	if options.ProfileMemory {
+		emu.stats = console.EnableAccessStats(options.ProfilePerFrame)
+	}
+	if cart.HasBattery() && !options.DisableSaveFile {
+		emu.savePath = cartridge.SavePath(path, options.SaveDirectory)
+		if err := cart.LoadSaveFile(emu.savePath); err != nil {
+			return nil, err
+		}
+	}
+	console.PowerOn()
+	emu.saved = cart.BatteryRAM()
+	return emu, nil
+}
+
+func loadDatabase(path string) (*cartridge.Database, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return cartridge.ParseDatabase(file)
+}
+
+// GameName returns the name the game database gives the ROM, or "".
+func (e *Emulator) GameName() string {
+	return e.console.Cartridge().GameName()
+}
+
+// Patches returns the patch files that were applied to the ROM.
+func (e *Emulator) Patches() []string {
+	return e.console.Cartridge().Patches()
+}
+
+// HeaderCorrections describes each ROM header field that was corrected from
+// the game database, such as "mapper 4 -> 118".
+func (e *Emulator) HeaderCorrections() []string {
+	return e.console.Cartridge().Corrections()
+}
+
+// Close writes battery-backed RAM to the save file if it changed since it
+// was last written. The emulator must not be used afterwards.
+func (e *Emulator) Close() error {
+	return e.FlushSave()
+}
+
+// SavePath returns the file that battery-backed RAM is saved to, or "" if
+// the game has no battery or save files are disabled.
+func (e *Emulator) SavePath() string {
+	return e.savePath
+}
+
+// FlushSave writes battery-backed RAM to the save file if it changed since
+// it was last written. StepFrame also does this periodically.
+func (e *Emulator) FlushSave() error {
+	if e.savePath == "" {
+		return nil
+	}
+	e.saveFrames = 0
+	cart := e.console.Cartridge()
+	data := cart.BatteryRAM()
+	if bytes.Equal(data, e.saved) {
+		return nil
+	}
+	if err := cart.WriteSaveFile(e.savePath); err != nil {
+		return err
+	}
+	e.saved = data
+	return nil
+}
+
+// Reset presses the console's reset button.
+func (e *Emulator) Reset() {
+	e.console.Reset()
+}
+
+// StepFrame runs the emulator until the next video frame is complete, or
+// until emulation breaks. Every Options.SaveInterval frames it writes
+// changed battery-backed RAM to the save file. A failed write is passed to
+// Options.SaveError and retried at the next interval, and Close reports it
+// if it keeps failing.
+func (e *Emulator) StepFrame() {
+	e.console.StepFrame()
+	if e.saveFrames++; e.saveFrames >= e.saveInterval {
+		if err := e.FlushSave(); err != nil && e.saveError != nil {
+			e.saveError(err)
+		}
+	}
+}
+
+// Resume continues emulation after it broke, clearing the error reported by Err.
+func (e *Emulator) Resume() {
+	e.console.Resume()
+}
+
+// Err returns the first emulation error encountered, such as the CPU
+// fetching an opcode it cannot execute. Emulation continues after an error,
+// but its output is unlikely to be meaningful.
+func (e *Emulator) Err() error {
+	return e.console.Err()
+}
+
+// FrameCount returns the number of video frames emulated since power-on.
+func (e *Emulator) FrameCount() uint64 {
+	return e.console.PPU().Frame()
+}
+
+// SetButtons sets the buttons held on a player's controller. The state is
+// sampled by the game when it next polls the controller.
+func (e *Emulator) SetButtons(player int, buttons Buttons) error {
+	pad, err := e.controller(player)
+	if err != nil {
+		return err
+	}
+	pad.SetButtons(uint8(buttons))
+	return nil
+}
+
+// SetButton presses or releases a single button on a player's controller.
+func (e *Emulator) SetButton(player int, button Button, pressed bool) error {
+	pad, err := e.controller(player)
+	if err != nil {
+		return err
+	}
+	pad.SetButton(controller.Button(button), pressed)
+	return nil
+}
+
+func (e *Emulator) controller(player int) (*controller.Controller, error) {
+	if player != Player1 && player != Player2 {
+		return nil, ErrInvalidPlayer
+	}
+	return e.console.Controller(player), nil
+}
+
+// Framebuffer returns a copy of the most recently completed video frame.
+func (e *Emulator) Framebuffer() *image.RGBA {
+	buffer := e.console.PPU().Buffer()
+	frame := image.NewRGBA(buffer.Rect)
+	copy(frame.Pix, buffer.Pix)
+	return frame
+}
+
+// SetSampleRate sets the rate, in Hz, of the samples returned by AudioSamples.
+func (e *Emulator) SetSampleRate(rate int) {
+	e.console.APU().SetSampleRate(float64(rate))
+}
+
+// SampleRate returns the rate, in Hz, of the samples returned by AudioSamples.
+func (e *Emulator) SampleRate() int {
+	return int(e.console.APU().SampleRate())
+}
+
+// AudioSamples returns the mono audio samples produced since the last call,
+// as values in the range [-1, 1].
+func (e *Emulator) AudioSamples() []float32 {
+	return e.console.APU().Samples()
+}
+
+// WriteAccessCSV writes the memory access counts as CSV with the columns
+// address, bank, reads, writes and executes. Bank-switched addresses get an
+// extra row per bank.
+func (e *Emulator) WriteAccessCSV(w io.Writer) error {
+	if e.stats == nil {
+		return ErrProfilingDisabled
+	}
+	return e.stats.WriteCSV(w)
+}
+
+// WriteAccessHeatmap writes the memory access counts as a 256x256 PNG with
+// one pixel per address, row = high byte and column = low byte. Red shows
+// writes, green reads and blue executes.
+func (e *Emulator) WriteAccessHeatmap(w io.Writer) error {
+	if e.stats == nil {
+		return ErrProfilingDisabled
+	}
+	return e.stats.WritePNG(w)
+}
+
+// SaveState writes a snapshot of the emulator to w.
+func (e *Emulator) SaveState(w io.Writer) error {
+	return e.console.Save(w)
+}
+
+// LoadState restores a snapshot written by SaveState for the same game. A
+// snapshot of another game is rejected with ErrIncompatibleState.
+func (e *Emulator) LoadState(r io.Reader) error {
+	err := e.console.Load(r)
+	if errors.Is(err, core.ErrStateMismatch) {
+		return ErrIncompatibleState
+	}
+	return err
+}
@@ -0,0 +1,243 @@
+package nes_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/tejasdeepakmasne/NESemu/pkg/nes"
+)
+
+// nromImage is a 32K NROM image with CHR RAM.
+var nromImage = append([]byte("NES\x1a\x02\x00"), make([]byte, 10+0x8000)...)
+
+// writeZip writes a zip archive holding each name with data to a file in a
+// temporary directory and returns its path.
+func writeZip(t *testing.T, data []byte, names ...string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, name := range names {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write(data)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "games.zip")
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestOpenArchiveErrors(t *testing.T) {
+	path := writeZip(t, nromImage, "a.nes", "b.nes")
+	_, err := nes.Open(path)
+	if !errors.Is(err, nes.ErrAmbiguousArchive) {
+		t.Fatalf("Open = %v, want ErrAmbiguousArchive", err)
+	}
+	var archiveErr *nes.ArchiveError
+	if !errors.As(err, &archiveErr) {
+		t.Fatalf("Open = %T, want *nes.ArchiveError", err)
+	}
+	if archiveErr.Path != path || !reflect.DeepEqual(archiveErr.Entries, []string{"a.nes", "b.nes"}) {
+		t.Errorf("ArchiveError = %+v", archiveErr)
+	}
+
+	_, err = nes.Open(writeZip(t, nil, "readme.txt"))
+	if !errors.Is(err, nes.ErrNoROMInArchive) || !errors.As(err, &archiveErr) {
+		t.Errorf("Open = %v, want ErrNoROMInArchive in an *nes.ArchiveError", err)
+	}
+}
+
+func TestOpenArchiveSelectROM(t *testing.T) {
+	path := writeZip(t, nromImage, "a.nes", "b.nes")
+	var offered []string
+	emu, err := nes.OpenWithOptions(path, nes.Options{
+		SelectROM: func(names []string) (string, error) {
+			offered = names
+			return "b.nes", nil
+		},
+		DisableGameDatabase: true,
+		DisableSaveFile:     true,
+	})
+	if err != nil {
+		t.Fatalf("OpenWithOptions: %v", err)
+	}
+	defer emu.Close()
+	if !reflect.DeepEqual(offered, []string{"a.nes", "b.nes"}) {
+		t.Errorf("SelectROM offered %q", offered)
+	}
+}
+
+// registeredMappers lists every mapper number the emulator supports.
+var registeredMappers = []int{
+	0, 1, 2, 3, 4, 5, 7, 9, 10, 11, 18, 19, 21, 22, 23, 24,
+	25, 26, 32, 33, 34, 48, 64, 65, 66, 68, 69, 71, 85, 118, 119, 206,
+}
+
+// writeMapperImage writes an iNES image for mapper with 128K PRG ROM and
+// 64K CHR ROM to a temporary directory and returns its path. The first PRG
+// byte holds the mapper number so that each image is a different game.
+func writeMapperImage(t *testing.T, mapper int) string {
+	t.Helper()
+	header := []byte{'N', 'E', 'S', 0x1a, 8, 8, uint8(mapper&0x0F) << 4, uint8(mapper & 0xF0), 1, 0, 0, 0, 0, 0, 0, 0}
+	data := append(header, make([]byte, 0x20000+0x10000)...)
+	data[len(header)] = uint8(mapper)
+	path := filepath.Join(t.TempDir(), fmt.Sprintf("mapper%d.nes", mapper))
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func openMapperImage(t *testing.T, mapper int) *nes.Emulator {
+	t.Helper()
+	emu, err := nes.OpenWithOptions(writeMapperImage(t, mapper), nes.Options{
+		DisableGameDatabase: true,
+		DisableSaveFile:     true,
+	})
+	if err != nil {
+		t.Fatalf("OpenWithOptions: %v", err)
+	}
+	t.Cleanup(func() { emu.Close() })
+	return emu
+}
+
+func TestSaveStateRoundTrip(t *testing.T) {
+	for _, mapper := range registeredMappers {
+		t.Run(fmt.Sprintf("mapper %d", mapper), func(t *testing.T) {
+			emu := openMapperImage(t, mapper)
+			emu.StepFrame()
+
+			var saved bytes.Buffer
+			if err := emu.SaveState(&saved); err != nil {
+				t.Fatalf("SaveState: %v", err)
+			}
+			emu.StepFrame()
+			emu.StepFrame()
+			var want bytes.Buffer
+			if err := emu.SaveState(&want); err != nil {
+				t.Fatalf("SaveState: %v", err)
+			}
+
+			if err := emu.LoadState(bytes.NewReader(saved.Bytes())); err != nil {
+				t.Fatalf("LoadState: %v", err)
+			}
+			emu.StepFrame()
+			emu.StepFrame()
+			var got bytes.Buffer
+			if err := emu.SaveState(&got); err != nil {
+				t.Fatalf("SaveState: %v", err)
+			}
+			if !bytes.Equal(got.Bytes(), want.Bytes()) {
+				t.Error("state after loading and running differs from the original run")
+			}
+		})
+	}
+}
+
+func TestLoadStateOtherGame(t *testing.T) {
+	var state bytes.Buffer
+	if err := openMapperImage(t, 0).SaveState(&state); err != nil {
+		t.Fatalf("SaveState: %v", err)
+	}
+	err := openMapperImage(t, 1).LoadState(&state)
+	if !errors.Is(err, nes.ErrIncompatibleState) {
+		t.Errorf("LoadState = %v, want ErrIncompatibleState", err)
+	}
+}
+
+// batteryImage is an NROM image with battery-backed work RAM whose program
+// stores $42 to $6000 and then loops.
+func batteryImage() []byte {
+	data := append([]byte("NES\x1a\x02\x00\x02"), make([]byte, 9+0x8000)...)
+	prg := data[16:]
+	copy(prg, []byte{0xA9, 0x42, 0x8D, 0x00, 0x60, 0x4C, 0x05, 0x80})
+	prg[0x7FFC], prg[0x7FFD] = 0x00, 0x80
+	return data
+}
+
+// checkSave runs emu for a frame, flushes its save and checks that the save
+// file is path and holds want at $6000.
+func checkSave(t *testing.T, emu *nes.Emulator, path string, want byte) {
+	t.Helper()
+	if emu.SavePath() != path {
+		t.Errorf("SavePath = %q, want %q", emu.SavePath(), path)
+	}
+	emu.StepFrame()
+	if err := emu.FlushSave(); err != nil {
+		t.Fatalf("FlushSave: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data[0] != want {
+		t.Errorf("save holds %#02x at $6000, want %#02x", data[0], want)
+	}
+}
+
+func TestSaveDirectory(t *testing.T) {
+	romDir, saveDir := t.TempDir(), t.TempDir()
+	rom := filepath.Join(romDir, "game.nes")
+	if err := os.WriteFile(rom, batteryImage(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	emu, err := nes.OpenWithOptions(rom, nes.Options{SaveDirectory: saveDir, DisableGameDatabase: true})
+	if err != nil {
+		t.Fatalf("OpenWithOptions: %v", err)
+	}
+	defer emu.Close()
+	checkSave(t, emu, filepath.Join(saveDir, "game.sav"), 0x42)
+	if _, err := os.Stat(filepath.Join(romDir, "game.sav")); err == nil {
+		t.Error("save written next to the ROM despite SaveDirectory")
+	}
+}
+
+func TestSavePathIgnoresPatchAndDatabase(t *testing.T) {
+	romDir, saveDir := t.TempDir(), t.TempDir()
+	rom := filepath.Join(romDir, "game.nes")
+	if err := os.WriteFile(rom, batteryImage(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// The patch changes the stored value from $42 to $43.
+	ips := []byte("PATCH\x00\x00\x11\x00\x01\x43EOF")
+	if err := os.WriteFile(filepath.Join(romDir, "game.ips"), ips, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	patched := batteryImage()
+	patched[17] = 0x43
+	db := fmt.Sprintf(`<nes20db><game>
+		<!-- Patched Game -->
+		<prgrom size="32768"/>
+		<rom size="32768" crc32="%08X"/>
+		<prgnvram size="8192"/>
+		<chrram size="8192"/>
+		<pcb mapper="0" mirroring="V" battery="1"/>
+	</game></nes20db>`, crc32.ChecksumIEEE(patched[16:]))
+	dbPath := filepath.Join(t.TempDir(), "nes20db.xml")
+	if err := os.WriteFile(dbPath, []byte(db), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	emu, err := nes.OpenWithOptions(rom, nes.Options{SaveDirectory: saveDir, GameDatabase: dbPath})
+	if err != nil {
+		t.Fatalf("OpenWithOptions: %v", err)
+	}
+	defer emu.Close()
+	if emu.GameName() != "Patched Game" || len(emu.Patches()) != 1 {
+		t.Fatalf("GameName = %q, Patches = %q; want the database entry and game.ips", emu.GameName(), emu.Patches())
+	}
+	checkSave(t, emu, filepath.Join(saveDir, "game.sav"), 0x43)
+}